@@ -47,24 +47,10 @@ databases.forEach(function(dbName) {
         }
     }
     
-    // Create some basic collections for each database based on purpose
-    if (dbName === 'erp_analytics') {
-        targetDb.createCollection('user_analytics');
-        targetDb.createCollection('business_metrics');
-        targetDb.createCollection('performance_data');
-    } else if (dbName === 'erp_logs') {
-        targetDb.createCollection('application_logs');
-        targetDb.createCollection('error_logs');
-        targetDb.createCollection('audit_logs');
-    } else if (dbName === 'erp_ai_conversations') {
-        targetDb.createCollection('conversations');
-        targetDb.createCollection('embeddings');
-        targetDb.createCollection('training_data');
-    } else if (dbName === 'erp_audit_trail') {
-        targetDb.createCollection('user_actions');
-        targetDb.createCollection('system_events');
-        targetDb.createCollection('data_changes');
-    } else if (dbName === 'erp_notifications') {
+    // Collections of erp_analytics, erp_logs, erp_ai_conversations and
+    // erp_audit_trail are declared in shared-config (collection_specs) and
+    // created with validators and indexes by `make ensure-mongo`
+    if (dbName === 'erp_notifications') {
         targetDb.createCollection('notifications');
         targetDb.createCollection('templates');
         targetDb.createCollection('delivery_status');
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	sharedconfig "erp-suite/shared-config/loaders/go"
+)
+
+func main() {
+	environment := flag.String("env", "", "Environment (development, staging, production, testing); defaults to ERP_ENVIRONMENT")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: depgraph [flags] dot|mermaid|check|impact <service>\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *environment != "" {
+		os.Setenv("ERP_ENVIRONMENT", *environment)
+	}
+
+	config, err := sharedconfig.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	graph := config.ServiceGraph()
+	switch flag.Arg(0) {
+	case "dot":
+		graph.WriteDOT(os.Stdout)
+	case "mermaid":
+		graph.WriteMermaid(os.Stdout)
+	case "check":
+		problems := graph.Inconsistencies()
+		sharedconfig.WriteGraphReport(os.Stdout, problems)
+		if cycle := graph.FindCycle(); cycle != nil {
+			log.Printf("%v", &sharedconfig.DependencyCycleError{Cycle: cycle})
+			os.Exit(2)
+		}
+		if len(problems) > 0 {
+			os.Exit(2)
+		}
+	case "impact":
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		direct, transitive, err := graph.Impact(flag.Arg(1))
+		if err != nil {
+			log.Fatalf("Failed to compute impact: %v", err)
+		}
+		sharedconfig.WriteImpactReport(os.Stdout, flag.Arg(1), direct, transitive)
+	default:
+		flag.Usage()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	sharedconfig "erp-suite/shared-config/loaders/go"
+)
+
+func main() {
+	var (
+		environment = flag.String("env", "", "Environment (development, staging, production, testing); defaults to ERP_ENVIRONMENT")
+		jsonOutput  = flag.Bool("json", false, "Print results as JSON")
+		noColor     = flag.Bool("no-color", false, "Disable colored output")
+		only        = flag.String("only", "", "Comma-separated backends to check ("+strings.Join(sharedconfig.DoctorBackends, ", ")+")")
+		timeout     = flag.Duration("timeout", 5*time.Second, "Timeout for each check")
+	)
+	flag.Parse()
+
+	if *environment != "" {
+		os.Setenv("ERP_ENVIRONMENT", *environment)
+	}
+
+	config, err := sharedconfig.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	opts := sharedconfig.DoctorOptions{Timeout: *timeout}
+	if *only != "" {
+		opts.Backends = strings.Split(*only, ",")
+	}
+
+	results := sharedconfig.RunDoctor(context.Background(), config, opts)
+	if *jsonOutput {
+		if err := sharedconfig.WriteDoctorJSON(os.Stdout, results); err != nil {
+			log.Fatalf("Failed to write results: %v", err)
+		}
+	} else {
+		sharedconfig.WriteDoctorTable(os.Stdout, results, !*noColor && isTerminal(os.Stdout))
+	}
+
+	if sharedconfig.DoctorFailed(results) {
+		os.Exit(2)
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0 && os.Getenv("NO_COLOR") == ""
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	sharedconfig "erp-suite/shared-config/loaders/go"
+)
+
+func main() {
+	var (
+		environment = flag.String("env", "", "Environment (development, staging, production, testing); defaults to ERP_ENVIRONMENT")
+		dryRun      = flag.Bool("dry-run", false, "Report what would change without touching Qdrant")
+		switchAlias = flag.String("switch-alias", "", "Point the alias of a versioned collection (e.g. documents) at its current version and exit")
+		timeout     = flag.Duration("timeout", 30*time.Second, "Timeout for talking to Qdrant")
+	)
+	flag.Parse()
+
+	if *environment != "" {
+		os.Setenv("ERP_ENVIRONMENT", *environment)
+	}
+
+	config, err := sharedconfig.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	qdrantConfig := &config.VectorDatabase.Qdrant
+	client, err := sharedconfig.NewQdrantClient(qdrantConfig)
+	if err != nil {
+		log.Fatalf("Failed to create qdrant client: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	if *switchAlias != "" {
+		if err := sharedconfig.SwitchCollectionAlias(ctx, client, qdrantConfig, *switchAlias); err != nil {
+			log.Fatalf("Failed to switch alias: %v", err)
+		}
+		log.Printf("Alias %s now points to %s",
+			qdrantConfig.Collections.GetCollectionName(*switchAlias),
+			qdrantConfig.GetPhysicalCollectionName(*switchAlias))
+		return
+	}
+
+	results, err := sharedconfig.EnsureCollections(ctx, client, qdrantConfig, *dryRun)
+	sharedconfig.WriteCollectionReport(os.Stdout, results, *dryRun)
+	if err != nil {
+		log.Fatalf("Failed to ensure collections: %v", err)
+	}
+
+	for _, r := range results {
+		if r.Action == sharedconfig.CollectionActionMismatch {
+			os.Exit(2)
+		}
+	}
+}
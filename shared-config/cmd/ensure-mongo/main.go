@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	sharedconfig "erp-suite/shared-config/loaders/go"
+)
+
+func main() {
+	var (
+		environment = flag.String("env", "", "Environment (development, staging, production, testing); defaults to ERP_ENVIRONMENT")
+		dryRun      = flag.Bool("dry-run", false, "Report what would change without touching MongoDB")
+		timeout     = flag.Duration("timeout", 60*time.Second, "Timeout for talking to MongoDB")
+	)
+	flag.Parse()
+
+	if *environment != "" {
+		os.Setenv("ERP_ENVIRONMENT", *environment)
+	}
+
+	config, err := sharedconfig.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	retention, err := config.Monitoring.Logging.GetRetentionPeriod(config.Environment.Current)
+	if err != nil {
+		log.Fatalf("Invalid monitoring.logging.retention_period: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	mongoConfig := &config.Database.MongoDB
+	db, err := sharedconfig.OpenMongo(ctx, mongoConfig, "analytics")
+	if err != nil {
+		log.Fatalf("Failed to connect to mongodb: %v", err)
+	}
+	defer db.Client().Disconnect(context.Background())
+
+	admin := &sharedconfig.MongoDriverAdmin{Client: db.Client()}
+	results, err := sharedconfig.EnsureMongo(ctx, admin, mongoConfig, retention, *dryRun)
+	sharedconfig.WriteMongoReport(os.Stdout, results, *dryRun)
+	if err != nil {
+		log.Fatalf("Failed to ensure collections: %v", err)
+	}
+
+	for _, r := range results {
+		if r.Action == sharedconfig.MongoActionDrift {
+			os.Exit(2)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	sharedconfig "erp-suite/shared-config/loaders/go"
+)
+
+func main() {
+	var (
+		environment = flag.String("env", "", "Environment (development, staging, production, testing); defaults to ERP_ENVIRONMENT")
+		dryRun      = flag.Bool("dry-run", false, "Report what would change without creating topics")
+		timeout     = flag.Duration("timeout", 30*time.Second, "Timeout for talking to the brokers")
+	)
+	flag.Parse()
+
+	if *environment != "" {
+		os.Setenv("ERP_ENVIRONMENT", *environment)
+	}
+
+	config, err := sharedconfig.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	kafkaConfig := &config.MessageBroker.Kafka
+	clientOptions, err := kafkaConfig.GetClientOptions("ensure-topics")
+	if err != nil {
+		log.Fatalf("Invalid kafka configuration: %v", err)
+	}
+
+	client, err := kgo.NewClient(clientOptions.FranzClientOpts()...)
+	if err != nil {
+		log.Fatalf("Failed to create kafka client: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	admin := &sharedconfig.FranzTopicAdmin{Client: kadm.NewClient(client)}
+	results, err := sharedconfig.EnsureTopics(ctx, admin, kafkaConfig, *dryRun)
+	sharedconfig.WriteTopicReport(os.Stdout, results, *dryRun)
+	if err != nil {
+		log.Fatalf("Failed to ensure topics: %v", err)
+	}
+
+	for _, r := range results {
+		if r.Action == sharedconfig.TopicActionDrift {
+			os.Exit(2)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"erp-suite/shared-config/generators/envgen"
+)
+
+const environments = "development staging production testing"
+
+// bashCompletion completes commands, environments and formats; flags are
+// read from the -h output of the command being completed
+const bashCompletion = `# erpconfig bash completion: source <(erpconfig completion bash)
+_erpconfig() {
+	local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}
+	if [ "$COMP_CWORD" -eq 1 ]; then
+		COMPREPLY=($(compgen -W "%[1]s" -- "$cur"))
+		return
+	fi
+	local cmd=${COMP_WORDS[1]}
+	case "$prev" in
+		-env|--env) COMPREPLY=($(compgen -W "%[2]s all" -- "$cur")); return ;;
+		-format|--format) COMPREPLY=($(compgen -W "%[3]s" -- "$cur")); return ;;
+		-dialect|--dialect) COMPREPLY=($(compgen -W "%[4]s" -- "$cur")); return ;;
+		-output-dir|--output-dir|-templates|--templates) COMPREPLY=($(compgen -d -- "$cur")); return ;;
+	esac
+	if [[ $cur == -* ]]; then
+		COMPREPLY=($(compgen -W "$(erpconfig "$cmd" -h 2>&1 | sed -n 's/^  \(-[a-z-]*\).*/\1/p')" -- "$cur"))
+		return
+	fi
+	case "$cmd" in
+		diff) COMPREPLY=($(compgen -W "%[2]s" -- "$cur")) ;;
+		graph) COMPREPLY=($(compgen -W "dot mermaid check impact" -- "$cur")) ;;
+		completion) COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur")) ;;
+	esac
+}
+complete -F _erpconfig erpconfig
+`
+
+func runCompletion(name string, args []string) {
+	fs, _ := newFlagSet(name)
+	fs.Parse(args)
+
+	names := make([]string, len(commands))
+	for i, cmd := range commands {
+		names[i] = cmd.Name
+	}
+	dialects := make([]string, len(envgen.DotenvDialects))
+	for i, d := range envgen.DotenvDialects {
+		dialects[i] = string(d)
+	}
+	bash := fmt.Sprintf(bashCompletion, strings.Join(names, " "), environments,
+		strings.Join(envgen.Formats(), " "), strings.Join(dialects, " "))
+
+	switch fs.Arg(0) {
+	case "bash":
+		fmt.Print(bash)
+	case "zsh":
+		fmt.Print("# erpconfig zsh completion: source <(erpconfig completion zsh)\nautoload -U +X bashcompinit && bashcompinit\n")
+		fmt.Print(strings.TrimPrefix(bash, bash[:strings.Index(bash, "\n")+1]))
+	case "fish":
+		fmt.Println("# erpconfig fish completion: erpconfig completion fish | source")
+		fmt.Println("complete -c erpconfig -f")
+		for _, cmd := range commands {
+			fmt.Printf("complete -c erpconfig -n __fish_use_subcommand -a %s -d %q\n", cmd.Name, cmd.Summary)
+		}
+		fmt.Printf("complete -c erpconfig -n '__fish_seen_subcommand_from diff' -a '%s'\n", environments)
+		fmt.Println("complete -c erpconfig -n '__fish_seen_subcommand_from graph' -a 'dot mermaid check impact'")
+		fmt.Println("complete -c erpconfig -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish'")
+		fmt.Printf("complete -c erpconfig -o env -x -a '%s all' -d Environment\n", environments)
+		fmt.Printf("complete -c erpconfig -o format -x -a '%s' -d 'Output format'\n", strings.Join(envgen.Formats(), " "))
+		fmt.Printf("complete -c erpconfig -o dialect -x -a '%s' -d 'Dotenv dialect'\n", strings.Join(dialects, " "))
+		fmt.Println("complete -c erpconfig -o json -d 'Print results as JSON'")
+	default:
+		fs.Usage()
+		os.Exit(1)
+	}
+}
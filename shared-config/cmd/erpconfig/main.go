@@ -0,0 +1,599 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"gopkg.in/yaml.v3"
+
+	"erp-suite/shared-config/generators/envgen"
+	sharedconfig "erp-suite/shared-config/loaders/go"
+)
+
+// command is an erpconfig subcommand
+type command struct {
+	Name    string
+	Args    string
+	Summary string
+	Run     func(name string, args []string)
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"generate", "", "Generate environment files for modules and environments", runGenerate},
+		{"audit", "", "Report which secrets the generated environment files give each module", runAudit},
+		{"validate", "", "Load the configuration and check naming, the service graph and environment files", runValidate},
+		{"show", "[prefix]", "Print every setting, secrets redacted", runShow},
+		{"explain", "<path|ENV_VAR>", "Show where a setting gets its value from", runExplain},
+		{"diff", "<envA> <envB>", "Compare the settings of two environments", runDiff},
+		{"encrypt", "[value]", "Encrypt a value with ERP_CONFIG_KEY (reads stdin without value)", runEncrypt},
+		{"decrypt", "[value]", "Decrypt an " + sharedconfig.EncryptedPrefix + " value (reads stdin without value)", runDecrypt},
+		{"doctor", "", "Check DNS, TCP and handshakes for every backend", runDoctor},
+		{"graph", "[dot|mermaid|check|impact <service>]", "Render or check the dependency graph", runGraph},
+		{"lint", "", "Check generator templates for unknown fields, functions and partials", runLint},
+		{"completion", "bash|zsh|fish", "Print a shell completion script", runCompletion},
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: erpconfig <command> [flags] [args]\n\nCommands:\n")
+	w := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s %s\t%s\n", cmd.Name, cmd.Args, cmd.Summary)
+	}
+	w.Flush()
+	fmt.Fprintf(os.Stderr, "\nRun erpconfig <command> -h for the flags of a command. Commands that load the\nconfiguration run from the repository root, like the other shared-config tools.\n")
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(1)
+	}
+	for _, cmd := range commands {
+		if cmd.Name == os.Args[1] {
+			cmd.Run(cmd.Name, os.Args[2:])
+			return
+		}
+	}
+	if os.Args[1] != "-h" && os.Args[1] != "--help" && os.Args[1] != "help" {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", os.Args[1])
+	}
+	usage()
+	os.Exit(1)
+}
+
+// newFlagSet returns the flag set of a subcommand, with -json
+func newFlagSet(name string) (*flag.FlagSet, *bool) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		for _, cmd := range commands {
+			if cmd.Name == name {
+				fmt.Fprintf(fs.Output(), "Usage: erpconfig %s [flags] %s\n\n%s\n\n", name, cmd.Args, cmd.Summary)
+			}
+		}
+		fs.PrintDefaults()
+	}
+	return fs, fs.Bool("json", false, "Print results as JSON")
+}
+
+// envFlag adds -env to a subcommand that loads the configuration
+func envFlag(fs *flag.FlagSet) *string {
+	return fs.String("env", "", "Environment (development, staging, production, testing); defaults to ERP_ENVIRONMENT")
+}
+
+func loadConfig(environment string) *sharedconfig.Config {
+	if environment != "" {
+		os.Setenv("ERP_ENVIRONMENT", environment)
+	}
+	config, err := sharedconfig.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	return config
+}
+
+func writeJSON(v interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Fatalf("Failed to write results: %v", err)
+	}
+}
+
+// formatValue prints a setting value, with <unset> for missing ones
+func formatValue(value interface{}) string {
+	if value == nil {
+		return "<unset>"
+	}
+	if list, ok := value.([]string); ok {
+		return "[" + strings.Join(list, ", ") + "]"
+	}
+	return fmt.Sprint(value)
+}
+
+// splitList splits a comma-separated flag value; "all" selects everything
+func splitList(value string) []string {
+	if value == "all" {
+		return nil
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func findConfigDir() string {
+	dir, err := envgen.FindConfigDir(".")
+	if err != nil {
+		log.Fatalf("Failed to find shared-config directory: %v", err)
+	}
+	return dir
+}
+
+func runGenerate(name string, args []string) {
+	fs, jsonOutput := newFlagSet(name)
+	var (
+		environment = fs.String("env", "all", "Environments, comma-separated, or all")
+		module      = fs.String("module", "all", "Modules as registered under modules in config.yaml, comma-separated, or all")
+		format      = fs.String("format", "dotenv", "Output format ("+strings.Join(envgen.Formats(), ", ")+")")
+		dialect     = fs.String("dialect", "godotenv", "Dotenv parser the dotenv format quotes values for (godotenv, compose, python)")
+		outputDir   = fs.String("output-dir", ".", "Directory the files are written to")
+		check       = fs.Bool("check", false, "Compare with the files on disk, print a diff for each stale file and exit 2 instead of writing")
+		jobs        = fs.Int("jobs", runtime.NumCPU(), "Number of module/environment combinations rendered in parallel")
+	)
+	fs.Parse(args)
+
+	opts := envgen.Options{
+		ConfigDir:    findConfigDir(),
+		Modules:      splitList(*module),
+		Environments: splitList(*environment),
+		Format:       *format,
+		Dialect:      *dialect,
+		Jobs:         *jobs,
+	}
+	if !*check {
+		opts.Sink = envgen.DirSink(*outputDir)
+	}
+	artifacts, err := envgen.Generate(context.Background(), opts)
+	if err != nil {
+		log.Fatalf("Failed to generate environment files: %v", err)
+	}
+
+	if *check {
+		drifts, err := artifacts.Check(os.DirFS(*outputDir))
+		if err != nil {
+			log.Fatalf("Failed to check generated files: %v", err)
+		}
+		if *jsonOutput {
+			writeJSON(drifts)
+		} else {
+			for _, drift := range drifts {
+				fmt.Print(drift.Diff)
+			}
+		}
+		if len(drifts) > 0 {
+			os.Exit(2)
+		}
+		return
+	}
+
+	type generated struct {
+		Module      string `json:"module"`
+		Environment string `json:"environment"`
+		Path        string `json:"path"`
+		Secret      bool   `json:"secret"`
+	}
+	files := []generated{}
+	for _, artifact := range artifacts {
+		path := filepath.Join(*outputDir, artifact.Path)
+		files = append(files, generated{artifact.Module, artifact.Environment, path, artifact.Secret})
+		if !*jsonOutput {
+			fmt.Printf("Environment file generated: %s\n", path)
+		}
+	}
+	if *jsonOutput {
+		writeJSON(files)
+	}
+}
+
+func runAudit(name string, args []string) {
+	fs, jsonOutput := newFlagSet(name)
+	var (
+		environment = fs.String("env", "all", "Environments, comma-separated, or all")
+		module      = fs.String("module", "all", "Modules as registered under modules in config.yaml, comma-separated, or all")
+	)
+	fs.Parse(args)
+
+	artifacts, err := envgen.Generate(context.Background(), envgen.Options{
+		ConfigDir:    findConfigDir(),
+		Modules:      splitList(*module),
+		Environments: splitList(*environment),
+	})
+	if err != nil {
+		log.Fatalf("Failed to generate environment files: %v", err)
+	}
+	exposures := artifacts.SecretAudit()
+	if *jsonOutput {
+		writeJSON(exposures)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ENVIRONMENT\tSECRET\tMODULES")
+	for _, exposure := range exposures {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", exposure.Environment, exposure.Key, strings.Join(exposure.Modules, ", "))
+	}
+	w.Flush()
+}
+
+// problem is a finding of validate
+type problem struct {
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+func runValidate(name string, args []string) {
+	fs, jsonOutput := newFlagSet(name)
+	environment := envFlag(fs)
+	fs.Parse(args)
+
+	problems := []problem{}
+	if *environment != "" {
+		os.Setenv("ERP_ENVIRONMENT", *environment)
+	}
+	config, err := sharedconfig.Load()
+	if err != nil {
+		problems = append(problems, problem{"load", err.Error()})
+	} else {
+		for _, v := range config.ValidateNaming() {
+			problems = append(problems, problem{"naming", v.String()})
+		}
+		graph := config.ServiceGraph()
+		for _, p := range graph.Inconsistencies() {
+			problems = append(problems, problem{"graph", p.String()})
+		}
+		if cycle := graph.FindCycle(); cycle != nil {
+			problems = append(problems, problem{"graph", (&sharedconfig.DependencyCycleError{Cycle: cycle}).Error()})
+		}
+	}
+
+	files, _ := filepath.Glob("shared-config/environments/*.yaml")
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err == nil {
+			var v interface{}
+			err = yaml.Unmarshal(data, &v)
+		}
+		if err != nil {
+			problems = append(problems, problem{"yaml", fmt.Sprintf("%s: %v", file, err)})
+		}
+	}
+
+	if *jsonOutput {
+		writeJSON(struct {
+			Valid    bool      `json:"valid"`
+			Problems []problem `json:"problems"`
+		}{len(problems) == 0, problems})
+	} else {
+		for _, p := range problems {
+			fmt.Printf("%s: %s\n", p.Check, p.Message)
+		}
+		if len(problems) == 0 {
+			fmt.Println("Configuration is valid")
+		}
+	}
+	if len(problems) > 0 {
+		os.Exit(2)
+	}
+}
+
+func runShow(name string, args []string) {
+	fs, jsonOutput := newFlagSet(name)
+	environment := envFlag(fs)
+	fs.Parse(args)
+
+	config := loadConfig(*environment)
+	settings := []sharedconfig.Setting{}
+	for _, s := range config.Settings() {
+		if fs.NArg() == 0 || s.Path == fs.Arg(0) || strings.HasPrefix(s.Path, fs.Arg(0)+".") {
+			settings = append(settings, s.Redacted())
+		}
+	}
+
+	if *jsonOutput {
+		writeJSON(settings)
+		return
+	}
+	for _, s := range settings {
+		fmt.Printf("%s = %s\n", s.Path, formatValue(s.Value))
+	}
+}
+
+func runExplain(name string, args []string) {
+	fs, jsonOutput := newFlagSet(name)
+	environment := envFlag(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	if *environment != "" {
+		os.Setenv("ERP_ENVIRONMENT", *environment)
+	}
+	explanation, err := sharedconfig.Explain(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Failed to explain %s: %v", fs.Arg(0), err)
+	}
+	if *jsonOutput {
+		writeJSON(explanation)
+		return
+	}
+
+	fmt.Printf("%s = %s\n", explanation.Path, formatValue(explanation.Value))
+	fmt.Printf("  from: %s\n", explanation.Origin)
+	if explanation.EnvVar != "" {
+		fmt.Printf("  environment variable: %s\n", explanation.EnvVar)
+	}
+	fmt.Println("  sources, highest precedence first:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, source := range explanation.Sources {
+		value := source.Value
+		if !source.Set {
+			value = "<unset>"
+		}
+		fmt.Fprintf(w, "    %s\t%s\n", source.Source, value)
+	}
+	w.Flush()
+}
+
+func runDiff(name string, args []string) {
+	fs, jsonOutput := newFlagSet(name)
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	var settings [2][]sharedconfig.Setting
+	for i, environment := range fs.Args() {
+		config, err := sharedconfig.LoadEnvironment(environment)
+		if err != nil {
+			log.Fatalf("Failed to load %s configuration: %v", environment, err)
+		}
+		settings[i] = config.Settings()
+	}
+	changes := []sharedconfig.SettingChange{}
+	for _, change := range sharedconfig.DiffSettings(settings[0], settings[1]) {
+		if change.Path != "environment.current" {
+			changes = append(changes, change.Redacted())
+		}
+	}
+
+	if *jsonOutput {
+		writeJSON(changes)
+		return
+	}
+	if len(changes) == 0 {
+		fmt.Printf("%s and %s have the same settings\n", fs.Arg(0), fs.Arg(1))
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "SETTING\t%s\t%s\n", strings.ToUpper(fs.Arg(0)), strings.ToUpper(fs.Arg(1)))
+	for _, change := range changes {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", change.Path, formatValue(change.A), formatValue(change.B))
+	}
+	w.Flush()
+}
+
+// valueArg returns the single argument, or stdin without its final newline
+func valueArg(fs *flag.FlagSet) string {
+	switch fs.NArg() {
+	case 0:
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatalf("Failed to read value: %v", err)
+		}
+		return strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r")
+	case 1:
+		return fs.Arg(0)
+	}
+	fs.Usage()
+	os.Exit(1)
+	return ""
+}
+
+func runEncrypt(name string, args []string) {
+	fs, jsonOutput := newFlagSet(name)
+	fs.Parse(args)
+	value := valueArg(fs)
+
+	key, err := sharedconfig.ConfigKey()
+	if err != nil {
+		log.Fatalf("Failed to read config key: %v", err)
+	}
+	encrypted, err := sharedconfig.EncryptValue(key, value)
+	if err != nil {
+		log.Fatalf("Failed to encrypt value: %v", err)
+	}
+	if *jsonOutput {
+		writeJSON(map[string]string{"value": encrypted})
+		return
+	}
+	fmt.Println(encrypted)
+}
+
+func runDecrypt(name string, args []string) {
+	fs, jsonOutput := newFlagSet(name)
+	fs.Parse(args)
+	value := strings.TrimSpace(valueArg(fs))
+
+	key, err := sharedconfig.ConfigKey()
+	if err != nil {
+		log.Fatalf("Failed to read config key: %v", err)
+	}
+	plaintext, err := sharedconfig.DecryptValue(key, value)
+	if err != nil {
+		log.Fatalf("Failed to decrypt value: %v", err)
+	}
+	if *jsonOutput {
+		writeJSON(map[string]string{"value": plaintext})
+		return
+	}
+	fmt.Println(plaintext)
+}
+
+func runDoctor(name string, args []string) {
+	fs, jsonOutput := newFlagSet(name)
+	var (
+		environment = envFlag(fs)
+		noColor     = fs.Bool("no-color", false, "Disable colored output")
+		only        = fs.String("only", "", "Comma-separated backends to check ("+strings.Join(sharedconfig.DoctorBackends, ", ")+")")
+		timeout     = fs.Duration("timeout", 5*time.Second, "Timeout for each check")
+	)
+	fs.Parse(args)
+
+	config := loadConfig(*environment)
+	opts := sharedconfig.DoctorOptions{Timeout: *timeout}
+	if *only != "" {
+		opts.Backends = strings.Split(*only, ",")
+	}
+	results := sharedconfig.RunDoctor(context.Background(), config, opts)
+	if *jsonOutput {
+		if err := sharedconfig.WriteDoctorJSON(os.Stdout, results); err != nil {
+			log.Fatalf("Failed to write results: %v", err)
+		}
+	} else {
+		sharedconfig.WriteDoctorTable(os.Stdout, results, !*noColor && isTerminal(os.Stdout))
+	}
+	if sharedconfig.DoctorFailed(results) {
+		os.Exit(2)
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0 && os.Getenv("NO_COLOR") == ""
+}
+
+func runGraph(name string, args []string) {
+	fs, jsonOutput := newFlagSet(name)
+	environment := envFlag(fs)
+	fs.Parse(args)
+
+	graph := loadConfig(*environment).ServiceGraph()
+	switch fs.Arg(0) {
+	case "", "dot", "mermaid":
+		switch {
+		case *jsonOutput:
+			writeJSON(graphJSON(graph))
+		case fs.Arg(0) == "mermaid":
+			graph.WriteMermaid(os.Stdout)
+		default:
+			graph.WriteDOT(os.Stdout)
+		}
+	case "check":
+		problems := graph.Inconsistencies()
+		cycle := graph.FindCycle()
+		if *jsonOutput {
+			messages := []string{}
+			for _, p := range problems {
+				messages = append(messages, p.String())
+			}
+			writeJSON(map[string]interface{}{"problems": messages, "cycle": cycle})
+		} else {
+			sharedconfig.WriteGraphReport(os.Stdout, problems)
+			if cycle != nil {
+				log.Printf("%v", &sharedconfig.DependencyCycleError{Cycle: cycle})
+			}
+		}
+		if len(problems) > 0 || cycle != nil {
+			os.Exit(2)
+		}
+	case "impact":
+		if fs.NArg() != 2 {
+			fs.Usage()
+			os.Exit(1)
+		}
+		direct, transitive, err := graph.Impact(fs.Arg(1))
+		if err != nil {
+			log.Fatalf("Failed to compute impact: %v", err)
+		}
+		if *jsonOutput {
+			writeJSON(map[string]interface{}{"service": fs.Arg(1), "direct": direct, "transitive": transitive})
+			return
+		}
+		sharedconfig.WriteImpactReport(os.Stdout, fs.Arg(1), direct, transitive)
+	default:
+		fs.Usage()
+		os.Exit(1)
+	}
+}
+
+// graphJSON lists the services of graph with their group and its edges
+func graphJSON(graph *sharedconfig.ServiceGraph) interface{} {
+	type node struct {
+		Name  string `json:"name"`
+		Group string `json:"group,omitempty"`
+	}
+	type edge struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	nodes, edges := []node{}, []edge{}
+	for _, name := range graph.Nodes() {
+		nodes = append(nodes, node{name, graph.Groups[name]})
+		for _, dep := range graph.Dependencies(name) {
+			edges = append(edges, edge{name, dep})
+		}
+	}
+	return map[string]interface{}{"nodes": nodes, "edges": edges}
+}
+
+func runLint(name string, args []string) {
+	fs, jsonOutput := newFlagSet(name)
+	templates := fs.String("templates", "", "Templates directory (default <config-dir>/templates)")
+	fs.Parse(args)
+
+	opts := envgen.Options{ConfigDir: findConfigDir()}
+	if *templates != "" {
+		opts.TemplatesFS = os.DirFS(*templates)
+	}
+	problems, err := envgen.Lint(opts)
+	if err != nil {
+		log.Fatalf("Failed to lint templates: %v", err)
+	}
+	if *jsonOutput {
+		if problems == nil {
+			problems = []envgen.TemplateProblem{}
+		}
+		writeJSON(problems)
+	} else {
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+		if len(problems) == 0 {
+			fmt.Println("Templates are valid")
+		}
+	}
+	if len(problems) > 0 {
+		os.Exit(2)
+	}
+}
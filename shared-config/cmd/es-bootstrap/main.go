@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	sharedconfig "erp-suite/shared-config/loaders/go"
+)
+
+func main() {
+	var (
+		environment = flag.String("env", "", "Environment (development, staging, production, testing); defaults to ERP_ENVIRONMENT")
+		dryRun      = flag.Bool("dry-run", false, "Report what would change without touching Elasticsearch")
+		timeout     = flag.Duration("timeout", 30*time.Minute, "Timeout for the whole bootstrap, including reindexing")
+	)
+	flag.Parse()
+
+	if *environment != "" {
+		os.Setenv("ERP_ENVIRONMENT", *environment)
+	}
+
+	config, err := sharedconfig.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	esConfig := &config.Search.Elasticsearch
+	client, err := sharedconfig.NewElasticsearchClient(esConfig)
+	if err != nil {
+		log.Fatalf("Invalid elasticsearch configuration: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	results, err := sharedconfig.BootstrapElasticsearch(ctx, client, esConfig, *dryRun)
+	sharedconfig.WriteIndexReport(os.Stdout, results, *dryRun)
+	if err != nil {
+		log.Fatalf("Failed to bootstrap elasticsearch: %v", err)
+	}
+
+	for _, r := range results {
+		if r.Action == sharedconfig.IndexActionConflict || r.Action == sharedconfig.IndexActionDrift {
+			os.Exit(2)
+		}
+	}
+}
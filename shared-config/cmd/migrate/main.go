@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	sharedconfig "erp-suite/shared-config/loaders/go"
+)
+
+func main() {
+	var (
+		environment = flag.String("env", "", "Environment (development, staging, production, testing); defaults to ERP_ENVIRONMENT")
+		module      = flag.String("module", "", "Module to migrate (auth, crm, hrm, ...); defaults to every module with a database")
+		dir         = flag.String("dir", "", "Migrations directory; defaults to database.postgresql.migrations.dir")
+		to          = flag.Int64("to", 0, "up: stop after this version (0 applies everything)")
+		steps       = flag.Int("steps", 1, "down: number of migrations to roll back")
+		timeout     = flag.Duration("timeout", 5*time.Minute, "Timeout for the whole run")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: migrate [flags] up|down|status|verify\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	command := flag.Arg(0)
+	switch command {
+	case "up", "status", "verify":
+	case "down":
+		if *module == "" {
+			log.Fatalf("down requires -module")
+		}
+	default:
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *environment != "" {
+		os.Setenv("ERP_ENVIRONMENT", *environment)
+	}
+
+	config, err := sharedconfig.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	pgConfig := &config.Database.PostgreSQL
+	if *dir != "" {
+		pgConfig.Migrations.Dir = *dir
+	}
+
+	modules := pgConfig.Databases.GetModules()
+	if *module != "" {
+		modules = []string{*module}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	failed := false
+	for _, name := range modules {
+		db, err := sharedconfig.OpenPostgresAs(ctx, pgConfig, name, sharedconfig.PostgreSQLRoleOwner)
+		if err != nil {
+			log.Fatalf("Failed to connect to %s database: %v", name, err)
+		}
+
+		migrator, err := sharedconfig.NewMigrator(db, pgConfig, name)
+		if err != nil {
+			db.Close()
+			log.Fatalf("Failed to load migrations: %v", err)
+		}
+		if len(migrator.Migrations) == 0 && command != "status" && command != "verify" {
+			db.Close()
+			continue
+		}
+
+		switch command {
+		case "up":
+			applied, err := migrator.Up(ctx, *to)
+			for _, m := range applied {
+				log.Printf("%s: applied %d_%s", name, m.Version, m.Name)
+			}
+			if err != nil {
+				log.Fatalf("Failed to migrate %s: %v", name, err)
+			}
+		case "down":
+			reverted, err := migrator.Down(ctx, *steps)
+			for _, m := range reverted {
+				log.Printf("%s: rolled back %d_%s", name, m.Version, m.Name)
+			}
+			if err != nil {
+				log.Fatalf("Failed to roll back %s: %v", name, err)
+			}
+		case "status":
+			statuses, err := migrator.Status(ctx)
+			if err != nil {
+				log.Fatalf("Failed to read migration status of %s: %v", name, err)
+			}
+			sharedconfig.WriteMigrationStatus(os.Stdout, name, statuses)
+		case "verify":
+			if err := migrator.Verify(ctx); err != nil {
+				log.Printf("%v", err)
+				failed = true
+			}
+		}
+		db.Close()
+	}
+
+	if failed {
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	sharedconfig "erp-suite/shared-config/loaders/go"
+)
+
+func main() {
+	var (
+		environment = flag.String("env", "", "Environment (development, staging, production, testing); defaults to ERP_ENVIRONMENT")
+		dryRun      = flag.Bool("dry-run", false, "Report what would change without touching PostgreSQL")
+		timeout     = flag.Duration("timeout", 2*time.Minute, "Timeout for the whole run")
+	)
+	flag.Parse()
+
+	if *environment != "" {
+		os.Setenv("ERP_ENVIRONMENT", *environment)
+	}
+
+	config, err := sharedconfig.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	results, err := sharedconfig.ProvisionPostgres(ctx, &config.Database.PostgreSQL, *dryRun)
+	sharedconfig.WriteProvisionReport(os.Stdout, results, *dryRun)
+	if err != nil {
+		log.Fatalf("Failed to provision databases: %v", err)
+	}
+}
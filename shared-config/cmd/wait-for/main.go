@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	sharedconfig "erp-suite/shared-config/loaders/go"
+)
+
+func main() {
+	var (
+		environment = flag.String("env", "", "Environment (development, staging, production, testing); defaults to ERP_ENVIRONMENT")
+		module      = flag.String("module", "", "Wait for the dependencies of this module")
+		order       = flag.Bool("order", false, "Print the startup order, one wave per line, instead of waiting")
+		compose     = flag.Bool("compose", false, "With -order, print docker compose service names")
+		timeout     = flag.Duration("timeout", 0, "Overall timeout; per-dependency timeouts come from startup.timeouts")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: wait-for [flags] [dependency ...]\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *environment != "" {
+		os.Setenv("ERP_ENVIRONMENT", *environment)
+	}
+
+	config, err := sharedconfig.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	graph := config.DependencyGraph()
+	if cycle := graph.FindCycle(); cycle != nil {
+		log.Fatalf("Invalid modules: %v", &sharedconfig.DependencyCycleError{Cycle: cycle})
+	}
+
+	names := flag.Args()
+	if *order {
+		if *module != "" {
+			names = append(names, *module)
+		}
+		waves, err := graph.StartupOrder(names...)
+		if err != nil {
+			log.Fatalf("Failed to compute startup order: %v", err)
+		}
+		for _, wave := range waves {
+			if *compose {
+				for i, name := range wave {
+					wave[i] = config.Startup.GetComposeService(name)
+				}
+			}
+			fmt.Println(strings.Join(wave, " "))
+		}
+		return
+	}
+
+	if *module != "" {
+		if !graph.Has(*module) {
+			log.Fatalf("Unknown module %q", *module)
+		}
+		names = append(names, graph.Dependencies(*module)...)
+	}
+	if len(names) == 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	if err := config.WaitForDependencies(ctx, *module, names, os.Stdout); err != nil {
+		log.Fatalf("Dependencies are not healthy: %v", err)
+	}
+	log.Printf("All dependencies ready after %s", time.Since(start).Round(time.Second))
+}
@@ -0,0 +1,274 @@
+package envgen
+
+import (
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the part of an environment config that templates can use
+type Config struct {
+	Environment struct {
+		Name      string `yaml:"name"`
+		Debug     bool   `yaml:"debug"`
+		LogLevel  string `yaml:"log_level"`
+		HotReload bool   `yaml:"hot_reload"`
+	} `yaml:"environment"`
+
+	Databases struct {
+		PostgreSQL struct {
+			Host              string            `yaml:"host"`
+			Port              int               `yaml:"port"`
+			Username          string            `yaml:"username"`
+			Password          string            `yaml:"password"`
+			SSLMode           string            `yaml:"ssl_mode"`
+			MaxConnections    int               `yaml:"max_connections"`
+			ConnectionTimeout int               `yaml:"connection_timeout"`
+			Databases         map[string]string `yaml:"databases"`
+			// Roles are the per-module login roles created by provision-db
+			Roles map[string]struct {
+				App postgresRole `yaml:"app"`
+			} `yaml:"roles"`
+		} `yaml:"postgresql"`
+
+		MongoDB struct {
+			Host        string            `yaml:"host"`
+			Port        int               `yaml:"port"`
+			Username    string            `yaml:"username"`
+			Password    string            `yaml:"password"`
+			AuthSource  string            `yaml:"auth_source"`
+			MaxPoolSize int               `yaml:"max_pool_size"`
+			SSL         bool              `yaml:"ssl,omitempty"`
+			Databases   map[string]string `yaml:"databases"`
+		} `yaml:"mongodb"`
+
+		Redis struct {
+			Host           string         `yaml:"host"`
+			Port           int            `yaml:"port"`
+			Password       string         `yaml:"password"`
+			MaxConnections int            `yaml:"max_connections"`
+			SSL            bool           `yaml:"ssl,omitempty"`
+			Databases      map[string]int `yaml:"databases"`
+		} `yaml:"redis"`
+
+		Qdrant struct {
+			Host        string            `yaml:"host"`
+			HTTPPort    int               `yaml:"http_port"`
+			GRPCPort    int               `yaml:"grpc_port"`
+			APIKey      string            `yaml:"api_key"`
+			SSL         bool              `yaml:"ssl,omitempty"`
+			Collections map[string]string `yaml:"collections"`
+		} `yaml:"qdrant"`
+	} `yaml:"databases"`
+
+	Messaging struct {
+		Kafka struct {
+			Brokers          stringList        `yaml:"brokers"`
+			SecurityProtocol string            `yaml:"security_protocol"`
+			SASLMechanism    string            `yaml:"sasl_mechanism"`
+			SASLUsername     string            `yaml:"sasl_username,omitempty"`
+			SASLPassword     string            `yaml:"sasl_password,omitempty"`
+			Topics           map[string]string `yaml:"topics"`
+			ConsumerGroups   map[string]string `yaml:"consumer_groups"`
+		} `yaml:"kafka"`
+	} `yaml:"messaging"`
+
+	Search struct {
+		Elasticsearch struct {
+			Host        string            `yaml:"host"`
+			Port        int               `yaml:"port"`
+			Username    string            `yaml:"username"`
+			Password    string            `yaml:"password"`
+			UseSSL      bool              `yaml:"use_ssl"`
+			VerifyCerts bool              `yaml:"verify_certs"`
+			CACert      string            `yaml:"ca_cert,omitempty"`
+			Indices     map[string]string `yaml:"indices"`
+		} `yaml:"elasticsearch"`
+	} `yaml:"search"`
+
+	Monitoring struct {
+		Prometheus struct {
+			Host               string `yaml:"host"`
+			Port               int    `yaml:"port"`
+			ScrapeInterval     string `yaml:"scrape_interval"`
+			EvaluationInterval string `yaml:"evaluation_interval"`
+		} `yaml:"prometheus"`
+
+		Grafana struct {
+			Host     string `yaml:"host"`
+			Port     int    `yaml:"port"`
+			Username string `yaml:"username"`
+			Password string `yaml:"password"`
+		} `yaml:"grafana"`
+
+		Jaeger struct {
+			Host      string `yaml:"host"`
+			Port      int    `yaml:"port"`
+			GRPCPort  int    `yaml:"grpc_port"`
+			HTTPPort  int    `yaml:"http_port"`
+			AgentHost string `yaml:"agent_host"`
+			AgentPort int    `yaml:"agent_port"`
+		} `yaml:"jaeger"`
+
+		Logging struct {
+			Level  string `yaml:"level"`
+			Format string `yaml:"format"`
+			Output string `yaml:"output"`
+		} `yaml:"logging"`
+	} `yaml:"monitoring"`
+
+	Realtime struct {
+		WebSocket struct {
+			Host        string     `yaml:"host"`
+			Port        int        `yaml:"port"`
+			Path        string     `yaml:"path"`
+			CORSOrigins stringList `yaml:"cors_origins"`
+			SSL         bool       `yaml:"ssl,omitempty"`
+			Transports  []string   `yaml:"transports"`
+		} `yaml:"websocket"`
+	} `yaml:"realtime"`
+
+	Security struct {
+		JWT struct {
+			Secret             string `yaml:"secret"`
+			AccessTokenExpiry  int    `yaml:"access_token_expiry"`
+			RefreshTokenExpiry int    `yaml:"refresh_token_expiry"`
+			Algorithm          string `yaml:"algorithm"`
+		} `yaml:"jwt"`
+
+		CORS struct {
+			AllowedOrigins   stringList `yaml:"allowed_origins"`
+			AllowedMethods   []string   `yaml:"allowed_methods"`
+			AllowedHeaders   []string   `yaml:"allowed_headers"`
+			AllowCredentials bool       `yaml:"allow_credentials"`
+		} `yaml:"cors"`
+
+		RateLimiting struct {
+			Enabled           bool `yaml:"enabled"`
+			RequestsPerMinute int  `yaml:"requests_per_minute"`
+			BurstSize         int  `yaml:"burst_size"`
+		} `yaml:"rate_limiting"`
+
+		Encryption struct {
+			Key       string `yaml:"key,omitempty"`
+			Algorithm string `yaml:"algorithm,omitempty"`
+		} `yaml:"encryption,omitempty"`
+	} `yaml:"security"`
+
+	Services map[string]struct {
+		Host           string `yaml:"host"`
+		HTTPPort       int    `yaml:"http_port,omitempty"`
+		GRPCPort       int    `yaml:"grpc_port,omitempty"`
+		Port           int    `yaml:"port,omitempty"`
+		HealthEndpoint string `yaml:"health_endpoint,omitempty"`
+	} `yaml:"services"`
+
+	External struct {
+		Email struct {
+			Provider     string `yaml:"provider"`
+			SMTPHost     string `yaml:"smtp_host"`
+			SMTPPort     int    `yaml:"smtp_port"`
+			SMTPUsername string `yaml:"smtp_username"`
+			SMTPPassword string `yaml:"smtp_password"`
+			FromAddress  string `yaml:"from_address"`
+			UseTLS       bool   `yaml:"use_tls,omitempty"`
+		} `yaml:"email"`
+
+		Storage struct {
+			Provider    string `yaml:"provider"`
+			LocalPath   string `yaml:"local_path,omitempty"`
+			S3Bucket    string `yaml:"s3_bucket,omitempty"`
+			S3Region    string `yaml:"s3_region,omitempty"`
+			S3AccessKey string `yaml:"s3_access_key,omitempty"`
+			S3SecretKey string `yaml:"s3_secret_key,omitempty"`
+		} `yaml:"storage"`
+
+		AI struct {
+			OpenAI struct {
+				APIKey    string `yaml:"api_key"`
+				Model     string `yaml:"model"`
+				MaxTokens int    `yaml:"max_tokens"`
+			} `yaml:"openai"`
+		} `yaml:"ai"`
+
+		Payment struct {
+			Stripe struct {
+				PublishableKey string `yaml:"publishable_key"`
+				SecretKey      string `yaml:"secret_key"`
+				WebhookSecret  string `yaml:"webhook_secret"`
+			} `yaml:"stripe"`
+		} `yaml:"payment"`
+	} `yaml:"external"`
+
+	FeatureFlags map[string]bool `yaml:"feature_flags"`
+}
+
+// postgresRole is a module login role; the username defaults to
+// <database>_<role> as in the loader
+type postgresRole struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// stringList is a list that may also be written as a comma-separated
+// string, as staging does with ${KAFKA_BROKERS}
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*l = nil
+		for _, item := range strings.Split(value.Value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*l = append(*l, item)
+			}
+		}
+		return nil
+	}
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// TemplateData is the dot of templates and partials
+type TemplateData struct {
+	Module      string
+	Environment string
+	Timestamp   string
+	Config      Config
+	Service     *ResolvedModule
+}
+
+// expandNode expands the environment references of every scalar in a parsed
+// YAML document, so that substituted values are never read as YAML: a # in
+// a password does not start a comment. Plain scalars that changed lose
+// their tag and resolve again, so ${PORT:5432} still decodes into an int.
+func expandNode(n *yaml.Node, lookup func(string) (string, bool)) {
+	if n.Kind == yaml.ScalarNode {
+		if value := expandEnv(n.Value, lookup); value != n.Value {
+			n.Value = value
+			if n.Style == 0 {
+				n.Tag = ""
+			}
+		}
+	}
+	for _, child := range n.Content {
+		expandNode(child, lookup)
+	}
+}
+
+// expandEnv substitutes $VAR and ${VAR}, and also ${VAR:default} and
+// ${VAR:-default}, which fall back to default when VAR is unset or empty
+func expandEnv(s string, lookup func(string) (string, bool)) string {
+	return os.Expand(s, func(name string) string {
+		name, def, hasDefault := strings.Cut(name, ":")
+		value, _ := lookup(name)
+		if value == "" && hasDefault {
+			return strings.TrimPrefix(def, "-")
+		}
+		return value
+	})
+}
@@ -0,0 +1,145 @@
+package envgen
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 3
+
+// diffOp is one line of an edit script: ' ' kept, '-' removed, '+' added
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// UnifiedDiff returns the changes from a to b in unified diff format
+func UnifiedDiff(aName, bName string, a, b []byte) string {
+	ops := diffLines(splitLines(string(a)), splitLines(string(b)))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+	for _, hunk := range diffHunks(ops) {
+		from, to := hunk[0], hunk[1]
+		aStart, bStart := lineNumbers(ops, from)
+		aCount, bCount := 0, 0
+		for _, op := range ops[from:to] {
+			if op.kind != '+' {
+				aCount++
+			}
+			if op.kind != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+		for _, op := range ops[from:to] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.line)
+			out.WriteByte('\n')
+		}
+	}
+	return out.String()
+}
+
+// diffHunks groups the changes of ops into [from, to) ranges with
+// diffContext unchanged lines around them. Changes closer than twice the
+// context share a hunk.
+func diffHunks(ops []diffOp) [][2]int {
+	var hunks [][2]int
+	for i, op := range ops {
+		if op.kind == ' ' {
+			continue
+		}
+		from, to := i-diffContext, i+1+diffContext
+		if from < 0 {
+			from = 0
+		}
+		if to > len(ops) {
+			to = len(ops)
+		}
+		if n := len(hunks); n > 0 && from <= hunks[n-1][1] {
+			hunks[n-1][1] = to
+			continue
+		}
+		hunks = append(hunks, [2]int{from, to})
+	}
+	return hunks
+}
+
+// lineNumbers returns the 1-based line numbers in a and b of ops[i]
+func lineNumbers(ops []diffOp, i int) (int, int) {
+	a, b := 1, 1
+	for _, op := range ops[:i] {
+		if op.kind != '+' {
+			a++
+		}
+		if op.kind != '-' {
+			b++
+		}
+	}
+	return a, b
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines computes a shortest edit script from a longest common
+// subsequence. Generated files are a few hundred lines, so the quadratic
+// table is cheap.
+func diffLines(a, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = lcs[i+1][j]
+				if lcs[i][j+1] > lcs[i][j] {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
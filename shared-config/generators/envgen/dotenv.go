@@ -0,0 +1,217 @@
+package envgen
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DotenvDialect is the dotenv parser a generated file is written for. They
+// agree on plain KEY=value lines but differ on quotes, escapes and variable
+// interpolation.
+type DotenvDialect string
+
+const (
+	// DialectGodotenv is github.com/joho/godotenv: single quotes are
+	// literal; double quotes understand \n, \r and \<char>; double quoted
+	// and unquoted values interpolate $VAR and ${VAR} unless the $ is escaped
+	DialectGodotenv DotenvDialect = "godotenv"
+	// DialectCompose is a docker compose env_file, parsed like godotenv
+	DialectCompose DotenvDialect = "compose"
+	// DialectPython is python-dotenv: single quotes only understand \\ and
+	// \'; double quotes understand the C escapes. Every value, single quoted
+	// ones included, interpolates ${VAR}, which cannot be escaped.
+	DialectPython DotenvDialect = "python"
+)
+
+// DotenvDialects lists the supported dialects
+var DotenvDialects = []DotenvDialect{DialectGodotenv, DialectCompose, DialectPython}
+
+// ParseDotenvDialect validates a dialect name; empty means godotenv
+func ParseDotenvDialect(name string) (DotenvDialect, error) {
+	if name == "" {
+		return DialectGodotenv, nil
+	}
+	for _, d := range DotenvDialects {
+		if string(d) == name {
+			return d, nil
+		}
+	}
+	return "", fmt.Errorf("unknown dotenv dialect %q; available dialects: godotenv, compose, python", name)
+}
+
+// dotenvSafe reports whether s reads the same unquoted in every dialect
+func dotenvSafe(s string) bool {
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("_-.,/:@%+=?&~", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Quote returns s as a dotenv value that the dialect reads back unchanged.
+// Some values have no such form; the writers reject them by parsing the
+// output back with checkRoundTrip.
+func (d DotenvDialect) Quote(s string) string {
+	if dotenvSafe(s) {
+		return s
+	}
+	if strings.HasSuffix(s, `\`) && dotenvSafe(strings.ReplaceAll(s, `\`, "")) {
+		// A quote after a backslash never closes a value in any dialect, so
+		// a trailing backslash can only be written unquoted
+		return s
+	}
+	if d == DialectPython {
+		// Only double quotes understand \n; ${VAR} is interpolated in every
+		// form, so a value holding one does not read back
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`).Replace(s) + `"`
+	}
+	if !strings.ContainsAny(s, "'\n\r") {
+		return "'" + s + "'"
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "\n", `\n`, "\r", `\r`).Replace(s) + `"`
+}
+
+// Parse reads a dotenv file the way the dialect does and returns its
+// variables in order. Variables referenced by interpolation are taken as
+// unset, so that a value the writer failed to protect does not read back.
+func (d DotenvDialect) Parse(data []byte) ([]EnvEntry, error) {
+	var entries []EnvEntry
+	rest := string(data)
+	for line := 1; rest != ""; line++ {
+		text, next, _ := strings.Cut(rest, "\n")
+		rest = next
+		// Only the left is trimmed: a quoted value may end in whitespace
+		trimmed := strings.TrimLeft(text, " \t")
+		if strings.TrimSpace(trimmed) == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(trimmed, "export "), "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected KEY=value, got %q", line, text)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimLeft(value, " \t")
+
+		if value == "" || (value[0] != '\'' && value[0] != '"') {
+			if loc := inlineComment.FindStringIndex(value); loc != nil {
+				value = value[:loc[0]]
+			}
+			entries = append(entries, EnvEntry{Key: key, Value: d.decode(strings.TrimSpace(value), 0)})
+			continue
+		}
+
+		// Quoted values may span lines
+		quote := value[0]
+		body := value[1:]
+		if rest != "" || strings.HasSuffix(string(data), "\n") {
+			body += "\n" + rest
+		}
+		end := closingQuote(body, quote)
+		if end < 0 {
+			return nil, fmt.Errorf("line %d: unterminated %c quote in %s", line, quote, key)
+		}
+		raw := body[:end]
+		after, remaining, _ := strings.Cut(body[end+1:], "\n")
+		if after = strings.TrimSpace(after); after != "" && !strings.HasPrefix(after, "#") {
+			return nil, fmt.Errorf("line %d: unexpected %q after the value of %s", line, after, key)
+		}
+		line += strings.Count(raw, "\n")
+		rest = remaining
+		entries = append(entries, EnvEntry{Key: key, Value: d.decode(raw, quote)})
+	}
+	return entries, nil
+}
+
+// closingQuote returns the index in body of the quote ending a value. Every
+// dialect skips a quote preceded by a backslash, even an escaped one.
+func closingQuote(body string, quote byte) int {
+	for i := 0; i < len(body); i++ {
+		if body[i] == quote && (i == 0 || body[i-1] != '\\') {
+			return i
+		}
+	}
+	return -1
+}
+
+// The expressions the parsers themselves use, from godotenv's parser.go and
+// python-dotenv's parser.py and variables.py
+var (
+	inlineComment      = regexp.MustCompile(`\s#`)
+	godotenvEscape     = regexp.MustCompile(`\\.`)
+	godotenvUnescape   = regexp.MustCompile(`\\([^$])`)
+	godotenvVariable   = regexp.MustCompile(`(\\)?(\$)(\()?\{?([A-Z0-9_]+)?\}?`)
+	pythonSingleEscape = regexp.MustCompile(`\\[\\']`)
+	pythonDoubleEscape = regexp.MustCompile(`\\[\\'"abfnrtv]`)
+	pythonVariable     = regexp.MustCompile(`\$\{([^}:]*)(?::-([^}]*))?\}`)
+)
+
+var pythonEscapes = map[string]string{
+	`\\`: `\`, `\'`: "'", `\"`: `"`, `\a`: "\a", `\b`: "\b", `\f`: "\f", `\n`: "\n", `\r`: "\r", `\t`: "\t", `\v`: "\v",
+}
+
+// decode returns the value of the raw text between the quotes, or of an
+// unquoted value when quote is 0
+func (d DotenvDialect) decode(raw string, quote byte) string {
+	if d == DialectPython {
+		switch quote {
+		case '\'':
+			raw = pythonSingleEscape.ReplaceAllStringFunc(raw, func(m string) string { return pythonEscapes[m] })
+		case '"':
+			raw = pythonDoubleEscape.ReplaceAllStringFunc(raw, func(m string) string { return pythonEscapes[m] })
+		}
+		// Every form is interpolated and ${VAR} cannot be escaped
+		return pythonVariable.ReplaceAllString(raw, "$2")
+	}
+
+	// godotenv trims every trailing quote, escaped or not
+	raw = strings.TrimRight(raw, string(quote))
+	switch quote {
+	case '\'':
+		return raw
+	case '"':
+		raw = godotenvEscape.ReplaceAllStringFunc(raw, func(m string) string {
+			switch m {
+			case `\n`:
+				return "\n"
+			case `\r`:
+				return "\r"
+			}
+			return m
+		})
+		raw = godotenvUnescape.ReplaceAllString(raw, "$1")
+	}
+	return godotenvVariable.ReplaceAllStringFunc(raw, func(m string) string {
+		match := godotenvVariable.FindStringSubmatch(m)
+		switch {
+		case match[1] == `\` || match[2] == "(":
+			return m[1:]
+		case match[4] != "":
+			return ""
+		}
+		return m
+	})
+}
+
+// checkRoundTrip parses data back with the dialect and fails when a
+// variable does not read back as entries has it
+func checkRoundTrip(d DotenvDialect, data []byte, entries []EnvEntry) error {
+	parsed, err := d.Parse(data)
+	if err != nil {
+		return fmt.Errorf("error parsing generated %s dotenv: %w", d, err)
+	}
+	got := map[string]string{}
+	for _, e := range parsed {
+		got[e.Key] = e.Value
+	}
+	for _, e := range entries {
+		if value, ok := got[e.Key]; !ok || value != e.Value {
+			return fmt.Errorf("%s does not read back from the generated %s dotenv: got %q, want %q", e.Key, d, value, e.Value)
+		}
+	}
+	return nil
+}
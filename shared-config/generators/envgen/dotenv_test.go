@@ -0,0 +1,154 @@
+package envgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/joho/godotenv"
+)
+
+// dotenvValues covers what Quote has to protect: whitespace, both quotes,
+// line breaks, backslashes (trailing ones especially), $ and ${VAR}
+var dotenvValues = []string{
+	"plain",
+	"",
+	"has space",
+	"  padded  ",
+	"it's",
+	`say "hi"`,
+	`"double" and 'single'`,
+	`'single' and "double"`,
+	"line1\nline2",
+	"cr\rx",
+	"tab\tx",
+	`back\slash`,
+	`two\\backslashes`,
+	`literal\n`,
+	`end\`,
+	`C:\dir\`,
+	`a b\`,
+	`quote"\`,
+	`\"`,
+	`$HOME`,
+	`$home`,
+	`${HOME}`,
+	`${HOME:-fallback}`,
+	`\$HOME`,
+	`price $5`,
+	"#hash",
+	"a #comment",
+	"a\t#comment",
+}
+
+// unrepresentable lists the values a dialect has no way to write
+var unrepresentable = map[DotenvDialect][]string{
+	DialectGodotenv: {`'single' and "double"`, `a b\`, `quote"\`},
+	DialectCompose:  {`'single' and "double"`, `a b\`, `quote"\`},
+	DialectPython:   {`a b\`, `quote"\`, `${HOME}`, `${HOME:-fallback}`},
+}
+
+// quoteAll writes every value as V<i> and reports whether it read back. A
+// quoted line follows, as in a generated file, so that a value whose closing
+// quote is missed runs into it.
+func quoteAll(d DotenvDialect) (docs []string, ok []bool) {
+	for i, value := range dotenvValues {
+		doc := fmt.Sprintf("V%d=%s\nNEXT=\"next\"\n", i, d.Quote(value))
+		docs = append(docs, doc)
+		ok = append(ok, checkRoundTrip(d, []byte(doc), []EnvEntry{{Key: fmt.Sprintf("V%d", i), Value: value}}) == nil)
+	}
+	return docs, ok
+}
+
+func TestQuoteRoundTrips(t *testing.T) {
+	for _, d := range DotenvDialects {
+		rejected := map[string]bool{}
+		for _, value := range unrepresentable[d] {
+			rejected[value] = true
+		}
+		_, ok := quoteAll(d)
+		for i, value := range dotenvValues {
+			if ok[i] == rejected[value] {
+				t.Errorf("%s: %q reads back = %v, want %v", d, value, ok[i], !rejected[value])
+			}
+		}
+	}
+}
+
+func TestQuoteTrailingBackslashIsUnquoted(t *testing.T) {
+	for _, d := range DotenvDialects {
+		if got := d.Quote(`C:\dir\`); got != `C:\dir\` {
+			t.Errorf("%s: Quote(C:\\dir\\) = %s, want it unquoted", d, got)
+		}
+	}
+}
+
+func TestWriteRejectsUnrepresentableValue(t *testing.T) {
+	doc := &EnvDocument{Module: "auth", Environment: "testing", Dialect: DialectPython,
+		Entries: []EnvEntry{{Key: "TEMPLATE", Value: "${HOME}"}}}
+	if _, err := envWriters["dotenv"].Write(doc, "out"); err == nil {
+		t.Error("python dotenv with a ${VAR} value was written")
+	}
+}
+
+// TestParseMatchesGodotenv checks the godotenv model against the real parser
+func TestParseMatchesGodotenv(t *testing.T) {
+	docs, ok := quoteAll(DialectGodotenv)
+	for i, doc := range docs {
+		key := fmt.Sprintf("V%d", i)
+		got, err := godotenv.Unmarshal(doc)
+		if ok[i] && (err != nil || got[key] != dotenvValues[i]) {
+			t.Errorf("godotenv reads %q as %q (err %v), want %q", doc, got[key], err, dotenvValues[i])
+		}
+		if !ok[i] && err == nil && got[key] == dotenvValues[i] {
+			t.Errorf("godotenv reads %q back but Parse rejects it", doc)
+		}
+	}
+}
+
+// TestParseMatchesPythonDotenv checks the python model against python-dotenv.
+// It runs $PYTHON, or python3, and is skipped when the dotenv package is not
+// installed there.
+func TestParseMatchesPythonDotenv(t *testing.T) {
+	python := os.Getenv("PYTHON")
+	if python == "" {
+		python = "python3"
+	}
+	if err := exec.Command(python, "-c", "import dotenv").Run(); err != nil {
+		t.Skipf("python-dotenv is not available to %s: %v", python, err)
+	}
+
+	docs, ok := quoteAll(DialectPython)
+	input, err := json.Marshal(docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(python, "-c", `import io, json, sys
+from dotenv import dotenv_values
+print(json.dumps([dotenv_values(stream=io.StringIO(doc)) for doc in json.load(sys.stdin)]))`)
+	// Referenced variables are unset, as Parse takes them
+	cmd.Env = []string{}
+	cmd.Stdin = strings.NewReader(string(input))
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("python-dotenv: %v", err)
+	}
+	var parsed []map[string]*string
+	if err := json.Unmarshal(out, &parsed); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, doc := range docs {
+		got := parsed[i][fmt.Sprintf("V%d", i)]
+		readBack := got != nil && *got == dotenvValues[i]
+		if ok[i] && !readBack {
+			t.Errorf("python-dotenv reads %q as %v, want %q", doc, got, dotenvValues[i])
+		}
+		if !ok[i] && readBack {
+			t.Errorf("python-dotenv reads %q back but Parse rejects it", doc)
+		}
+	}
+}
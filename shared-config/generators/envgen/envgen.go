@@ -0,0 +1,375 @@
+// Package envgen renders the environment files of ERP suite modules from the
+// shared-config environments, the config.yaml module registry and the
+// templates directory. The generate-env command is a thin wrapper around
+// Generate.
+package envgen
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// DefaultTemplate is the template rendered when Options.Template is empty
+const DefaultTemplate = ".env.template"
+
+// Options configures Generate
+type Options struct {
+	// ConfigDir is the shared-config directory holding config.yaml,
+	// environments/ and templates/. Ignored when FS is set.
+	ConfigDir string
+	// FS replaces ConfigDir, e.g. with an embed.FS or fstest.MapFS
+	FS fs.FS
+	// TemplatesFS defaults to the templates directory of FS
+	TemplatesFS fs.FS
+	// Template defaults to DefaultTemplate
+	Template string
+
+	// Modules and Environments select the matrix to render; empty means
+	// every registered module and every environments/*.yaml
+	Modules      []string
+	Environments []string
+
+	// Format is a registered writer name; defaults to dotenv
+	Format string
+	// Dialect is the dotenv parser the dotenv format is quoted for, see
+	// DotenvDialects; defaults to godotenv
+	Dialect string
+	// Output names the file of a single module and environment; by default
+	// the writer's DefaultPath is used. Paths are relative to the Sink.
+	Output string
+	// Timestamp is written to the Generated at header; empty leaves it out
+	// so that output only changes with the config
+	Timestamp string
+	// Jobs is the number of cells rendered in parallel; defaults to the
+	// number of CPUs
+	Jobs int
+
+	// LookupEnv resolves ${VAR} references in environment configs; defaults
+	// to os.LookupEnv
+	LookupEnv func(string) (string, bool)
+	// Sink, when set, receives every generated file
+	Sink Sink
+}
+
+// GetFormat returns the output format
+// Default: dotenv
+func (o *Options) GetFormat() string {
+	if o.Format == "" {
+		return "dotenv"
+	}
+	return o.Format
+}
+
+// GetTemplate returns the template name
+// Default: .env.template
+func (o *Options) GetTemplate() string {
+	if o.Template == "" {
+		return DefaultTemplate
+	}
+	return o.Template
+}
+
+// GetJobs returns the number of parallel workers
+// Default: number of CPUs
+func (o *Options) GetJobs() int {
+	if o.Jobs <= 0 {
+		return runtime.NumCPU()
+	}
+	return o.Jobs
+}
+
+func (o *Options) configFS() (fs.FS, error) {
+	if o.FS != nil {
+		return o.FS, nil
+	}
+	if o.ConfigDir == "" {
+		return nil, errors.New("either ConfigDir or FS must be set")
+	}
+	return os.DirFS(o.ConfigDir), nil
+}
+
+func (o *Options) templatesFS(configFS fs.FS) (fs.FS, error) {
+	if o.TemplatesFS != nil {
+		return o.TemplatesFS, nil
+	}
+	return fs.Sub(configFS, "templates")
+}
+
+// Artifact is a generated file of one module and environment
+type Artifact struct {
+	Module      string
+	Environment string
+	// Secrets are the keys of the credentials in the environment of the
+	// module, whichever of its files they are written to
+	Secrets []string
+	Output
+}
+
+// Artifacts are the files produced by Generate, in environment then module
+// order
+type Artifacts []Artifact
+
+// Drift is a generated file that differs from the one on disk
+type Drift struct {
+	Path string
+	// Diff is a unified diff from the file on disk to the generated one
+	Diff string
+}
+
+// Check compares the artifacts with the files in fsys, typically
+// os.DirFS of the output directory, and returns the stale or missing ones
+func (a Artifacts) Check(fsys fs.FS) ([]Drift, error) {
+	var drifts []Drift
+	for _, artifact := range a {
+		current, err := fs.ReadFile(fsys, artifact.Path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			drifts = append(drifts, Drift{artifact.Path, UnifiedDiff("/dev/null", artifact.Path, nil, artifact.Data)})
+		case err != nil:
+			return nil, err
+		case !bytes.Equal(current, artifact.Data):
+			drifts = append(drifts, Drift{artifact.Path, UnifiedDiff(artifact.Path, artifact.Path+" (generated)", current, artifact.Data)})
+		}
+	}
+	return drifts, nil
+}
+
+// SecretExposure is a secret of an environment and the modules whose
+// generated files carry it
+type SecretExposure struct {
+	Environment string   `json:"environment"`
+	Key         string   `json:"key"`
+	Modules     []string `json:"modules"`
+}
+
+// SecretAudit reports which secrets reach which modules, sorted by
+// environment and key. A secret counts even when its value is empty: the
+// module is configured to receive it.
+func (a Artifacts) SecretAudit() []SecretExposure {
+	type secretKey struct{ environment, key string }
+	modules := map[secretKey][]string{}
+	for _, artifact := range a {
+		for _, key := range artifact.Secrets {
+			k := secretKey{artifact.Environment, key}
+			if !contains(modules[k], artifact.Module) {
+				modules[k] = append(modules[k], artifact.Module)
+			}
+		}
+	}
+	exposures := make([]SecretExposure, 0, len(modules))
+	for k, names := range modules {
+		sort.Strings(names)
+		exposures = append(exposures, SecretExposure{Environment: k.environment, Key: k.key, Modules: names})
+	}
+	sort.Slice(exposures, func(i, j int) bool {
+		if exposures[i].Environment != exposures[j].Environment {
+			return exposures[i].Environment < exposures[j].Environment
+		}
+		return exposures[i].Key < exposures[j].Key
+	})
+	return exposures
+}
+
+// WriteTo writes every artifact to sink; secret artifacts are written 0600
+func (a Artifacts) WriteTo(sink Sink) error {
+	for _, artifact := range a {
+		perm := fs.FileMode(0644)
+		if artifact.Secret {
+			perm = 0600
+		}
+		if err := sink.WriteFile(artifact.Path, artifact.Data, perm); err != nil {
+			return fmt.Errorf("error writing %s: %w", artifact.Path, err)
+		}
+	}
+	return nil
+}
+
+// Sink receives generated files
+type Sink interface {
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+}
+
+// DirSink writes files under a directory, creating directories as needed
+type DirSink string
+
+func (d DirSink) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	target := filepath.Join(string(d), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(target, data, perm)
+}
+
+// WriterSink writes the content of every file to W, one after the other
+type WriterSink struct {
+	W io.Writer
+}
+
+func (s WriterSink) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	_, err := s.W.Write(data)
+	return err
+}
+
+// CellError is the failure to generate one module and environment
+type CellError struct {
+	Module      string
+	Environment string
+	Err         error
+}
+
+func (e *CellError) Error() string {
+	return fmt.Sprintf("%s/%s: %v", e.Module, e.Environment, e.Err)
+}
+
+func (e *CellError) Unwrap() error {
+	return e.Err
+}
+
+// Generate renders the selected modules in the selected environments in
+// parallel. Cells that fail are reported together as CellErrors joined into
+// the returned error; the artifacts of the other cells are still returned,
+// but nothing is written to the Sink unless every cell succeeded.
+func Generate(ctx context.Context, opts Options) (Artifacts, error) {
+	configFS, err := opts.configFS()
+	if err != nil {
+		return nil, err
+	}
+	templatesFS, err := opts.templatesFS(configFS)
+	if err != nil {
+		return nil, err
+	}
+
+	writer, ok := envWriters[opts.GetFormat()]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q; available formats: %s", opts.GetFormat(), strings.Join(Formats(), ", "))
+	}
+	dialect, err := ParseDotenvDialect(opts.Dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	registry, err := loadModuleRegistry(configFS, "config.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("error reading module registry: %w", err)
+	}
+
+	modules, environments := opts.Modules, opts.Environments
+	if len(modules) == 0 {
+		modules = registry.Names()
+	}
+	if len(environments) == 0 {
+		if environments, err = listEnvironments(configFS); err != nil {
+			return nil, fmt.Errorf("error listing environments: %w", err)
+		}
+	}
+	cells := matrixCells(modules, environments)
+	if len(cells) == 0 {
+		return nil, errors.New("no environments to generate")
+	}
+	if len(cells) > 1 && opts.Output != "" {
+		return nil, errors.New("a single module and environment is needed when Output is set")
+	}
+
+	lookupEnv := opts.LookupEnv
+	if lookupEnv == nil {
+		lookupEnv = os.LookupEnv
+	}
+	g := &generator{
+		configFS:     configFS,
+		templatesFS:  templatesFS,
+		templateName: opts.GetTemplate(),
+		writer:       writer,
+		dialect:      dialect,
+		registry:     registry,
+		lookupEnv:    lookupEnv,
+		timestamp:    opts.Timestamp,
+	}
+	if err := g.loadConfigs(environments); err != nil {
+		return nil, err
+	}
+
+	outputPath := func(cell matrixCell) string {
+		if opts.Output != "" {
+			return opts.Output
+		}
+		return writer.DefaultPath(cell.Module, cell.Environment)
+	}
+
+	var artifacts Artifacts
+	var errs []error
+	for _, result := range g.renderMatrix(ctx, cells, outputPath, opts.GetJobs()) {
+		if result.Err != nil {
+			errs = append(errs, &CellError{Module: result.Cell.Module, Environment: result.Cell.Environment, Err: result.Err})
+			continue
+		}
+		var secrets []string
+		for _, e := range result.Doc.Secrets() {
+			secrets = append(secrets, e.Key)
+		}
+		for _, out := range result.Outputs {
+			artifacts = append(artifacts, Artifact{Module: result.Cell.Module, Environment: result.Cell.Environment, Secrets: secrets, Output: out})
+		}
+	}
+	if len(errs) > 0 {
+		return artifacts, errors.Join(errs...)
+	}
+
+	if opts.Sink != nil {
+		if err := artifacts.WriteTo(opts.Sink); err != nil {
+			return artifacts, err
+		}
+	}
+	return artifacts, nil
+}
+
+// Lint checks the templates of opts, see LintTemplates
+func Lint(opts Options) ([]TemplateProblem, error) {
+	configFS, err := opts.configFS()
+	if err != nil {
+		return nil, err
+	}
+	templatesFS, err := opts.templatesFS(configFS)
+	if err != nil {
+		return nil, err
+	}
+	return LintTemplates(templatesFS)
+}
+
+// FindConfigDir returns the shared-config directory for start: start itself
+// or one of its parents when it holds config.yaml and environments/, or
+// their shared-config subdirectory
+func FindConfigDir(start string) (string, error) {
+	dir, err := filepath.Abs(start)
+	if err != nil {
+		return "", err
+	}
+	for {
+		for _, candidate := range []string{dir, filepath.Join(dir, "shared-config")} {
+			if isConfigDir(candidate) {
+				return candidate, nil
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("no shared-config directory found above %s", start)
+		}
+		dir = parent
+	}
+}
+
+func isConfigDir(dir string) bool {
+	if _, err := os.Stat(filepath.Join(dir, "config.yaml")); err != nil {
+		return false
+	}
+	info, err := os.Stat(filepath.Join(dir, "environments"))
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,358 @@
+package envgen
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+type memFile struct {
+	data []byte
+	perm fs.FileMode
+}
+
+// memSink keeps generated files in memory
+type memSink map[string]memFile
+
+func (s memSink) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	s[name] = memFile{data: data, perm: perm}
+	return nil
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// testConfigDir writes a small shared-config directory with two modules
+// and two environments to a temporary directory
+func testConfigDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"config.yaml": `
+modules:
+  - name: billing
+    type: backend
+    database: postgresql
+    dependencies: [postgresql]
+  - name: web
+    type: frontend
+    dependencies: [billing]
+    ports:
+      http: 3000
+`,
+		"environments/testing.yaml": `
+databases:
+  postgresql:
+    host: ${DB_HOST:localhost}
+    databases:
+      billing: erp_billing_test
+    roles:
+      billing:
+        app:
+          password: ${BILLING_DB_PASSWORD}
+services:
+  billing:
+    host: billing.test
+    http_port: 8200
+`,
+		"environments/staging.yaml": `
+databases:
+  postgresql:
+    host: db.staging
+    databases:
+      billing: erp_billing_staging
+`,
+		"templates/.env.template": "MODULE={{.Module}}\n{{template \"database\" .}}\n",
+		"templates/partials/database.tmpl": `
+{{- if .Service.PostgresDatabase}}
+DB_HOST={{.Config.Databases.PostgreSQL.Host}}
+DB_NAME={{.Service.PostgresDatabase}}
+DB_PASSWORD={{.Service.PostgresPassword}}
+{{- end}}
+{{- range $dep, $url := .Service.ServiceURLs}}
+{{$dep | upper}}_SERVICE_URL={{$url}}
+{{- end}}`,
+	})
+	return dir
+}
+
+func lookup(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+func TestGenerateToSink(t *testing.T) {
+	sink := memSink{}
+	artifacts, err := Generate(context.Background(), Options{
+		ConfigDir:    testConfigDir(t),
+		Environments: []string{"testing"},
+		LookupEnv:    lookup(map[string]string{"BILLING_DB_PASSWORD": "s3cret"}),
+		Sink:         sink,
+	})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	var paths []string
+	for _, a := range artifacts {
+		paths = append(paths, a.Module+" "+a.Environment+" "+a.Path)
+	}
+	if want := []string{"billing testing .env.billing.testing", "web testing .env.web.testing"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("artifacts = %v, want %v", paths, want)
+	}
+	if !reflect.DeepEqual(artifacts[0].Secrets, []string{"DB_PASSWORD"}) || artifacts[1].Secrets != nil {
+		t.Errorf("secrets = %v, %v", artifacts[0].Secrets, artifacts[1].Secrets)
+	}
+
+	billing := sink[".env.billing.testing"]
+	for _, want := range []string{"MODULE=billing\n", "DB_HOST=localhost\n", "DB_NAME=erp_billing_test\n", "DB_PASSWORD=s3cret\n"} {
+		if !strings.Contains(string(billing.data), want) {
+			t.Errorf("billing output is missing %q:\n%s", want, billing.data)
+		}
+	}
+	if billing.perm != 0600 {
+		t.Errorf("billing output with a password written %v, want 0600", billing.perm)
+	}
+	web := sink[".env.web.testing"]
+	if !strings.Contains(string(web.data), "BILLING_SERVICE_URL=http://billing.test:8200\n") || strings.Contains(string(web.data), "DB_") {
+		t.Errorf("web output:\n%s", web.data)
+	}
+	if web.perm != 0644 {
+		t.Errorf("web output written %v, want 0644", web.perm)
+	}
+}
+
+func TestGenerateWritesNothingWhenACellFails(t *testing.T) {
+	dir := testConfigDir(t)
+	writeFiles(t, dir, map[string]string{"environments/staging.yaml": "databases: {}\n"})
+	sink := memSink{}
+	artifacts, err := Generate(context.Background(), Options{ConfigDir: dir, LookupEnv: noEnv, Sink: sink})
+
+	var cellErr *CellError
+	if !errors.As(err, &cellErr) || cellErr.Module != "billing" || cellErr.Environment != "staging" {
+		t.Fatalf("err = %v, want a billing/staging CellError", err)
+	}
+	if len(artifacts) != 3 {
+		t.Errorf("got %d artifacts, want the 3 cells that succeeded", len(artifacts))
+	}
+	if len(sink) != 0 {
+		t.Errorf("files were written despite a failed cell: %v", sink)
+	}
+}
+
+func TestGenerateOptions(t *testing.T) {
+	dir := testConfigDir(t)
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{"no config", Options{}, "either ConfigDir or FS must be set"},
+		{"unknown format", Options{ConfigDir: dir, Format: "ini"}, `unknown format "ini"`},
+		{"unknown dialect", Options{ConfigDir: dir, Dialect: "bash"}, "bash"},
+		{"output for several cells", Options{ConfigDir: dir, Output: "out.env"}, "a single module and environment is needed"},
+		{"missing environment", Options{ConfigDir: dir, Environments: []string{"production"}}, "environments/production.yaml"},
+		{"missing template", Options{ConfigDir: dir, Template: "docker.template"}, "template docker.template not found"},
+	}
+	for _, tt := range tests {
+		tt.opts.LookupEnv = noEnv
+		if _, err := Generate(context.Background(), tt.opts); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestGenerateTemplatesFSAndOutput(t *testing.T) {
+	templates := fstest.MapFS{
+		"custom.template": {Data: []byte("# {{.Module}} in {{.Environment}}\nNAME={{.Service.PostgresDatabase}}\n")},
+	}
+	var out bytes.Buffer
+	artifacts, err := Generate(context.Background(), Options{
+		ConfigDir:    testConfigDir(t),
+		TemplatesFS:  templates,
+		Template:     "custom.template",
+		Modules:      []string{"billing"},
+		Environments: []string{"staging"},
+		Format:       "json",
+		Output:       "billing.json",
+		LookupEnv:    noEnv,
+		Sink:         WriterSink{W: &out},
+	})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if len(artifacts) != 1 || artifacts[0].Path != "billing.json" {
+		t.Fatalf("artifacts = %+v", artifacts)
+	}
+	if !strings.Contains(out.String(), `"NAME": "erp_billing_staging"`) {
+		t.Errorf("output:\n%s", out.String())
+	}
+}
+
+func TestArtifactsCheck(t *testing.T) {
+	artifacts, err := Generate(context.Background(), Options{ConfigDir: testConfigDir(t), Environments: []string{"staging"}, LookupEnv: noEnv})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	onDisk := fstest.MapFS{
+		".env.billing.staging": {Data: artifacts[0].Data},
+		".env.web.staging":     {Data: []byte("MODULE=web\nBILLING_SERVICE_URL=http://localhost:8200\n")},
+	}
+	drifts, err := artifacts.Check(onDisk)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if len(drifts) != 1 || drifts[0].Path != ".env.web.staging" || !strings.Contains(drifts[0].Diff, "+BILLING_SERVICE_URL=http://billing:") {
+		t.Errorf("drifts = %+v", drifts)
+	}
+}
+
+func TestFindConfigDir(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"shared-config/config.yaml":               "modules: []\n",
+		"shared-config/environments/testing.yaml": "{}\n",
+		"services/crm/main.go":                    "package main\n",
+	})
+	want := filepath.Join(root, "shared-config")
+	for _, start := range []string{root, filepath.Join(root, "services", "crm"), want} {
+		if got, err := FindConfigDir(start); err != nil || got != want {
+			t.Errorf("FindConfigDir(%s) = %s, %v, want %s", start, got, err, want)
+		}
+	}
+	if _, err := FindConfigDir(t.TempDir()); err == nil {
+		t.Error("FindConfigDir found a config directory in an empty tree")
+	}
+}
+
+func TestGenerateShippedConfig(t *testing.T) {
+	sink := memSink{}
+	artifacts, err := Generate(context.Background(), Options{ConfigDir: "../..", Environments: []string{"testing"}, LookupEnv: noEnv, Sink: sink})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	registry, err := loadModuleRegistry(os.DirFS("../.."), "config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(artifacts) != len(registry.Modules) || len(sink) != len(registry.Modules) {
+		t.Errorf("got %d artifacts and %d files for %d modules", len(artifacts), len(sink), len(registry.Modules))
+	}
+}
+
+// stagingSecrets sets every credential of the shipped staging config, so
+// that an empty value cannot hide a leak
+var stagingSecrets = map[string]string{
+	"KAFKA_USERNAME":         "kafka-user",
+	"KAFKA_PASSWORD":         "kafka-pass",
+	"GRAFANA_PASSWORD":       "grafana-pass",
+	"OPENAI_API_KEY":         "sk-openai",
+	"STRIPE_PUBLISHABLE_KEY": "pk_stripe",
+	"STRIPE_SECRET_KEY":      "sk_stripe",
+	"STRIPE_WEBHOOK_SECRET":  "whsec_stripe",
+}
+
+func TestGenerateFiltersSectionsByDependencies(t *testing.T) {
+	artifacts, err := Generate(context.Background(), Options{ConfigDir: "../..", Environments: []string{"staging"}, LookupEnv: lookup(stagingSecrets)})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	keys := map[string][]string{}
+	for _, a := range artifacts {
+		entries, err := DialectGodotenv.Parse(a.Data)
+		if err != nil {
+			t.Fatalf("%s: %v", a.Path, err)
+		}
+		for _, e := range entries {
+			keys[a.Module] = append(keys[a.Module], e.Key)
+		}
+	}
+	hasPrefix := func(module string, prefixes ...string) []string {
+		var found []string
+		for _, key := range keys[module] {
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(key, prefix) {
+					found = append(found, key)
+				}
+			}
+		}
+		return found
+	}
+
+	if leaked := hasPrefix("inventory", "STRIPE_", "OPENAI_", "GRAFANA_", "KAFKA_SASL_USERNAME", "KAFKA_SASL_PASSWORD", "MONGODB_", "QDRANT_"); leaked != nil {
+		t.Errorf("inventory gets %v", leaked)
+	}
+	if got := hasPrefix("inventory", "KAFKA_BROKERS", "DB_NAME", "ELASTICSEARCH_"); len(got) < 3 {
+		t.Errorf("inventory is missing the sections of its dependencies, got %v", got)
+	}
+	if leaked := hasPrefix("frontend", "KAFKA_", "DB_", "REDIS_", "STRIPE_"); leaked != nil {
+		t.Errorf("frontend gets %v", leaked)
+	}
+	if got := hasPrefix("notification", "KAFKA_SASL_PASSWORD", "MONGODB_"); len(got) < 2 {
+		t.Errorf("notification is missing kafka_sasl or its database, got %v", got)
+	}
+}
+
+func TestSecretAuditOfShippedModules(t *testing.T) {
+	artifacts, err := Generate(context.Background(), Options{ConfigDir: "../..", Environments: []string{"staging"}, LookupEnv: lookup(stagingSecrets)})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	audit := map[string][]string{}
+	for _, exposure := range artifacts.SecretAudit() {
+		if exposure.Environment != "staging" {
+			t.Errorf("exposure of %s in %s", exposure.Key, exposure.Environment)
+		}
+		audit[exposure.Key] = exposure.Modules
+	}
+	want := map[string][]string{
+		"STRIPE_SECRET_KEY":     {"finance"},
+		"STRIPE_WEBHOOK_SECRET": {"finance"},
+		"OPENAI_API_KEY":        {"ai"},
+		"GRAFANA_PASSWORD":      {"admin"},
+		"KAFKA_SASL_PASSWORD":   {"ai", "auth", "notification"},
+	}
+	for key, modules := range want {
+		if !reflect.DeepEqual(audit[key], modules) {
+			t.Errorf("%s reaches %v, want %v", key, audit[key], modules)
+		}
+	}
+}
+
+func TestSecretAudit(t *testing.T) {
+	artifacts := Artifacts{
+		{Module: "crm", Environment: "staging", Secrets: []string{"DB_PASSWORD", "JWT_SECRET"}, Output: Output{Path: "crm.env"}},
+		// a writer with two files reports the secrets of the module twice
+		{Module: "crm", Environment: "staging", Secrets: []string{"DB_PASSWORD", "JWT_SECRET"}, Output: Output{Path: "crm.env.secrets"}},
+		{Module: "auth", Environment: "staging", Secrets: []string{"JWT_SECRET"}, Output: Output{Path: "auth.env"}},
+		{Module: "auth", Environment: "production", Secrets: []string{"JWT_SECRET"}, Output: Output{Path: "auth.env"}},
+		{Module: "frontend", Environment: "staging", Output: Output{Path: "frontend.env"}},
+	}
+	want := []SecretExposure{
+		{Environment: "production", Key: "JWT_SECRET", Modules: []string{"auth"}},
+		{Environment: "staging", Key: "DB_PASSWORD", Modules: []string{"crm"}},
+		{Environment: "staging", Key: "JWT_SECRET", Modules: []string{"auth", "crm"}},
+	}
+	if got := artifacts.SecretAudit(); !reflect.DeepEqual(got, want) {
+		t.Errorf("SecretAudit() =\n%+v\nwant\n%+v", got, want)
+	}
+}
@@ -0,0 +1,420 @@
+package envgen
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// EnvEntry is one resolved variable of the generated environment
+type EnvEntry struct {
+	Key     string
+	Value   string
+	Section string
+	Secret  bool
+}
+
+// EnvDocument is the resolved environment of a module, shared by all writers
+type EnvDocument struct {
+	Module      string
+	Environment string
+	Timestamp   string
+	// Dialect is the parser the dotenv writer quotes values for
+	Dialect DotenvDialect
+	// Lines is the layout of the rendered template, kept by the dotenv writer
+	Lines   []EnvLine
+	Entries []EnvEntry
+}
+
+// EnvLine is a line of the rendered template: a comment or blank line, or
+// the assignment of Entries[Entry]
+type EnvLine struct {
+	Text  string
+	Entry int
+}
+
+// Secrets returns the entries that must go to the secret-bearing output
+func (d *EnvDocument) Secrets() []EnvEntry {
+	var secrets []EnvEntry
+	for _, e := range d.Entries {
+		if e.Secret {
+			secrets = append(secrets, e)
+		}
+	}
+	return secrets
+}
+
+// Plain returns the entries that are safe to store in clear text
+func (d *EnvDocument) Plain() []EnvEntry {
+	var plain []EnvEntry
+	for _, e := range d.Entries {
+		if !e.Secret {
+			plain = append(plain, e)
+		}
+	}
+	return plain
+}
+
+// Output is a file produced by a writer. Secret outputs are written 0600.
+type Output struct {
+	Path   string
+	Secret bool
+	Data   []byte
+}
+
+// EnvWriter renders an EnvDocument in one output format
+type EnvWriter interface {
+	// DefaultPath returns the output path used when Options.Output is empty
+	DefaultPath(module, environment string) string
+	Write(doc *EnvDocument, path string) ([]Output, error)
+}
+
+var envWriters = map[string]EnvWriter{
+	"dotenv":  dotenvWriter{},
+	"json":    jsonWriter{},
+	"yaml":    yamlWriter{},
+	"systemd": systemdWriter{},
+	"k8s":     k8sWriter{},
+	"compose": composeWriter{},
+	"helm":    helmWriter{},
+}
+
+// RegisterEnvWriter adds or replaces the writer for a format
+func RegisterEnvWriter(format string, writer EnvWriter) {
+	envWriters[format] = writer
+}
+
+// Formats returns the registered output formats, sorted
+func Formats() []string {
+	formats := make([]string, 0, len(envWriters))
+	for format := range envWriters {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+var secretKeySuffixes = []string{"_PASSWORD", "_SECRET", "_SECRET_KEY", "_API_KEY", "_ACCESS_KEY", "_TOKEN", "ENCRYPTION_KEY"}
+
+// isSecret reports whether a variable holds a credential: by name, or
+// because it is a URL with a password in it
+func isSecret(key, value string) bool {
+	for _, suffix := range secretKeySuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		if password, ok := u.User.Password(); ok && password != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// unquoteEnvValue undoes the quoting of the quote template function. Single
+// quoted values are literal.
+func unquoteEnvValue(value string) string {
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		return value[1 : len(value)-1]
+	}
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+	var b strings.Builder
+	inner := value[1 : len(value)-1]
+	for i := 0; i < len(inner); i++ {
+		if inner[i] == '\\' && i+1 < len(inner) {
+			i++
+			if inner[i] == 'n' {
+				b.WriteByte('\n')
+				continue
+			}
+		}
+		b.WriteByte(inner[i])
+	}
+	return b.String()
+}
+
+// parseEnvDocument reads the rendered dotenv template back into entries. The
+// last comment line before a variable names its section, and values passed
+// through the secret template function are flagged as secrets.
+func parseEnvDocument(module, environment, timestamp string, rendered []byte) (*EnvDocument, error) {
+	doc := &EnvDocument{Module: module, Environment: environment, Timestamp: timestamp, Dialect: DialectGodotenv}
+	seen := map[string]int{}
+	section := ""
+
+	scanner := bufio.NewScanner(bytes.NewReader(rendered))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case text == "":
+			doc.Lines = append(doc.Lines, EnvLine{Entry: -1})
+			continue
+		case strings.HasPrefix(text, "#"):
+			if title := strings.TrimSpace(strings.TrimLeft(text, "#")); title != "" && !strings.HasPrefix(title, "=") {
+				section = title
+			}
+			doc.Lines = append(doc.Lines, EnvLine{Text: renderDecoder.Replace(strings.ReplaceAll(text, secretMarker, "")), Entry: -1})
+			continue
+		}
+
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected KEY=value, got %q", line, text)
+		}
+		marked := strings.Contains(value, secretMarker)
+		value = unquoteEnvValue(renderDecoder.Replace(strings.ReplaceAll(value, secretMarker, "")))
+		entry := EnvEntry{Key: key, Value: value, Section: section, Secret: marked || isSecret(key, value)}
+		// Later assignments win, as they do when the dotenv file is sourced
+		if i, ok := seen[key]; ok {
+			doc.Entries[i] = entry
+			doc.Lines = append(doc.Lines, EnvLine{Entry: i})
+			continue
+		}
+		seen[key] = len(doc.Entries)
+		doc.Lines = append(doc.Lines, EnvLine{Entry: len(doc.Entries)})
+		doc.Entries = append(doc.Entries, entry)
+	}
+	return doc, scanner.Err()
+}
+
+// header is the comment block at the top of every output. The Generated at
+// line is left out without a timestamp, so that output is deterministic.
+func header(doc *EnvDocument, comment string) string {
+	h := fmt.Sprintf("%s Generated for %s module\n%s Environment: %s\n", comment, doc.Module, comment, doc.Environment)
+	if doc.Timestamp != "" {
+		h += fmt.Sprintf("%s Generated at: %s\n", comment, doc.Timestamp)
+	}
+	return h
+}
+
+// jsonString quotes s as a JSON string, which is also a valid YAML
+// double-quoted scalar, so "true" and "8080" stay strings
+func jsonString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+func hasSecrets(entries []EnvEntry) bool {
+	for _, e := range entries {
+		if e.Secret {
+			return true
+		}
+	}
+	return false
+}
+
+type dotenvWriter struct{}
+
+func (dotenvWriter) DefaultPath(module, environment string) string {
+	return fmt.Sprintf(".env.%s.%s", module, environment)
+}
+
+// Write keeps the comments and layout of the template and quotes every value
+// for the dialect of doc. The file is parsed back before it is returned, so
+// that a value the dialect would read differently fails the generation.
+func (dotenvWriter) Write(doc *EnvDocument, path string) ([]Output, error) {
+	var buf bytes.Buffer
+	for _, line := range doc.Lines {
+		if line.Entry < 0 {
+			buf.WriteString(line.Text + "\n")
+			continue
+		}
+		e := doc.Entries[line.Entry]
+		fmt.Fprintf(&buf, "%s=%s\n", e.Key, doc.Dialect.Quote(e.Value))
+	}
+	if err := checkRoundTrip(doc.Dialect, buf.Bytes(), doc.Entries); err != nil {
+		return nil, err
+	}
+	return []Output{{Path: path, Secret: hasSecrets(doc.Entries), Data: buf.Bytes()}}, nil
+}
+
+type jsonWriter struct{}
+
+func (jsonWriter) DefaultPath(module, environment string) string {
+	return fmt.Sprintf("env.%s.%s.json", module, environment)
+}
+
+func (jsonWriter) Write(doc *EnvDocument, path string) ([]Output, error) {
+	var buf bytes.Buffer
+	buf.WriteString("{\n")
+	for i, e := range doc.Entries {
+		buf.WriteString("  " + jsonString(e.Key) + ": " + jsonString(e.Value))
+		if i < len(doc.Entries)-1 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("}\n")
+	return []Output{{Path: path, Secret: hasSecrets(doc.Entries), Data: buf.Bytes()}}, nil
+}
+
+// writeYAMLMap writes key: followed by entries as a mapping indented by
+// indent spaces, with a comment before each new section. An empty key writes
+// the entries at the top level.
+func writeYAMLMap(buf *bytes.Buffer, key string, entries []EnvEntry, indent int, quote func(string) string) {
+	if key != "" {
+		if len(entries) == 0 {
+			fmt.Fprintf(buf, "%s%s: {}\n", strings.Repeat(" ", indent-2), key)
+			return
+		}
+		fmt.Fprintf(buf, "%s%s:\n", strings.Repeat(" ", indent-2), key)
+	}
+	pad := strings.Repeat(" ", indent)
+	section := ""
+	for _, e := range groupBySection(entries) {
+		if e.Section != section {
+			section = e.Section
+			fmt.Fprintf(buf, "%s# %s\n", pad, section)
+		}
+		fmt.Fprintf(buf, "%s%s: %s\n", pad, e.Key, quote(e.Value))
+	}
+}
+
+// groupBySection orders entries by the first appearance of their section,
+// keeping their order within a section. A later assignment takes the section
+// of its own comment, so without grouping a section could be split in two.
+func groupBySection(entries []EnvEntry) []EnvEntry {
+	var sections []string
+	bySection := map[string][]EnvEntry{}
+	for _, e := range entries {
+		if _, ok := bySection[e.Section]; !ok {
+			sections = append(sections, e.Section)
+		}
+		bySection[e.Section] = append(bySection[e.Section], e)
+	}
+	grouped := make([]EnvEntry, 0, len(entries))
+	for _, section := range sections {
+		grouped = append(grouped, bySection[section]...)
+	}
+	return grouped
+}
+
+type yamlWriter struct{}
+
+func (yamlWriter) DefaultPath(module, environment string) string {
+	return fmt.Sprintf("env.%s.%s.yaml", module, environment)
+}
+
+func (yamlWriter) Write(doc *EnvDocument, path string) ([]Output, error) {
+	var buf bytes.Buffer
+	buf.WriteString(header(doc, "#"))
+	writeYAMLMap(&buf, "", doc.Entries, 0, jsonString)
+	return []Output{{Path: path, Secret: hasSecrets(doc.Entries), Data: buf.Bytes()}}, nil
+}
+
+// systemdQuote quotes a value for an EnvironmentFile. systemd does not
+// expand variables there, so only backslashes and quotes need escaping.
+func systemdQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func writeSystemd(doc *EnvDocument, entries []EnvEntry) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(header(doc, "#"))
+	for _, e := range entries {
+		fmt.Fprintf(&buf, "%s=%s\n", e.Key, systemdQuote(e.Value))
+	}
+	return buf.Bytes()
+}
+
+type systemdWriter struct{}
+
+func (systemdWriter) DefaultPath(module, environment string) string {
+	return fmt.Sprintf("%s-%s.env", module, environment)
+}
+
+// Write produces the plain EnvironmentFile and a .secrets companion; the
+// unit lists both with EnvironmentFile=
+func (systemdWriter) Write(doc *EnvDocument, path string) ([]Output, error) {
+	return []Output{
+		{Path: path, Data: writeSystemd(doc, doc.Plain())},
+		{Path: path + ".secrets", Secret: true, Data: writeSystemd(doc, doc.Secrets())},
+	}, nil
+}
+
+type k8sWriter struct{}
+
+func (k8sWriter) DefaultPath(module, environment string) string {
+	return fmt.Sprintf("%s-%s.k8s.yaml", module, environment)
+}
+
+// Write produces a ConfigMap with the plain values and a Secret with the
+// credentials in one multi-document manifest
+func (k8sWriter) Write(doc *EnvDocument, path string) ([]Output, error) {
+	var buf bytes.Buffer
+	buf.WriteString(header(doc, "#"))
+	metadata := func(kind, name string) {
+		fmt.Fprintf(&buf, "apiVersion: v1\nkind: %s\nmetadata:\n  name: %s\n  labels:\n", kind, name)
+		fmt.Fprintf(&buf, "    app.kubernetes.io/name: %s\n    app.kubernetes.io/part-of: erp-suite\n    environment: %s\n", doc.Module, doc.Environment)
+	}
+
+	metadata("ConfigMap", doc.Module+"-config")
+	writeYAMLMap(&buf, "data", doc.Plain(), 2, jsonString)
+
+	buf.WriteString("---\n")
+	metadata("Secret", doc.Module+"-secrets")
+	buf.WriteString("type: Opaque\n")
+	writeYAMLMap(&buf, "stringData", doc.Secrets(), 2, jsonString)
+	return []Output{{Path: path, Secret: true, Data: buf.Bytes()}}, nil
+}
+
+// composeQuote quotes a value inside a compose file, where $ starts an
+// interpolation unless doubled
+func composeQuote(s string) string {
+	return jsonString(strings.ReplaceAll(s, "$", "$$"))
+}
+
+type composeWriter struct{}
+
+func (composeWriter) DefaultPath(module, environment string) string {
+	return fmt.Sprintf("docker-compose.%s.%s.yml", module, environment)
+}
+
+// Write produces a compose override with the plain values under environment:
+// and an env_file holding the credentials
+func (composeWriter) Write(doc *EnvDocument, path string) ([]Output, error) {
+	secretsPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".secrets.env"
+
+	var buf bytes.Buffer
+	buf.WriteString(header(doc, "#"))
+	fmt.Fprintf(&buf, "services:\n  %s-service:\n", doc.Module)
+	fmt.Fprintf(&buf, "    env_file:\n      - %s\n", jsonString(filepath.Base(secretsPath)))
+	writeYAMLMap(&buf, "environment", doc.Plain(), 6, composeQuote)
+
+	var secrets bytes.Buffer
+	secrets.WriteString(header(doc, "#"))
+	for _, e := range doc.Secrets() {
+		fmt.Fprintf(&secrets, "%s=%s\n", e.Key, DialectCompose.Quote(e.Value))
+	}
+	if err := checkRoundTrip(DialectCompose, secrets.Bytes(), doc.Secrets()); err != nil {
+		return nil, err
+	}
+
+	return []Output{
+		{Path: path, Data: buf.Bytes()},
+		{Path: secretsPath, Secret: true, Data: secrets.Bytes()},
+	}, nil
+}
+
+type helmWriter struct{}
+
+func (helmWriter) DefaultPath(module, environment string) string {
+	return fmt.Sprintf("values-%s-%s.yaml", module, environment)
+}
+
+// Write produces values.yaml with plain values under env: and credentials
+// under secrets:, for the chart to render into a ConfigMap and a Secret
+func (helmWriter) Write(doc *EnvDocument, path string) ([]Output, error) {
+	var buf bytes.Buffer
+	buf.WriteString(header(doc, "#"))
+	writeYAMLMap(&buf, "env", doc.Plain(), 2, jsonString)
+	writeYAMLMap(&buf, "secrets", doc.Secrets(), 2, jsonString)
+	return []Output{{Path: path, Secret: true, Data: buf.Bytes()}}, nil
+}
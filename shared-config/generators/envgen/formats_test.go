@@ -0,0 +1,46 @@
+package envgen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWritersGroupEntriesBySection(t *testing.T) {
+	// LOG_LEVEL is reassigned under Logging after the ENVIRONMENT section,
+	// so the later-wins entry sits among the ENVIRONMENT entries
+	rendered := strings.Join([]string{
+		"# ENVIRONMENT",
+		"ERP_ENVIRONMENT=staging",
+		"LOG_LEVEL=debug",
+		"NODE_ENV=production",
+		"# Logging",
+		"LOG_FORMAT=json",
+		"LOG_LEVEL=info",
+		"# JWT",
+		"JWT_SECRET=s3cret",
+	}, "\n")
+	doc, err := parseEnvDocument("auth", "staging", "", []byte(rendered))
+	if err != nil {
+		t.Fatalf("parseEnvDocument: %v", err)
+	}
+
+	for _, format := range []string{"yaml", "k8s", "helm", "compose"} {
+		outputs, err := envWriters[format].Write(doc, "out")
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		for _, document := range strings.Split(string(outputs[0].Data), "---\n") {
+			seen := map[string]bool{}
+			for _, line := range strings.Split(document, "\n") {
+				comment := strings.TrimSpace(line)
+				if !strings.HasPrefix(comment, "# ") || strings.Contains(comment, ":") {
+					continue
+				}
+				if seen[comment] {
+					t.Errorf("%s output repeats %q:\n%s", format, comment, document)
+				}
+				seen[comment] = true
+			}
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package envgen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// matrixCell is one module × environment combination to generate
+type matrixCell struct {
+	Module      string
+	Environment string
+}
+
+func (c matrixCell) String() string {
+	return c.Module + "/" + c.Environment
+}
+
+// generator renders cells of the module × environment matrix. It is safe
+// for concurrent use once the configs of every environment are loaded.
+type generator struct {
+	configFS     fs.FS
+	templatesFS  fs.FS
+	templateName string
+	writer       EnvWriter
+	dialect      DotenvDialect
+	registry     *ModuleRegistry
+	lookupEnv    func(string) (string, bool)
+	configs      map[string]*Config
+	// timestamp is written to the Generated at header; empty leaves it out
+	// so that regenerating unchanged config gives identical files
+	timestamp string
+}
+
+// listEnvironments returns the environments with a YAML config, sorted
+func listEnvironments(fsys fs.FS) ([]string, error) {
+	paths, err := fs.Glob(fsys, "environments/*.yaml")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(paths))
+	for _, p := range paths {
+		names = append(names, strings.TrimSuffix(path.Base(p), ".yaml"))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// MissingEnvironments returns the environments advertised in config.yaml
+// that have no environments/<name>.yaml. Generating every environment skips
+// them, so callers should warn about or reject them.
+func MissingEnvironments(opts Options) ([]string, error) {
+	configFS, err := opts.configFS()
+	if err != nil {
+		return nil, err
+	}
+	registry, err := loadModuleRegistry(configFS, "config.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("error reading module registry: %w", err)
+	}
+	existing, err := listEnvironments(configFS)
+	if err != nil {
+		return nil, fmt.Errorf("error listing environments: %w", err)
+	}
+
+	var missing []string
+	for _, env := range registry.Environments {
+		if !contains(existing, env.Name) {
+			missing = append(missing, env.Name)
+		}
+	}
+	return missing, nil
+}
+
+// loadConfigs reads and expands the config of every environment
+func (g *generator) loadConfigs(environments []string) error {
+	g.configs = map[string]*Config{}
+	for _, environment := range environments {
+		configPath := "environments/" + environment + ".yaml"
+		data, err := fs.ReadFile(g.configFS, configPath)
+		if err != nil {
+			return fmt.Errorf("error reading config file %s: %w", configPath, err)
+		}
+		var root yaml.Node
+		if err := yaml.Unmarshal(data, &root); err != nil {
+			return fmt.Errorf("error parsing config file %s: %w", configPath, err)
+		}
+		expandNode(&root, g.lookupEnv)
+		var config Config
+		if err := root.Decode(&config); err != nil {
+			return fmt.Errorf("error parsing config file %s: %w", configPath, err)
+		}
+		g.configs[environment] = &config
+	}
+	return nil
+}
+
+// render generates the outputs of one cell, named after outputPath, along
+// with the environment document they were written from
+func (g *generator) render(cell matrixCell, outputPath string) (*EnvDocument, []Output, error) {
+	config := g.configs[cell.Environment]
+	service, err := g.registry.Resolve(cell.Module, cell.Environment, config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tmpl, err := loadTemplate(g.templatesFS, g.templateName, cell.Module, cell.Environment)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rendered bytes.Buffer
+	data := TemplateData{
+		Module:      cell.Module,
+		Environment: cell.Environment,
+		Timestamp:   g.timestamp,
+		Config:      *config,
+		Service:     service,
+	}
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return nil, nil, fmt.Errorf("error executing template: %w", err)
+	}
+
+	doc, err := parseEnvDocument(cell.Module, cell.Environment, g.timestamp, rendered.Bytes())
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing generated environment: %w", err)
+	}
+	doc.Dialect = g.dialect
+	outputs, err := g.writer.Write(doc, outputPath)
+	return doc, outputs, err
+}
+
+// matrixResult is the outcome of rendering one cell
+type matrixResult struct {
+	Cell    matrixCell
+	Doc     *EnvDocument
+	Outputs []Output
+	Err     error
+}
+
+// renderMatrix renders cells with up to jobs workers. Results are in the
+// order of cells, whatever order the workers finish in. Cells not started
+// when ctx is done fail with its error.
+func (g *generator) renderMatrix(ctx context.Context, cells []matrixCell, outputPath func(matrixCell) string, jobs int) []matrixResult {
+	if jobs < 1 {
+		jobs = 1
+	}
+	results := make([]matrixResult, len(cells))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := ctx.Err(); err != nil {
+					results[i] = matrixResult{Cell: cells[i], Err: err}
+					continue
+				}
+				doc, outputs, err := g.render(cells[i], outputPath(cells[i]))
+				results[i] = matrixResult{Cell: cells[i], Doc: doc, Outputs: outputs, Err: err}
+			}
+		}()
+	}
+	for i := range cells {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+// matrixCells returns every combination of modules and environments
+func matrixCells(modules, environments []string) []matrixCell {
+	cells := make([]matrixCell, 0, len(modules)*len(environments))
+	for _, environment := range environments {
+		for _, module := range modules {
+			cells = append(cells, matrixCell{Module: module, Environment: environment})
+		}
+	}
+	return cells
+}
@@ -0,0 +1,32 @@
+package envgen
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMissingEnvironments(t *testing.T) {
+	fsys := fstest.MapFS{
+		"config.yaml": {Data: []byte(`
+environments:
+  - name: development
+    config_file: development.yaml
+  - name: testing
+    config_file: testing.yaml
+  - name: staging
+    config_file: staging.yaml
+modules: []
+`)},
+		"environments/testing.yaml": {Data: []byte("environment:\n  name: testing\n")},
+		"environments/staging.yaml": {Data: []byte("environment:\n  name: staging\n")},
+	}
+
+	missing, err := MissingEnvironments(Options{FS: fsys})
+	if err != nil {
+		t.Fatalf("MissingEnvironments: %v", err)
+	}
+	if !reflect.DeepEqual(missing, []string{"development"}) {
+		t.Errorf("missing = %v, want [development]", missing)
+	}
+}
@@ -0,0 +1,250 @@
+package envgen
+
+import (
+	"fmt"
+	"io/fs"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Module is an entry of the modules registry in config.yaml. DatabaseName,
+// ConsumerGroup and Service only need to be set when they differ from the
+// names derived from Name. Dependencies and Integrations decide which
+// sections, and so which secrets, the generated environment contains.
+type Module struct {
+	Name          string   `yaml:"name"`
+	Type          string   `yaml:"type"`
+	Language      string   `yaml:"language"`
+	Database      string   `yaml:"database"`
+	DatabaseName  string   `yaml:"database_name"`
+	ConsumerGroup string   `yaml:"consumer_group"`
+	Service       string   `yaml:"service"`
+	Dependencies  []string `yaml:"dependencies"`
+	Integrations  []string `yaml:"integrations"`
+	Ports         struct {
+		HTTP int `yaml:"http"`
+		GRPC int `yaml:"grpc"`
+	} `yaml:"ports"`
+}
+
+// ModuleRegistry is the modules section of config.yaml, along with the
+// environments it advertises
+type ModuleRegistry struct {
+	Modules      []Module                `yaml:"modules"`
+	Environments []AdvertisedEnvironment `yaml:"environments"`
+}
+
+// AdvertisedEnvironment is an entry of the environments list in config.yaml
+type AdvertisedEnvironment struct {
+	Name       string `yaml:"name"`
+	ConfigFile string `yaml:"config_file"`
+}
+
+// ResolvedModule is what the template needs to know about the module being
+// generated, resolved from the registry and the environment config
+type ResolvedModule struct {
+	Name             string
+	Type             string
+	Database         string
+	PostgresDatabase string
+	// PostgresUser and PostgresPassword are the module's app role, never
+	// the shared superuser
+	PostgresUser     string
+	PostgresPassword string
+	MongoDatabase    string
+	ConsumerGroup    string
+	HTTPPort         int
+	GRPCPort         int
+	Port             int
+	Dependencies     []string
+	Integrations     []string
+	// ServiceURLs maps every module dependency to its HTTP base URL
+	ServiceURLs map[string]string
+	APIURL      string
+	WebSocket   bool
+}
+
+// knownIntegrations are the external integrations and shared credentials a
+// module can be allowed in modules[].integrations, each gating a block of the
+// templates. kafka_sasl is the shared Kafka SASL account: depending on kafka
+// alone gives the brokers and topics, not the credentials.
+var knownIntegrations = []string{"email", "storage", "openai", "stripe", "grafana", "encryption", "kafka_sasl"}
+
+// Uses reports whether the module may see the settings of name: its own
+// name or database, a dependency or an allowed integration
+func (m *ResolvedModule) Uses(name string) bool {
+	if name == m.Name || name == m.Database {
+		return true
+	}
+	return contains(m.Dependencies, name) || contains(m.Integrations, name)
+}
+
+// UsesAny reports whether the module uses one of names
+func (m *ResolvedModule) UsesAny(names ...string) bool {
+	for _, name := range names {
+		if m.Uses(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func loadModuleRegistry(fsys fs.FS, name string) (*ModuleRegistry, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	var registry ModuleRegistry
+	if err := yaml.Unmarshal(data, &registry); err != nil {
+		return nil, err
+	}
+	return &registry, nil
+}
+
+// Get returns the module with the given name
+func (r *ModuleRegistry) Get(name string) (*Module, bool) {
+	for i := range r.Modules {
+		if r.Modules[i].Name == name {
+			return &r.Modules[i], true
+		}
+	}
+	return nil, false
+}
+
+// Names returns the registered module names, sorted
+func (r *ModuleRegistry) Names() []string {
+	names := make([]string, 0, len(r.Modules))
+	for _, m := range r.Modules {
+		names = append(names, m.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (m *Module) dependsOn(name string) bool {
+	return contains(m.Dependencies, name)
+}
+
+// serviceKey returns the key of the module under services in the
+// environment config
+func (m *Module) serviceKey(config *Config) string {
+	if m.Service != "" {
+		return m.Service
+	}
+	if _, ok := config.Services[m.Name+"_service"]; ok {
+		return m.Name + "_service"
+	}
+	return m.Name
+}
+
+// Resolve looks up everything the template needs for module in config and
+// fails when the environment does not declare it, instead of falling back
+// to another module's settings
+func (r *ModuleRegistry) Resolve(name string, environment string, config *Config) (*ResolvedModule, error) {
+	m, ok := r.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown module %q; registered modules: %s", name, strings.Join(r.Names(), ", "))
+	}
+
+	for _, integration := range m.Integrations {
+		if !contains(knownIntegrations, integration) {
+			return nil, fmt.Errorf("module %s: unknown integration %q; known integrations: %s", name, integration, strings.Join(knownIntegrations, ", "))
+		}
+	}
+
+	resolved := &ResolvedModule{
+		Name:         m.Name,
+		Type:         m.Type,
+		Database:     m.Database,
+		Dependencies: m.Dependencies,
+		Integrations: m.Integrations,
+		ServiceURLs:  map[string]string{},
+		WebSocket:    m.dependsOn("websocket"),
+	}
+
+	databaseName := m.DatabaseName
+	if databaseName == "" {
+		databaseName = m.Name
+	}
+	switch m.Database {
+	case "":
+	case "postgresql":
+		resolved.PostgresDatabase = config.Databases.PostgreSQL.Databases[databaseName]
+		if resolved.PostgresDatabase == "" {
+			return nil, fmt.Errorf("module %s: environment %s has no databases.postgresql.databases.%s", name, environment, databaseName)
+		}
+		app := config.Databases.PostgreSQL.Roles[databaseName].App
+		resolved.PostgresUser = app.Username
+		if resolved.PostgresUser == "" {
+			resolved.PostgresUser = resolved.PostgresDatabase + "_app"
+		}
+		resolved.PostgresPassword = app.Password
+	case "mongodb":
+		resolved.MongoDatabase = config.Databases.MongoDB.Databases[databaseName]
+		if resolved.MongoDatabase == "" {
+			return nil, fmt.Errorf("module %s: environment %s has no databases.mongodb.databases.%s", name, environment, databaseName)
+		}
+	default:
+		return nil, fmt.Errorf("module %s: unsupported database %q", name, m.Database)
+	}
+
+	if m.dependsOn("kafka") {
+		group := m.ConsumerGroup
+		if group == "" {
+			group = m.Name + "_service"
+		}
+		resolved.ConsumerGroup = config.Messaging.Kafka.ConsumerGroups[group]
+		if resolved.ConsumerGroup == "" {
+			return nil, fmt.Errorf("module %s: environment %s has no messaging.kafka.consumer_groups.%s", name, environment, group)
+		}
+	}
+
+	// Ports declared by the environment win over the registry defaults
+	service := config.Services[m.serviceKey(config)]
+	if m.Type == "frontend" {
+		resolved.Port = firstNonZero(service.Port, m.Ports.HTTP)
+	} else {
+		resolved.HTTPPort = firstNonZero(service.HTTPPort, m.Ports.HTTP)
+		resolved.GRPCPort = firstNonZero(service.GRPCPort, m.Ports.GRPC)
+	}
+
+	for _, dep := range m.Dependencies {
+		depModule, ok := r.Get(dep)
+		if !ok {
+			continue
+		}
+		depService := config.Services[depModule.serviceKey(config)]
+		host := depService.Host
+		if host == "" {
+			host = depModule.Name
+		}
+		port := firstNonZero(depService.HTTPPort, depService.Port, depModule.Ports.HTTP)
+		resolved.ServiceURLs[dep] = "http://" + net.JoinHostPort(host, strconv.Itoa(port))
+		if resolved.APIURL == "" && depModule.Type == "backend" {
+			resolved.APIURL = resolved.ServiceURLs[dep]
+		}
+	}
+	return resolved, nil
+}
+
+func firstNonZero(values ...int) int {
+	for _, v := range values {
+		if v != 0 {
+			return v
+		}
+	}
+	return 0
+}
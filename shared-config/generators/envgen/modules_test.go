@@ -0,0 +1,217 @@
+package envgen
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"gopkg.in/yaml.v3"
+)
+
+func noEnv(string) (string, bool) { return "", false }
+
+// shippedModules returns the registry and testing config of the shared-config
+// directory, with every ${VAR} left to its default
+func shippedModules(t *testing.T) (*ModuleRegistry, *Config) {
+	t.Helper()
+	configFS := os.DirFS("../..")
+	registry, err := loadModuleRegistry(configFS, "config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &generator{configFS: configFS, lookupEnv: noEnv}
+	if err := g.loadConfigs([]string{"testing"}); err != nil {
+		t.Fatal(err)
+	}
+	return registry, g.configs["testing"]
+}
+
+func TestResolveShippedModules(t *testing.T) {
+	registry, config := shippedModules(t)
+
+	notification, err := registry.Resolve("notification", "testing", config)
+	if err != nil {
+		t.Fatalf("Resolve(notification): %v", err)
+	}
+	if notification.MongoDatabase != "erp_notification_test" || notification.ConsumerGroup != "notification-service-group-test" {
+		t.Errorf("notification database %q, consumer group %q", notification.MongoDatabase, notification.ConsumerGroup)
+	}
+	if notification.PostgresDatabase != "" || notification.HTTPPort != 8097 {
+		t.Errorf("notification = %+v", notification)
+	}
+
+	admin, err := registry.Resolve("admin", "testing", config)
+	if err != nil {
+		t.Fatalf("Resolve(admin): %v", err)
+	}
+	if admin.Port != 3011 || admin.PostgresDatabase != "" || admin.MongoDatabase != "" || admin.ConsumerGroup != "" {
+		t.Errorf("admin = %+v, want the admin_panel port and no database or consumer group", admin)
+	}
+	if admin.APIURL != "http://localhost:8090" || !admin.WebSocket || !admin.Uses("grafana") {
+		t.Errorf("admin = %+v", admin)
+	}
+
+	// every module with a database or a consumer group has one of its own
+	databases, groups := map[string]string{}, map[string]string{}
+	claim := func(owners map[string]string, value, module string) {
+		if value == "" {
+			return
+		}
+		if other, ok := owners[value]; ok {
+			t.Errorf("%s and %s share %s", other, module, value)
+		}
+		owners[value] = module
+	}
+	for _, name := range registry.Names() {
+		m, err := registry.Resolve(name, "testing", config)
+		if err != nil {
+			t.Fatalf("Resolve(%s): %v", name, err)
+		}
+		claim(databases, m.PostgresDatabase+m.MongoDatabase, name)
+		claim(groups, m.ConsumerGroup, name)
+	}
+}
+
+func TestResolveUnknownModule(t *testing.T) {
+	registry, config := shippedModules(t)
+	_, err := registry.Resolve("analytics", "testing", config)
+	if err == nil || !strings.Contains(err.Error(), `unknown module "analytics"`) || !strings.Contains(err.Error(), "notification") {
+		t.Errorf("err = %v, want an unknown module error listing the registered modules", err)
+	}
+
+	_, err = Generate(context.Background(), Options{ConfigDir: "../..", Modules: []string{"analytics"}, Environments: []string{"testing"}, LookupEnv: noEnv})
+	if err == nil || !strings.Contains(err.Error(), `unknown module "analytics"`) {
+		t.Errorf("Generate with an unknown module: err = %v", err)
+	}
+}
+
+func TestResolveFromRegistry(t *testing.T) {
+	fsys := fstest.MapFS{"config.yaml": {Data: []byte(`
+modules:
+  - name: billing
+    type: backend
+    database: postgresql
+    database_name: ledger
+    consumer_group: ledger_group
+    ports:
+      http: 8100
+    dependencies: [kafka, auth]
+    integrations: [stripe]
+  - name: auth
+    type: backend
+    ports:
+      http: 8080
+`)}}
+	registry, err := loadModuleRegistry(fsys, "config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config Config
+	err = yaml.Unmarshal([]byte(`
+databases:
+  postgresql:
+    databases:
+      ledger: erp_ledger
+messaging:
+  kafka:
+    consumer_groups:
+      ledger_group: ledger-group-test
+services:
+  billing:
+    http_port: 8200
+`), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	billing, err := registry.Resolve("billing", "testing", &config)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	want := &ResolvedModule{
+		Name:             "billing",
+		Type:             "backend",
+		Database:         "postgresql",
+		PostgresDatabase: "erp_ledger",
+		PostgresUser:     "erp_ledger_app",
+		ConsumerGroup:    "ledger-group-test",
+		// the port of the environment wins over the registry
+		HTTPPort:     8200,
+		Dependencies: []string{"kafka", "auth"},
+		Integrations: []string{"stripe"},
+		// auth is not in services, so its name and registry port are used
+		ServiceURLs: map[string]string{"auth": "http://auth:8080"},
+		APIURL:      "http://auth:8080",
+	}
+	if !reflect.DeepEqual(billing, want) {
+		t.Errorf("resolved\n%+v\nwant\n%+v", billing, want)
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		module Module
+		want   string
+	}{
+		{"missing postgres database", Module{Name: "billing", Database: "postgresql"}, "has no databases.postgresql.databases.billing"},
+		{"missing mongo database", Module{Name: "billing", Database: "mongodb"}, "has no databases.mongodb.databases.billing"},
+		{"unsupported database", Module{Name: "billing", Database: "cassandra"}, `unsupported database "cassandra"`},
+		{"missing consumer group", Module{Name: "billing", Dependencies: []string{"kafka"}}, "has no messaging.kafka.consumer_groups.billing_service"},
+		{"unknown integration", Module{Name: "billing", Integrations: []string{"paypal"}}, `unknown integration "paypal"`},
+	}
+	for _, tt := range tests {
+		registry := &ModuleRegistry{Modules: []Module{tt.module}}
+		if _, err := registry.Resolve("billing", "testing", &Config{}); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestGenerateNewModuleNeedsNoCodeChanges(t *testing.T) {
+	fsys := fstest.MapFS{
+		"config.yaml": {Data: []byte(`
+modules:
+  - name: billing
+    type: backend
+    database: postgresql
+    ports:
+      http: 8200
+    dependencies: [postgresql]
+`)},
+		"environments/testing.yaml": {Data: []byte(`
+databases:
+  postgresql:
+    databases:
+      billing: erp_billing_test
+`)},
+		"templates/.env.template": {Data: []byte("MODULE={{.Module}}\nDB_NAME={{.Service.PostgresDatabase}}\nHTTP_PORT={{.Service.HTTPPort}}\n")},
+	}
+	artifacts, err := Generate(context.Background(), Options{FS: fsys, LookupEnv: noEnv})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if len(artifacts) != 1 || !strings.Contains(string(artifacts[0].Data), "DB_NAME=erp_billing_test\nHTTP_PORT=8200\n") {
+		t.Errorf("artifacts = %+v", artifacts)
+	}
+}
+
+func TestResolvedModuleUses(t *testing.T) {
+	m := &ResolvedModule{Name: "finance", Database: "postgresql", Dependencies: []string{"auth", "kafka"}, Integrations: []string{"stripe"}}
+	for _, name := range []string{"finance", "postgresql", "auth", "kafka", "stripe"} {
+		if !m.Uses(name) {
+			t.Errorf("Uses(%s) = false", name)
+		}
+	}
+	for _, name := range []string{"mongodb", "openai", "grafana", "kafka_sasl"} {
+		if m.Uses(name) {
+			t.Errorf("Uses(%s) = true", name)
+		}
+	}
+	if !m.UsesAny("mongodb", "stripe") || m.UsesAny("mongodb", "openai") || m.UsesAny() {
+		t.Error("UsesAny does not match Uses")
+	}
+}
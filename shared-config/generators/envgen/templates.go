@@ -0,0 +1,488 @@
+package envgen
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// secretMarker wraps values passed through the secret function so that
+// parseEnvDocument can flag them; it never reaches an output file
+const secretMarker = "\x00secret\x00"
+
+// renderEscape stands in for newlines printed by template actions, so that a
+// value cannot break the KEY=value line it is printed on. parseEnvDocument
+// decodes it after splitting the lines; the writers then quote the value.
+const renderEscape = "\x01"
+
+var (
+	renderEncoder = strings.NewReplacer(renderEscape, renderEscape+renderEscape, "\n", renderEscape+"n", "\r", renderEscape+"r")
+	renderDecoder = strings.NewReplacer(renderEscape+renderEscape, renderEscape, renderEscape+"n", "\n", renderEscape+"r", "\r")
+)
+
+// templateLayers returns the directories searched for templates and
+// partials, least specific first: the base directory, then
+// environments/<env>, modules/<module> and modules/<module>/<env>
+func templateLayers(module, environment string) []string {
+	return []string{
+		".",
+		path.Join("environments", environment),
+		path.Join("modules", module),
+		path.Join("modules", module, environment),
+	}
+}
+
+// partialName is the name a partials/<name>.tmpl file is defined under
+func partialName(name string) string {
+	return strings.TrimSuffix(path.Base(name), path.Ext(name))
+}
+
+// loadTemplate parses the most specific override of name for the module and
+// environment, along with every partial. Partials in a more specific layer
+// replace those of the same name in the layers below it.
+func loadTemplate(fsys fs.FS, name, module, environment string) (*template.Template, error) {
+	tmpl := template.New(name)
+	tmpl.Funcs(templateFuncs(tmpl))
+
+	mainPath := ""
+	for _, layer := range templateLayers(module, environment) {
+		partials, err := fs.Glob(fsys, path.Join(layer, "partials", "*.tmpl"))
+		if err != nil {
+			return nil, err
+		}
+		for _, partial := range partials {
+			content, err := fs.ReadFile(fsys, partial)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := tmpl.New(partialName(partial)).Parse(string(content)); err != nil {
+				return nil, fmt.Errorf("error parsing partial %s: %w", partial, err)
+			}
+		}
+		if _, err := fs.Stat(fsys, path.Join(layer, name)); err == nil {
+			mainPath = path.Join(layer, name)
+		}
+	}
+	if mainPath == "" {
+		return nil, fmt.Errorf("template %s not found", name)
+	}
+
+	content, err := fs.ReadFile(fsys, mainPath)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tmpl.Parse(string(content)); err != nil {
+		return nil, fmt.Errorf("error parsing template %s: %w", mainPath, err)
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			escapeActions(t.Tree.Root)
+		}
+	}
+	return tmpl, nil
+}
+
+// escapeActions pipes the value of every action in list through
+// renderEncode, the way html/template adds its escapers. Declarations print
+// nothing, and actions using include print whole lines.
+func escapeActions(list *parse.ListNode) {
+	if list == nil {
+		return
+	}
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.ActionNode:
+			if len(n.Pipe.Decl) > 0 || callsInclude(n.Pipe) {
+				continue
+			}
+			n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+				NodeType: parse.NodeCommand,
+				Pos:      n.Pos,
+				Args:     []parse.Node{parse.NewIdentifier("renderEncode").SetPos(n.Pos)},
+			})
+		case *parse.IfNode:
+			escapeActions(n.List)
+			escapeActions(n.ElseList)
+		case *parse.RangeNode:
+			escapeActions(n.List)
+			escapeActions(n.ElseList)
+		case *parse.WithNode:
+			escapeActions(n.List)
+			escapeActions(n.ElseList)
+		case *parse.ListNode:
+			escapeActions(n)
+		}
+	}
+}
+
+func callsInclude(pipe *parse.PipeNode) bool {
+	for _, cmd := range pipe.Cmds {
+		if ident, ok := cmd.Args[0].(*parse.IdentifierNode); ok && ident.Ident == "include" {
+			return true
+		}
+	}
+	return false
+}
+
+func renderEncode(value interface{}) string {
+	return renderEncoder.Replace(fmt.Sprint(value))
+}
+
+// templateFuncs is the function library available to templates. include
+// renders a partial of tmpl to a string so that it can be piped.
+func templateFuncs(tmpl *template.Template) template.FuncMap {
+	return template.FuncMap{
+		"join":     strings.Join,
+		"upper":    strings.ToUpper,
+		"title":    strings.Title,
+		"default":  defaultValue,
+		"required": required,
+		"quote":    quote,
+		"b64":      b64,
+		"dsn":      dsn,
+		"secret":   secret,
+		// renderEncode is added to every action by escapeActions
+		"renderEncode": renderEncode,
+		"include": func(name string, data interface{}) (string, error) {
+			var buf bytes.Buffer
+			if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+				return "", err
+			}
+			return buf.String(), nil
+		},
+	}
+}
+
+// isEmpty reports whether v is nil, a zero value or an empty collection
+func isEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		return value.Len() == 0
+	}
+	return value.IsZero()
+}
+
+// defaultValue returns value, or def when value is empty:
+// {{.Config.Environment.LogLevel | default "info"}}
+func defaultValue(def, value interface{}) interface{} {
+	if isEmpty(value) {
+		return def
+	}
+	return value
+}
+
+// required fails the rendering with message when value is empty
+func required(message string, value interface{}) (interface{}, error) {
+	if isEmpty(value) {
+		return nil, errors.New(message)
+	}
+	return value, nil
+}
+
+// quote double-quotes a value for a dotenv file
+func quote(value interface{}) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`", "\n", `\n`).Replace(fmt.Sprint(value)) + `"`
+}
+
+func b64(value interface{}) string {
+	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprint(value)))
+}
+
+// dsn builds a connection URL, escaping the credentials and the path. The
+// user info is left out when both user and password are empty.
+func dsn(scheme, user, password, host string, port interface{}, path string) string {
+	u := url.URL{Scheme: scheme, Host: net.JoinHostPort(host, fmt.Sprint(port))}
+	if user != "" || password != "" {
+		u.User = url.UserPassword(user, password)
+	}
+	if path != "" {
+		u.Path = "/" + path
+	}
+	return u.String()
+}
+
+// secret marks a value as a credential, for values the key and URL
+// heuristics of isSecret would not catch
+func secret(value interface{}) string {
+	return secretMarker + fmt.Sprint(value)
+}
+
+// TemplateProblem is a lint finding, located as file:line:col
+type TemplateProblem struct {
+	Location string `json:"location"`
+	Message  string `json:"message"`
+}
+
+func (p TemplateProblem) String() string {
+	return p.Location + ": " + p.Message
+}
+
+// LintTemplates parses every template and partial in fsys and checks that
+// each referenced field exists on TemplateData, each function is defined and
+// each {{template}} or include names a known partial. Partials are checked
+// with TemplateData as their dot, as they are invoked with {{template "x" .}}.
+func LintTemplates(fsys fs.FS) ([]TemplateProblem, error) {
+	var files []string
+	partials := map[string]bool{}
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.IsDir():
+		case path.Base(path.Dir(name)) == "partials" && path.Ext(name) == ".tmpl":
+			partials[partialName(name)] = true
+			files = append(files, name)
+		case path.Ext(name) == ".template":
+			files = append(files, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	funcs := templateFuncs(nil)
+	var problems []TemplateProblem
+	var parsed []*template.Template
+	for _, name := range files {
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		tmpl, err := template.New(name).Funcs(funcs).Parse(string(content))
+		if err != nil {
+			problems = append(problems, TemplateProblem{Location: name, Message: err.Error()})
+			continue
+		}
+		// {{define}} blocks are partials too
+		for _, t := range tmpl.Templates() {
+			partials[t.Name()] = true
+		}
+		parsed = append(parsed, tmpl)
+	}
+
+	root := reflect.TypeOf(TemplateData{})
+	for _, tmpl := range parsed {
+		templates := tmpl.Templates()
+		sort.Slice(templates, func(i, j int) bool { return templates[i].Name() < templates[j].Name() })
+		for _, t := range templates {
+			if t.Tree == nil {
+				continue
+			}
+			l := &templateLinter{tree: t.Tree, funcs: funcs, partials: partials}
+			l.walk(t.Tree.Root, lintScope{dot: root, vars: map[string]reflect.Type{"$": root}})
+			problems = append(problems, l.problems...)
+		}
+	}
+	return problems, nil
+}
+
+// lintScope is the type of dot and of the variables in scope. A nil type is
+// unknown, e.g. the result of index or of an interface{} field, and is not
+// checked further.
+type lintScope struct {
+	dot  reflect.Type
+	vars map[string]reflect.Type
+}
+
+func (s lintScope) child(dot reflect.Type) lintScope {
+	vars := make(map[string]reflect.Type, len(s.vars))
+	for name, t := range s.vars {
+		vars[name] = t
+	}
+	return lintScope{dot: dot, vars: vars}
+}
+
+type templateLinter struct {
+	tree     *parse.Tree
+	funcs    template.FuncMap
+	partials map[string]bool
+	problems []TemplateProblem
+}
+
+func (l *templateLinter) report(node parse.Node, format string, args ...interface{}) {
+	location, _ := l.tree.ErrorContext(node)
+	l.problems = append(l.problems, TemplateProblem{Location: location, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *templateLinter) walk(node parse.Node, s lintScope) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			l.walk(child, s)
+		}
+	case *parse.ActionNode:
+		l.pipe(n.Pipe, s)
+	case *parse.IfNode:
+		l.pipe(n.Pipe, s)
+		l.walk(n.List, s.child(s.dot))
+		l.walk(n.ElseList, s.child(s.dot))
+	case *parse.WithNode:
+		inner := s.child(s.dot)
+		inner.dot = l.pipe(n.Pipe, inner)
+		l.walk(n.List, inner)
+		l.walk(n.ElseList, s.child(s.dot))
+	case *parse.RangeNode:
+		inner := s.child(s.dot)
+		key, elem := rangeTypes(l.pipe(n.Pipe, inner))
+		inner.dot = elem
+		switch len(n.Pipe.Decl) {
+		case 1:
+			inner.vars[n.Pipe.Decl[0].Ident[0]] = elem
+		case 2:
+			inner.vars[n.Pipe.Decl[0].Ident[0]] = key
+			inner.vars[n.Pipe.Decl[1].Ident[0]] = elem
+		}
+		l.walk(n.List, inner)
+		l.walk(n.ElseList, s.child(s.dot))
+	case *parse.TemplateNode:
+		if !l.partials[n.Name] {
+			l.report(n, "no partial named %q", n.Name)
+		}
+		if n.Pipe != nil {
+			l.pipe(n.Pipe, s)
+		}
+	}
+}
+
+// pipe checks a pipeline and returns the type it evaluates to
+func (l *templateLinter) pipe(p *parse.PipeNode, s lintScope) reflect.Type {
+	if p == nil {
+		return nil
+	}
+	var result reflect.Type
+	for _, cmd := range p.Cmds {
+		result = l.command(cmd, s)
+	}
+	for _, decl := range p.Decl {
+		s.vars[decl.Ident[0]] = result
+	}
+	return result
+}
+
+func (l *templateLinter) command(cmd *parse.CommandNode, s lintScope) reflect.Type {
+	for _, arg := range cmd.Args[1:] {
+		l.arg(arg, s)
+	}
+	ident, ok := cmd.Args[0].(*parse.IdentifierNode)
+	if !ok {
+		return l.arg(cmd.Args[0], s)
+	}
+	if ident.Ident == "include" && len(cmd.Args) > 1 {
+		if name, ok := cmd.Args[1].(*parse.StringNode); ok && !l.partials[name.Text] {
+			l.report(name, "no partial named %q", name.Text)
+		}
+	}
+	if fn, ok := l.funcs[ident.Ident]; ok {
+		if t := reflect.TypeOf(fn); t.NumOut() > 0 && t.Out(0).Kind() != reflect.Interface {
+			return t.Out(0)
+		}
+	}
+	// builtins such as or, index and print, and functions returning
+	// interface{}, are not followed
+	return nil
+}
+
+func (l *templateLinter) arg(node parse.Node, s lintScope) reflect.Type {
+	switch n := node.(type) {
+	case *parse.DotNode:
+		return s.dot
+	case *parse.FieldNode:
+		return l.field(n, s.dot, n.Ident)
+	case *parse.VariableNode:
+		t, ok := s.vars[n.Ident[0]]
+		if !ok {
+			l.report(n, "undefined variable %s", n.Ident[0])
+			return nil
+		}
+		return l.field(n, t, n.Ident[1:])
+	case *parse.ChainNode:
+		return l.field(n, l.arg(n.Node, s), n.Field)
+	case *parse.PipeNode:
+		return l.pipe(n, s.child(s.dot))
+	}
+	return nil
+}
+
+// field follows a chain of field names from t the way text/template does:
+// methods, then struct fields, then map keys
+func (l *templateLinter) field(node parse.Node, t reflect.Type, idents []string) reflect.Type {
+	for _, ident := range idents {
+		if t == nil {
+			return nil
+		}
+		receiver := t
+		if receiver.Kind() != reflect.Ptr && receiver.Kind() != reflect.Interface {
+			receiver = reflect.PtrTo(t)
+		}
+		if method, ok := receiver.MethodByName(ident); ok && method.Type.NumOut() > 0 {
+			t = method.Type.Out(0)
+			continue
+		}
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			f, ok := t.FieldByName(ident)
+			if !ok || f.PkgPath != "" {
+				l.report(node, "%s: no field %s in %s", node, ident, typeName(t))
+				return nil
+			}
+			t = f.Type
+		case reflect.Map:
+			t = t.Elem()
+		case reflect.Interface:
+			return nil
+		default:
+			l.report(node, "%s: no field %s in %s", node, ident, typeName(t))
+			return nil
+		}
+	}
+	return t
+}
+
+// typeName names t for lint messages; the anonymous structs of Config are
+// reported by kind
+func typeName(t reflect.Type) string {
+	if t.Name() == "" {
+		return t.Kind().String()
+	}
+	return t.String()
+}
+
+// rangeTypes returns the key and element types of ranging over t
+func rangeTypes(t reflect.Type) (key, elem reflect.Type) {
+	if t == nil {
+		return nil, nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Map:
+		return t.Key(), t.Elem()
+	case reflect.Slice, reflect.Array:
+		return reflect.TypeOf(0), t.Elem()
+	}
+	return nil, nil
+}
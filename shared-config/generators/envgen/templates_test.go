@@ -0,0 +1,199 @@
+package envgen
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func renderTemplate(t *testing.T, fsys fstest.MapFS, name, module, environment string) (string, error) {
+	t.Helper()
+	tmpl, err := loadTemplate(fsys, name, module, environment)
+	if err != nil {
+		t.Fatalf("loadTemplate(%s): %v", name, err)
+	}
+	var buf strings.Builder
+	err = tmpl.Execute(&buf, TemplateData{Module: module, Environment: environment, Service: &ResolvedModule{Name: module}})
+	return buf.String(), err
+}
+
+func file(content string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(content)}
+}
+
+func TestLoadTemplateLayers(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app.template":                               file(`base {{template "section" .}}`),
+		"partials/section.tmpl":                      file("base section"),
+		"environments/staging/app.template":          file(`staging {{template "section" .}}`),
+		"environments/staging/partials/section.tmpl": file("staging section"),
+		"modules/crm/app.template":                   file(`crm {{template "section" .}}`),
+		"modules/crm/staging/partials/section.tmpl":  file("crm staging section"),
+	}
+	tests := []struct {
+		module, environment, want string
+	}{
+		{"hrm", "testing", "base base section"},
+		{"hrm", "staging", "staging staging section"},
+		{"crm", "testing", "crm base section"},
+		// the module template wins, with the partial of the most specific layer
+		{"crm", "staging", "crm crm staging section"},
+	}
+	for _, tt := range tests {
+		got, err := renderTemplate(t, fsys, "app.template", tt.module, tt.environment)
+		if err != nil {
+			t.Fatalf("%s/%s: %v", tt.module, tt.environment, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s/%s rendered %q, want %q", tt.module, tt.environment, got, tt.want)
+		}
+	}
+}
+
+func TestLoadTemplateErrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app.template":                  file("{{.Module}}"),
+		"broken.template":               file("{{.Module"),
+		"modules/crm/partials/bad.tmpl": file("{{end}}"),
+	}
+	if _, err := loadTemplate(fsys, "missing.template", "hrm", "testing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("missing template: err = %v", err)
+	}
+	if _, err := loadTemplate(fsys, "broken.template", "hrm", "testing"); err == nil || !strings.Contains(err.Error(), "broken.template") {
+		t.Errorf("broken template: err = %v", err)
+	}
+	if _, err := loadTemplate(fsys, "app.template", "crm", "testing"); err == nil || !strings.Contains(err.Error(), "modules/crm/partials/bad.tmpl") {
+		t.Errorf("broken partial: err = %v", err)
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	tests := []struct {
+		name, template, want string
+	}{
+		{"default empty", `{{"" | default "info"}}`, "info"},
+		{"default zero", `{{0 | default 5432}}`, "5432"},
+		{"default set", `{{.Module | default "none"}}`, "crm"},
+		{"required set", `{{.Module | required "module is required"}}`, "crm"},
+		{"quote", `{{quote "a \"b\" $HOME\\"}}`, `"a \"b\" \$HOME\\"`},
+		{"b64", `{{b64 "user:pass"}}`, "dXNlcjpwYXNz"},
+		{"dsn", `{{dsn "postgres" "erp app" "p@ss/w:rd" "db" 5432 "erp_crm"}}`, "postgres://erp%20app:p%40ss%2Fw%3Ard@db:5432/erp_crm"},
+		{"dsn without credentials", `{{dsn "redis" "" "" "cache" 6379 ""}}`, "redis://cache:6379"},
+		{"include", `{{include "section" . | upper}}`, "SECTION OF CRM"},
+		{"join", `{{join .Service.Dependencies ","}}`, ""},
+	}
+	for _, tt := range tests {
+		fsys := fstest.MapFS{
+			"app.template":          file(tt.template),
+			"partials/section.tmpl": file("section of {{.Module}}"),
+		}
+		got, err := renderTemplate(t, fsys, "app.template", "crm", "testing")
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: rendered %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	fsys := fstest.MapFS{"app.template": file(`KEY={{.Timestamp | required "a timestamp is required"}}`)}
+	if _, err := renderTemplate(t, fsys, "app.template", "crm", "testing"); err == nil || !strings.Contains(err.Error(), "a timestamp is required") {
+		t.Errorf("required on an empty value: err = %v", err)
+	}
+}
+
+func TestRenderedValuesStayOnTheirLine(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app.template": file("# Section\nNOTE={{.Module}}\nTOKEN={{secret .Environment}}\nAFTER=1\n"),
+	}
+	tmpl, err := loadTemplate(fsys, "app.template", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf strings.Builder
+	data := TemplateData{Module: "line one\nINJECTED=1", Environment: "plain", Service: &ResolvedModule{}}
+	if err := tmpl.Execute(&buf, data); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := parseEnvDocument("crm", "testing", "", []byte(buf.String()))
+	if err != nil {
+		t.Fatalf("parseEnvDocument: %v", err)
+	}
+
+	values := map[string]EnvEntry{}
+	for _, e := range doc.Entries {
+		values[e.Key] = e
+	}
+	if _, ok := values["INJECTED"]; ok || len(doc.Entries) != 3 {
+		t.Fatalf("a newline in a value added an entry: %+v", doc.Entries)
+	}
+	if got := values["NOTE"].Value; got != "line one\nINJECTED=1" {
+		t.Errorf("NOTE = %q", got)
+	}
+	if token := values["TOKEN"]; !token.Secret || token.Value != "plain" {
+		t.Errorf("TOKEN = %+v, want the marked value without the marker", token)
+	}
+	if values["AFTER"].Secret {
+		t.Error("AFTER is flagged as a secret")
+	}
+}
+
+func TestLintTemplates(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app.template":                    file("{{.Module}} {{.Config.Environment.LogLevel}} {{template \"section\" .}}"),
+		"partials/section.tmpl":           file("{{range $name, $s := .Config.Services}}{{$s.Host}}{{end}}"),
+		"modules/crm/bad.template":        file("{{.Modul}} {{.Config.Nope}} {{template \"missing\" .}} {{include \"gone\" .}}"),
+		"modules/crm/func.template":       file("{{frobnicate .Module}}"),
+		"environments/staging/x.template": file("{{.Module"),
+	}
+	problems, err := LintTemplates(fsys)
+	if err != nil {
+		t.Fatalf("LintTemplates: %v", err)
+	}
+	var got []string
+	for _, p := range problems {
+		got = append(got, p.String())
+	}
+	report := strings.Join(got, "\n")
+	for _, want := range []string{
+		"environments/staging/x.template",
+		"no field Modul in envgen.TemplateData",
+		"no field Nope in envgen.Config",
+		`function "frobnicate" not defined`,
+		`no partial named "missing"`,
+		`no partial named "gone"`,
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("lint report is missing %q:\n%s", want, report)
+		}
+	}
+	for _, p := range problems {
+		if strings.HasPrefix(p.Location, "app.template") || strings.HasPrefix(p.Location, "partials/") {
+			t.Errorf("valid template reported: %s", p)
+		}
+	}
+}
+
+func TestShippedTemplates(t *testing.T) {
+	fsys := os.DirFS("../../templates")
+	problems, err := LintTemplates(fsys)
+	if err != nil {
+		t.Fatalf("LintTemplates: %v", err)
+	}
+	for _, p := range problems {
+		t.Errorf("shipped template: %s", p)
+	}
+
+	for _, name := range []string{DefaultTemplate, "docker.template", "k8s.template"} {
+		tmpl, err := loadTemplate(fsys, name, "crm", "staging")
+		if err != nil {
+			t.Errorf("loadTemplate(%s): %v", name, err)
+			continue
+		}
+		if tmpl.Lookup("sections") == nil {
+			t.Errorf("%s does not load the sections partial", name)
+		}
+	}
+}
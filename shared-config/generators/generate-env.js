@@ -79,18 +79,21 @@ class EnvironmentGenerator {
             '# PostgreSQL',
             `DB_HOST=${pgConfig.host}`,
             `DB_PORT=${pgConfig.port}`,
-            `DB_USER=${pgConfig.username}`,
-            `DB_PASSWORD=${pgConfig.password}`,
             `DB_SSL_MODE=${pgConfig.ssl_mode}`,
             `DB_MAX_CONNECTIONS=${pgConfig.max_connections}`,
             `DB_CONNECTION_TIMEOUT=${pgConfig.connection_timeout}`
         );
 
-        // Module-specific database
+        // Module-specific database, connected to as the module's app role
         if (pgConfig.databases[module]) {
             const dbName = pgConfig.databases[module];
+            const appRole = ((pgConfig.roles || {})[module] || {}).app || {};
+            const dbUser = appRole.username || `${dbName}_app`;
+            const dbPassword = appRole.password || '';
             content.push(`DB_NAME=${dbName}`);
-            const dbUrl = `postgresql://${pgConfig.username}:${pgConfig.password}@${pgConfig.host}:${pgConfig.port}/${dbName}?sslmode=${pgConfig.ssl_mode}`;
+            content.push(`DB_USER=${dbUser}`);
+            content.push(`DB_PASSWORD=${dbPassword}`);
+            const dbUrl = `postgresql://${dbUser}:${dbPassword}@${pgConfig.host}:${pgConfig.port}/${dbName}?sslmode=${pgConfig.ssl_mode}`;
             content.push(`DATABASE_URL=${dbUrl}`);
         }
 
@@ -77,18 +77,21 @@ class EnvironmentGenerator:
             "# PostgreSQL",
             f"DB_HOST={pg_config['host']}",
             f"DB_PORT={pg_config['port']}",
-            f"DB_USER={pg_config['username']}",
-            f"DB_PASSWORD={pg_config['password']}",
             f"DB_SSL_MODE={pg_config['ssl_mode']}",
             f"DB_MAX_CONNECTIONS={pg_config['max_connections']}",
             f"DB_CONNECTION_TIMEOUT={pg_config['connection_timeout']}",
         ])
         
-        # Module-specific database
+        # Module-specific database, connected to as the module's app role
         if module in pg_config['databases']:
             db_name = pg_config['databases'][module]
+            app_role = (pg_config.get('roles') or {}).get(module, {}).get('app') or {}
+            db_user = app_role.get('username') or f"{db_name}_app"
+            db_password = app_role.get('password') or ''
             content.append(f"DB_NAME={db_name}")
-            db_url = f"postgresql://{pg_config['username']}:{pg_config['password']}@{pg_config['host']}:{pg_config['port']}/{db_name}?sslmode={pg_config['ssl_mode']}"
+            content.append(f"DB_USER={db_user}")
+            content.append(f"DB_PASSWORD={db_password}")
+            db_url = f"postgresql://{db_user}:{db_password}@{pg_config['host']}:{pg_config['port']}/{db_name}?sslmode={pg_config['ssl_mode']}"
             content.append(f"DATABASE_URL={db_url}")
         
         content.append("")
@@ -2,16 +2,42 @@ package sharedconfig
 
 import (
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
 )
 
 // RedisConfig holds Redis configuration
 type RedisConfig struct {
-	Host      string              `yaml:"host"`
-	Port      int                 `yaml:"port"`
-	Password  string              `yaml:"password"`
-	Databases RedisDatabasesConfig `yaml:"databases"`
-	Pool      RedisPoolConfig     `yaml:"pool"`
+	Mode          string               `yaml:"mode"`
+	Host          string               `yaml:"host"`
+	Port          int                  `yaml:"port"`
+	Username      string               `yaml:"username"`
+	Password      string               `yaml:"password"`
+	SSL           bool                 `yaml:"ssl"`
+	TLS           TLSConfig            `yaml:"tls"`
+	Sentinel      RedisSentinelConfig  `yaml:"sentinel"`
+	Cluster       RedisClusterConfig   `yaml:"cluster"`
+	Databases     RedisDatabasesConfig `yaml:"databases"`
+	Pool          RedisPoolConfig      `yaml:"pool"`
+}
+
+// Redis topologies supported by RedisConfig.Mode
+const (
+	RedisModeStandalone = "standalone"
+	RedisModeSentinel   = "sentinel"
+	RedisModeCluster    = "cluster"
+)
+
+type RedisSentinelConfig struct {
+	MasterName string   `yaml:"master_name"`
+	Addresses  []string `yaml:"addresses"`
+	Username   string   `yaml:"username"`
+	Password   string   `yaml:"password"`
+}
+
+type RedisClusterConfig struct {
+	Nodes []string `yaml:"nodes"`
 }
 
 type RedisDatabasesConfig struct {
@@ -33,11 +59,17 @@ type RedisPoolConfig struct {
 
 // KafkaConfig holds Kafka configuration
 type KafkaConfig struct {
-	Brokers        []string                `yaml:"brokers"`
-	Topics         KafkaTopicsConfig       `yaml:"topics"`
-	ConsumerGroups KafkaConsumerGroupsConfig `yaml:"consumer_groups"`
-	Producer       KafkaProducerConfig     `yaml:"producer"`
-	Consumer       KafkaConsumerConfig     `yaml:"consumer"`
+	Brokers          StringList                `yaml:"brokers"`
+	SecurityProtocol string                    `yaml:"security_protocol"`
+	SASLMechanism    string                    `yaml:"sasl_mechanism"`
+	SASLUsername     string                    `yaml:"sasl_username"`
+	SASLPassword     string                    `yaml:"sasl_password"`
+	TLS              TLSConfig                 `yaml:"tls"`
+	Topics           KafkaTopicsConfig         `yaml:"topics"`
+	TopicSpecs       map[string]KafkaTopicSpec `yaml:"topic_specs"`
+	ConsumerGroups   KafkaConsumerGroupsConfig `yaml:"consumer_groups"`
+	Producer         KafkaProducerConfig       `yaml:"producer_config"`
+	Consumer         KafkaConsumerConfig       `yaml:"consumer_config"`
 }
 
 type KafkaTopicsConfig struct {
@@ -58,11 +90,12 @@ type KafkaConsumerGroupsConfig struct {
 }
 
 type KafkaProducerConfig struct {
-	BatchSize       int    `yaml:"batch_size"`
-	LingerMs        int    `yaml:"linger_ms"`
-	CompressionType string `yaml:"compression_type"`
-	Acks            string `yaml:"acks"`
-	Retries         int    `yaml:"retries"`
+	BatchSize         int    `yaml:"batch_size"`
+	LingerMs          int    `yaml:"linger_ms"`
+	CompressionType   string `yaml:"compression_type"`
+	Acks              string `yaml:"acks"`
+	Retries           int    `yaml:"retries"`
+	EnableIdempotence bool   `yaml:"enable_idempotence"`
 }
 
 type KafkaConsumerConfig struct {
@@ -75,12 +108,15 @@ type KafkaConsumerConfig struct {
 
 // QdrantConfig holds Qdrant vector database configuration
 type QdrantConfig struct {
-	Host        string                 `yaml:"host"`
-	HTTPPort    int                    `yaml:"http_port"`
-	GRPCPort    int                    `yaml:"grpc_port"`
-	APIKey      string                 `yaml:"api_key"`
-	Collections QdrantCollectionsConfig `yaml:"collections"`
-	Vector      QdrantVectorConfig     `yaml:"vector"`
+	Host            string                          `yaml:"host"`
+	HTTPPort        int                             `yaml:"http_port"`
+	GRPCPort        int                             `yaml:"grpc_port"`
+	APIKey          string                          `yaml:"api_key"`
+	SSL             bool                            `yaml:"ssl"`
+	TLS             TLSConfig                       `yaml:"tls"`
+	Collections     QdrantCollectionsConfig         `yaml:"collections"`
+	Vector          QdrantVectorConfig              `yaml:"vector"`
+	CollectionSpecs map[string]QdrantCollectionSpec `yaml:"collection_specs"`
 }
 
 type QdrantCollectionsConfig struct {
@@ -91,19 +127,29 @@ type QdrantCollectionsConfig struct {
 }
 
 type QdrantVectorConfig struct {
-	Size     int    `yaml:"size"`
-	Distance string `yaml:"distance"`
+	Size     int    `yaml:"size" json:"size"`
+	Distance string `yaml:"distance" json:"distance"`
 }
 
 // ElasticsearchConfig holds Elasticsearch configuration
 type ElasticsearchConfig struct {
-	Host     string                       `yaml:"host"`
-	Port     int                          `yaml:"port"`
-	Username string                       `yaml:"username"`
-	Password string                       `yaml:"password"`
-	Scheme   string                       `yaml:"scheme"`
-	Indices  ElasticsearchIndicesConfig   `yaml:"indices"`
-	Settings ElasticsearchSettingsConfig  `yaml:"settings"`
+	Host          string                            `yaml:"host"`
+	Port          int                               `yaml:"port"`
+	Nodes         []string                          `yaml:"nodes"`
+	Username      string                            `yaml:"username"`
+	Password      string                            `yaml:"password"`
+	APIKey        string                            `yaml:"api_key"`
+	BearerToken   string                            `yaml:"bearer_token"`
+	Scheme        string                            `yaml:"scheme"`
+	UseSSL        bool                              `yaml:"use_ssl"`
+	VerifyCerts   *bool                             `yaml:"verify_certs"`
+	CACert        string                            `yaml:"ca_cert"`
+	CAFingerprint string                            `yaml:"ca_fingerprint"`
+	TLS           TLSConfig                         `yaml:"tls"`
+	Indices       ElasticsearchIndicesConfig        `yaml:"indices"`
+	Settings      ElasticsearchSettingsConfig       `yaml:"settings"`
+	TemplatesFile string                            `yaml:"templates_file"`
+	IndexSpecs    map[string]ElasticsearchIndexSpec `yaml:"index_specs"`
 }
 
 type ElasticsearchIndicesConfig struct {
@@ -115,18 +161,78 @@ type ElasticsearchIndicesConfig struct {
 }
 
 type ElasticsearchSettingsConfig struct {
-	MaxRetries     int    `yaml:"max_retries"`
-	RetryOnStatus  string `yaml:"retry_on_status"`
-	Timeout        int    `yaml:"timeout"`
+	MaxRetries            int         `yaml:"max_retries"`
+	RetryOnStatus         StatusCodes `yaml:"retry_on_status"`
+	RetryBackoffMs        int         `yaml:"retry_backoff_ms"`
+	MaxRetryBackoffMs     int         `yaml:"max_retry_backoff_ms"`
+	Timeout               int         `yaml:"timeout"`
+	CompressRequestBody   bool        `yaml:"compress_request_body"`
+	DiscoverNodesOnStart  bool        `yaml:"discover_nodes_on_start"`
+	DiscoverNodesInterval int         `yaml:"discover_nodes_interval"`
 }
 
 // GetConnectionString returns the Redis connection string for a specific database
+// on the standalone server at host:port, whatever the configured mode. Use
+// GetURL when the deployment may run in cluster or sentinel mode.
 func (r *RedisConfig) GetConnectionString(database string) string {
-	dbNum := r.getDatabaseNumber(database)
-	if r.Password != "" {
-		return fmt.Sprintf("redis://:%s@%s:%d/%d", r.Password, r.Host, r.Port, dbNum)
+	u := r.baseURL()
+	u.Host = r.GetAddress()
+	u.Path = fmt.Sprintf("/%d", r.getDatabaseNumber(database))
+	return u.String()
+}
+
+// GetURL returns the connection URL for a specific database in the configured
+// mode. Cluster mode returns a go-redis cluster URL (redis.ParseClusterURL)
+// listing every node with addr parameters and no database; sentinel mode has
+// no URL form, so it returns an error and callers should use GetClientOptions.
+func (r *RedisConfig) GetURL(database string) (string, error) {
+	switch r.GetMode() {
+	case RedisModeStandalone:
+		return r.GetConnectionString(database), nil
+	case RedisModeCluster:
+		if len(r.Cluster.Nodes) == 0 {
+			return "", fmt.Errorf("redis cluster mode requires cluster.nodes")
+		}
+		u := r.baseURL()
+		u.Host = r.Cluster.Nodes[0]
+		q := url.Values{}
+		for _, node := range r.Cluster.Nodes[1:] {
+			q.Add("addr", node)
+		}
+		u.RawQuery = q.Encode()
+		return u.String(), nil
+	case RedisModeSentinel:
+		return "", fmt.Errorf("redis sentinel mode has no connection string; use GetClientOptions")
+	default:
+		return "", fmt.Errorf("unknown redis mode %q", r.Mode)
+	}
+}
+
+// baseURL returns the scheme and credentials shared by every connection URL
+func (r *RedisConfig) baseURL() url.URL {
+	u := url.URL{Scheme: "redis"}
+	if r.UseTLS() {
+		u.Scheme = "rediss"
+	}
+	if r.Username != "" {
+		u.User = url.UserPassword(r.Username, r.Password)
+	} else if r.Password != "" {
+		u.User = url.UserPassword("", r.Password)
+	}
+	return u
+}
+
+// UseTLS reports whether connections to Redis use TLS
+func (r *RedisConfig) UseTLS() bool {
+	return r.SSL || r.TLS.IsEnabled()
+}
+
+// GetMode returns the configured Redis topology, defaulting to standalone
+func (r *RedisConfig) GetMode() string {
+	if r.Mode == "" {
+		return RedisModeStandalone
 	}
-	return fmt.Sprintf("redis://%s:%d/%d", r.Host, r.Port, dbNum)
+	return r.Mode
 }
 
 // GetAddress returns the Redis address
@@ -134,8 +240,27 @@ func (r *RedisConfig) GetAddress() string {
 	return fmt.Sprintf("%s:%d", r.Host, r.Port)
 }
 
+// GetKeyPrefix returns the key prefix that isolates a purpose's keys. Cluster
+// mode has no numbered databases, so sessions, queues, websocket and cache keys
+// are namespaced by prefix instead; other modes isolate by database number and
+// return an empty prefix. NewRedisClient applies the prefix automatically.
+func (r *RedisConfig) GetKeyPrefix(purpose string) string {
+	if r.GetMode() != RedisModeCluster {
+		return ""
+	}
+	switch purpose {
+	case "sessions", "queues", "websocket", "cache":
+		return purpose + ":"
+	default:
+		return ""
+	}
+}
+
 // getDatabaseNumber returns the database number for a given purpose
 func (r *RedisConfig) getDatabaseNumber(purpose string) int {
+	if r.GetMode() == RedisModeCluster {
+		return 0
+	}
 	switch purpose {
 	case "default":
 		return r.Databases.Default
@@ -189,7 +314,7 @@ func (k *KafkaConfig) GetBrokerList() string {
 	if len(k.Brokers) == 0 {
 		return "localhost:9092"
 	}
-	return fmt.Sprintf("%v", k.Brokers)
+	return strings.Join(k.Brokers, ",")
 }
 
 // GetTopicName returns the topic name for a given event type
@@ -232,6 +357,9 @@ func (k *KafkaConsumerGroupsConfig) GetConsumerGroup(service string) string {
 
 // GetHTTPURL returns the Qdrant HTTP URL
 func (q *QdrantConfig) GetHTTPURL() string {
+	if q.SSL || q.TLS.IsEnabled() {
+		return fmt.Sprintf("https://%s:%d", q.Host, q.HTTPPort)
+	}
 	return fmt.Sprintf("http://%s:%d", q.Host, q.HTTPPort)
 }
 
@@ -256,9 +384,35 @@ func (q *QdrantCollectionsConfig) GetCollectionName(purpose string) string {
 	}
 }
 
-// GetURL returns the Elasticsearch URL
+// GetURL returns the Elasticsearch URL without credentials
 func (e *ElasticsearchConfig) GetURL() string {
-	return fmt.Sprintf("%s://%s:%d", e.Scheme, e.Host, e.Port)
+	return fmt.Sprintf("%s://%s:%d", e.GetScheme(), e.Host, e.Port)
+}
+
+// GetConnectionString returns the Elasticsearch URL with escaped basic auth credentials
+func (e *ElasticsearchConfig) GetConnectionString() string {
+	u := url.URL{Scheme: e.GetScheme(), Host: fmt.Sprintf("%s:%d", e.Host, e.Port)}
+	if e.Username != "" {
+		u.User = url.UserPassword(e.Username, e.Password)
+	}
+	return u.String()
+}
+
+// GetScheme returns the URL scheme, honouring UseSSL when Scheme is unset
+func (e *ElasticsearchConfig) GetScheme() string {
+	switch {
+	case e.Scheme != "":
+		return e.Scheme
+	case e.UseSSL || e.TLS.IsEnabled():
+		return "https"
+	default:
+		return "http"
+	}
+}
+
+// GetVerifyCerts reports whether server certificates are verified (default true)
+func (e *ElasticsearchConfig) GetVerifyCerts() bool {
+	return e.VerifyCerts == nil || *e.VerifyCerts
 }
 
 // GetIndexName returns the index name for a given purpose
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
@@ -27,6 +28,10 @@ type Config struct {
 	Logging          LoggingConfig          `yaml:"logging"`
 	HealthCheck      HealthCheckConfig      `yaml:"health_check"`
 	Features         FeaturesConfig         `yaml:"features"`
+	Validation       ValidationConfig       `yaml:"validation"`
+	Modules          []ModuleConfig         `yaml:"modules"`
+	Infrastructure   InfrastructureConfig   `yaml:"infrastructure"`
+	Startup          StartupConfig          `yaml:"startup"`
 }
 
 type EnvironmentConfig struct {
@@ -56,26 +61,97 @@ type SearchConfig struct {
 }
 
 type MonitoringConfig struct {
-	Prometheus PrometheusConfig `yaml:"prometheus"`
-	Grafana    GrafanaConfig    `yaml:"grafana"`
-	Jaeger     JaegerConfig     `yaml:"jaeger"`
+	Prometheus PrometheusConfig        `yaml:"prometheus"`
+	Grafana    GrafanaConfig           `yaml:"grafana"`
+	Jaeger     JaegerConfig            `yaml:"jaeger"`
+	Logging    MonitoringLoggingConfig `yaml:"logging"`
+}
+
+type JaegerConfig struct {
+	Host      string `yaml:"host"`
+	Port      int    `yaml:"port"`
+	GRPCPort  int    `yaml:"grpc_port"`
+	HTTPPort  int    `yaml:"http_port"`
+	AgentHost string `yaml:"agent_host"`
+	AgentPort int    `yaml:"agent_port"`
+}
+
+type PrometheusConfig struct {
+	Host               string `yaml:"host"`
+	Port               int    `yaml:"port"`
+	ScrapeInterval     string `yaml:"scrape_interval"`
+	EvaluationInterval string `yaml:"evaluation_interval"`
+}
+
+type GrafanaConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
 }
 
 type RealtimeConfig struct {
 	WebSocket WebSocketConfig `yaml:"websocket"`
 }
 
+type WebSocketConfig struct {
+	Host        string     `yaml:"host"`
+	Port        int        `yaml:"port"`
+	Path        string     `yaml:"path"`
+	CORSOrigins StringList `yaml:"cors_origins"`
+	SSL         bool       `yaml:"ssl"`
+	Transports  []string   `yaml:"transports"`
+	TLS         TLSConfig  `yaml:"tls"`
+}
+
+// UseTLS reports whether clients connect to the WebSocket server over TLS
+func (w *WebSocketConfig) UseTLS() bool {
+	return w.SSL || w.TLS.IsEnabled()
+}
+
 type SecurityConfig struct {
 	JWT        JWTConfig        `yaml:"jwt"`
 	Encryption EncryptionConfig `yaml:"encryption"`
 	CORS       CORSConfig       `yaml:"cors"`
 }
 
+type JWTConfig struct {
+	Secret        string `yaml:"secret"`
+	AccessExpiry  int    `yaml:"access_token_expiry"`
+	RefreshExpiry int    `yaml:"refresh_token_expiry"`
+	Algorithm     string `yaml:"algorithm"`
+}
+
+type EncryptionConfig struct {
+	Key                  string   `yaml:"key"`
+	Algorithm            string   `yaml:"algorithm"`
+	RequiredEnvironments []string `yaml:"required_environments"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins   StringList `yaml:"allowed_origins"`
+	AllowedMethods   []string   `yaml:"allowed_methods"`
+	AllowedHeaders   []string   `yaml:"allowed_headers"`
+	AllowCredentials bool       `yaml:"allow_credentials"`
+}
+
 type ServiceDiscoveryConfig struct {
 	Consul     ConsulConfig     `yaml:"consul"`
 	Kubernetes KubernetesConfig `yaml:"kubernetes"`
 }
 
+type ConsulConfig struct {
+	Host       string `yaml:"host"`
+	Port       int    `yaml:"port"`
+	Scheme     string `yaml:"scheme"`
+	Datacenter string `yaml:"datacenter"`
+}
+
+type KubernetesConfig struct {
+	Namespace     string `yaml:"namespace"`
+	ClusterDomain string `yaml:"cluster_domain"`
+}
+
 type LoggingConfig struct {
 	Level        string                 `yaml:"level"`
 	Format       string                 `yaml:"format"`
@@ -84,6 +160,11 @@ type LoggingConfig struct {
 	Fields       map[string]interface{} `yaml:"fields"`
 }
 
+type LogDestinationsConfig struct {
+	Elasticsearch bool `yaml:"elasticsearch"`
+	Kafka         bool `yaml:"kafka"`
+}
+
 type HealthCheckConfig struct {
 	Enabled      bool                    `yaml:"enabled"`
 	Endpoint     string                  `yaml:"endpoint"`
@@ -93,9 +174,48 @@ type HealthCheckConfig struct {
 }
 
 type HealthCheckDependency struct {
-	Name     string `yaml:"name"`
-	Type     string `yaml:"type"`
-	Critical bool   `yaml:"critical"`
+	Name     string    `yaml:"name"`
+	Type     string    `yaml:"type"`
+	Critical bool      `yaml:"critical"`
+	Target   string    `yaml:"target"`
+	Service  string    `yaml:"service"`
+	TLS      TLSConfig `yaml:"tls"`
+}
+
+// ModuleConfig describes a service declared under modules in config.yaml
+type ModuleConfig struct {
+	Name           string            `yaml:"name"`
+	Description    string            `yaml:"description"`
+	Type           string            `yaml:"type"`
+	Language       string            `yaml:"language"`
+	Framework      string            `yaml:"framework"`
+	Database       string            `yaml:"database"`
+	DatabaseName   string            `yaml:"database_name"`
+	ConsumerGroup  string            `yaml:"consumer_group"`
+	Service        string            `yaml:"service"`
+	Ports          ModulePortsConfig `yaml:"ports"`
+	Dependencies   []string          `yaml:"dependencies"`
+	Integrations   []string          `yaml:"integrations"`
+	Host           string            `yaml:"host"`
+	HealthEndpoint string            `yaml:"health_endpoint"`
+}
+
+type ModulePortsConfig struct {
+	HTTP int `yaml:"http"`
+	GRPC int `yaml:"grpc"`
+}
+
+// InfrastructureConfig groups the infrastructure services declared in
+// config.yaml by kind (databases, messaging, search, ...)
+type InfrastructureConfig map[string]map[string]InfrastructureServiceConfig
+
+type InfrastructureServiceConfig struct {
+	Description string         `yaml:"description"`
+	Version     string         `yaml:"version"`
+	Technology  string         `yaml:"technology"`
+	Port        int            `yaml:"port"`
+	Ports       map[string]int `yaml:"ports"`
+	UsedBy      []string       `yaml:"used_by"`
 }
 
 type FeaturesConfig struct {
@@ -106,6 +226,133 @@ type FeaturesConfig struct {
 	WebSocketEnabled  bool `yaml:"websocket_enabled"`
 }
 
+// configFilePath is the main config file, relative to the repository root
+const configFilePath = "shared-config/config.yaml"
+
+// envFilePath is the .env file of an environment, relative to the
+// repository root
+func envFilePath(environment string) string {
+	return fmt.Sprintf("shared-config/environments/%s.env", environment)
+}
+
+// environmentFilePath is the YAML file of an environment, relative to the
+// repository root
+func environmentFilePath(environment string) string {
+	return fmt.Sprintf("shared-config/environments/%s.yaml", environment)
+}
+
+// EnvironmentSection maps a section of an environment YAML file, e.g.
+// databases.postgresql, onto the setting it configures. Field is the Go path
+// of the setting in Config.
+type EnvironmentSection struct {
+	File  string
+	Field string
+}
+
+// environmentSections are the sections of environments/<env>.yaml read by
+// Load, overlaid on config.yaml
+var environmentSections = []EnvironmentSection{
+	{"environment.name", "Environment.Current"},
+	{"databases.postgresql", "Database.PostgreSQL"},
+	{"databases.mongodb", "Database.MongoDB"},
+	{"databases.redis", "Cache.Redis"},
+	{"databases.qdrant", "VectorDatabase.Qdrant"},
+	{"messaging.kafka", "MessageBroker.Kafka"},
+	{"search", "Search"},
+	{"monitoring", "Monitoring"},
+	{"health_check", "HealthCheck"},
+	{"realtime", "Realtime"},
+	{"security", "Security"},
+}
+
+// loadEnvironmentFile overlays the sections of an environment YAML file on
+// config. ${VAR} and ${VAR:default} references are expanded first.
+func (c *Config) loadEnvironmentFile(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("error reading environment file: %w", err)
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return fmt.Errorf("error parsing environment file %s: %w", file, err)
+	}
+	expandNode(&root, os.LookupEnv)
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = *root.Content[0]
+	}
+
+	for _, section := range environmentSections {
+		node := &root
+		for _, name := range strings.Split(section.File, ".") {
+			if node = childNode(node, name); node == nil {
+				break
+			}
+		}
+		if node == nil {
+			continue
+		}
+		field := reflect.ValueOf(c).Elem()
+		for _, name := range strings.Split(section.Field, ".") {
+			field = field.FieldByName(name)
+		}
+		if err := node.Decode(field.Addr().Interface()); err != nil {
+			return fmt.Errorf("error parsing %s in %s: %w", section.File, file, err)
+		}
+	}
+	return nil
+}
+
+// expandNode expands environment references in every scalar of a YAML tree.
+// Expanded plain scalars are retyped so ${PORT:5432} decodes as a number.
+func expandNode(n *yaml.Node, lookup func(string) (string, bool)) {
+	if n.Kind == yaml.ScalarNode {
+		if value := expandEnv(n.Value, lookup); value != n.Value {
+			n.Value = value
+			if n.Style == 0 {
+				n.Tag = ""
+			}
+		}
+	}
+	for _, child := range n.Content {
+		expandNode(child, lookup)
+	}
+}
+
+// expandEnv substitutes $VAR and ${VAR}, and also ${VAR:default} and
+// ${VAR:-default}, which fall back to default when VAR is unset or empty
+func expandEnv(s string, lookup func(string) (string, bool)) string {
+	return os.Expand(s, func(name string) string {
+		name, def, hasDefault := strings.Cut(name, ":")
+		value, _ := lookup(name)
+		if value == "" && hasDefault {
+			return strings.TrimPrefix(def, "-")
+		}
+		return value
+	})
+}
+
+// StringList is a list that may also be written as a comma-separated
+// string, as environment files do with ${KAFKA_BROKERS}
+type StringList []string
+
+func (l *StringList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*l = nil
+		for _, item := range strings.Split(value.Value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*l = append(*l, item)
+			}
+		}
+		return nil
+	}
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
 // Load loads the configuration from various sources
 func Load() (*Config, error) {
 	config := &Config{}
@@ -114,7 +361,7 @@ func Load() (*Config, error) {
 	env := getEnv("ERP_ENVIRONMENT", "development")
 
 	// Load environment-specific .env file
-	envFile := fmt.Sprintf("shared-config/environments/%s.env", env)
+	envFile := envFilePath(env)
 	if _, err := os.Stat(envFile); err == nil {
 		if err := godotenv.Load(envFile); err != nil {
 			return nil, fmt.Errorf("error loading %s: %w", envFile, err)
@@ -122,31 +369,55 @@ func Load() (*Config, error) {
 	}
 
 	// Load main config.yaml
-	configFile := "shared-config/config.yaml"
-	if _, err := os.Stat(configFile); err == nil {
-		data, err := os.ReadFile(configFile)
+	if _, err := os.Stat(configFilePath); err == nil {
+		data, err := os.ReadFile(configFilePath)
 		if err != nil {
 			return nil, fmt.Errorf("error reading config file: %w", err)
 		}
 
-		// Expand environment variables in YAML
-		expandedData := os.ExpandEnv(string(data))
-
-		if err := yaml.Unmarshal([]byte(expandedData), config); err != nil {
+		// Expand environment variables in YAML, with the same ${VAR:default}
+		// syntax as the environment file
+		var root yaml.Node
+		if err := yaml.Unmarshal(data, &root); err != nil {
+			return nil, fmt.Errorf("error parsing config file: %w", err)
+		}
+		expandNode(&root, os.LookupEnv)
+		if err := root.Decode(config); err != nil {
 			return nil, fmt.Errorf("error parsing config file: %w", err)
 		}
 	}
 
+	// Overlay the environment's YAML file
+	envYAML := environmentFilePath(env)
+	if _, err := os.Stat(envYAML); err == nil {
+		if err := config.loadEnvironmentFile(envYAML); err != nil {
+			return nil, err
+		}
+	}
+
 	// Override with environment variables
-	config.overrideWithEnvVars()
+	if err := config.overrideWithEnvVars(); err != nil {
+		return nil, fmt.Errorf("error applying environment variables: %w", err)
+	}
+	if err := config.DecryptValues(); err != nil {
+		return nil, fmt.Errorf("error decrypting configuration: %w", err)
+	}
+	if config.Environment.Current == "" {
+		config.Environment.Current = env
+	}
+
+	// Derive unset resource names from the naming conventions
+	config.ApplyNamingDefaults()
+
+	if err := config.ValidateTLS(); err != nil {
+		return nil, fmt.Errorf("invalid tls configuration: %w", err)
+	}
 
 	return config, nil
 }
 
 // LoadFromPath loads configuration from a specific path
 func LoadFromPath(configPath string) (*Config, error) {
-	config := &Config{}
-
 	// Change to the specified directory
 	originalDir, err := os.Getwd()
 	if err != nil {
@@ -161,43 +432,114 @@ func LoadFromPath(configPath string) (*Config, error) {
 	return Load()
 }
 
-// overrideWithEnvVars overrides configuration with environment variables
-func (c *Config) overrideWithEnvVars() {
+// EnvBinding is an environment variable that overrides a setting. Field is
+// the Go path of the setting in Config, e.g. Database.PostgreSQL.Host.
+type EnvBinding struct {
+	Var   string
+	Field string
+}
+
+// envBindings are the variables read by overrideWithEnvVars. Lists are
+// comma-separated and only replace the configured list when set.
+var envBindings = []EnvBinding{
 	// Environment
-	c.Environment.Current = getEnv("ERP_ENVIRONMENT", c.Environment.Current)
+	{"ERP_ENVIRONMENT", "Environment.Current"},
 
 	// Database - PostgreSQL
-	c.Database.PostgreSQL.Host = getEnv("POSTGRES_HOST", c.Database.PostgreSQL.Host)
-	c.Database.PostgreSQL.Port = getEnvAsInt("POSTGRES_PORT", c.Database.PostgreSQL.Port)
-	c.Database.PostgreSQL.Username = getEnv("POSTGRES_USER", c.Database.PostgreSQL.Username)
-	c.Database.PostgreSQL.Password = getEnv("POSTGRES_PASSWORD", c.Database.PostgreSQL.Password)
-	c.Database.PostgreSQL.SSLMode = getEnv("POSTGRES_SSL_MODE", c.Database.PostgreSQL.SSLMode)
+	{"POSTGRES_HOST", "Database.PostgreSQL.Host"},
+	{"POSTGRES_PORT", "Database.PostgreSQL.Port"},
+	{"POSTGRES_USER", "Database.PostgreSQL.Username"},
+	{"POSTGRES_PASSWORD", "Database.PostgreSQL.Password"},
+	{"POSTGRES_SSL_MODE", "Database.PostgreSQL.SSLMode"},
+	{"POSTGRES_DRIVER", "Database.PostgreSQL.Driver"},
 
 	// Database - MongoDB
-	c.Database.MongoDB.Host = getEnv("MONGODB_HOST", c.Database.MongoDB.Host)
-	c.Database.MongoDB.Port = getEnvAsInt("MONGODB_PORT", c.Database.MongoDB.Port)
-	c.Database.MongoDB.Username = getEnv("MONGODB_USER", c.Database.MongoDB.Username)
-	c.Database.MongoDB.Password = getEnv("MONGODB_PASSWORD", c.Database.MongoDB.Password)
+	{"MONGODB_HOST", "Database.MongoDB.Host"},
+	{"MONGODB_PORT", "Database.MongoDB.Port"},
+	{"MONGODB_USER", "Database.MongoDB.Username"},
+	{"MONGODB_PASSWORD", "Database.MongoDB.Password"},
+	{"MONGODB_REPLICA_SET", "Database.MongoDB.ReplicaSet"},
+	{"MONGODB_SSL", "Database.MongoDB.SSL"},
+	{"MONGODB_HOSTS", "Database.MongoDB.Hosts"},
 
 	// Cache - Redis
-	c.Cache.Redis.Host = getEnv("REDIS_HOST", c.Cache.Redis.Host)
-	c.Cache.Redis.Port = getEnvAsInt("REDIS_PORT", c.Cache.Redis.Port)
-	c.Cache.Redis.Password = getEnv("REDIS_PASSWORD", c.Cache.Redis.Password)
+	{"REDIS_HOST", "Cache.Redis.Host"},
+	{"REDIS_PORT", "Cache.Redis.Port"},
+	{"REDIS_PASSWORD", "Cache.Redis.Password"},
+	{"REDIS_MODE", "Cache.Redis.Mode"},
+	{"REDIS_USERNAME", "Cache.Redis.Username"},
+	{"REDIS_SSL", "Cache.Redis.SSL"},
+	{"REDIS_SENTINEL_MASTER", "Cache.Redis.Sentinel.MasterName"},
+	{"REDIS_SENTINEL_ADDRESSES", "Cache.Redis.Sentinel.Addresses"},
+	{"REDIS_CLUSTER_NODES", "Cache.Redis.Cluster.Nodes"},
 
 	// Message Broker - Kafka
-	if brokers := getEnv("KAFKA_BROKERS", ""); brokers != "" {
-		c.MessageBroker.Kafka.Brokers = strings.Split(brokers, ",")
-	}
+	{"KAFKA_BROKERS", "MessageBroker.Kafka.Brokers"},
+	{"KAFKA_SECURITY_PROTOCOL", "MessageBroker.Kafka.SecurityProtocol"},
+	{"KAFKA_SASL_MECHANISM", "MessageBroker.Kafka.SASLMechanism"},
+	{"KAFKA_SASL_USERNAME", "MessageBroker.Kafka.SASLUsername"},
+	{"KAFKA_SASL_PASSWORD", "MessageBroker.Kafka.SASLPassword"},
+
+	// Search - Elasticsearch
+	{"ELASTICSEARCH_USERNAME", "Search.Elasticsearch.Username"},
+	{"ELASTICSEARCH_PASSWORD", "Search.Elasticsearch.Password"},
+	{"ELASTICSEARCH_API_KEY", "Search.Elasticsearch.APIKey"},
+	{"ELASTICSEARCH_CA_CERT", "Search.Elasticsearch.CACert"},
+	{"ELASTICSEARCH_CA_FINGERPRINT", "Search.Elasticsearch.CAFingerprint"},
+	{"ELASTICSEARCH_NODES", "Search.Elasticsearch.Nodes"},
+
+	// Monitoring - Jaeger
+	{"JAEGER_HOST", "Monitoring.Jaeger.Host"},
+	{"JAEGER_PORT", "Monitoring.Jaeger.Port"},
 
 	// Security - JWT
-	c.Security.JWT.Secret = getEnv("JWT_SECRET", c.Security.JWT.Secret)
-	c.Security.JWT.AccessExpiry = getEnvAsInt("JWT_ACCESS_EXPIRY", c.Security.JWT.AccessExpiry)
-	c.Security.JWT.RefreshExpiry = getEnvAsInt("JWT_REFRESH_EXPIRY", c.Security.JWT.RefreshExpiry)
+	{"JWT_SECRET", "Security.JWT.Secret"},
+	{"JWT_ACCESS_EXPIRY", "Security.JWT.AccessExpiry"},
+	{"JWT_REFRESH_EXPIRY", "Security.JWT.RefreshExpiry"},
 
 	// Logging
-	c.Logging.Level = getEnv("LOG_LEVEL", c.Logging.Level)
-	c.Logging.Format = getEnv("LOG_FORMAT", c.Logging.Format)
-	c.Logging.Output = getEnv("LOG_OUTPUT", c.Logging.Output)
+	{"LOG_LEVEL", "Logging.Level"},
+	{"LOG_FORMAT", "Logging.Format"},
+	{"LOG_OUTPUT", "Logging.Output"},
+}
+
+// apply overrides the bound field of config when the variable is set
+func (b EnvBinding) apply(config reflect.Value) error {
+	field := config
+	for _, name := range strings.Split(b.Field, ".") {
+		if field.Kind() != reflect.Struct {
+			return fmt.Errorf("%s is bound to %s, which is not a struct field", b.Var, b.Field)
+		}
+		if field = field.FieldByName(name); !field.IsValid() {
+			return fmt.Errorf("%s is bound to %s, which does not exist", b.Var, b.Field)
+		}
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(getEnv(b.Var, field.String()))
+	case reflect.Int:
+		field.SetInt(int64(getEnvAsInt(b.Var, int(field.Int()))))
+	case reflect.Bool:
+		field.SetBool(getEnvAsBool(b.Var, field.Bool()))
+	case reflect.Slice:
+		if value := getEnv(b.Var, ""); value != "" {
+			field.Set(reflect.ValueOf(strings.Split(value, ",")))
+		}
+	default:
+		return fmt.Errorf("%s is bound to %s, which has unsupported type %s", b.Var, b.Field, field.Type())
+	}
+	return nil
+}
+
+// overrideWithEnvVars overrides configuration with environment variables
+func (c *Config) overrideWithEnvVars() error {
+	for _, binding := range envBindings {
+		if err := binding.apply(reflect.ValueOf(c).Elem()); err != nil {
+			return err
+		}
+	}
+	c.Database.PostgreSQL.overrideRolesWithEnvVars()
+	return nil
 }
 
 // Helper functions
@@ -0,0 +1,201 @@
+package sharedconfig
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// repoRoot is the repository root, which Load resolves shared-config/ against
+var repoRoot = filepath.Join("..", "..", "..")
+
+// loadEnvironment loads the repository's configuration for an environment
+func loadEnvironment(t *testing.T, env string) *Config {
+	t.Helper()
+	t.Setenv("ERP_ENVIRONMENT", env)
+	root, err := filepath.Abs(repoRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadFromPath(root)
+	if err != nil {
+		t.Fatalf("LoadFromPath(%s) with ERP_ENVIRONMENT=%s: %v", root, env, err)
+	}
+	return config
+}
+
+func TestLoadReadsEnvironmentFile(t *testing.T) {
+	staging := loadEnvironment(t, "staging")
+	test := loadEnvironment(t, "testing")
+
+	if got := staging.Database.PostgreSQL.Host; got != "postgres-staging.internal" {
+		t.Errorf("staging postgresql host = %q", got)
+	}
+	if got := test.Database.PostgreSQL.Host; got != "localhost" {
+		t.Errorf("testing postgresql host = %q", got)
+	}
+	if got := []string(staging.MessageBroker.Kafka.Brokers); !reflect.DeepEqual(got, []string{"kafka-staging.internal:9092"}) {
+		t.Errorf("staging kafka brokers = %v", got)
+	}
+	if got := staging.MessageBroker.Kafka.Producer.BatchSize; got != 32768 {
+		t.Errorf("staging kafka producer batch_size = %d", got)
+	}
+	if got := staging.Cache.Redis.Host; got != "redis-staging.internal" {
+		t.Errorf("staging redis host = %q", got)
+	}
+}
+
+func TestLoadEnvironmentFileExpandsDefaultsAndOverrides(t *testing.T) {
+	t.Setenv("POSTGRES_PORT", "6543")
+	t.Setenv("KAFKA_BROKERS", "k1:9092,k2:9092")
+	staging := loadEnvironment(t, "staging")
+
+	if got := staging.Database.PostgreSQL.Port; got != 6543 {
+		t.Errorf("postgresql port = %d, want 6543 from POSTGRES_PORT", got)
+	}
+	if got := []string(staging.MessageBroker.Kafka.Brokers); !reflect.DeepEqual(got, []string{"k1:9092", "k2:9092"}) {
+		t.Errorf("kafka brokers = %v", got)
+	}
+	if got := staging.Database.MongoDB.Port; got != 27017 {
+		t.Errorf("mongodb port = %d, want the ${MONGODB_PORT:27017} default", got)
+	}
+}
+
+func TestLoadEnvironmentFileSpecsReachEnsureTopics(t *testing.T) {
+	staging := loadEnvironment(t, "staging")
+	admin := &fakeTopicAdmin{topics: map[string]KafkaTopicState{}}
+
+	if _, err := EnsureTopics(context.Background(), admin, &staging.MessageBroker.Kafka, false); err != nil {
+		t.Fatalf("EnsureTopics: %v", err)
+	}
+	auth := admin.topics["auth-events-staging"]
+	if auth.Partitions != 6 || auth.ReplicationFactor != 3 {
+		t.Errorf("auth-events-staging = %+v, want the staging default of 6 partitions and replication 3", auth)
+	}
+	if got := auth.Configs["retention.ms"]; got != "2592000000" {
+		t.Errorf("auth-events-staging retention.ms = %q", got)
+	}
+	if got := admin.topics["system-events-staging"].Partitions; got != 3 {
+		t.Errorf("system-events-staging partitions = %d, want 3", got)
+	}
+}
+
+func TestLoadEnvironmentFileSections(t *testing.T) {
+	staging := loadEnvironment(t, "staging")
+
+	if got := staging.VectorDatabase.Qdrant.CollectionSpecs["documents"].HNSW.M; got != 16 {
+		t.Errorf("qdrant documents hnsw.m = %d", got)
+	}
+	es := staging.Search.Elasticsearch
+	if got := es.IndexSpecs["contacts"].Version; got != 1 {
+		t.Errorf("elasticsearch contacts version = %d", got)
+	}
+	if got := es.Settings.MaxRetries; got != 3 {
+		t.Errorf("elasticsearch settings.max_retries = %d", got)
+	}
+	if pg := staging.Database.PostgreSQL; pg.SSLMode != "require" || pg.TLS.IsEnabled() {
+		t.Errorf("postgresql ssl_mode = %q, tls = %+v", pg.SSLMode, pg.TLS)
+	}
+	if got := staging.Database.PostgreSQL.GetModuleRoles("analytics").ReadOnly; got == nil || got.Username != "erp_reporting" {
+		t.Errorf("analytics readonly role = %+v", got)
+	}
+	if got := staging.Database.MongoDB.CollectionSpecs["logs"]["audit_logs"].Capped; got == nil || got.SizeBytes != 1073741824 {
+		t.Errorf("mongodb logs.audit_logs capped = %+v", got)
+	}
+	if got := len(staging.HealthCheck.Dependencies); got != 5 {
+		t.Errorf("health_check dependencies = %d, want 5", got)
+	}
+}
+
+func TestLoadEnvironmentFileAPIKeyFromEnv(t *testing.T) {
+	t.Setenv("ELASTICSEARCH_API_KEY", "es-key")
+	if got := loadEnvironment(t, "staging").Search.Elasticsearch.APIKey; got != "es-key" {
+		t.Errorf("elasticsearch api_key = %q", got)
+	}
+}
+
+func TestStringListAcceptsScalarsAndSequences(t *testing.T) {
+	var v struct {
+		A StringList `yaml:"a"`
+		B StringList `yaml:"b"`
+	}
+	if err := yaml.Unmarshal([]byte("a: x:1, y:2\nb: [p, q]\n"), &v); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual([]string(v.A), []string{"x:1", "y:2"}) || !reflect.DeepEqual([]string(v.B), []string{"p", "q"}) {
+		t.Errorf("got %v and %v", v.A, v.B)
+	}
+}
+
+func TestLoadExpandsConfigFileLikeEnvironmentFile(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "shared-config"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	config := `
+logging:
+  level: ${ERP_TEST_LOG_LEVEL:warn}
+  format: "${ERP_TEST_LOG_FORMAT:-json}"
+database:
+  postgresql:
+    port: ${ERP_TEST_POSTGRES_PORT:5432}
+    password: ${ERP_TEST_POSTGRES_PASSWORD}
+`
+	if err := os.WriteFile(filepath.Join(root, "shared-config", "config.yaml"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the bound variables would override the file
+	for _, name := range []string{"LOG_LEVEL", "LOG_FORMAT", "POSTGRES_PORT", "POSTGRES_PASSWORD"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("ERP_ENVIRONMENT", "testing")
+	t.Setenv("ERP_TEST_POSTGRES_PORT", "6543")
+	t.Setenv("ERP_TEST_POSTGRES_PASSWORD", "p#ss: word")
+
+	cfg, err := LoadFromPath(root)
+	if err != nil {
+		t.Fatalf("LoadFromPath: %v", err)
+	}
+	if cfg.Logging.Level != "warn" || cfg.Logging.Format != "json" {
+		t.Errorf("logging = %q, %q, want the ${VAR:default} defaults", cfg.Logging.Level, cfg.Logging.Format)
+	}
+	if cfg.Database.PostgreSQL.Port != 6543 {
+		t.Errorf("postgresql port = %d, want 6543", cfg.Database.PostgreSQL.Port)
+	}
+	if cfg.Database.PostgreSQL.Password != "p#ss: word" {
+		t.Errorf("postgresql password = %q, want it read verbatim", cfg.Database.PostgreSQL.Password)
+	}
+}
+
+func TestEnvBindingApply(t *testing.T) {
+	for _, b := range envBindings {
+		t.Setenv(b.Var, "1")
+	}
+	cfg := &Config{}
+	if err := cfg.overrideWithEnvVars(); err != nil {
+		t.Fatalf("overrideWithEnvVars: %v", err)
+	}
+	if cfg.Logging.Level != "1" || cfg.Monitoring.Jaeger.Port != 1 {
+		t.Errorf("bindings were not applied: %+v", cfg.Logging)
+	}
+
+	tests := []struct {
+		field string
+		want  string
+	}{
+		{"Logging.Fields", "unsupported type map[string]interface {}"},
+		{"Logging.Lvl", "does not exist"},
+		{"Logging.Level.Name", "not a struct field"},
+	}
+	for _, tt := range tests {
+		b := EnvBinding{Var: "ERP_TEST_BINDING", Field: tt.field}
+		if err := b.apply(reflect.ValueOf(cfg).Elem()); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.field, err, tt.want)
+		}
+	}
+}
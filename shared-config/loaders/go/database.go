@@ -2,20 +2,28 @@ package sharedconfig
 
 import (
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
 )
 
 // PostgreSQLConfig holds PostgreSQL configuration
 type PostgreSQLConfig struct {
-	Host               string                    `yaml:"host"`
-	Port               int                       `yaml:"port"`
-	Username           string                    `yaml:"username"`
-	Password           string                    `yaml:"password"`
-	SSLMode            string                    `yaml:"ssl_mode"`
-	MaxConnections     int                       `yaml:"max_connections"`
-	ConnectionTimeout  int                       `yaml:"connection_timeout"`
-	Databases          PostgreSQLDatabasesConfig `yaml:"databases"`
-	Pool               PostgreSQLPoolConfig      `yaml:"pool"`
+	Host                string                           `yaml:"host"`
+	Port                int                              `yaml:"port"`
+	Username            string                           `yaml:"username"`
+	Password            string                           `yaml:"password"`
+	SSLMode             string                           `yaml:"ssl_mode"`
+	MaxConnections      int                              `yaml:"max_connections"`
+	ConnectionTimeout   int                              `yaml:"connection_timeout"`
+	Driver              string                           `yaml:"driver"`
+	TLS                 TLSConfig                        `yaml:"tls"`
+	Databases           PostgreSQLDatabasesConfig        `yaml:"databases"`
+	Pool                PostgreSQLPoolConfig             `yaml:"pool"`
+	Retry               PostgreSQLRetryConfig            `yaml:"retry"`
+	Migrations          PostgreSQLMigrationsConfig       `yaml:"migrations"`
+	Roles               map[string]PostgreSQLModuleRoles `yaml:"roles"`
+	MaintenanceDatabase string                           `yaml:"maintenance_database"`
 }
 
 type PostgreSQLDatabasesConfig struct {
@@ -37,13 +45,23 @@ type PostgreSQLPoolConfig struct {
 
 // MongoDBConfig holds MongoDB configuration
 type MongoDBConfig struct {
-	Host       string                 `yaml:"host"`
-	Port       int                    `yaml:"port"`
-	Username   string                 `yaml:"username"`
-	Password   string                 `yaml:"password"`
-	AuthSource string                 `yaml:"auth_source"`
-	Databases  MongoDBDatabasesConfig `yaml:"databases"`
-	Options    MongoDBOptionsConfig   `yaml:"options"`
+	Host           string                 `yaml:"host"`
+	Port           int                    `yaml:"port"`
+	Hosts          []string               `yaml:"hosts"`
+	SRV            bool                   `yaml:"srv"`
+	Username       string                 `yaml:"username"`
+	Password       string                 `yaml:"password"`
+	AuthSource     string                 `yaml:"auth_source"`
+	ReplicaSet     string                 `yaml:"replica_set"`
+	ReadPreference string                 `yaml:"read_preference"`
+	WriteConcern   string                 `yaml:"write_concern"`
+	SSL            bool                   `yaml:"ssl"`
+	TLS            TLSConfig              `yaml:"tls"`
+	Databases      MongoDBDatabasesConfig `yaml:"databases"`
+	Options        MongoDBOptionsConfig   `yaml:"options"`
+	// CollectionSpecs maps a database purpose (analytics, logs, ...) to its
+	// collections, see EnsureMongo
+	CollectionSpecs map[string]map[string]MongoCollectionSpec `yaml:"collection_specs"`
 }
 
 type MongoDBDatabasesConfig struct {
@@ -60,18 +78,86 @@ type MongoDBOptionsConfig struct {
 	ServerSelectionTimeout   int `yaml:"server_selection_timeout"`
 }
 
-// GetConnectionString returns the PostgreSQL connection string for a specific database
+// GetConnectionString returns the PostgreSQL connection string for a specific
+// database, using the module's app role credentials. Without an app role
+// password PostgreSQL rejects the connection; GetCredentials reports why.
 func (p *PostgreSQLConfig) GetConnectionString(database string) string {
 	dbName := p.getDatabaseName(database)
-	return fmt.Sprintf("postgresql://%s:%s@%s:%d/%s?sslmode=%s",
-		p.Username, p.Password, p.Host, p.Port, dbName, p.SSLMode)
+	username, password, _ := p.GetCredentials(database, PostgreSQLRoleApp)
+	conn := fmt.Sprintf("postgresql://%s@%s:%d/%s?sslmode=%s",
+		url.UserPassword(username, password).String(), p.Host, p.Port, dbName, p.GetSSLMode())
+	for _, param := range p.tlsParams() {
+		conn += fmt.Sprintf("&%s=%s", param[0], url.QueryEscape(param[1]))
+	}
+	return conn
 }
 
-// GetDSN returns the PostgreSQL DSN for a specific database
+// GetDSN returns the PostgreSQL DSN for a specific database, using the
+// module's app role credentials. Without an app role password PostgreSQL
+// rejects the connection; use GetDSNAs to get the error up front.
 func (p *PostgreSQLConfig) GetDSN(database string) string {
-	dbName := p.getDatabaseName(database)
-	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		p.Host, p.Port, p.Username, p.Password, dbName, p.SSLMode)
+	username, password, _ := p.GetCredentials(database, PostgreSQLRoleApp)
+	return p.dsn(p.getDatabaseName(database), username, password)
+}
+
+// GetDSNAs returns the PostgreSQL DSN for a specific database, connecting as
+// role. It fails when the role has no password.
+func (p *PostgreSQLConfig) GetDSNAs(database string, role PostgreSQLRole) (string, error) {
+	username, password, err := p.GetCredentials(database, role)
+	if err != nil {
+		return "", err
+	}
+	return p.dsn(p.getDatabaseName(database), username, password), nil
+}
+
+func (p *PostgreSQLConfig) dsn(dbName, username, password string) string {
+	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		quoteDSNValue(p.Host), p.Port, quoteDSNValue(username), quoteDSNValue(password),
+		quoteDSNValue(dbName), p.GetSSLMode())
+	for _, param := range p.tlsParams() {
+		dsn += fmt.Sprintf(" %s=%s", param[0], quoteDSNValue(param[1]))
+	}
+	return dsn
+}
+
+// quoteDSNValue quotes a libpq keyword/value when it is empty or contains
+// whitespace, quotes or backslashes
+func quoteDSNValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\n'\\") {
+		return value
+	}
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
+
+// GetSSLMode returns the libpq sslmode. When SSLMode is unset and TLS is
+// configured, certificates are fully verified unless verification is disabled.
+func (p *PostgreSQLConfig) GetSSLMode() string {
+	switch {
+	case p.SSLMode != "":
+		return p.SSLMode
+	case p.TLS.IsEnabled() && p.TLS.InsecureSkipVerify:
+		return "require"
+	case p.TLS.IsEnabled():
+		return "verify-full"
+	default:
+		return "disable"
+	}
+}
+
+// tlsParams returns the libpq certificate parameters. PostgreSQL drivers take
+// certificates as file paths, so inline ca_pem is not supported here.
+func (p *PostgreSQLConfig) tlsParams() [][2]string {
+	var params [][2]string
+	if p.TLS.CAFile != "" {
+		params = append(params, [2]string{"sslrootcert", p.TLS.CAFile})
+	}
+	if p.TLS.CertFile != "" {
+		params = append(params, [2]string{"sslcert", p.TLS.CertFile})
+		params = append(params, [2]string{"sslkey", p.TLS.KeyFile})
+	}
+	return params
 }
 
 // getDatabaseName returns the database name for a given module
@@ -96,11 +182,64 @@ func (p *PostgreSQLConfig) getDatabaseName(module string) string {
 	}
 }
 
-// GetConnectionString returns the MongoDB connection string for a specific database
+// GetConnectionString returns the MongoDB connection string for a specific database.
+// Credentials are escaped, and Hosts, SRV, replica set, read preference, write
+// concern and TLS settings are carried over into the URI.
 func (m *MongoDBConfig) GetConnectionString(database string) string {
-	dbName := m.getDatabaseName(database)
-	return fmt.Sprintf("mongodb://%s:%s@%s:%d/%s?authSource=%s",
-		m.Username, m.Password, m.Host, m.Port, dbName, m.AuthSource)
+	u := url.URL{
+		Scheme: "mongodb",
+		Host:   strings.Join(m.GetHosts(), ","),
+		Path:   "/" + m.getDatabaseName(database),
+	}
+	if m.SRV {
+		u.Scheme = "mongodb+srv"
+	}
+	if m.Username != "" {
+		u.User = url.UserPassword(m.Username, m.Password)
+	}
+
+	query := url.Values{}
+	if m.AuthSource != "" {
+		query.Set("authSource", m.AuthSource)
+	}
+	if m.ReplicaSet != "" {
+		query.Set("replicaSet", m.ReplicaSet)
+	}
+	if m.ReadPreference != "" {
+		query.Set("readPreference", m.ReadPreference)
+	}
+	if m.WriteConcern != "" {
+		query.Set("w", m.WriteConcern)
+	}
+	if m.UseTLS() {
+		query.Set("tls", "true")
+	}
+	if m.TLS.CAFile != "" {
+		query.Set("tlsCAFile", m.TLS.CAFile)
+	}
+	if m.TLS.InsecureSkipVerify {
+		query.Set("tlsInsecure", "true")
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// UseTLS reports whether connections to MongoDB use TLS
+func (m *MongoDBConfig) UseTLS() bool {
+	return m.SSL || m.TLS.IsEnabled()
+}
+
+// GetHosts returns the seed list for the MongoDB connection string. Hosts
+// takes precedence over Host/Port; SRV connection strings use Host alone.
+func (m *MongoDBConfig) GetHosts() []string {
+	if len(m.Hosts) > 0 {
+		return m.Hosts
+	}
+	if m.SRV || m.Port <= 0 {
+		return []string{m.Host}
+	}
+	return []string{fmt.Sprintf("%s:%d", m.Host, m.Port)}
 }
 
 // GetURI returns the MongoDB URI for a specific database
@@ -0,0 +1,624 @@
+package sharedconfig
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// DoctorStatus is the outcome of a single doctor check
+type DoctorStatus string
+
+const (
+	DoctorPass DoctorStatus = "pass"
+	DoctorWarn DoctorStatus = "warn"
+	DoctorFail DoctorStatus = "fail"
+	DoctorSkip DoctorStatus = "skip"
+)
+
+// DoctorResult is one row of the doctor report
+type DoctorResult struct {
+	Backend   string       `json:"backend"`
+	Check     string       `json:"check"`
+	Target    string       `json:"target"`
+	Status    DoctorStatus `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Hint      string       `json:"hint,omitempty"`
+	LatencyMs int64        `json:"latency_ms"`
+}
+
+// DoctorOptions tunes RunDoctor. Backends limits the run to the named
+// backends; Timeout bounds every individual check.
+type DoctorOptions struct {
+	Backends []string
+	Timeout  time.Duration
+}
+
+// GetTimeout returns the per-check timeout
+func (o *DoctorOptions) GetTimeout() time.Duration {
+	if o.Timeout <= 0 {
+		return 5 * time.Second // Default
+	}
+	return o.Timeout
+}
+
+// DoctorBackends lists the backends RunDoctor knows, in report order
+var DoctorBackends = []string{"postgresql", "mongodb", "redis", "kafka", "qdrant", "elasticsearch", "jaeger"}
+
+// doctorProbe checks one backend: DNS and TCP for every address, then a
+// protocol handshake if all addresses are reachable
+type doctorProbe struct {
+	backend   string
+	addresses []string
+	srv       bool
+	handshake func(ctx context.Context) []DoctorResult
+}
+
+// RunDoctor checks every configured backend and returns one result per check.
+// Backends are probed concurrently; results keep the DoctorBackends order.
+func RunDoctor(ctx context.Context, cfg *Config, opts DoctorOptions) []DoctorResult {
+	selected := map[string]bool{}
+	for _, b := range opts.Backends {
+		selected[b] = true
+	}
+
+	probes := cfg.doctorProbes(opts.GetTimeout())
+	results := make([][]DoctorResult, len(probes))
+	var wg sync.WaitGroup
+	for i, probe := range probes {
+		if len(selected) > 0 && !selected[probe.backend] {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, probe doctorProbe) {
+			defer wg.Done()
+			results[i] = runProbe(ctx, probe, opts.GetTimeout())
+		}(i, probe)
+	}
+	wg.Wait()
+
+	var all []DoctorResult
+	for _, r := range results {
+		all = append(all, r...)
+	}
+	return all
+}
+
+func runProbe(ctx context.Context, probe doctorProbe, timeout time.Duration) []DoctorResult {
+	if len(probe.addresses) == 0 {
+		return []DoctorResult{{Backend: probe.backend, Check: "config", Status: DoctorSkip, Detail: "not configured"}}
+	}
+
+	var results []DoctorResult
+	reachable := true
+	for _, address := range probe.addresses {
+		dns := checkDNS(ctx, probe.backend, address, probe.srv, timeout)
+		results = append(results, dns)
+		if dns.Status == DoctorFail {
+			reachable = false
+			continue
+		}
+		if probe.srv {
+			continue
+		}
+		tcp := checkTCP(ctx, probe.backend, address, timeout)
+		results = append(results, tcp)
+		if tcp.Status == DoctorFail {
+			reachable = false
+		}
+	}
+
+	if !reachable {
+		return append(results, DoctorResult{Backend: probe.backend, Check: "handshake", Status: DoctorSkip, Detail: "backend is not reachable"})
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return append(results, probe.handshake(ctx)...)
+}
+
+func checkDNS(ctx context.Context, backend, address string, srv bool, timeout time.Duration) DoctorResult {
+	result := DoctorResult{Backend: backend, Check: "dns", Target: address}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	if net.ParseIP(host) != nil {
+		result.Status = DoctorPass
+		result.Detail = "ip address"
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	var resolved []string
+	if srv {
+		_, records, lookupErr := net.DefaultResolver.LookupSRV(ctx, "mongodb", "tcp", host)
+		for _, r := range records {
+			resolved = append(resolved, net.JoinHostPort(strings.TrimSuffix(r.Target, "."), strconv.Itoa(int(r.Port))))
+		}
+		err = lookupErr
+	} else {
+		resolved, err = net.DefaultResolver.LookupHost(ctx, host)
+	}
+	result.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Status = DoctorFail
+		result.Detail = err.Error()
+		result.Hint = fmt.Sprintf("%s does not resolve; check the %s host setting or start the container", host, backend)
+		return result
+	}
+	result.Status = DoctorPass
+	result.Detail = strings.Join(resolved, ", ")
+	return result
+}
+
+func checkTCP(ctx context.Context, backend, address string, timeout time.Duration) DoctorResult {
+	result := DoctorResult{Backend: backend, Check: "tcp", Target: address}
+	dialer := net.Dialer{Timeout: timeout}
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	result.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Status = DoctorFail
+		result.Detail = err.Error()
+		result.Hint = fmt.Sprintf("nothing is listening on %s; is %s running and is the port mapped?", address, backend)
+		return result
+	}
+	conn.Close()
+	result.Status = DoctorPass
+	return result
+}
+
+// timed runs fn and fills in the latency and, on error, the failure detail
+// and hint of result
+func timed(result DoctorResult, hint func(error) string, fn func() (string, error)) DoctorResult {
+	start := time.Now()
+	detail, err := fn()
+	result.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Status = DoctorFail
+		result.Detail = err.Error()
+		result.Hint = hint(err)
+		return result
+	}
+	result.Status = DoctorPass
+	result.Detail = detail
+	return result
+}
+
+func (c *Config) doctorProbes(timeout time.Duration) []doctorProbe {
+	probes := []doctorProbe{
+		c.Database.PostgreSQL.doctorProbe(timeout),
+		c.Database.MongoDB.doctorProbe(),
+		c.Cache.Redis.doctorProbe(),
+		c.MessageBroker.Kafka.doctorProbe(),
+		c.VectorDatabase.Qdrant.doctorProbe(),
+		c.Search.Elasticsearch.doctorProbe(),
+		c.Monitoring.Jaeger.doctorProbe(),
+	}
+	return probes
+}
+
+func hostPort(host string, port int) []string {
+	if host == "" {
+		return nil
+	}
+	return []string{net.JoinHostPort(host, strconv.Itoa(port))}
+}
+
+func (p *PostgreSQLConfig) doctorProbe(timeout time.Duration) doctorProbe {
+	return doctorProbe{
+		backend:   "postgresql",
+		addresses: hostPort(p.Host, p.Port),
+		handshake: func(ctx context.Context) []DoctorResult {
+			var results []DoctorResult
+			for _, module := range p.Databases.GetModules() {
+				dbName := p.getDatabaseName(module)
+				if dbName == "" {
+					continue
+				}
+				username, _, _ := p.GetCredentials(module, PostgreSQLRoleApp)
+				result := DoctorResult{Backend: "postgresql", Check: "database", Target: username + "@" + dbName}
+				results = append(results, timed(result, postgresHint(module), func() (string, error) {
+					dsn, err := p.GetDSNAs(module, PostgreSQLRoleApp)
+					if err != nil {
+						return "", err
+					}
+					db, err := sql.Open(p.GetDriver(), fmt.Sprintf("%s connect_timeout=%d", dsn, int(timeout.Seconds())))
+					if err != nil {
+						return "", err
+					}
+					defer db.Close()
+					var version string
+					if err := db.QueryRowContext(ctx, "SHOW server_version").Scan(&version); err != nil {
+						return "", err
+					}
+					return "server " + version, nil
+				}))
+			}
+			return results
+		},
+	}
+}
+
+func postgresHint(module string) func(error) string {
+	return func(err error) string {
+		msg := err.Error()
+		switch {
+		case strings.Contains(msg, "unknown driver"):
+			return "register the driver, e.g. import _ \"github.com/jackc/pgx/v5/stdlib\""
+		case strings.Contains(msg, "password authentication failed"), strings.Contains(msg, "has no password"):
+			return fmt.Sprintf("check POSTGRES_PASSWORD or POSTGRES_%s_APP_PASSWORD", strings.ToUpper(module))
+		case strings.Contains(msg, "does not exist"):
+			return "create databases and roles with make provision-db"
+		case strings.Contains(msg, "SSL"), strings.Contains(msg, "tls"):
+			return "check ssl_mode and the tls settings against the server"
+		default:
+			return "check the postgresql settings and server logs"
+		}
+	}
+}
+
+func (m *MongoDBConfig) doctorProbe() doctorProbe {
+	probe := doctorProbe{backend: "mongodb", srv: m.SRV}
+	if m.Host != "" || len(m.Hosts) > 0 {
+		probe.addresses = m.GetHosts()
+	}
+	probe.handshake = func(ctx context.Context) []DoctorResult {
+		result := DoctorResult{Backend: "mongodb", Check: "ping", Target: m.getDatabaseName("analytics")}
+		return []DoctorResult{timed(result, mongoHint, func() (string, error) {
+			db, err := OpenMongo(ctx, m, "analytics")
+			if err != nil {
+				return "", err
+			}
+			db.Client().Disconnect(context.Background())
+			return "", nil
+		})}
+	}
+	return probe
+}
+
+func mongoHint(err error) string {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "Authentication failed"), strings.Contains(msg, "auth error"):
+		return "check MONGODB_USER, MONGODB_PASSWORD and auth_source"
+	case strings.Contains(msg, "replica set"), strings.Contains(msg, "server selection"):
+		return "check replica_set and that the advertised member hosts resolve from here"
+	default:
+		return "check the mongodb settings and server logs"
+	}
+}
+
+func (r *RedisConfig) doctorProbe() doctorProbe {
+	probe := doctorProbe{backend: "redis"}
+	switch r.GetMode() {
+	case RedisModeSentinel:
+		probe.addresses = r.Sentinel.Addresses
+	case RedisModeCluster:
+		probe.addresses = r.Cluster.Nodes
+	default:
+		probe.addresses = hostPort(r.Host, r.Port)
+	}
+	probe.handshake = func(ctx context.Context) []DoctorResult {
+		var results []DoctorResult
+		seen := map[int]bool{}
+		for _, purpose := range []string{"default", "sessions", "queues", "websocket", "cache"} {
+			db := r.getDatabaseNumber(purpose)
+			if seen[db] {
+				continue
+			}
+			seen[db] = true
+			result := DoctorResult{Backend: "redis", Check: "ping", Target: fmt.Sprintf("db %d (%s)", db, purpose)}
+			results = append(results, timed(result, redisHint, func() (string, error) {
+				client, err := NewRedisClient(r, purpose)
+				if err != nil {
+					return "", err
+				}
+				defer client.Close()
+				return "", client.Ping(ctx).Err()
+			}))
+		}
+		return results
+	}
+	return probe
+}
+
+func redisHint(err error) string {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "NOAUTH"), strings.Contains(msg, "WRONGPASS"), strings.Contains(msg, "invalid password"):
+		return "check REDIS_USERNAME and REDIS_PASSWORD"
+	case strings.Contains(msg, "DB index is out of range"):
+		return "raise `databases` in redis.conf or fix the redis databases mapping"
+	default:
+		return "check the redis mode and addresses"
+	}
+}
+
+func (k *KafkaConfig) doctorProbe() doctorProbe {
+	probe := doctorProbe{backend: "kafka"}
+	if len(k.Brokers) > 0 {
+		probe.addresses = strings.Split(k.GetBrokerList(), ",")
+	}
+	probe.handshake = func(ctx context.Context) []DoctorResult {
+		metadata := DoctorResult{Backend: "kafka", Check: "metadata", Target: k.GetBrokerList()}
+		opts, err := k.GetClientOptions("doctor")
+		if err != nil {
+			metadata.Status = DoctorFail
+			metadata.Detail = err.Error()
+			metadata.Hint = "fix security_protocol and the sasl settings"
+			return []DoctorResult{metadata}
+		}
+		client, err := kgo.NewClient(opts.FranzClientOpts()...)
+		if err != nil {
+			metadata.Status = DoctorFail
+			metadata.Detail = err.Error()
+			return []DoctorResult{metadata}
+		}
+		defer client.Close()
+
+		topics := k.Topics.GetTopics()
+		names := make([]string, 0, len(topics))
+		for _, name := range topics {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var states map[string]KafkaTopicState
+		admin := &FranzTopicAdmin{Client: kadm.NewClient(client)}
+		metadata = timed(metadata, kafkaHint, func() (string, error) {
+			states, err = admin.DescribeTopics(ctx, names...)
+			return "", err
+		})
+		results := []DoctorResult{metadata}
+		if metadata.Status != DoctorPass {
+			return results
+		}
+		for _, name := range names {
+			result := DoctorResult{Backend: "kafka", Check: "topic", Target: name, Status: DoctorPass}
+			if state, ok := states[name]; ok {
+				result.Detail = fmt.Sprintf("%d partitions, rf %d", state.Partitions, state.ReplicationFactor)
+			} else {
+				result.Status = DoctorFail
+				result.Detail = "topic does not exist"
+				result.Hint = "create topics with make ensure-topics"
+			}
+			results = append(results, result)
+		}
+		return results
+	}
+	return probe
+}
+
+func kafkaHint(err error) string {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "SASL"), strings.Contains(msg, "sasl"):
+		return "check KAFKA_SASL_MECHANISM, KAFKA_SASL_USERNAME and KAFKA_SASL_PASSWORD"
+	case strings.Contains(msg, "tls"), strings.Contains(msg, "certificate"):
+		return "check security_protocol and the kafka tls settings"
+	default:
+		return "check that advertised.listeners resolve from this machine"
+	}
+}
+
+func (q *QdrantConfig) doctorProbe() doctorProbe {
+	return doctorProbe{
+		backend:   "qdrant",
+		addresses: hostPort(q.Host, q.HTTPPort),
+		handshake: func(ctx context.Context) []DoctorResult {
+			list := DoctorResult{Backend: "qdrant", Check: "collections", Target: q.GetHTTPURL()}
+			client, err := NewQdrantClient(q)
+			if err != nil {
+				list.Status = DoctorFail
+				list.Detail = err.Error()
+				return []DoctorResult{list}
+			}
+
+			existing := map[string]bool{}
+			list = timed(list, qdrantHint, func() (string, error) {
+				var result struct {
+					Collections []struct {
+						Name string `json:"name"`
+					} `json:"collections"`
+				}
+				if err := client.do(ctx, http.MethodGet, "/collections", nil, &result); err != nil {
+					return "", err
+				}
+				for _, c := range result.Collections {
+					existing[c.Name] = true
+				}
+				aliases, err := client.getAliases(ctx)
+				for alias := range aliases {
+					existing[alias] = true
+				}
+				return fmt.Sprintf("%d collections", len(result.Collections)), err
+			})
+			results := []DoctorResult{list}
+			if list.Status != DoctorPass {
+				return results
+			}
+			for _, name := range sortedValues(q.Collections.fields()) {
+				result := DoctorResult{Backend: "qdrant", Check: "collection", Target: name, Status: DoctorPass}
+				if !existing[name] {
+					result.Status = DoctorFail
+					result.Detail = "collection does not exist"
+					result.Hint = "create collections with make ensure-collections"
+				}
+				results = append(results, result)
+			}
+			return results
+		},
+	}
+}
+
+func qdrantHint(err error) string {
+	if qerr, ok := err.(*QdrantError); ok && (qerr.StatusCode == http.StatusUnauthorized || qerr.StatusCode == http.StatusForbidden) {
+		return "check QDRANT_API_KEY"
+	}
+	return "check the qdrant host, http_port and ssl settings"
+}
+
+func (e *ElasticsearchConfig) doctorProbe() doctorProbe {
+	probe := doctorProbe{backend: "elasticsearch"}
+	if e.Host != "" || len(e.Nodes) > 0 {
+		nodes, err := e.GetNodes()
+		if err == nil {
+			for _, node := range nodes {
+				probe.addresses = append(probe.addresses, nodeAddress(node))
+			}
+		}
+	}
+	probe.handshake = func(ctx context.Context) []DoctorResult {
+		info := DoctorResult{Backend: "elasticsearch", Check: "cluster", Target: e.GetURL()}
+		client, err := NewElasticsearchClient(e)
+		if err != nil {
+			info.Status = DoctorFail
+			info.Detail = err.Error()
+			info.Hint = "fix the elasticsearch tls and auth settings"
+			return []DoctorResult{info}
+		}
+
+		info = timed(info, elasticsearchHint, func() (string, error) {
+			var result struct {
+				ClusterName string `json:"cluster_name"`
+				Version     struct {
+					Number string `json:"number"`
+				} `json:"version"`
+			}
+			if err := client.do(ctx, http.MethodGet, "/", nil, &result); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%s, version %s", result.ClusterName, result.Version.Number), nil
+		})
+		results := []DoctorResult{info}
+		if info.Status != DoctorPass {
+			return results
+		}
+		for _, name := range sortedValues(e.Indices.fields()) {
+			result := DoctorResult{Backend: "elasticsearch", Check: "index", Target: name}
+			results = append(results, timed(result, elasticsearchHint, func() (string, error) {
+				return "", client.do(ctx, http.MethodHead, "/"+name, nil, nil)
+			}))
+		}
+		return results
+	}
+	return probe
+}
+
+func nodeAddress(node *url.URL) string {
+	if node.Port() != "" {
+		return node.Host
+	}
+	if node.Scheme == "https" {
+		return net.JoinHostPort(node.Hostname(), "443")
+	}
+	return net.JoinHostPort(node.Hostname(), "80")
+}
+
+func elasticsearchHint(err error) string {
+	if isNotFound(err) {
+		return "create indices with make es-bootstrap"
+	}
+	if esErr, ok := err.(*ElasticsearchError); ok && esErr.StatusCode == http.StatusUnauthorized {
+		return "check ELASTICSEARCH_USERNAME/ELASTICSEARCH_PASSWORD or ELASTICSEARCH_API_KEY"
+	}
+	if strings.Contains(err.Error(), "certificate") {
+		return "check ca_cert, ca_fingerprint or the tls settings"
+	}
+	return "check the elasticsearch nodes and scheme"
+}
+
+func (j *JaegerConfig) doctorProbe() doctorProbe {
+	return doctorProbe{
+		backend:   "jaeger",
+		addresses: hostPort(j.Host, j.Port),
+		handshake: func(ctx context.Context) []DoctorResult {
+			target := fmt.Sprintf("http://%s/api/services", net.JoinHostPort(j.Host, strconv.Itoa(j.Port)))
+			result := DoctorResult{Backend: "jaeger", Check: "query", Target: target}
+			return []DoctorResult{timed(result, func(error) string {
+				return "port should point at the jaeger query service (16686)"
+			}, func() (string, error) {
+				req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+				if err != nil {
+					return "", err
+				}
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					return "", err
+				}
+				defer resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					return "", fmt.Errorf("jaeger returned %d", resp.StatusCode)
+				}
+				return "", nil
+			})}
+		},
+	}
+}
+
+func sortedValues(fields map[string]*string) []string {
+	var values []string
+	for _, v := range fields {
+		if *v != "" {
+			values = append(values, *v)
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
+// DoctorFailed reports whether any check failed
+func DoctorFailed(results []DoctorResult) bool {
+	for _, r := range results {
+		if r.Status == DoctorFail {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteDoctorJSON writes the results as an indented JSON array
+func WriteDoctorJSON(w io.Writer, results []DoctorResult) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(results)
+}
+
+var doctorColors = map[DoctorStatus]string{
+	DoctorPass: "\033[32m",
+	DoctorWarn: "\033[33m",
+	DoctorFail: "\033[31m",
+	DoctorSkip: "\033[90m",
+}
+
+// WriteDoctorTable prints one line per check, with the hint below failed
+// checks. Statuses are colored when color is true.
+func WriteDoctorTable(w io.Writer, results []DoctorResult, color bool) {
+	fmt.Fprintf(w, "%-14s %-11s %-40s %-6s %8s  %s\n", "BACKEND", "CHECK", "TARGET", "STATUS", "LATENCY", "DETAIL")
+	for _, r := range results {
+		status := fmt.Sprintf("%-6s", r.Status)
+		if color {
+			status = doctorColors[r.Status] + status + "\033[0m"
+		}
+		fmt.Fprintf(w, "%-14s %-11s %-40s %s %6dms  %s\n", r.Backend, r.Check, r.Target, status, r.LatencyMs, r.Detail)
+		if r.Hint != "" && r.Status != DoctorPass {
+			fmt.Fprintf(w, "%14s   hint: %s\n", "", r.Hint)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package sharedconfig
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// closedAddress returns a loopback address nothing listens on
+func closedAddress(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := l.Addr().String()
+	l.Close()
+	return address
+}
+
+func splitHostPort(t *testing.T, address string) (string, int) {
+	t.Helper()
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return host, port
+}
+
+func doctorRows(results []DoctorResult) []string {
+	var rows []string
+	for _, r := range results {
+		rows = append(rows, fmt.Sprintf("%s %s %s", r.Backend, r.Check, r.Status))
+	}
+	return rows
+}
+
+func TestRunProbeSkipsUnconfiguredBackend(t *testing.T) {
+	results := runProbe(context.Background(), (&QdrantConfig{}).doctorProbe(), time.Second)
+	if len(results) != 1 || results[0].Status != DoctorSkip || results[0].Detail != "not configured" {
+		t.Errorf("results = %+v, want one skipped config check", results)
+	}
+}
+
+func TestRunProbeFailsOnClosedPort(t *testing.T) {
+	host, port := splitHostPort(t, closedAddress(t))
+	handshakes := 0
+	probe := doctorProbe{
+		backend:   "redis",
+		addresses: hostPort(host, port),
+		handshake: func(ctx context.Context) []DoctorResult {
+			handshakes++
+			return nil
+		},
+	}
+
+	results := runProbe(context.Background(), probe, time.Second)
+	if got, want := strings.Join(doctorRows(results), "\n"), "redis dns pass\nredis tcp fail\nredis handshake skip"; got != want {
+		t.Fatalf("results =\n%s\nwant\n%s", got, want)
+	}
+	if results[0].Detail != "ip address" {
+		t.Errorf("dns detail = %q, want the address used as is", results[0].Detail)
+	}
+	if !strings.Contains(results[1].Hint, "nothing is listening on "+results[1].Target) {
+		t.Errorf("tcp hint = %q", results[1].Hint)
+	}
+	if handshakes != 0 {
+		t.Error("the handshake ran against an unreachable backend")
+	}
+}
+
+func TestRunProbeQdrant(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/collections":
+			fmt.Fprint(w, `{"result": {"collections": [{"name": "erp_documents_v2"}]}}`)
+		case "/aliases":
+			fmt.Fprint(w, `{"result": {"aliases": [{"alias_name": "erp_documents", "collection_name": "erp_documents_v2"}]}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	host, port := splitHostPort(t, srv.Listener.Addr().String())
+	cfg := &QdrantConfig{Host: host, HTTPPort: port, Collections: QdrantCollectionsConfig{Documents: "erp_documents", Products: "erp_products"}}
+
+	results := runProbe(context.Background(), cfg.doctorProbe(), time.Second)
+	want := []string{
+		"qdrant dns pass",
+		"qdrant tcp pass",
+		"qdrant collections pass",
+		"qdrant collection pass",
+		"qdrant collection fail",
+	}
+	if got := doctorRows(results); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("results =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if results[3].Target != "erp_documents" || results[4].Target != "erp_products" {
+		t.Errorf("collection targets = %s, %s", results[3].Target, results[4].Target)
+	}
+	if results[4].Hint != "create collections with make ensure-collections" {
+		t.Errorf("missing collection hint = %q", results[4].Hint)
+	}
+}
+
+func TestRunProbeElasticsearchHints(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Header.Get("Authorization") != "ApiKey es-key":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/":
+			fmt.Fprint(w, `{"cluster_name": "erp", "version": {"number": "8.11.0"}}`)
+		case r.URL.Path == "/erp_contacts":
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := &ElasticsearchConfig{Nodes: []string{srv.URL}, APIKey: "es-key", Indices: ElasticsearchIndicesConfig{Contacts: "erp_contacts", Products: "erp_products"}}
+	results := runProbe(context.Background(), cfg.doctorProbe(), time.Second)
+	want := []string{
+		"elasticsearch dns pass",
+		"elasticsearch tcp pass",
+		"elasticsearch cluster pass",
+		"elasticsearch index pass",
+		"elasticsearch index fail",
+	}
+	if got := doctorRows(results); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("results =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if results[2].Detail != "erp, version 8.11.0" {
+		t.Errorf("cluster detail = %q", results[2].Detail)
+	}
+	if results[4].Hint != "create indices with make es-bootstrap" {
+		t.Errorf("missing index hint = %q", results[4].Hint)
+	}
+
+	cfg.APIKey = "wrong"
+	results = runProbe(context.Background(), cfg.doctorProbe(), time.Second)
+	if cluster := results[2]; cluster.Status != DoctorFail || !strings.Contains(cluster.Hint, "ELASTICSEARCH_API_KEY") {
+		t.Errorf("cluster with a bad key = %+v", cluster)
+	}
+	if len(results) != 3 {
+		t.Errorf("indices were checked after the cluster check failed: %v", doctorRows(results))
+	}
+}
+
+func TestDoctorHints(t *testing.T) {
+	tests := []struct {
+		name string
+		hint func(error) string
+		err  error
+		want string
+	}{
+		{"postgres driver", postgresHint("crm"), errors.New(`sql: unknown driver "pgx"`), "register the driver"},
+		{"postgres password", postgresHint("crm"), errors.New("password authentication failed for user"), "POSTGRES_CRM_APP_PASSWORD"},
+		{"postgres role password", postgresHint("hrm"), errors.New("postgresql app role erp_hrm_app of hrm has no password"), "POSTGRES_HRM_APP_PASSWORD"},
+		{"postgres database", postgresHint("crm"), errors.New(`database "erp_crm" does not exist`), "make provision-db"},
+		{"mongo auth", mongoHint, errors.New("auth error: sasl conversation error: Authentication failed"), "MONGODB_USER"},
+		{"mongo replica set", mongoHint, errors.New("server selection error: context deadline exceeded"), "replica_set"},
+		{"redis auth", redisHint, errors.New("WRONGPASS invalid username-password pair"), "REDIS_PASSWORD"},
+		{"redis db", redisHint, errors.New("ERR DB index is out of range"), "redis.conf"},
+		{"kafka sasl", kafkaHint, errors.New("SASL authentication failed"), "KAFKA_SASL_MECHANISM"},
+		{"kafka listeners", kafkaHint, errors.New("dial tcp: lookup kafka: no such host"), "advertised.listeners"},
+		{"qdrant key", qdrantHint, &QdrantError{StatusCode: http.StatusForbidden}, "QDRANT_API_KEY"},
+		{"qdrant other", qdrantHint, errors.New("connection refused"), "http_port"},
+		{"elasticsearch certificate", elasticsearchHint, errors.New("x509: certificate signed by unknown authority"), "ca_fingerprint"},
+	}
+	for _, tt := range tests {
+		if got := tt.hint(tt.err); !strings.Contains(got, tt.want) {
+			t.Errorf("%s: hint = %q, want it to mention %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRunDoctorSelectsBackends(t *testing.T) {
+	host, port := splitHostPort(t, closedAddress(t))
+	cfg := &Config{}
+	cfg.Cache.Redis = RedisConfig{Host: host, Port: port}
+	cfg.Monitoring.Jaeger = JaegerConfig{Host: host, Port: port}
+
+	results := RunDoctor(context.Background(), cfg, DoctorOptions{Backends: []string{"redis", "qdrant"}, Timeout: time.Second})
+	want := []string{"redis dns pass", "redis tcp fail", "redis handshake skip", "qdrant config skip"}
+	if got := doctorRows(results); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("results =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if !DoctorFailed(results) {
+		t.Error("DoctorFailed() = false with a failed tcp check")
+	}
+
+	var out bytes.Buffer
+	WriteDoctorTable(&out, results, false)
+	if !strings.Contains(out.String(), "hint: nothing is listening on "+net.JoinHostPort(host, strconv.Itoa(port))) {
+		t.Errorf("table is missing the tcp hint:\n%s", out.String())
+	}
+}
@@ -0,0 +1,406 @@
+package sharedconfig
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ElasticsearchIndexSpec declares the settings and mappings of a versioned
+// index. The configured index name (e.g. erp_contacts) is an alias backed by
+// <name>_v<version>; bump Version whenever the mappings change and
+// BootstrapElasticsearch reindexes into the new version and swaps the alias.
+type ElasticsearchIndexSpec struct {
+	Version  int                    `yaml:"version"`
+	Settings map[string]interface{} `yaml:"settings"`
+	Mappings map[string]interface{} `yaml:"mappings"`
+}
+
+// Index actions reported by BootstrapElasticsearch
+const (
+	IndexActionOK       = "ok"
+	IndexActionCreate   = "create"
+	IndexActionReindex  = "reindex"
+	IndexActionDrift    = "drift"
+	IndexActionConflict = "conflict"
+)
+
+// IndexResult describes what BootstrapElasticsearch did or would do for one index
+type IndexResult struct {
+	Purpose string   `json:"purpose"`
+	Alias   string   `json:"alias"`
+	Index   string   `json:"index"`
+	Action  string   `json:"action"`
+	Details []string `json:"details,omitempty"`
+}
+
+// ElasticsearchTemplates is the layout of config/kibana/index-templates.json
+type ElasticsearchTemplates struct {
+	IndexTemplates []struct {
+		Name          string                 `json:"name"`
+		IndexPatterns []string               `json:"index_patterns"`
+		Priority      int                    `json:"priority"`
+		Template      map[string]interface{} `json:"template"`
+	} `json:"index_templates"`
+	LifecyclePolicies []struct {
+		Name   string                 `json:"name"`
+		Policy map[string]interface{} `json:"policy"`
+	} `json:"lifecycle_policies"`
+}
+
+// ElasticsearchClient is a minimal client for the Elasticsearch REST API
+type ElasticsearchClient struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// NewElasticsearchClient returns a client for the configured cluster. Requests
+// go through the transport from BuildTransport, which picks the node and adds
+// authentication, compression and retries.
+func NewElasticsearchClient(cfg *ElasticsearchConfig) (*ElasticsearchClient, error) {
+	transport, err := cfg.BuildTransport()
+	if err != nil {
+		return nil, err
+	}
+	node := transport.Nodes()[0]
+
+	return &ElasticsearchClient{
+		BaseURL:    node.Scheme + "://" + node.Host,
+		HTTPClient: &http.Client{Transport: transport},
+	}, nil
+}
+
+// ElasticsearchError is returned for non-2xx responses from Elasticsearch
+type ElasticsearchError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *ElasticsearchError) Error() string {
+	return fmt.Sprintf("elasticsearch returned %d: %s", e.StatusCode, e.Body)
+}
+
+func (c *ElasticsearchClient) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(c.BaseURL, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &ElasticsearchError{StatusCode: resp.StatusCode, Body: string(data)}
+	}
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+func isNotFound(err error) bool {
+	esErr, ok := err.(*ElasticsearchError)
+	return ok && esErr.StatusCode == http.StatusNotFound
+}
+
+// GetTemplatesFile returns the path of the index templates file
+func (e *ElasticsearchConfig) GetTemplatesFile() string {
+	if e.TemplatesFile == "" {
+		return "config/kibana/index-templates.json" // Default
+	}
+	return e.TemplatesFile
+}
+
+// GetVersionedIndexName returns the concrete index backing a purpose's alias
+func (e *ElasticsearchConfig) GetVersionedIndexName(purpose string, version int) string {
+	return fmt.Sprintf("%s_v%d", e.Indices.GetIndexName(purpose), version)
+}
+
+// InstallTemplates installs the lifecycle policies and index templates from
+// the templates file
+func InstallTemplates(ctx context.Context, client *ElasticsearchClient, path string, dryRun bool) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading index templates: %w", err)
+	}
+	var templates ElasticsearchTemplates
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return nil, fmt.Errorf("error parsing index templates %s: %w", path, err)
+	}
+
+	var installed []string
+	for _, p := range templates.LifecyclePolicies {
+		installed = append(installed, "lifecycle policy "+p.Name)
+		if dryRun {
+			continue
+		}
+		body := map[string]interface{}{"policy": p.Policy}
+		if err := client.do(ctx, http.MethodPut, "/_ilm/policy/"+p.Name, body, nil); err != nil {
+			return installed, fmt.Errorf("error installing lifecycle policy %s: %w", p.Name, err)
+		}
+	}
+	for _, t := range templates.IndexTemplates {
+		installed = append(installed, "index template "+t.Name)
+		if dryRun {
+			continue
+		}
+		body := map[string]interface{}{
+			"index_patterns": t.IndexPatterns,
+			"priority":       t.Priority,
+			"template":       t.Template,
+		}
+		if err := client.do(ctx, http.MethodPut, "/_index_template/"+t.Name, body, nil); err != nil {
+			return installed, fmt.Errorf("error installing index template %s: %w", t.Name, err)
+		}
+	}
+	return installed, nil
+}
+
+// BootstrapElasticsearch installs index templates and makes sure every index
+// with a spec exists as a versioned index behind its alias. When the spec
+// version is newer than the index the alias points at, the data is reindexed
+// into the new version and the alias is swapped atomically, so readers never
+// see a missing or half-filled index. The previous version is kept for rollback.
+func BootstrapElasticsearch(ctx context.Context, client *ElasticsearchClient, cfg *ElasticsearchConfig, dryRun bool) ([]IndexResult, error) {
+	if _, err := os.Stat(cfg.GetTemplatesFile()); err == nil {
+		if _, err := InstallTemplates(ctx, client, cfg.GetTemplatesFile(), dryRun); err != nil {
+			return nil, err
+		}
+	}
+
+	purposes := make([]string, 0, len(cfg.IndexSpecs))
+	for purpose := range cfg.IndexSpecs {
+		purposes = append(purposes, purpose)
+	}
+	sort.Strings(purposes)
+
+	var results []IndexResult
+	for _, purpose := range purposes {
+		result, err := bootstrapIndex(ctx, client, cfg, purpose, dryRun)
+		results = append(results, result)
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+func bootstrapIndex(ctx context.Context, client *ElasticsearchClient, cfg *ElasticsearchConfig, purpose string, dryRun bool) (IndexResult, error) {
+	spec := cfg.IndexSpecs[purpose]
+	if spec.Version <= 0 {
+		spec.Version = 1
+	}
+	alias := cfg.Indices.GetIndexName(purpose)
+	index := cfg.GetVersionedIndexName(purpose, spec.Version)
+	result := IndexResult{Purpose: purpose, Alias: alias, Index: index, Action: IndexActionOK}
+
+	targets, err := client.aliasTargets(ctx, alias)
+	if err != nil {
+		return result, fmt.Errorf("error resolving alias %s: %w", alias, err)
+	}
+	current := ""
+	if len(targets) > 0 {
+		current = targets[0]
+	}
+
+	switch {
+	case len(targets) > 1:
+		result.Action = IndexActionDrift
+		result.Details = append(result.Details, fmt.Sprintf("alias %s points to %s; point it at %s only", alias, strings.Join(targets, ", "), index))
+
+	case current == alias:
+		result.Action = IndexActionConflict
+		result.Details = append(result.Details, fmt.Sprintf("%s is a concrete index, not an alias; reindex it into %s manually", alias, index))
+
+	case current == "":
+		result.Action = IndexActionCreate
+		if !dryRun {
+			if err := client.createIndex(ctx, index, spec, alias); err != nil {
+				return result, err
+			}
+		}
+
+	case current != index:
+		result.Action = IndexActionReindex
+		result.Details = append(result.Details, fmt.Sprintf("reindex %s -> %s and swap alias", current, index))
+		if !dryRun {
+			if err := client.reindexAndSwap(ctx, current, index, alias, spec); err != nil {
+				return result, err
+			}
+		}
+
+	default:
+		drift, err := client.mappingDrift(ctx, index, spec)
+		if err != nil {
+			return result, err
+		}
+		if len(drift) > 0 {
+			result.Action = IndexActionDrift
+			result.Details = append(drift, "bump the index version to apply mapping changes")
+		}
+	}
+
+	return result, nil
+}
+
+// aliasTargets returns the indices an alias points to, sorted, the alias
+// itself if it is a concrete index, or nothing if neither exists
+func (c *ElasticsearchClient) aliasTargets(ctx context.Context, alias string) ([]string, error) {
+	var aliases map[string]interface{}
+	err := c.do(ctx, http.MethodGet, "/_alias/"+alias, nil, &aliases)
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+	if len(aliases) > 0 {
+		indices := make([]string, 0, len(aliases))
+		for index := range aliases {
+			indices = append(indices, index)
+		}
+		sort.Strings(indices)
+		return indices, nil
+	}
+
+	err = c.do(ctx, http.MethodHead, "/"+alias, nil, nil)
+	if err == nil {
+		return []string{alias}, nil
+	}
+	if isNotFound(err) {
+		return nil, nil
+	}
+	return nil, err
+}
+
+// createIndex creates index with the spec's settings and mappings, optionally
+// attaching alias in the same request
+func (c *ElasticsearchClient) createIndex(ctx context.Context, index string, spec ElasticsearchIndexSpec, alias string) error {
+	body := map[string]interface{}{}
+	if len(spec.Settings) > 0 {
+		body["settings"] = spec.Settings
+	}
+	if len(spec.Mappings) > 0 {
+		body["mappings"] = spec.Mappings
+	}
+	if alias != "" {
+		body["aliases"] = map[string]interface{}{alias: map[string]interface{}{}}
+	}
+	if err := c.do(ctx, http.MethodPut, "/"+index, body, nil); err != nil {
+		return fmt.Errorf("error creating index %s: %w", index, err)
+	}
+	return nil
+}
+
+// reindexAndSwap copies from into a freshly created to index and atomically
+// moves alias over
+func (c *ElasticsearchClient) reindexAndSwap(ctx context.Context, from, to, alias string, spec ElasticsearchIndexSpec) error {
+	if err := c.do(ctx, http.MethodHead, "/"+to, nil, nil); isNotFound(err) {
+		if err := c.createIndex(ctx, to, spec, ""); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	reindex := map[string]interface{}{
+		"source": map[string]string{"index": from},
+		"dest":   map[string]string{"index": to},
+	}
+	var resp struct {
+		Failures []interface{} `json:"failures"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/_reindex?wait_for_completion=true&refresh=true", reindex, &resp); err != nil {
+		return fmt.Errorf("error reindexing %s into %s: %w", from, to, err)
+	}
+	if len(resp.Failures) > 0 {
+		return fmt.Errorf("reindexing %s into %s had %d failures; alias left on %s", from, to, len(resp.Failures), from)
+	}
+
+	actions := map[string]interface{}{
+		"actions": []map[string]interface{}{
+			{"remove": map[string]string{"index": from, "alias": alias}},
+			{"add": map[string]string{"index": to, "alias": alias}},
+		},
+	}
+	if err := c.do(ctx, http.MethodPost, "/_aliases", actions, nil); err != nil {
+		return fmt.Errorf("error swapping alias %s to %s: %w", alias, to, err)
+	}
+	return nil
+}
+
+// mappingDrift compares the field types declared in the spec with the live
+// mapping. Only top-level properties the spec declares are compared.
+func (c *ElasticsearchClient) mappingDrift(ctx context.Context, index string, spec ElasticsearchIndexSpec) ([]string, error) {
+	want, _ := spec.Mappings["properties"].(map[string]interface{})
+	if len(want) == 0 {
+		return nil, nil
+	}
+
+	var resp map[string]struct {
+		Mappings struct {
+			Properties map[string]struct {
+				Type string `json:"type"`
+			} `json:"properties"`
+		} `json:"mappings"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/"+index+"/_mapping", nil, &resp); err != nil {
+		return nil, fmt.Errorf("error reading mapping of %s: %w", index, err)
+	}
+	have := resp[index].Mappings.Properties
+
+	fields := make([]string, 0, len(want))
+	for field := range want {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var drift []string
+	for _, field := range fields {
+		props, _ := want[field].(map[string]interface{})
+		wantType, _ := props["type"].(string)
+		if wantType == "" {
+			continue
+		}
+		if got, ok := have[field]; !ok {
+			drift = append(drift, fmt.Sprintf("field %s: missing", field))
+		} else if got.Type != wantType {
+			drift = append(drift, fmt.Sprintf("field %s: want type %s, have %s", field, wantType, got.Type))
+		}
+	}
+	return drift, nil
+}
+
+// WriteIndexReport prints BootstrapElasticsearch results as a plain-text table
+func WriteIndexReport(w io.Writer, results []IndexResult, dryRun bool) {
+	for _, r := range results {
+		action := r.Action
+		if dryRun && (action == IndexActionCreate || action == IndexActionReindex) {
+			action = "would " + action
+		}
+		fmt.Fprintf(w, "%-16s %-40s %s\n", action, r.Index, r.Alias)
+		for _, d := range r.Details {
+			fmt.Fprintf(w, "%16s   - %s\n", "", d)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package sharedconfig
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeElasticsearch is an in-memory stand-in for the index, alias, mapping,
+// reindex and template endpoints BootstrapElasticsearch uses
+type fakeElasticsearch struct {
+	mu        sync.Mutex
+	indices   map[string]map[string]interface{} // index -> properties
+	aliases   map[string]string                 // alias -> index
+	shared    map[string][]string               // alias -> further indices it also points to
+	reindexed []string
+	templates []string
+	requests  []string
+	apiKeys   []string
+}
+
+func newFakeElasticsearch(t *testing.T) (*fakeElasticsearch, *httptest.Server) {
+	es := &fakeElasticsearch{
+		indices: map[string]map[string]interface{}{},
+		aliases: map[string]string{},
+	}
+	srv := httptest.NewServer(es)
+	t.Cleanup(srv.Close)
+	return es, srv
+}
+
+func (es *fakeElasticsearch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	es.requests = append(es.requests, r.Method+" "+r.URL.Path)
+	es.apiKeys = append(es.apiKeys, r.Header.Get("Authorization"))
+
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	reply := func(v interface{}) { json.NewEncoder(w).Encode(v) }
+
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "_alias/"):
+		alias := strings.TrimPrefix(path, "_alias/")
+		index, ok := es.aliases[alias]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			reply(map[string]interface{}{"error": "alias [" + alias + "] missing", "status": 404})
+			return
+		}
+		indices := map[string]interface{}{}
+		for _, index := range append([]string{index}, es.shared[alias]...) {
+			indices[index] = map[string]interface{}{"aliases": map[string]interface{}{alias: map[string]interface{}{}}}
+		}
+		reply(indices)
+
+	case r.Method == http.MethodPut && (strings.HasPrefix(path, "_ilm/policy/") || strings.HasPrefix(path, "_index_template/")):
+		es.templates = append(es.templates, path)
+		reply(map[string]bool{"acknowledged": true})
+
+	case r.Method == http.MethodPost && path == "_reindex":
+		source := body["source"].(map[string]interface{})["index"].(string)
+		dest := body["dest"].(map[string]interface{})["index"].(string)
+		es.reindexed = append(es.reindexed, source+"->"+dest)
+		reply(map[string]interface{}{"failures": []interface{}{}})
+
+	case r.Method == http.MethodPost && path == "_aliases":
+		for _, a := range body["actions"].([]interface{}) {
+			for op, args := range a.(map[string]interface{}) {
+				args := args.(map[string]interface{})
+				alias, index := args["alias"].(string), args["index"].(string)
+				if op == "add" {
+					es.aliases[alias] = index
+				} else if es.aliases[alias] == index {
+					delete(es.aliases, alias)
+				}
+			}
+		}
+		reply(map[string]bool{"acknowledged": true})
+
+	case r.Method == http.MethodGet && strings.HasSuffix(path, "/_mapping"):
+		index := strings.TrimSuffix(path, "/_mapping")
+		reply(map[string]interface{}{index: map[string]interface{}{"mappings": map[string]interface{}{"properties": es.indices[index]}}})
+
+	case r.Method == http.MethodHead:
+		if _, ok := es.indices[path]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+
+	case r.Method == http.MethodPut:
+		if _, ok := es.indices[path]; ok {
+			w.WriteHeader(http.StatusBadRequest)
+			reply(map[string]string{"error": "resource_already_exists_exception"})
+			return
+		}
+		properties := map[string]interface{}{}
+		if mappings, ok := body["mappings"].(map[string]interface{}); ok {
+			properties, _ = mappings["properties"].(map[string]interface{})
+		}
+		es.indices[path] = properties
+		if aliases, ok := body["aliases"].(map[string]interface{}); ok {
+			for alias := range aliases {
+				es.aliases[alias] = path
+			}
+		}
+		reply(map[string]bool{"acknowledged": true})
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func testElasticsearchConfig(srv *httptest.Server, version int) *ElasticsearchConfig {
+	return &ElasticsearchConfig{
+		Nodes:         []string{srv.URL},
+		APIKey:        "es-key",
+		TemplatesFile: filepath.Join("testdata", "missing.json"),
+		Indices:       ElasticsearchIndicesConfig{Contacts: "erp_contacts"},
+		IndexSpecs: map[string]ElasticsearchIndexSpec{
+			"contacts": {
+				Version: version,
+				Mappings: map[string]interface{}{"properties": map[string]interface{}{
+					"email": map[string]interface{}{"type": "keyword"},
+					"name":  map[string]interface{}{"type": "text"},
+				}},
+			},
+		},
+	}
+}
+
+func bootstrap(t *testing.T, cfg *ElasticsearchConfig, dryRun bool) []IndexResult {
+	t.Helper()
+	client, err := NewElasticsearchClient(cfg)
+	if err != nil {
+		t.Fatalf("NewElasticsearchClient: %v", err)
+	}
+	results, err := BootstrapElasticsearch(context.Background(), client, cfg, dryRun)
+	if err != nil {
+		t.Fatalf("BootstrapElasticsearch: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("results = %+v, want one index", results)
+	}
+	return results
+}
+
+func TestBootstrapElasticsearchCreatesVersionedIndexBehindAlias(t *testing.T) {
+	es, srv := newFakeElasticsearch(t)
+	results := bootstrap(t, testElasticsearchConfig(srv, 1), false)
+
+	if got := results[0]; got.Action != IndexActionCreate || got.Index != "erp_contacts_v1" || got.Alias != "erp_contacts" {
+		t.Errorf("result = %+v", got)
+	}
+	if got := es.aliases["erp_contacts"]; got != "erp_contacts_v1" {
+		t.Errorf("alias erp_contacts -> %q, want erp_contacts_v1", got)
+	}
+	if got := es.apiKeys[0]; got != "ApiKey es-key" {
+		t.Errorf("Authorization = %q, want the configured api key", got)
+	}
+
+	// A second run finds the index up to date
+	if got := bootstrap(t, testElasticsearchConfig(srv, 1), false)[0].Action; got != IndexActionOK {
+		t.Errorf("second run action = %q, want %q", got, IndexActionOK)
+	}
+}
+
+func TestBootstrapElasticsearchReindexesNewVersion(t *testing.T) {
+	es, srv := newFakeElasticsearch(t)
+	bootstrap(t, testElasticsearchConfig(srv, 1), false)
+
+	results := bootstrap(t, testElasticsearchConfig(srv, 2), false)
+	if got := results[0].Action; got != IndexActionReindex {
+		t.Errorf("action = %q, want %q", got, IndexActionReindex)
+	}
+	if !reflect.DeepEqual(es.reindexed, []string{"erp_contacts_v1->erp_contacts_v2"}) {
+		t.Errorf("reindexed = %v", es.reindexed)
+	}
+	if got := es.aliases["erp_contacts"]; got != "erp_contacts_v2" {
+		t.Errorf("alias erp_contacts -> %q, want erp_contacts_v2", got)
+	}
+	if _, ok := es.indices["erp_contacts_v1"]; !ok {
+		t.Error("previous version was removed; it should be kept for rollback")
+	}
+}
+
+func TestBootstrapElasticsearchDryRunChangesNothing(t *testing.T) {
+	es, srv := newFakeElasticsearch(t)
+	bootstrap(t, testElasticsearchConfig(srv, 1), false)
+	before := len(es.requests)
+
+	results := bootstrap(t, testElasticsearchConfig(srv, 2), true)
+	if got := results[0].Action; got != IndexActionReindex {
+		t.Errorf("action = %q, want %q", got, IndexActionReindex)
+	}
+	for _, req := range es.requests[before:] {
+		if !strings.HasPrefix(req, http.MethodGet) && !strings.HasPrefix(req, http.MethodHead) {
+			t.Errorf("dry run sent %s", req)
+		}
+	}
+	if got := es.aliases["erp_contacts"]; got != "erp_contacts_v1" {
+		t.Errorf("dry run moved alias to %q", got)
+	}
+}
+
+func TestBootstrapElasticsearchReportsMappingDrift(t *testing.T) {
+	es, srv := newFakeElasticsearch(t)
+	bootstrap(t, testElasticsearchConfig(srv, 1), false)
+	es.indices["erp_contacts_v1"]["email"] = map[string]interface{}{"type": "text"}
+	delete(es.indices["erp_contacts_v1"], "name")
+
+	result := bootstrap(t, testElasticsearchConfig(srv, 1), false)[0]
+	want := []string{
+		"field email: want type keyword, have text",
+		"field name: missing",
+		"bump the index version to apply mapping changes",
+	}
+	if result.Action != IndexActionDrift || !reflect.DeepEqual(result.Details, want) {
+		t.Errorf("result = %+v, want drift %v", result, want)
+	}
+}
+
+func TestBootstrapElasticsearchReportsConcreteIndexConflict(t *testing.T) {
+	es, srv := newFakeElasticsearch(t)
+	es.indices["erp_contacts"] = map[string]interface{}{}
+
+	if got := bootstrap(t, testElasticsearchConfig(srv, 1), false)[0].Action; got != IndexActionConflict {
+		t.Errorf("action = %q, want %q", got, IndexActionConflict)
+	}
+	if _, ok := es.indices["erp_contacts_v1"]; ok {
+		t.Error("created erp_contacts_v1 next to a concrete erp_contacts index")
+	}
+}
+
+func TestBootstrapElasticsearchReportsAliasOnSeveralIndices(t *testing.T) {
+	es, srv := newFakeElasticsearch(t)
+	bootstrap(t, testElasticsearchConfig(srv, 1), false)
+	es.shared = map[string][]string{"erp_contacts": {"erp_contacts_legacy"}}
+	before := len(es.requests)
+
+	result := bootstrap(t, testElasticsearchConfig(srv, 2), false)[0]
+	want := []string{"alias erp_contacts points to erp_contacts_legacy, erp_contacts_v1; point it at erp_contacts_v2 only"}
+	if result.Action != IndexActionDrift || !reflect.DeepEqual(result.Details, want) {
+		t.Errorf("result = %+v, want drift %v", result, want)
+	}
+	for _, req := range es.requests[before:] {
+		if !strings.HasPrefix(req, http.MethodGet) && !strings.HasPrefix(req, http.MethodHead) {
+			t.Errorf("sent %s for an alias on several indices", req)
+		}
+	}
+}
+
+func TestBootstrapElasticsearchInstallsTemplates(t *testing.T) {
+	es, srv := newFakeElasticsearch(t)
+	cfg := testElasticsearchConfig(srv, 1)
+	cfg.TemplatesFile = filepath.Join(t.TempDir(), "index-templates.json")
+	templates := `{
+		"lifecycle_policies": [{"name": "erp-logs", "policy": {"phases": {}}}],
+		"index_templates": [{"name": "erp-contacts", "index_patterns": ["erp_contacts_v*"], "template": {}}]
+	}`
+	if err := os.WriteFile(cfg.TemplatesFile, []byte(templates), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	bootstrap(t, cfg, false)
+	want := []string{"_ilm/policy/erp-logs", "_index_template/erp-contacts"}
+	if !reflect.DeepEqual(es.templates, want) {
+		t.Errorf("installed %v, want %v", es.templates, want)
+	}
+}
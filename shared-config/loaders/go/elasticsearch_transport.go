@@ -0,0 +1,454 @@
+package sharedconfig
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StatusCodes is a list of HTTP status codes. In YAML it may be written as a
+// list or as a comma-separated string such as "502,503,504".
+type StatusCodes []int
+
+// UnmarshalYAML accepts both list and comma-separated string forms
+func (s *StatusCodes) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.SequenceNode {
+		var codes []int
+		if err := value.Decode(&codes); err != nil {
+			return err
+		}
+		*s = codes
+		return nil
+	}
+
+	codes, err := ParseStatusCodes(value.Value)
+	if err != nil {
+		return err
+	}
+	*s = codes
+	return nil
+}
+
+// ParseStatusCodes parses a comma-separated list of HTTP status codes
+func ParseStatusCodes(value string) (StatusCodes, error) {
+	var codes StatusCodes
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		code, err := strconv.Atoi(part)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid http status code %q", part)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// GetRetryOnStatus returns the statuses that trigger a retry
+func (e *ElasticsearchSettingsConfig) GetRetryOnStatus() StatusCodes {
+	if len(e.RetryOnStatus) == 0 {
+		return StatusCodes{502, 503, 504} // Default
+	}
+	return e.RetryOnStatus
+}
+
+// GetMaxRetries returns how often a failed request is retried
+func (e *ElasticsearchSettingsConfig) GetMaxRetries() int {
+	if e.MaxRetries <= 0 {
+		return 3 // Default
+	}
+	return e.MaxRetries
+}
+
+// GetRetryBackoff returns the delay before the first retry
+func (e *ElasticsearchSettingsConfig) GetRetryBackoff() time.Duration {
+	if e.RetryBackoffMs <= 0 {
+		return 100 * time.Millisecond // Default
+	}
+	return time.Duration(e.RetryBackoffMs) * time.Millisecond
+}
+
+// GetMaxRetryBackoff returns the upper bound for a single retry delay
+func (e *ElasticsearchSettingsConfig) GetMaxRetryBackoff() time.Duration {
+	if e.MaxRetryBackoffMs <= 0 {
+		return 5 * time.Second // Default
+	}
+	return time.Duration(e.MaxRetryBackoffMs) * time.Millisecond
+}
+
+// GetDiscoverNodesInterval returns how often the node list is refreshed by
+// sniffing; zero disables periodic sniffing
+func (e *ElasticsearchSettingsConfig) GetDiscoverNodesInterval() time.Duration {
+	if e.DiscoverNodesInterval <= 0 {
+		return 0
+	}
+	return time.Duration(e.DiscoverNodesInterval) * time.Second
+}
+
+// ElasticsearchTransport is an http.RoundTripper that spreads requests over
+// the configured nodes, adds authentication, compresses request bodies and
+// retries failed requests with backoff
+type ElasticsearchTransport struct {
+	// Transport is the underlying transport with TLS and timeouts applied
+	Transport *http.Transport
+
+	Username    string
+	Password    string
+	APIKey      string
+	BearerToken string
+
+	MaxRetries          int
+	RetryOnStatus       StatusCodes
+	RetryBackoff        time.Duration
+	MaxRetryBackoff     time.Duration
+	CompressRequestBody bool
+
+	// DiscoverNodesInterval refreshes the node list by sniffing when the last
+	// refresh is older than the interval; the first request sniffs when the
+	// transport was built with discover_nodes_on_start
+	DiscoverNodesInterval time.Duration
+
+	mu             sync.Mutex
+	nodes          []*url.URL
+	next           int
+	lastDiscovered time.Time
+}
+
+// BuildTransport returns a ready transport and node list for the configured cluster
+func (e *ElasticsearchConfig) BuildTransport() (*ElasticsearchTransport, error) {
+	nodes, err := e.GetNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := e.buildTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	fingerprint, err := e.caFingerprint()
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: e.Settings.GetTimeout(), KeepAlive: 30 * time.Second}
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.TLSClientConfig = tlsConfig
+	base.ResponseHeaderTimeout = e.Settings.GetTimeout()
+	base.DialContext = dialer.DialContext
+	if fingerprint != nil {
+		base.DialTLSContext = dialPinned(dialer, tlsConfig, fingerprint)
+	}
+
+	transport := &ElasticsearchTransport{
+		Transport:             base,
+		Username:              e.Username,
+		Password:              e.Password,
+		APIKey:                e.APIKey,
+		BearerToken:           e.BearerToken,
+		MaxRetries:            e.Settings.GetMaxRetries(),
+		RetryOnStatus:         e.Settings.GetRetryOnStatus(),
+		RetryBackoff:          e.Settings.GetRetryBackoff(),
+		MaxRetryBackoff:       e.Settings.GetMaxRetryBackoff(),
+		CompressRequestBody:   e.Settings.CompressRequestBody,
+		DiscoverNodesInterval: e.Settings.GetDiscoverNodesInterval(),
+		nodes:                 nodes,
+	}
+	if !e.Settings.DiscoverNodesOnStart {
+		transport.lastDiscovered = time.Now()
+	}
+	return transport, nil
+}
+
+// GetNodes returns the node URLs: Nodes if set, otherwise the single Host/Port node
+func (e *ElasticsearchConfig) GetNodes() ([]*url.URL, error) {
+	raw := e.Nodes
+	if len(raw) == 0 {
+		raw = []string{e.GetURL()}
+	}
+
+	nodes := make([]*url.URL, 0, len(raw))
+	for _, node := range raw {
+		u, err := url.Parse(strings.TrimSpace(node))
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid elasticsearch node %q", node)
+		}
+		u.User = nil
+		nodes = append(nodes, u)
+	}
+	return nodes, nil
+}
+
+func (e *ElasticsearchConfig) buildTLSConfig() (*tls.Config, error) {
+	// ca_cert and verify_certs predate the shared tls block and still apply
+	settings := e.TLS
+	if settings.CAFile == "" {
+		settings.CAFile = e.CACert
+	}
+	if !e.GetVerifyCerts() {
+		settings.InsecureSkipVerify = true
+	}
+
+	tlsConfig, err := settings.ToStdTLS()
+	if err != nil {
+		return nil, fmt.Errorf("invalid elasticsearch tls config: %w", err)
+	}
+	return tlsConfig, nil
+}
+
+// caFingerprint decodes ca_fingerprint, or returns nil when it is unset
+func (e *ElasticsearchConfig) caFingerprint() ([]byte, error) {
+	if e.CAFingerprint == "" {
+		return nil, nil
+	}
+	want, err := hex.DecodeString(strings.ReplaceAll(e.CAFingerprint, ":", ""))
+	if err != nil || len(want) != sha256.Size {
+		return nil, fmt.Errorf("elasticsearch ca_fingerprint must be a hex encoded SHA-256 digest")
+	}
+	return want, nil
+}
+
+// dialPinned returns a DialTLSContext that verifies the chain against the CA
+// whose SHA-256 digest is want instead of the system roots. The certificate
+// is checked against tls.server_name, or else the dialed host.
+func dialPinned(dialer *net.Dialer, config *tls.Config, want []byte) func(context.Context, string, string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		pinned := config.Clone()
+		if pinned.ServerName == "" {
+			pinned.ServerName = host
+		}
+		serverName := pinned.ServerName
+		pinned.InsecureSkipVerify = true
+		pinned.VerifyPeerCertificate = nil
+		pinned.VerifyConnection = func(cs tls.ConnectionState) error {
+			return verifyPinnedChain(cs, want, serverName)
+		}
+
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		tlsConn := tls.Client(conn, pinned)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+}
+
+// verifyPinnedChain verifies the server certificate of cs for serverName
+// against the CA among the presented certificates whose SHA-256 digest is want
+func verifyPinnedChain(cs tls.ConnectionState, want []byte, serverName string) error {
+	if len(cs.PeerCertificates) == 0 {
+		return fmt.Errorf("elasticsearch tls: server presented no certificate")
+	}
+
+	roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+	pinned := false
+	for _, cert := range cs.PeerCertificates {
+		digest := sha256.Sum256(cert.Raw)
+		if bytes.Equal(digest[:], want) {
+			roots.AddCert(cert)
+			pinned = true
+		} else {
+			intermediates.AddCert(cert)
+		}
+	}
+	if !pinned {
+		return fmt.Errorf("elasticsearch certificate chain does not contain the ca_fingerprint CA")
+	}
+	opts := x509.VerifyOptions{Roots: roots, Intermediates: intermediates, DNSName: serverName}
+	if _, err := cs.PeerCertificates[0].Verify(opts); err != nil {
+		return fmt.Errorf("elasticsearch certificate is not issued by the ca_fingerprint CA: %w", err)
+	}
+	return nil
+}
+
+// Nodes returns the current node list
+func (t *ElasticsearchTransport) Nodes() []*url.URL {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*url.URL(nil), t.nodes...)
+}
+
+// nextNode returns the next node in round-robin order
+func (t *ElasticsearchTransport) nextNode() *url.URL {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	node := t.nodes[t.next%len(t.nodes)]
+	t.next++
+	return node
+}
+
+// DiscoverNodes replaces the node list with the HTTP publish addresses of the
+// cluster's nodes, keeping the scheme of the configured nodes
+func (t *ElasticsearchTransport) DiscoverNodes(ctx context.Context) error {
+	seed := t.nextNode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, seed.String()+"/_nodes/http", nil)
+	if err != nil {
+		return err
+	}
+	t.authorize(req)
+
+	resp, err := t.Transport.RoundTrip(req)
+	if err != nil {
+		return fmt.Errorf("error discovering elasticsearch nodes: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error discovering elasticsearch nodes: status %d", resp.StatusCode)
+	}
+
+	var info struct {
+		Nodes map[string]struct {
+			HTTP struct {
+				PublishAddress string `json:"publish_address"`
+			} `json:"http"`
+		} `json:"nodes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return fmt.Errorf("error decoding elasticsearch nodes: %w", err)
+	}
+
+	var nodes []*url.URL
+	for _, node := range info.Nodes {
+		addr := node.HTTP.PublishAddress
+		// publish_address may be "hostname/ip:port"
+		if i := strings.LastIndex(addr, "/"); i >= 0 {
+			addr = addr[i+1:]
+		}
+		if addr != "" {
+			nodes = append(nodes, &url.URL{Scheme: seed.Scheme, Host: addr})
+		}
+	}
+	if len(nodes) == 0 {
+		return fmt.Errorf("elasticsearch node discovery returned no nodes")
+	}
+
+	t.mu.Lock()
+	t.nodes = nodes
+	t.lastDiscovered = time.Now()
+	t.mu.Unlock()
+	return nil
+}
+
+func (t *ElasticsearchTransport) authorize(req *http.Request) {
+	switch {
+	case t.APIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+t.APIKey)
+	case t.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+t.BearerToken)
+	case t.Username != "":
+		req.SetBasicAuth(t.Username, t.Password)
+	}
+}
+
+// RoundTrip sends req to the next node, retrying on network errors and on
+// the configured statuses with exponential backoff
+func (t *ElasticsearchTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	stale := t.lastDiscovered.IsZero() ||
+		(t.DiscoverNodesInterval > 0 && time.Since(t.lastDiscovered) > t.DiscoverNodesInterval)
+	if stale {
+		t.lastDiscovered = time.Now()
+	}
+	t.mu.Unlock()
+	if stale {
+		// A failed refresh keeps the previous node list
+		_ = t.DiscoverNodes(req.Context())
+	}
+
+	var body []byte
+	if req.Body != nil {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = data
+	}
+	compressed := false
+	if t.CompressRequestBody && len(body) > 0 {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		body = buf.Bytes()
+		compressed = true
+	}
+
+	backoff := t.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		node := t.nextNode()
+		attemptReq := req.Clone(req.Context())
+		attemptReq.URL.Scheme = node.Scheme
+		attemptReq.URL.Host = node.Host
+		attemptReq.URL.Path = strings.TrimRight(node.Path, "/") + req.URL.Path
+		attemptReq.Host = node.Host
+		t.authorize(attemptReq)
+		if body != nil {
+			attemptReq.Body = io.NopCloser(bytes.NewReader(body))
+			attemptReq.ContentLength = int64(len(body))
+		}
+		if compressed {
+			attemptReq.Header.Set("Content-Encoding", "gzip")
+		}
+
+		resp, err := t.Transport.RoundTrip(attemptReq)
+		retry := err != nil || t.retryOnStatus(resp.StatusCode)
+		if !retry || attempt >= t.MaxRetries {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		delay := time.Duration(rand.Int63n(int64(backoff)) + 1)
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+		backoff *= 2
+		if backoff > t.MaxRetryBackoff {
+			backoff = t.MaxRetryBackoff
+		}
+	}
+}
+
+func (t *ElasticsearchTransport) retryOnStatus(status int) bool {
+	for _, code := range t.RetryOnStatus {
+		if code == status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,339 @@
+package sharedconfig
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// testCert is a certificate and key generated for a test. A certificate
+// without hosts is a CA.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+var testCertSerial atomic.Int64
+
+// newTestCert issues a certificate for hosts signed by parent, or a
+// self-signed CA when parent is nil
+func newTestCert(t *testing.T, name string, hosts []string, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(testCertSerial.Add(1)),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	if len(hosts) == 0 {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+// fingerprint returns the ca_fingerprint form of the certificate's digest
+func (c *testCert) fingerprint() string {
+	digest := sha256.Sum256(c.cert.Raw)
+	return hex.EncodeToString(digest[:])
+}
+
+// tlsServer serves handler over TLS, presenting leaf followed by chain
+func tlsServer(t *testing.T, handler http.Handler, leaf *testCert, chain ...*testCert) *httptest.Server {
+	t.Helper()
+	certificate := tls.Certificate{Certificate: [][]byte{leaf.cert.Raw}, PrivateKey: leaf.key}
+	for _, c := range chain {
+		certificate.Certificate = append(certificate.Certificate, c.cert.Raw)
+	}
+	srv := httptest.NewUnstartedServer(handler)
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{certificate}}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestParseStatusCodes(t *testing.T) {
+	got, err := ParseStatusCodes(" 502, 503,504,")
+	if err != nil || !reflect.DeepEqual(got, StatusCodes{502, 503, 504}) {
+		t.Errorf("ParseStatusCodes = %v, %v", got, err)
+	}
+	for _, bad := range []string{"abc", "99", "600", "502;503"} {
+		if _, err := ParseStatusCodes(bad); err == nil {
+			t.Errorf("ParseStatusCodes(%q) succeeded", bad)
+		}
+	}
+
+	var v struct {
+		A StatusCodes `yaml:"a"`
+		B StatusCodes `yaml:"b"`
+	}
+	if err := yaml.Unmarshal([]byte("a: 429,503\nb: [500, 502]\n"), &v); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v.A, StatusCodes{429, 503}) || !reflect.DeepEqual(v.B, StatusCodes{500, 502}) {
+		t.Errorf("got %v and %v", v.A, v.B)
+	}
+}
+
+// testTransport builds the transport for nodes with fast retries
+func testTransport(t *testing.T, nodes ...string) *ElasticsearchTransport {
+	t.Helper()
+	cfg := &ElasticsearchConfig{
+		Nodes:  nodes,
+		APIKey: "es-key",
+		Settings: ElasticsearchSettingsConfig{
+			MaxRetries:        2,
+			RetryBackoffMs:    1,
+			MaxRetryBackoffMs: 2,
+		},
+	}
+	transport, err := cfg.BuildTransport()
+	if err != nil {
+		t.Fatalf("BuildTransport: %v", err)
+	}
+	return transport
+}
+
+func get(t *testing.T, transport http.RoundTripper, path string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, "http://placeholder"+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestTransportRetriesConfiguredStatuses(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	if got := get(t, testTransport(t, srv.URL), "/").StatusCode; got != http.StatusOK {
+		t.Errorf("status = %d, want 200 after two retries", got)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("requests = %d, want 3", got)
+	}
+}
+
+func TestTransportGivesUpAfterMaxRetries(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	if got := get(t, testTransport(t, srv.URL), "/").StatusCode; got != http.StatusBadGateway {
+		t.Errorf("status = %d, want the last 502", got)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("requests = %d, want 1 plus max_retries 2", got)
+	}
+}
+
+func TestTransportDoesNotRetryOtherStatuses(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	get(t, testTransport(t, srv.URL), "/")
+	if got := calls.Load(); got != 1 {
+		t.Errorf("requests = %d, want 1", got)
+	}
+}
+
+func TestTransportRoundRobinsAuthorizesAndCompresses(t *testing.T) {
+	var hits [2]atomic.Int32
+	var bodies []string
+	handler := func(i int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			hits[i].Add(1)
+			if got := r.Header.Get("Authorization"); got != "ApiKey es-key" {
+				t.Errorf("Authorization = %q", got)
+			}
+			if r.Header.Get("Content-Encoding") == "gzip" {
+				zr, err := gzip.NewReader(r.Body)
+				if err != nil {
+					t.Errorf("gzip: %v", err)
+					return
+				}
+				data, _ := io.ReadAll(zr)
+				bodies = append(bodies, string(data))
+			}
+		}
+	}
+	a := httptest.NewServer(handler(0))
+	defer a.Close()
+	b := httptest.NewServer(handler(1))
+	defer b.Close()
+
+	transport := testTransport(t, a.URL, b.URL)
+	transport.CompressRequestBody = true
+	for i := 0; i < 4; i++ {
+		get(t, transport, "/")
+	}
+	if hits[0].Load() != 2 || hits[1].Load() != 2 {
+		t.Errorf("hits = %d and %d, want 2 each", hits[0].Load(), hits[1].Load())
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "http://placeholder/_bulk", strings.NewReader(`{"index":{}}`))
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	resp.Body.Close()
+	if !reflect.DeepEqual(bodies, []string{`{"index":{}}`}) {
+		t.Errorf("decompressed bodies = %q", bodies)
+	}
+}
+
+func TestTransportDiscoversNodes(t *testing.T) {
+	var sniffs atomic.Int32
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_nodes/http" {
+			sniffs.Add(1)
+			host := strings.TrimPrefix(srv.URL, "http://")
+			fmt.Fprintf(w, `{"nodes":{"n1":{"http":{"publish_address":"es-1.internal/%s"}}}}`, host)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := &ElasticsearchConfig{
+		Nodes:    []string{srv.URL},
+		Settings: ElasticsearchSettingsConfig{DiscoverNodesOnStart: true, RetryBackoffMs: 1},
+	}
+	transport, err := cfg.BuildTransport()
+	if err != nil {
+		t.Fatalf("BuildTransport: %v", err)
+	}
+	get(t, transport, "/")
+	get(t, transport, "/")
+	if got := sniffs.Load(); got != 1 {
+		t.Errorf("sniffs = %d, want 1 on start and none without an interval", got)
+	}
+	want := []*url.URL{{Scheme: "http", Host: strings.TrimPrefix(srv.URL, "http://")}}
+	if got := transport.Nodes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("nodes = %v, want %v", got, want)
+	}
+}
+
+func TestTransportPinsCAFingerprint(t *testing.T) {
+	ca := newTestCert(t, "erp ca", nil, nil)
+	leaf := newTestCert(t, "elasticsearch", []string{"127.0.0.1"}, ca)
+	// An attacker's own CA signs its leaf and it presents the real, public
+	// CA certificate after it
+	attackerCA := newTestCert(t, "attacker ca", nil, nil)
+	attackerLeaf := newTestCert(t, "elasticsearch", []string{"127.0.0.1"}, attackerCA)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name        string
+		srv         *httptest.Server
+		fingerprint string
+		serverName  string
+		wantErr     string
+	}{
+		{"pinned ca", tlsServer(t, ok, leaf, ca), ca.fingerprint(), "", ""},
+		{"colon separated", tlsServer(t, ok, leaf, ca), strings.ToUpper(colonHex(ca.fingerprint())), "", ""},
+		{"other ca", tlsServer(t, ok, leaf, ca), attackerCA.fingerprint(), "", "does not contain the ca_fingerprint CA"},
+		{"leaf not issued by the pinned ca", tlsServer(t, ok, attackerLeaf, ca), ca.fingerprint(), "", "not issued by the ca_fingerprint CA"},
+		{"wrong hostname", tlsServer(t, ok, leaf, ca), ca.fingerprint(), "es.example.com", "not issued by the ca_fingerprint CA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &ElasticsearchConfig{
+				Nodes:         []string{tt.srv.URL},
+				CAFingerprint: tt.fingerprint,
+				TLS:           TLSConfig{ServerName: tt.serverName},
+				Settings:      ElasticsearchSettingsConfig{MaxRetries: 1, RetryBackoffMs: 1},
+			}
+			transport, err := cfg.BuildTransport()
+			if err != nil {
+				t.Fatalf("BuildTransport: %v", err)
+			}
+			req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, tt.srv.URL+"/", nil)
+			resp, err := transport.RoundTrip(req)
+			if resp != nil {
+				resp.Body.Close()
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("RoundTrip: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func colonHex(s string) string {
+	var parts []string
+	for i := 0; i < len(s); i += 2 {
+		parts = append(parts, s[i:i+2])
+	}
+	return strings.Join(parts, ":")
+}
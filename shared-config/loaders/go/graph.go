@@ -0,0 +1,253 @@
+package sharedconfig
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// moduleGroup is the ServiceGraph group of services declared under modules
+const moduleGroup = "modules"
+
+// edge sources: an edge can be declared by modules[].dependencies, by
+// infrastructure.*.used_by, or by both
+const (
+	declaredByModule = 1 << iota
+	declaredByUsedBy
+)
+
+// GraphInconsistency is a disagreement between modules[].dependencies and
+// infrastructure.*.used_by, or a reference to an undeclared service
+type GraphInconsistency struct {
+	Module     string
+	Dependency string
+	Problem    string
+}
+
+func (i GraphInconsistency) String() string {
+	return fmt.Sprintf("%s -> %s: %s", i.Module, i.Dependency, i.Problem)
+}
+
+// ServiceGraph is the DependencyGraph of modules combined with the
+// infrastructure.*.used_by declarations. Groups maps every service to
+// "modules" or its infrastructure kind; services referenced but declared
+// nowhere have no group.
+type ServiceGraph struct {
+	*DependencyGraph
+	Groups map[string]string
+
+	declared map[[2]string]int
+}
+
+// ServiceGraph builds the combined graph of modules and infrastructure
+func (c *Config) ServiceGraph() *ServiceGraph {
+	g := &ServiceGraph{
+		DependencyGraph: NewDependencyGraph(c.Modules),
+		Groups:          map[string]string{},
+		declared:        map[[2]string]int{},
+	}
+	for _, m := range c.Modules {
+		g.Groups[m.Name] = moduleGroup
+		for _, dep := range m.Dependencies {
+			g.declared[[2]string{m.Name, dep}] |= declaredByModule
+		}
+	}
+	for group, services := range c.Infrastructure {
+		for name, service := range services {
+			g.Groups[name] = group
+			if !g.Has(name) {
+				g.deps[name] = nil
+			}
+			for _, user := range service.UsedBy {
+				g.addEdge(user, name)
+				g.declared[[2]string{user, name}] |= declaredByUsedBy
+			}
+		}
+	}
+	return g
+}
+
+func (g *ServiceGraph) addEdge(from, to string) {
+	for _, dep := range g.deps[from] {
+		if dep == to {
+			return
+		}
+	}
+	g.deps[from] = append(g.deps[from], to)
+	sort.Strings(g.deps[from])
+}
+
+// Inconsistencies reports edges declared on only one side, used_by entries
+// naming unknown modules and dependencies on undeclared services
+func (g *ServiceGraph) Inconsistencies() []GraphInconsistency {
+	var problems []GraphInconsistency
+	for _, from := range g.Nodes() {
+		for _, to := range g.deps[from] {
+			source := g.declared[[2]string{from, to}]
+			fromGroup, toGroup := g.Groups[from], g.Groups[to]
+			switch {
+			case fromGroup == "":
+				problems = append(problems, GraphInconsistency{from, to,
+					fmt.Sprintf("infrastructure.%s.%s.used_by names unknown module %s", toGroup, to, from)})
+			case toGroup == "":
+				problems = append(problems, GraphInconsistency{from, to,
+					fmt.Sprintf("modules[%s].dependencies names undeclared service %s", from, to)})
+			case toGroup == moduleGroup:
+			case source == declaredByModule:
+				problems = append(problems, GraphInconsistency{from, to,
+					fmt.Sprintf("missing from infrastructure.%s.%s.used_by", toGroup, to)})
+			case source == declaredByUsedBy:
+				problems = append(problems, GraphInconsistency{from, to,
+					fmt.Sprintf("missing from modules[%s].dependencies", from)})
+			}
+		}
+	}
+	return problems
+}
+
+// Impact returns the modules that depend on name directly and those that
+// only depend on it through other modules
+func (g *ServiceGraph) Impact(name string) (direct, transitive []string, err error) {
+	if !g.Has(name) {
+		return nil, nil, fmt.Errorf("unknown module or service %q", name)
+	}
+
+	dependents := map[string][]string{}
+	for _, from := range g.Nodes() {
+		for _, to := range g.deps[from] {
+			dependents[to] = append(dependents[to], from)
+		}
+	}
+
+	seen := map[string]bool{name: true}
+	queue := []string{name}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, dependent := range dependents[current] {
+			if seen[dependent] {
+				continue
+			}
+			seen[dependent] = true
+			queue = append(queue, dependent)
+			if current == name {
+				direct = append(direct, dependent)
+			} else {
+				transitive = append(transitive, dependent)
+			}
+		}
+	}
+	sort.Strings(direct)
+	sort.Strings(transitive)
+	return direct, transitive, nil
+}
+
+// edgeInconsistent reports whether an edge is declared on one side only
+func (g *ServiceGraph) edgeInconsistent(from, to string) bool {
+	if g.Groups[to] == moduleGroup {
+		return false
+	}
+	return g.declared[[2]string{from, to}] != declaredByModule|declaredByUsedBy
+}
+
+// WriteDOT renders the graph in Graphviz DOT. Infrastructure is drawn as
+// cylinders grouped by kind; edges declared on only one side are dashed red.
+func (g *ServiceGraph) WriteDOT(w io.Writer) {
+	fmt.Fprintln(w, "digraph dependencies {")
+	fmt.Fprintln(w, "  rankdir=LR;")
+	fmt.Fprintln(w, "  node [shape=box];")
+	for i, group := range g.infrastructureGroups() {
+		fmt.Fprintf(w, "  subgraph cluster_%d {\n    label=%q;\n", i, group)
+		for _, name := range g.groupMembers(group) {
+			fmt.Fprintf(w, "    %q [shape=cylinder];\n", name)
+		}
+		fmt.Fprintln(w, "  }")
+	}
+	for _, from := range g.Nodes() {
+		for _, to := range g.deps[from] {
+			if g.edgeInconsistent(from, to) {
+				fmt.Fprintf(w, "  %q -> %q [style=dashed, color=red];\n", from, to)
+			} else {
+				fmt.Fprintf(w, "  %q -> %q;\n", from, to)
+			}
+		}
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// WriteMermaid renders the graph as a Mermaid flowchart. Edges declared on
+// only one side are dotted.
+func (g *ServiceGraph) WriteMermaid(w io.Writer) {
+	fmt.Fprintln(w, "graph LR")
+	for _, group := range g.infrastructureGroups() {
+		fmt.Fprintf(w, "  subgraph %s\n", group)
+		for _, name := range g.groupMembers(group) {
+			fmt.Fprintf(w, "    %s[(%s)]\n", mermaidID(name), name)
+		}
+		fmt.Fprintln(w, "  end")
+	}
+	for _, from := range g.Nodes() {
+		for _, to := range g.deps[from] {
+			arrow := "-->"
+			if g.edgeInconsistent(from, to) {
+				arrow = "-.->"
+			}
+			fmt.Fprintf(w, "  %s %s %s\n", mermaidID(from), arrow, mermaidID(to))
+		}
+	}
+}
+
+func (g *ServiceGraph) infrastructureGroups() []string {
+	seen := map[string]bool{}
+	var groups []string
+	for _, group := range g.Groups {
+		if group != moduleGroup && !seen[group] {
+			seen[group] = true
+			groups = append(groups, group)
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+func (g *ServiceGraph) groupMembers(group string) []string {
+	var members []string
+	for name, memberGroup := range g.Groups {
+		if memberGroup == group {
+			members = append(members, name)
+		}
+	}
+	sort.Strings(members)
+	return members
+}
+
+// mermaidID makes a service name safe as a Mermaid node id
+func mermaidID(name string) string {
+	return strings.NewReplacer("-", "_", ".", "_", " ", "_").Replace(name)
+}
+
+// WriteGraphReport prints the inconsistencies, one per line
+func WriteGraphReport(w io.Writer, problems []GraphInconsistency) {
+	if len(problems) == 0 {
+		fmt.Fprintln(w, "modules and infrastructure declarations agree")
+		return
+	}
+	for _, p := range problems {
+		fmt.Fprintf(w, "%-14s -> %-14s %s\n", p.Module, p.Dependency, p.Problem)
+	}
+}
+
+// WriteImpactReport prints the modules affected when name goes down
+func WriteImpactReport(w io.Writer, name string, direct, transitive []string) {
+	fmt.Fprintf(w, "%-14s %s\n", "service", name)
+	fmt.Fprintf(w, "%-14s %s\n", "direct", joinOrNone(direct))
+	fmt.Fprintf(w, "%-14s %s\n", "transitive", joinOrNone(transitive))
+}
+
+func joinOrNone(names []string) string {
+	if len(names) == 0 {
+		return "(none)"
+	}
+	return strings.Join(names, ", ")
+}
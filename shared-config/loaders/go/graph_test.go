@@ -0,0 +1,125 @@
+package sharedconfig
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testServiceGraph declares every kind of disagreement: analytics is not a
+// module, auth does not list kafka, redis does not list crm and nothing
+// declares elasticsearch
+func testServiceGraph() *ServiceGraph {
+	c := &Config{
+		Modules: []ModuleConfig{
+			{Name: "auth", Dependencies: []string{"postgresql"}},
+			{Name: "crm", Dependencies: []string{"auth", "postgresql", "redis"}},
+			{Name: "reports", Dependencies: []string{"crm", "elasticsearch"}},
+		},
+		Infrastructure: InfrastructureConfig{
+			"databases": {"postgresql": {UsedBy: []string{"auth", "crm", "analytics"}}},
+			"cache":     {"redis": {}},
+			"messaging": {"kafka": {UsedBy: []string{"auth"}}},
+		},
+	}
+	return c.ServiceGraph()
+}
+
+func TestServiceGraphInconsistencies(t *testing.T) {
+	var got []string
+	for _, p := range testServiceGraph().Inconsistencies() {
+		got = append(got, p.String())
+	}
+	want := []string{
+		"analytics -> postgresql: infrastructure.databases.postgresql.used_by names unknown module analytics",
+		"auth -> kafka: missing from modules[auth].dependencies",
+		"crm -> redis: missing from infrastructure.cache.redis.used_by",
+		"reports -> elasticsearch: modules[reports].dependencies names undeclared service elasticsearch",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Inconsistencies() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestServiceGraphImpact(t *testing.T) {
+	g := testServiceGraph()
+	tests := []struct {
+		name               string
+		direct, transitive []string
+	}{
+		{"postgresql", []string{"analytics", "auth", "crm"}, []string{"reports"}},
+		{"auth", []string{"crm"}, []string{"reports"}},
+		{"kafka", []string{"auth"}, []string{"crm", "reports"}},
+		{"reports", nil, nil},
+	}
+	for _, tt := range tests {
+		direct, transitive, err := g.Impact(tt.name)
+		if err != nil {
+			t.Errorf("Impact(%s): %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(direct, tt.direct) || !reflect.DeepEqual(transitive, tt.transitive) {
+			t.Errorf("Impact(%s) = %v, %v, want %v, %v", tt.name, direct, transitive, tt.direct, tt.transitive)
+		}
+	}
+
+	if _, _, err := g.Impact("billing"); err == nil {
+		t.Error("Impact accepted an unknown service")
+	}
+}
+
+func TestServiceGraphWriteDOT(t *testing.T) {
+	var out bytes.Buffer
+	testServiceGraph().WriteDOT(&out)
+	dot := out.String()
+
+	for _, want := range []string{
+		"digraph dependencies {\n",
+		"  subgraph cluster_1 {\n    label=\"databases\";\n    \"postgresql\" [shape=cylinder];\n  }\n",
+		"  \"auth\" -> \"postgresql\";\n",
+		"  \"crm\" -> \"auth\";\n",
+		"  \"crm\" -> \"redis\" [style=dashed, color=red];\n",
+		"  \"auth\" -> \"kafka\" [style=dashed, color=red];\n",
+		"  \"reports\" -> \"elasticsearch\" [style=dashed, color=red];\n",
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("DOT output is missing %q:\n%s", want, dot)
+		}
+	}
+	if !strings.HasSuffix(dot, "}\n") {
+		t.Errorf("DOT output is not closed:\n%s", dot)
+	}
+}
+
+func TestServiceGraphWriteMermaid(t *testing.T) {
+	var out bytes.Buffer
+	testServiceGraph().WriteMermaid(&out)
+	mermaid := out.String()
+
+	for _, want := range []string{
+		"graph LR\n",
+		"  subgraph messaging\n    kafka[(kafka)]\n  end\n",
+		"  auth --> postgresql\n",
+		"  crm --> auth\n",
+		"  crm -.-> redis\n",
+		"  auth -.-> kafka\n",
+	} {
+		if !strings.Contains(mermaid, want) {
+			t.Errorf("Mermaid output is missing %q:\n%s", want, mermaid)
+		}
+	}
+	if got := mermaidID("es-node.1 a"); got != "es_node_1_a" {
+		t.Errorf("mermaidID = %q", got)
+	}
+}
+
+func TestShippedServiceGraphIsConsistent(t *testing.T) {
+	g := loadEnvironment(t, "staging").ServiceGraph()
+	if problems := g.Inconsistencies(); len(problems) > 0 {
+		t.Errorf("config.yaml declarations disagree: %v", problems)
+	}
+	if cycle := g.FindCycle(); cycle != nil {
+		t.Errorf("config.yaml has a dependency cycle: %v", cycle)
+	}
+}
@@ -0,0 +1,578 @@
+package sharedconfig
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// GetEndpoint returns the path of the full health report
+func (h *HealthCheckConfig) GetEndpoint() string {
+	if h.Endpoint == "" {
+		return "/health" // Default
+	}
+	return h.Endpoint
+}
+
+// GetInterval returns how often dependencies are checked
+func (h *HealthCheckConfig) GetInterval() time.Duration {
+	if h.Interval <= 0 {
+		return 30 * time.Second // Default
+	}
+	return time.Duration(h.Interval) * time.Second
+}
+
+// GetTimeout returns the timeout of a single dependency check
+func (h *HealthCheckConfig) GetTimeout() time.Duration {
+	if h.Timeout <= 0 {
+		return 5 * time.Second // Default
+	}
+	return time.Duration(h.Timeout) * time.Second
+}
+
+// HealthChecker checks a single dependency
+type HealthChecker interface {
+	Check(ctx context.Context) error
+}
+
+// HealthCheckerFunc adapts a function to HealthChecker
+type HealthCheckerFunc func(ctx context.Context) error
+
+// Check calls f
+func (f HealthCheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// HealthCheckerFactory builds the checker for a configured dependency from
+// the loaded Config. A checker that also implements io.Closer is closed by
+// Health.Close.
+type HealthCheckerFactory func(cfg *Config, dep HealthCheckDependency) (HealthChecker, error)
+
+// healthCheckerFactoriesMu guards healthCheckerFactories
+var healthCheckerFactoriesMu sync.RWMutex
+
+var healthCheckerFactories = map[string]HealthCheckerFactory{
+	"postgres":      postgresHealthChecker,
+	"postgresql":    postgresHealthChecker,
+	"mongodb":       mongoHealthChecker,
+	"redis":         redisHealthChecker,
+	"kafka":         kafkaHealthChecker,
+	"qdrant":        qdrantHealthChecker,
+	"elasticsearch": elasticsearchHealthChecker,
+	"http":          httpHealthChecker,
+	"grpc":          grpcHealthChecker,
+	"tcp":           tcpHealthChecker,
+}
+
+// RegisterHealthChecker adds or replaces the factory for a dependency type.
+// It is safe to call while health checks are being built.
+func RegisterHealthChecker(depType string, factory HealthCheckerFactory) {
+	healthCheckerFactoriesMu.Lock()
+	defer healthCheckerFactoriesMu.Unlock()
+	healthCheckerFactories[depType] = factory
+}
+
+func lookupHealthCheckerFactory(depType string) (HealthCheckerFactory, bool) {
+	healthCheckerFactoriesMu.RLock()
+	defer healthCheckerFactoriesMu.RUnlock()
+	factory, ok := healthCheckerFactories[depType]
+	return factory, ok
+}
+
+// PostgresHealthChecker pings a database pool
+func PostgresHealthChecker(db *sql.DB) HealthChecker {
+	return HealthCheckerFunc(db.PingContext)
+}
+
+// MongoHealthChecker pings the primary
+func MongoHealthChecker(client *mongo.Client) HealthChecker {
+	return HealthCheckerFunc(func(ctx context.Context) error {
+		return client.Ping(ctx, nil)
+	})
+}
+
+// RedisHealthChecker sends PING on the client's selected database
+func RedisHealthChecker(client redis.UniversalClient) HealthChecker {
+	return HealthCheckerFunc(func(ctx context.Context) error {
+		return client.Ping(ctx).Err()
+	})
+}
+
+// KafkaHealthChecker requests broker metadata
+func KafkaHealthChecker(client *kgo.Client) HealthChecker {
+	return HealthCheckerFunc(client.Ping)
+}
+
+// QdrantHealthChecker calls Qdrant's readiness endpoint
+func QdrantHealthChecker(client *QdrantClient) HealthChecker {
+	return HealthCheckerFunc(func(ctx context.Context) error {
+		return client.do(ctx, http.MethodGet, "/readyz", nil, nil)
+	})
+}
+
+// ElasticsearchHealthChecker fails when the cluster health is red
+func ElasticsearchHealthChecker(client *ElasticsearchClient) HealthChecker {
+	return HealthCheckerFunc(func(ctx context.Context) error {
+		var result struct {
+			Status string `json:"status"`
+		}
+		if err := client.do(ctx, http.MethodGet, "/_cluster/health", nil, &result); err != nil {
+			return err
+		}
+		if result.Status == "red" {
+			return fmt.Errorf("cluster health is red")
+		}
+		return nil
+	})
+}
+
+// HTTPHealthChecker expects a 2xx response from url
+func HTTPHealthChecker(client *http.Client, url string) HealthChecker {
+	return HealthCheckerFunc(func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("%s returned %d", url, resp.StatusCode)
+		}
+		return nil
+	})
+}
+
+// GRPCHealthChecker calls the standard grpc.health.v1 Check for service
+// ("" checks the whole server)
+func GRPCHealthChecker(conn *grpc.ClientConn, service string) HealthChecker {
+	client := healthpb.NewHealthClient(conn)
+	return HealthCheckerFunc(func(ctx context.Context) error {
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			return err
+		}
+		if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("grpc service %q is %s", service, resp.GetStatus())
+		}
+		return nil
+	})
+}
+
+// TCPHealthChecker expects address to accept TCP connections
+func TCPHealthChecker(address string) HealthChecker {
+	return HealthCheckerFunc(func(ctx context.Context) error {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+}
+
+// closingChecker closes the client a factory opened for its checker
+type closingChecker struct {
+	HealthChecker
+	close func() error
+}
+
+func (c *closingChecker) Close() error {
+	return c.close()
+}
+
+func postgresHealthChecker(cfg *Config, dep HealthCheckDependency) (HealthChecker, error) {
+	if dep.Target == "" {
+		return nil, fmt.Errorf("health check %s needs the module as target", dep.Name)
+	}
+	pg := &cfg.Database.PostgreSQL
+	dsn, err := pg.GetDSNAs(dep.Target, PostgreSQLRoleApp)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(pg.GetDriver(), dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	return &closingChecker{PostgresHealthChecker(db), db.Close}, nil
+}
+
+func mongoHealthChecker(cfg *Config, dep HealthCheckDependency) (HealthChecker, error) {
+	opts, err := cfg.Database.MongoDB.GetClientOptions(dep.GetTarget("analytics"))
+	if err != nil {
+		return nil, err
+	}
+	client, err := mongo.Connect(context.Background(), opts)
+	if err != nil {
+		return nil, err
+	}
+	return &closingChecker{MongoHealthChecker(client), func() error {
+		return client.Disconnect(context.Background())
+	}}, nil
+}
+
+func redisHealthChecker(cfg *Config, dep HealthCheckDependency) (HealthChecker, error) {
+	client, err := NewRedisClient(&cfg.Cache.Redis, dep.GetTarget("default"))
+	if err != nil {
+		return nil, err
+	}
+	return &closingChecker{RedisHealthChecker(client), client.Close}, nil
+}
+
+func kafkaHealthChecker(cfg *Config, dep HealthCheckDependency) (HealthChecker, error) {
+	opts, err := cfg.MessageBroker.Kafka.GetClientOptions(dep.GetTarget("health"))
+	if err != nil {
+		return nil, err
+	}
+	client, err := kgo.NewClient(opts.FranzClientOpts()...)
+	if err != nil {
+		return nil, err
+	}
+	return &closingChecker{KafkaHealthChecker(client), func() error {
+		client.Close()
+		return nil
+	}}, nil
+}
+
+func qdrantHealthChecker(cfg *Config, dep HealthCheckDependency) (HealthChecker, error) {
+	client, err := NewQdrantClient(&cfg.VectorDatabase.Qdrant)
+	if err != nil {
+		return nil, err
+	}
+	return QdrantHealthChecker(client), nil
+}
+
+func elasticsearchHealthChecker(cfg *Config, dep HealthCheckDependency) (HealthChecker, error) {
+	client, err := NewElasticsearchClient(&cfg.Search.Elasticsearch)
+	if err != nil {
+		return nil, err
+	}
+	return ElasticsearchHealthChecker(client), nil
+}
+
+func httpHealthChecker(cfg *Config, dep HealthCheckDependency) (HealthChecker, error) {
+	if dep.Target == "" {
+		return nil, fmt.Errorf("health check %s needs a url as target", dep.Name)
+	}
+	client := http.DefaultClient
+	if dep.TLS.IsEnabled() {
+		tlsConfig, err := dep.TLS.ToStdTLS()
+		if err != nil {
+			return nil, fmt.Errorf("invalid tls config for health check %s: %w", dep.Name, err)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		client = &http.Client{Transport: transport}
+	}
+	return HTTPHealthChecker(client, dep.Target), nil
+}
+
+func grpcHealthChecker(cfg *Config, dep HealthCheckDependency) (HealthChecker, error) {
+	if dep.Target == "" {
+		return nil, fmt.Errorf("health check %s needs an address as target", dep.Name)
+	}
+	creds := insecure.NewCredentials()
+	if dep.TLS.IsEnabled() {
+		tlsConfig, err := dep.TLS.ToStdTLS()
+		if err != nil {
+			return nil, fmt.Errorf("invalid tls config for health check %s: %w", dep.Name, err)
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	conn, err := grpc.NewClient(dep.Target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	return &closingChecker{GRPCHealthChecker(conn, dep.Service), conn.Close}, nil
+}
+
+func tcpHealthChecker(cfg *Config, dep HealthCheckDependency) (HealthChecker, error) {
+	if dep.Target == "" {
+		return nil, fmt.Errorf("health check %s needs an address as target", dep.Name)
+	}
+	return TCPHealthChecker(dep.Target), nil
+}
+
+// GetTarget returns the dependency target, e.g. the module, purpose, url or
+// address the checker connects to
+func (d *HealthCheckDependency) GetTarget(defaultTarget string) string {
+	if d.Target == "" {
+		return defaultTarget
+	}
+	return d.Target
+}
+
+// HealthStatus is the state of a single dependency
+type HealthStatus string
+
+const (
+	HealthUp      HealthStatus = "up"
+	HealthDown    HealthStatus = "down"
+	HealthUnknown HealthStatus = "unknown"
+)
+
+// Overall states reported by /readyz and the health endpoint
+const (
+	HealthStatusOK          = "ok"
+	HealthStatusDegraded    = "degraded"
+	HealthStatusUnavailable = "unavailable"
+)
+
+// HealthResult is the cached result of the last check of a dependency
+type HealthResult struct {
+	Name      string       `json:"name"`
+	Type      string       `json:"type"`
+	Critical  bool         `json:"critical"`
+	Status    HealthStatus `json:"status"`
+	Error     string       `json:"error,omitempty"`
+	CheckedAt *time.Time   `json:"checked_at,omitempty"`
+	LatencyMs int64        `json:"latency_ms"`
+}
+
+// HealthReport is the body served by the health handlers
+type HealthReport struct {
+	Status string         `json:"status"`
+	Checks []HealthResult `json:"checks,omitempty"`
+}
+
+type healthEntry struct {
+	dep     HealthCheckDependency
+	checker HealthChecker
+}
+
+// Health runs dependency checks in the background and serves the cached
+// results. Critical dependencies that are down make the service unready;
+// non-critical ones only degrade it.
+type Health struct {
+	Interval time.Duration
+	Timeout  time.Duration
+	Endpoint string
+
+	mu      sync.RWMutex
+	entries []healthEntry
+	results map[string]HealthResult
+	lastRun time.Time
+}
+
+// NewHealth builds a checker for every configured dependency through the
+// factory registered for its type
+func NewHealth(cfg *Config) (*Health, error) {
+	h := &Health{
+		Interval: cfg.HealthCheck.GetInterval(),
+		Timeout:  cfg.HealthCheck.GetTimeout(),
+		Endpoint: cfg.HealthCheck.GetEndpoint(),
+		results:  map[string]HealthResult{},
+	}
+	for _, dep := range cfg.HealthCheck.Dependencies {
+		factory, ok := lookupHealthCheckerFactory(dep.Type)
+		if !ok {
+			h.Close()
+			return nil, fmt.Errorf("unknown health check type %q for %s", dep.Type, dep.Name)
+		}
+		checker, err := factory(cfg, dep)
+		if err != nil {
+			h.Close()
+			return nil, fmt.Errorf("error creating health check %s: %w", dep.Name, err)
+		}
+		h.Register(dep, checker)
+	}
+	return h, nil
+}
+
+// Register adds a checker, replacing any configured checker of the same name.
+// Services use it to check the clients they already hold.
+func (h *Health) Register(dep HealthCheckDependency, checker HealthChecker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.results == nil {
+		h.results = map[string]HealthResult{}
+	}
+	for i, e := range h.entries {
+		if e.dep.Name == dep.Name {
+			closeChecker(e.checker)
+			h.entries[i] = healthEntry{dep, checker}
+			return
+		}
+	}
+	h.entries = append(h.entries, healthEntry{dep, checker})
+}
+
+// Start checks every dependency immediately and then every Interval until ctx
+// is done
+func (h *Health) Start(ctx context.Context) {
+	h.RunChecks(ctx)
+	go func() {
+		ticker := time.NewTicker(h.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				h.RunChecks(ctx)
+			}
+		}
+	}()
+}
+
+// RunChecks checks every dependency concurrently, each bounded by Timeout,
+// and caches the results
+func (h *Health) RunChecks(ctx context.Context) {
+	h.mu.RLock()
+	entries := append([]healthEntry(nil), h.entries...)
+	h.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	results := make([]HealthResult, len(entries))
+	for i, e := range entries {
+		wg.Add(1)
+		go func(i int, e healthEntry) {
+			defer wg.Done()
+			results[i] = h.check(ctx, e)
+		}(i, e)
+	}
+	wg.Wait()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, r := range results {
+		h.results[r.Name] = r
+	}
+	h.lastRun = time.Now()
+}
+
+func (h *Health) check(ctx context.Context, e healthEntry) HealthResult {
+	ctx, cancel := context.WithTimeout(ctx, h.Timeout)
+	defer cancel()
+
+	result := HealthResult{Name: e.dep.Name, Type: e.dep.Type, Critical: e.dep.Critical, Status: HealthUp}
+	start := time.Now()
+	err := e.checker.Check(ctx)
+	checkedAt := time.Now()
+	result.CheckedAt = &checkedAt
+	result.LatencyMs = checkedAt.Sub(start).Milliseconds()
+	if err != nil {
+		result.Status = HealthDown
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Report returns the cached results. Dependencies that have not been checked
+// yet are unknown and count as down.
+func (h *Health) Report() HealthReport {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	report := HealthReport{Status: HealthStatusOK}
+	for _, e := range h.entries {
+		result, ok := h.results[e.dep.Name]
+		if !ok {
+			result = HealthResult{Name: e.dep.Name, Type: e.dep.Type, Critical: e.dep.Critical, Status: HealthUnknown}
+		}
+		report.Checks = append(report.Checks, result)
+
+		if result.Status == HealthUp {
+			continue
+		}
+		if result.Critical {
+			report.Status = HealthStatusUnavailable
+		} else if report.Status == HealthStatusOK {
+			report.Status = HealthStatusDegraded
+		}
+	}
+	sort.Slice(report.Checks, func(i, j int) bool { return report.Checks[i].Name < report.Checks[j].Name })
+	return report
+}
+
+// Ready reports whether every critical dependency is up
+func (h *Health) Ready() bool {
+	return h.Report().Status != HealthStatusUnavailable
+}
+
+// Live reports whether the background checks are still running. Dependencies
+// never affect liveness, so restarting the service cannot fix them.
+func (h *Health) Live() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.lastRun.IsZero() || time.Since(h.lastRun) < 3*h.Interval+h.Timeout
+}
+
+// LivezHandler answers 200 while the process is live
+func (h *Health) LivezHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.Live() {
+			writeHealthJSON(w, http.StatusServiceUnavailable, HealthReport{Status: HealthStatusUnavailable})
+			return
+		}
+		writeHealthJSON(w, http.StatusOK, HealthReport{Status: HealthStatusOK})
+	})
+}
+
+// ReadyzHandler answers 503 when a critical dependency is down and 200 with
+// status degraded when only non-critical dependencies are down
+func (h *Health) ReadyzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := h.Report()
+		status := http.StatusOK
+		if report.Status == HealthStatusUnavailable {
+			status = http.StatusServiceUnavailable
+		}
+		writeHealthJSON(w, status, report)
+	})
+}
+
+// Mount registers /livez, /readyz and the configured endpoint on mux
+func (h *Health) Mount(mux *http.ServeMux) {
+	mux.Handle("/livez", h.LivezHandler())
+	mux.Handle("/readyz", h.ReadyzHandler())
+	if h.Endpoint != "/livez" && h.Endpoint != "/readyz" {
+		mux.Handle(h.Endpoint, h.ReadyzHandler())
+	}
+}
+
+// Close closes the clients opened by the configured checkers
+func (h *Health) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var firstErr error
+	for _, e := range h.entries {
+		if err := closeChecker(e.checker); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	h.entries = nil
+	return firstErr
+}
+
+func closeChecker(checker HealthChecker) error {
+	if closer, ok := checker.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func writeHealthJSON(w http.ResponseWriter, status int, report HealthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,212 @@
+package sharedconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// switchChecker fails while err is set and counts its checks
+type switchChecker struct {
+	mu     sync.Mutex
+	err    error
+	checks atomic.Int64
+}
+
+func (c *switchChecker) Check(ctx context.Context) error {
+	c.checks.Add(1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *switchChecker) set(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+func serveHealth(t *testing.T, handler http.Handler) (int, HealthReport) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	var report HealthReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, report
+}
+
+func TestHealthReadyzAndLivez(t *testing.T) {
+	postgres, search := &switchChecker{}, &switchChecker{}
+	h := &Health{Interval: time.Minute, Timeout: time.Second}
+	h.Register(HealthCheckDependency{Name: "postgres", Type: "postgres", Critical: true}, postgres)
+	h.Register(HealthCheckDependency{Name: "search", Type: "elasticsearch"}, search)
+
+	tests := []struct {
+		name           string
+		postgres       error
+		search         error
+		readyz         int
+		status         string
+		postgresStatus HealthStatus
+	}{
+		{"all up", nil, nil, http.StatusOK, HealthStatusOK, HealthUp},
+		{"non-critical down", nil, errors.New("cluster health is red"), http.StatusOK, HealthStatusDegraded, HealthUp},
+		{"critical down", errors.New("connection refused"), nil, http.StatusServiceUnavailable, HealthStatusUnavailable, HealthDown},
+		{"both down", errors.New("connection refused"), errors.New("timeout"), http.StatusServiceUnavailable, HealthStatusUnavailable, HealthDown},
+	}
+	for _, tt := range tests {
+		postgres.set(tt.postgres)
+		search.set(tt.search)
+		h.RunChecks(context.Background())
+
+		code, report := serveHealth(t, h.ReadyzHandler())
+		if code != tt.readyz || report.Status != tt.status {
+			t.Errorf("%s: /readyz = %d %s, want %d %s", tt.name, code, report.Status, tt.readyz, tt.status)
+		}
+		if len(report.Checks) != 2 || report.Checks[0].Name != "postgres" || report.Checks[0].Status != tt.postgresStatus {
+			t.Errorf("%s: checks = %+v", tt.name, report.Checks)
+		}
+		if code, report := serveHealth(t, h.LivezHandler()); code != http.StatusOK || report.Checks != nil {
+			t.Errorf("%s: /livez = %d %+v, want 200 without dependencies", tt.name, code, report)
+		}
+	}
+}
+
+func TestHealthReportIsCached(t *testing.T) {
+	postgres := &switchChecker{}
+	h := &Health{Interval: time.Minute, Timeout: time.Second}
+	h.Register(HealthCheckDependency{Name: "postgres", Critical: true}, postgres)
+
+	if report := h.Report(); report.Status != HealthStatusUnavailable || report.Checks[0].Status != HealthUnknown {
+		t.Errorf("report before the first check = %+v, want an unknown critical dependency", report)
+	}
+
+	h.RunChecks(context.Background())
+	postgres.set(errors.New("connection refused"))
+	for i := 0; i < 3; i++ {
+		if !h.Ready() {
+			t.Fatal("Ready() changed without a new check run")
+		}
+	}
+	if got := postgres.checks.Load(); got != 1 {
+		t.Errorf("checker ran %d times, want 1: reports must be served from the cache", got)
+	}
+}
+
+func TestHealthStartChecksInBackground(t *testing.T) {
+	postgres := &switchChecker{}
+	h := &Health{Interval: 5 * time.Millisecond, Timeout: time.Second}
+	h.Register(HealthCheckDependency{Name: "postgres", Critical: true}, postgres)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h.Start(ctx)
+	if got := postgres.checks.Load(); got < 1 {
+		t.Fatal("Start returned before the first check")
+	}
+	postgres.set(errors.New("connection refused"))
+	deadline := time.Now().Add(5 * time.Second)
+	for h.Ready() {
+		if time.Now().After(deadline) {
+			t.Fatal("the background checks never noticed the failure")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+	stopped := postgres.checks.Load()
+	time.Sleep(20 * time.Millisecond)
+	if got := postgres.checks.Load(); got != stopped {
+		t.Errorf("checks kept running after ctx was done: %d -> %d", stopped, got)
+	}
+}
+
+func TestHealthCheckTimeout(t *testing.T) {
+	h := &Health{Interval: time.Minute, Timeout: 20 * time.Millisecond}
+	h.Register(HealthCheckDependency{Name: "kafka", Critical: true}, HealthCheckerFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+	h.Register(HealthCheckDependency{Name: "redis"}, &switchChecker{})
+
+	start := time.Now()
+	h.RunChecks(context.Background())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("RunChecks took %s with a 20ms timeout", elapsed)
+	}
+	report := h.Report()
+	if report.Checks[0].Name != "kafka" || report.Checks[0].Status != HealthDown || report.Checks[0].Error != context.DeadlineExceeded.Error() {
+		t.Errorf("hung check = %+v, want down with a deadline error", report.Checks[0])
+	}
+	if report.Checks[1].Status != HealthUp {
+		t.Errorf("a hung check held up %+v", report.Checks[1])
+	}
+}
+
+func TestHealthLivezFailsWhenChecksStall(t *testing.T) {
+	h := &Health{Interval: 10 * time.Millisecond, Timeout: 10 * time.Millisecond}
+	h.Register(HealthCheckDependency{Name: "postgres", Critical: true}, &switchChecker{err: errors.New("down")})
+	if code, _ := serveHealth(t, h.LivezHandler()); code != http.StatusOK {
+		t.Errorf("/livez before the first run = %d, want 200", code)
+	}
+
+	h.RunChecks(context.Background())
+	h.mu.Lock()
+	h.lastRun = time.Now().Add(-time.Second)
+	h.mu.Unlock()
+	if code, _ := serveHealth(t, h.LivezHandler()); code != http.StatusServiceUnavailable {
+		t.Errorf("/livez with stalled checks = %d, want 503", code)
+	}
+}
+
+func TestNewHealthUsesRegisteredFactories(t *testing.T) {
+	checker := &switchChecker{}
+	RegisterHealthChecker("test-queue", func(cfg *Config, dep HealthCheckDependency) (HealthChecker, error) {
+		return checker, nil
+	})
+
+	cfg := &Config{}
+	cfg.HealthCheck.Dependencies = []HealthCheckDependency{{Name: "queue", Type: "test-queue", Critical: true}}
+	h, err := NewHealth(cfg)
+	if err != nil {
+		t.Fatalf("NewHealth: %v", err)
+	}
+	defer h.Close()
+	h.RunChecks(context.Background())
+	if checker.checks.Load() != 1 {
+		t.Error("NewHealth did not use the registered factory")
+	}
+
+	cfg.HealthCheck.Dependencies = []HealthCheckDependency{{Name: "queue", Type: "carrier-pigeon"}}
+	if _, err := NewHealth(cfg); err == nil {
+		t.Error("NewHealth accepted an unknown type")
+	}
+}
+
+func TestRegisterHealthCheckerConcurrently(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			RegisterHealthChecker(fmt.Sprintf("test-concurrent-%d", i), tcpHealthChecker)
+		}(i)
+		go func() {
+			defer wg.Done()
+			lookupHealthCheckerFactory("tcp")
+		}()
+	}
+	wg.Wait()
+	if _, ok := lookupHealthCheckerFactory("test-concurrent-7"); !ok {
+		t.Error("a concurrently registered factory is missing")
+	}
+}
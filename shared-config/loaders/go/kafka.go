@@ -0,0 +1,270 @@
+package sharedconfig
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KafkaClientOptions is a validated, client-agnostic view of the Kafka
+// settings for one service. Use the adapters to turn it into options for a
+// concrete client library.
+type KafkaClientOptions struct {
+	Brokers  []string
+	ClientID string
+
+	SecurityProtocol string
+	SASLMechanism    string
+	SASLUsername     string
+	SASLPassword     string
+	TLS              TLSConfig
+	TLSConfig        *tls.Config
+
+	// Producer settings
+	Acks        string
+	Compression string
+	BatchSize   int
+	Linger      time.Duration
+	Retries     int
+	Idempotent  bool
+
+	// Consumer settings
+	GroupID            string
+	AutoOffsetReset    string
+	EnableAutoCommit   bool
+	AutoCommitInterval time.Duration
+	SessionTimeout     time.Duration
+	HeartbeatInterval  time.Duration
+}
+
+// GetClientOptions builds and validates the Kafka client options for a service.
+// The consumer group is resolved through ConsumerGroups.GetConsumerGroup.
+func (k *KafkaConfig) GetClientOptions(service string) (*KafkaClientOptions, error) {
+	opts := &KafkaClientOptions{
+		Brokers:          strings.Split(k.GetBrokerList(), ","),
+		ClientID:         service,
+		SecurityProtocol: k.GetSecurityProtocol(),
+		SASLMechanism:    strings.ToUpper(k.SASLMechanism),
+		SASLUsername:     k.SASLUsername,
+		SASLPassword:     k.SASLPassword,
+		TLS:              k.TLS,
+
+		Acks:        k.Producer.GetAcks(),
+		Compression: k.Producer.GetCompressionType(),
+		BatchSize:   k.Producer.GetBatchSize(),
+		Linger:      k.Producer.GetLinger(),
+		Retries:     k.Producer.Retries,
+		Idempotent:  k.Producer.EnableIdempotence,
+
+		GroupID:            k.ConsumerGroups.GetConsumerGroup(service),
+		AutoOffsetReset:    k.Consumer.GetAutoOffsetReset(),
+		EnableAutoCommit:   k.Consumer.EnableAutoCommit,
+		AutoCommitInterval: k.Consumer.GetAutoCommitInterval(),
+		SessionTimeout:     k.Consumer.GetSessionTimeout(),
+		HeartbeatInterval:  k.Consumer.GetHeartbeatInterval(),
+	}
+
+	// SASL settings only apply to the SASL_* protocols
+	if !strings.HasPrefix(opts.SecurityProtocol, "SASL_") {
+		opts.SASLMechanism, opts.SASLUsername, opts.SASLPassword = "", "", ""
+	}
+
+	if opts.UseTLS() {
+		tlsConfig, err := k.TLS.ToStdTLS()
+		if err != nil {
+			return nil, fmt.Errorf("invalid kafka tls config: %w", err)
+		}
+		opts.TLSConfig = tlsConfig
+	} else {
+		opts.TLS = TLSConfig{}
+	}
+
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// UseTLS reports whether the security protocol requires TLS
+func (o *KafkaClientOptions) UseTLS() bool {
+	return o.SecurityProtocol == "SSL" || o.SecurityProtocol == "SASL_SSL"
+}
+
+// Validate checks the options for values Kafka clients would reject or
+// silently misinterpret
+func (o *KafkaClientOptions) Validate() error {
+	switch o.SecurityProtocol {
+	case "PLAINTEXT", "SSL":
+	case "SASL_PLAINTEXT", "SASL_SSL":
+		switch o.SASLMechanism {
+		case "PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512":
+		case "":
+			return fmt.Errorf("kafka security protocol %s requires sasl_mechanism", o.SecurityProtocol)
+		default:
+			return fmt.Errorf("unsupported kafka sasl mechanism %q", o.SASLMechanism)
+		}
+		if o.SASLUsername == "" || o.SASLPassword == "" {
+			return fmt.Errorf("kafka security protocol %s requires sasl_username and sasl_password", o.SecurityProtocol)
+		}
+	default:
+		return fmt.Errorf("unsupported kafka security protocol %q", o.SecurityProtocol)
+	}
+
+	switch o.Acks {
+	case "0", "1", "all":
+	default:
+		return fmt.Errorf("invalid kafka acks %q (want 0, 1 or all)", o.Acks)
+	}
+	if o.Idempotent && o.Acks != "all" {
+		return fmt.Errorf("kafka idempotent producer requires acks=all, got %q", o.Acks)
+	}
+
+	switch o.Compression {
+	case "none", "gzip", "snappy", "lz4", "zstd":
+	default:
+		return fmt.Errorf("unsupported kafka compression type %q", o.Compression)
+	}
+
+	switch o.AutoOffsetReset {
+	case "earliest", "latest", "none":
+	default:
+		return fmt.Errorf("invalid kafka auto_offset_reset %q (want earliest, latest or none)", o.AutoOffsetReset)
+	}
+	if o.HeartbeatInterval*3 > o.SessionTimeout {
+		return fmt.Errorf("kafka heartbeat interval %s must be at most a third of the session timeout %s",
+			o.HeartbeatInterval, o.SessionTimeout)
+	}
+
+	return nil
+}
+
+// ProducerConfigMap returns librdkafka-style properties for a producer
+func (o *KafkaClientOptions) ProducerConfigMap() map[string]string {
+	m := o.commonConfigMap()
+	m["acks"] = o.Acks
+	m["compression.type"] = o.Compression
+	m["batch.size"] = strconv.Itoa(o.BatchSize)
+	m["linger.ms"] = strconv.FormatInt(o.Linger.Milliseconds(), 10)
+	m["enable.idempotence"] = strconv.FormatBool(o.Idempotent)
+	if o.Retries > 0 {
+		m["retries"] = strconv.Itoa(o.Retries)
+	}
+	return m
+}
+
+// ConsumerConfigMap returns librdkafka-style properties for a consumer
+func (o *KafkaClientOptions) ConsumerConfigMap() map[string]string {
+	m := o.commonConfigMap()
+	m["group.id"] = o.GroupID
+	m["auto.offset.reset"] = o.AutoOffsetReset
+	m["enable.auto.commit"] = strconv.FormatBool(o.EnableAutoCommit)
+	m["auto.commit.interval.ms"] = strconv.FormatInt(o.AutoCommitInterval.Milliseconds(), 10)
+	m["session.timeout.ms"] = strconv.FormatInt(o.SessionTimeout.Milliseconds(), 10)
+	m["heartbeat.interval.ms"] = strconv.FormatInt(o.HeartbeatInterval.Milliseconds(), 10)
+	return m
+}
+
+func (o *KafkaClientOptions) commonConfigMap() map[string]string {
+	m := map[string]string{
+		"bootstrap.servers": strings.Join(o.Brokers, ","),
+		"client.id":         o.ClientID,
+		"security.protocol": strings.ToLower(o.SecurityProtocol),
+	}
+	if o.SASLMechanism != "" {
+		m["sasl.mechanisms"] = o.SASLMechanism
+		m["sasl.username"] = o.SASLUsername
+		m["sasl.password"] = o.SASLPassword
+	}
+	if o.UseTLS() {
+		if o.TLS.CAFile != "" {
+			m["ssl.ca.location"] = o.TLS.CAFile
+		}
+		if o.TLS.CAPEM != "" {
+			m["ssl.ca.pem"] = o.TLS.CAPEM
+		}
+		if o.TLS.CertFile != "" {
+			m["ssl.certificate.location"] = o.TLS.CertFile
+			m["ssl.key.location"] = o.TLS.KeyFile
+		}
+		if o.TLS.InsecureSkipVerify {
+			m["enable.ssl.certificate.verification"] = "false"
+		}
+	}
+	return m
+}
+
+// GetSecurityProtocol returns the Kafka security protocol
+func (k *KafkaConfig) GetSecurityProtocol() string {
+	if k.SecurityProtocol == "" {
+		return "PLAINTEXT" // Default
+	}
+	return strings.ToUpper(k.SecurityProtocol)
+}
+
+// GetAcks returns the producer acknowledgement level, normalising -1 to all
+func (p *KafkaProducerConfig) GetAcks() string {
+	switch strings.ToLower(p.Acks) {
+	case "", "all", "-1":
+		return "all" // Default
+	default:
+		return p.Acks
+	}
+}
+
+// GetCompressionType returns the producer compression codec
+func (p *KafkaProducerConfig) GetCompressionType() string {
+	if p.CompressionType == "" {
+		return "none" // Default
+	}
+	return strings.ToLower(p.CompressionType)
+}
+
+// GetBatchSize returns the producer batch size in bytes
+func (p *KafkaProducerConfig) GetBatchSize() int {
+	if p.BatchSize <= 0 {
+		return 16384 // Default
+	}
+	return p.BatchSize
+}
+
+// GetLinger returns how long the producer waits to fill a batch
+func (p *KafkaProducerConfig) GetLinger() time.Duration {
+	if p.LingerMs <= 0 {
+		return 5 * time.Millisecond // Default
+	}
+	return time.Duration(p.LingerMs) * time.Millisecond
+}
+
+// GetAutoOffsetReset returns where a consumer starts without a committed offset
+func (c *KafkaConsumerConfig) GetAutoOffsetReset() string {
+	if c.AutoOffsetReset == "" {
+		return "latest" // Default
+	}
+	return strings.ToLower(c.AutoOffsetReset)
+}
+
+// GetAutoCommitInterval returns the offset auto-commit interval
+func (c *KafkaConsumerConfig) GetAutoCommitInterval() time.Duration {
+	if c.AutoCommitIntervalMs <= 0 {
+		return 5 * time.Second // Default
+	}
+	return time.Duration(c.AutoCommitIntervalMs) * time.Millisecond
+}
+
+// GetSessionTimeout returns the consumer group session timeout
+func (c *KafkaConsumerConfig) GetSessionTimeout() time.Duration {
+	if c.SessionTimeoutMs <= 0 {
+		return 45 * time.Second // Default
+	}
+	return time.Duration(c.SessionTimeoutMs) * time.Millisecond
+}
+
+// GetHeartbeatInterval returns the consumer group heartbeat interval
+func (c *KafkaConsumerConfig) GetHeartbeatInterval() time.Duration {
+	if c.HeartbeatIntervalMs <= 0 {
+		return 3 * time.Second // Default
+	}
+	return time.Duration(c.HeartbeatIntervalMs) * time.Millisecond
+}
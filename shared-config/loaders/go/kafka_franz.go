@@ -0,0 +1,194 @@
+package sharedconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+// FranzProducerOpts returns franz-go client options for a producer
+func (o *KafkaClientOptions) FranzProducerOpts() []kgo.Opt {
+	opts := o.FranzClientOpts()
+
+	switch o.Acks {
+	case "0":
+		opts = append(opts, kgo.RequiredAcks(kgo.NoAck()))
+	case "1":
+		opts = append(opts, kgo.RequiredAcks(kgo.LeaderAck()))
+	default:
+		opts = append(opts, kgo.RequiredAcks(kgo.AllISRAcks()))
+	}
+	if !o.Idempotent {
+		opts = append(opts, kgo.DisableIdempotentWrite())
+	}
+
+	// batch.size is a librdkafka/Java buffering hint with no franz-go
+	// equivalent; ProducerBatchMaxBytes is a hard per-batch limit that keeps
+	// its default matching the broker's max.message.bytes
+	opts = append(opts,
+		kgo.ProducerBatchCompression(franzCompression(o.Compression)),
+		kgo.ProducerLinger(o.Linger),
+	)
+	if o.Retries > 0 {
+		opts = append(opts, kgo.RecordRetries(o.Retries))
+	}
+	return opts
+}
+
+// FranzConsumerOpts returns franz-go client options for a group consumer
+func (o *KafkaClientOptions) FranzConsumerOpts() []kgo.Opt {
+	opts := o.FranzClientOpts()
+	opts = append(opts,
+		kgo.ConsumerGroup(o.GroupID),
+		kgo.SessionTimeout(o.SessionTimeout),
+		kgo.HeartbeatInterval(o.HeartbeatInterval),
+	)
+
+	switch o.AutoOffsetReset {
+	case "earliest":
+		opts = append(opts, kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()))
+	case "latest":
+		opts = append(opts, kgo.ConsumeResetOffset(kgo.NewOffset().AtEnd()))
+	case "none":
+		// Only resume from a committed offset; partitions without one fail
+		// in PollFetches instead of being reset
+		opts = append(opts, kgo.ConsumeResetOffset(kgo.NewOffset().AtCommitted()))
+	}
+
+	if o.EnableAutoCommit {
+		opts = append(opts, kgo.AutoCommitInterval(o.AutoCommitInterval))
+	} else {
+		opts = append(opts, kgo.DisableAutoCommit())
+	}
+	return opts
+}
+
+// FranzClientOpts returns the franz-go options shared by producers, consumers
+// and admin clients: seed brokers, client ID, TLS and SASL
+func (o *KafkaClientOptions) FranzClientOpts() []kgo.Opt {
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(o.Brokers...),
+		kgo.ClientID(o.ClientID),
+	}
+
+	if o.TLSConfig != nil {
+		opts = append(opts, kgo.DialTLSConfig(o.TLSConfig))
+	}
+	if mechanism := o.franzSASLMechanism(); mechanism != nil {
+		opts = append(opts, kgo.SASL(mechanism))
+	}
+	return opts
+}
+
+func (o *KafkaClientOptions) franzSASLMechanism() sasl.Mechanism {
+	switch o.SASLMechanism {
+	case "PLAIN":
+		return plain.Auth{User: o.SASLUsername, Pass: o.SASLPassword}.AsMechanism()
+	case "SCRAM-SHA-256":
+		return scram.Auth{User: o.SASLUsername, Pass: o.SASLPassword}.AsSha256Mechanism()
+	case "SCRAM-SHA-512":
+		return scram.Auth{User: o.SASLUsername, Pass: o.SASLPassword}.AsSha512Mechanism()
+	default:
+		return nil
+	}
+}
+
+func franzCompression(codec string) kgo.CompressionCodec {
+	switch codec {
+	case "gzip":
+		return kgo.GzipCompression()
+	case "snappy":
+		return kgo.SnappyCompression()
+	case "lz4":
+		return kgo.Lz4Compression()
+	case "zstd":
+		return kgo.ZstdCompression()
+	default:
+		return kgo.NoCompression()
+	}
+}
+
+// FranzTopicAdmin implements KafkaTopicAdmin on top of a franz-go admin client
+type FranzTopicAdmin struct {
+	Client *kadm.Client
+}
+
+// DescribeTopics returns the state of the given topics that exist on the cluster
+func (a *FranzTopicAdmin) DescribeTopics(ctx context.Context, topics ...string) (map[string]KafkaTopicState, error) {
+	details, err := a.Client.ListTopics(ctx, topics...)
+	if err != nil {
+		return nil, err
+	}
+
+	states, found, err := topicStates(details)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return states, nil
+	}
+
+	configs, err := a.Client.DescribeTopicConfigs(ctx, found...)
+	if err != nil {
+		return nil, err
+	}
+	for _, rc := range configs {
+		if rc.Err != nil {
+			return nil, fmt.Errorf("error describing configs of topic %s: %w", rc.Name, rc.Err)
+		}
+		for _, c := range rc.Configs {
+			if c.Value != nil {
+				states[rc.Name].Configs[c.Key] = *c.Value
+			}
+		}
+	}
+	return states, nil
+}
+
+// topicStates converts topic metadata into states. Only topics the broker
+// reports as unknown are treated as missing; any other per-topic error (e.g.
+// authorization failures or leader elections) is returned so EnsureTopics
+// does not try to create a topic that already exists.
+func topicStates(details kadm.TopicDetails) (map[string]KafkaTopicState, []string, error) {
+	states := make(map[string]KafkaTopicState)
+	var found []string
+	for name, detail := range details {
+		if errors.Is(detail.Err, kerr.UnknownTopicOrPartition) {
+			continue
+		}
+		if detail.Err != nil {
+			return nil, nil, fmt.Errorf("error describing topic %s: %w", name, detail.Err)
+		}
+		states[name] = KafkaTopicState{
+			Partitions:        len(detail.Partitions),
+			ReplicationFactor: detail.Partitions.NumReplicas(),
+			Configs:           map[string]string{},
+		}
+		found = append(found, name)
+	}
+	sort.Strings(found)
+	return states, found, nil
+}
+
+// CreateTopic creates a topic with the given layout and configs
+func (a *FranzTopicAdmin) CreateTopic(ctx context.Context, topic string, partitions, replicationFactor int, configs map[string]string) error {
+	topicConfigs := make(map[string]*string, len(configs))
+	for k, v := range configs {
+		v := v
+		topicConfigs[k] = &v
+	}
+
+	resp, err := a.Client.CreateTopic(ctx, int32(partitions), int16(replicationFactor), topicConfigs, topic)
+	if err != nil {
+		return err
+	}
+	return resp.Err
+}
@@ -0,0 +1,116 @@
+package sharedconfig
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func testKafkaClientOptions() *KafkaClientOptions {
+	return &KafkaClientOptions{
+		Brokers:           []string{"localhost:9092"},
+		ClientID:          "crm",
+		SecurityProtocol:  "PLAINTEXT",
+		Acks:              "all",
+		Compression:       "snappy",
+		BatchSize:         16384,
+		Linger:            5 * time.Millisecond,
+		Idempotent:        true,
+		GroupID:           "crm-group",
+		AutoOffsetReset:   "earliest",
+		SessionTimeout:    30 * time.Second,
+		HeartbeatInterval: 3 * time.Second,
+	}
+}
+
+// newFranzClient builds a client without contacting the brokers so tests can
+// read back the effective option values
+func newFranzClient(t *testing.T, opts []kgo.Opt) *kgo.Client {
+	t.Helper()
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		t.Fatalf("kgo.NewClient: %v", err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
+
+func TestFranzProducerOptsKeepsBatchMaxBytesDefault(t *testing.T) {
+	defaults := newFranzClient(t, []kgo.Opt{kgo.SeedBrokers("localhost:9092")})
+	client := newFranzClient(t, testKafkaClientOptions().FranzProducerOpts())
+
+	want := defaults.OptValue(kgo.ProducerBatchMaxBytes)
+	if got := client.OptValue(kgo.ProducerBatchMaxBytes); got != want {
+		t.Errorf("ProducerBatchMaxBytes = %v, want the franz-go default %v rather than batch.size", got, want)
+	}
+}
+
+func TestFranzConsumerOptsAutoOffsetReset(t *testing.T) {
+	tests := []struct {
+		reset string
+		want  kgo.Offset
+	}{
+		{"earliest", kgo.NewOffset().AtStart()},
+		{"latest", kgo.NewOffset().AtEnd()},
+		{"none", kgo.NewOffset().AtCommitted()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.reset, func(t *testing.T) {
+			o := testKafkaClientOptions()
+			o.AutoOffsetReset = tt.reset
+			if err := o.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			client := newFranzClient(t, o.FranzConsumerOpts())
+
+			got, ok := client.OptValue(kgo.ConsumeResetOffset).(kgo.Offset)
+			if !ok {
+				t.Fatalf("ConsumeResetOffset = %v", client.OptValue(kgo.ConsumeResetOffset))
+			}
+			if got != tt.want {
+				t.Errorf("ConsumeResetOffset = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTopicStatesTreatsOnlyUnknownTopicsAsMissing(t *testing.T) {
+	details := kadm.TopicDetails{
+		"erp.auth.events": {
+			Topic: "erp.auth.events",
+			Partitions: kadm.PartitionDetails{
+				0: {Replicas: []int32{1, 2, 3}},
+				1: {Replicas: []int32{2, 3, 1}},
+			},
+		},
+		"erp.user.events": {Topic: "erp.user.events", Err: kerr.UnknownTopicOrPartition},
+	}
+
+	states, found, err := topicStates(details)
+	if err != nil {
+		t.Fatalf("topicStates: %v", err)
+	}
+	if !reflect.DeepEqual(found, []string{"erp.auth.events"}) {
+		t.Errorf("found = %v", found)
+	}
+	if got := states["erp.auth.events"]; got.Partitions != 2 || got.ReplicationFactor != 3 {
+		t.Errorf("state = %+v, want 2 partitions and replication factor 3", got)
+	}
+	if _, ok := states["erp.user.events"]; ok {
+		t.Error("unknown topic reported as existing")
+	}
+}
+
+func TestTopicStatesReturnsOtherTopicErrors(t *testing.T) {
+	for _, topicErr := range []error{kerr.TopicAuthorizationFailed, kerr.LeaderNotAvailable} {
+		details := kadm.TopicDetails{"erp.auth.events": {Topic: "erp.auth.events", Err: topicErr}}
+		if _, _, err := topicStates(details); !errors.Is(err, topicErr) {
+			t.Errorf("topicStates with %v: err = %v", topicErr, err)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package sharedconfig
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// KafkaTopicSpec declares how a topic should be provisioned
+type KafkaTopicSpec struct {
+	Partitions        int               `yaml:"partitions"`
+	ReplicationFactor int               `yaml:"replication_factor"`
+	RetentionMs       int64             `yaml:"retention_ms"`
+	CleanupPolicy     string            `yaml:"cleanup_policy"`
+	Configs           map[string]string `yaml:"configs"`
+}
+
+// KafkaTopicState is the broker-side state of an existing topic
+type KafkaTopicState struct {
+	Partitions        int
+	ReplicationFactor int
+	Configs           map[string]string
+}
+
+// KafkaTopicAdmin is the subset of a Kafka admin client EnsureTopics needs
+type KafkaTopicAdmin interface {
+	DescribeTopics(ctx context.Context, topics ...string) (map[string]KafkaTopicState, error)
+	CreateTopic(ctx context.Context, topic string, partitions, replicationFactor int, configs map[string]string) error
+}
+
+// Topic actions reported by EnsureTopics
+const (
+	TopicActionOK     = "ok"
+	TopicActionCreate = "create"
+	TopicActionDrift  = "drift"
+)
+
+// TopicResult describes what EnsureTopics did or would do for one topic
+type TopicResult struct {
+	Key    string   `json:"key"`
+	Topic  string   `json:"topic"`
+	Action string   `json:"action"`
+	Drift  []string `json:"drift,omitempty"`
+}
+
+// GetTopicSpec returns the spec for a topic key (e.g. auth_events), falling
+// back to the "default" spec for unset fields
+func (k *KafkaConfig) GetTopicSpec(key string) KafkaTopicSpec {
+	spec := k.TopicSpecs[key]
+	def := k.TopicSpecs["default"]
+
+	if spec.Partitions <= 0 {
+		spec.Partitions = def.Partitions
+	}
+	if spec.Partitions <= 0 {
+		spec.Partitions = 1
+	}
+	if spec.ReplicationFactor <= 0 {
+		spec.ReplicationFactor = def.ReplicationFactor
+	}
+	if spec.ReplicationFactor <= 0 {
+		spec.ReplicationFactor = 1
+	}
+	if spec.RetentionMs == 0 {
+		spec.RetentionMs = def.RetentionMs
+	}
+	if spec.CleanupPolicy == "" {
+		spec.CleanupPolicy = def.CleanupPolicy
+	}
+
+	configs := make(map[string]string)
+	for k, v := range def.Configs {
+		configs[k] = v
+	}
+	for k, v := range spec.Configs {
+		configs[k] = v
+	}
+	spec.Configs = configs
+
+	return spec
+}
+
+// TopicConfigs returns the broker-level topic configs the spec manages
+func (s KafkaTopicSpec) TopicConfigs() map[string]string {
+	configs := make(map[string]string, len(s.Configs)+2)
+	for k, v := range s.Configs {
+		configs[k] = v
+	}
+	if s.RetentionMs != 0 {
+		configs["retention.ms"] = strconv.FormatInt(s.RetentionMs, 10)
+	}
+	if s.CleanupPolicy != "" {
+		configs["cleanup.policy"] = s.CleanupPolicy
+	}
+	return configs
+}
+
+// GetTopics returns every configured topic name keyed by its config key
+func (k *KafkaTopicsConfig) GetTopics() map[string]string {
+	topics := make(map[string]string)
+	for key, name := range k.fields() {
+		if *name != "" {
+			topics[key] = *name
+		}
+	}
+	return topics
+}
+
+// EnsureTopics creates missing topics and reports partition, replication and
+// config drift on existing ones. With dryRun set nothing is changed on the
+// broker; the results describe what would be done.
+func EnsureTopics(ctx context.Context, admin KafkaTopicAdmin, cfg *KafkaConfig, dryRun bool) ([]TopicResult, error) {
+	topics := cfg.Topics.GetTopics()
+	keys := make([]string, 0, len(topics))
+	names := make([]string, 0, len(topics))
+	for key, name := range topics {
+		keys = append(keys, key)
+		names = append(names, name)
+	}
+	sort.Strings(keys)
+
+	existing, err := admin.DescribeTopics(ctx, names...)
+	if err != nil {
+		return nil, fmt.Errorf("error describing kafka topics: %w", err)
+	}
+
+	results := make([]TopicResult, 0, len(keys))
+	for _, key := range keys {
+		name := topics[key]
+		spec := cfg.GetTopicSpec(key)
+		result := TopicResult{Key: key, Topic: name, Action: TopicActionOK}
+
+		state, ok := existing[name]
+		if !ok {
+			result.Action = TopicActionCreate
+			if !dryRun {
+				if err := admin.CreateTopic(ctx, name, spec.Partitions, spec.ReplicationFactor, spec.TopicConfigs()); err != nil {
+					return results, fmt.Errorf("error creating kafka topic %s: %w", name, err)
+				}
+			}
+		} else if drift := topicDrift(spec, state); len(drift) > 0 {
+			result.Action = TopicActionDrift
+			result.Drift = drift
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// topicDrift lists the differences between a spec and a topic's actual state
+func topicDrift(spec KafkaTopicSpec, state KafkaTopicState) []string {
+	var drift []string
+	if state.Partitions != spec.Partitions {
+		drift = append(drift, fmt.Sprintf("partitions: want %d, have %d", spec.Partitions, state.Partitions))
+	}
+	if state.ReplicationFactor != spec.ReplicationFactor {
+		drift = append(drift, fmt.Sprintf("replication_factor: want %d, have %d", spec.ReplicationFactor, state.ReplicationFactor))
+	}
+
+	want := spec.TopicConfigs()
+	keys := make([]string, 0, len(want))
+	for key := range want {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if have := state.Configs[key]; have != want[key] {
+			drift = append(drift, fmt.Sprintf("%s: want %q, have %q", key, want[key], have))
+		}
+	}
+	return drift
+}
+
+// WriteTopicReport prints EnsureTopics results as a plain-text table
+func WriteTopicReport(w io.Writer, results []TopicResult, dryRun bool) {
+	for _, r := range results {
+		action := r.Action
+		if dryRun && action == TopicActionCreate {
+			action = "would create"
+		}
+		fmt.Fprintf(w, "%-14s %-40s %s\n", action, r.Topic, r.Key)
+		for _, d := range r.Drift {
+			fmt.Fprintf(w, "%14s   - %s\n", "", d)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package sharedconfig
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// fakeTopicAdmin is an in-memory KafkaTopicAdmin
+type fakeTopicAdmin struct {
+	topics      map[string]KafkaTopicState
+	describeErr error
+	created     []string
+}
+
+func (a *fakeTopicAdmin) DescribeTopics(ctx context.Context, topics ...string) (map[string]KafkaTopicState, error) {
+	if a.describeErr != nil {
+		return nil, a.describeErr
+	}
+	states := make(map[string]KafkaTopicState)
+	for _, name := range topics {
+		if state, ok := a.topics[name]; ok {
+			states[name] = state
+		}
+	}
+	return states, nil
+}
+
+func (a *fakeTopicAdmin) CreateTopic(ctx context.Context, topic string, partitions, replicationFactor int, configs map[string]string) error {
+	a.created = append(a.created, topic)
+	a.topics[topic] = KafkaTopicState{Partitions: partitions, ReplicationFactor: replicationFactor, Configs: configs}
+	return nil
+}
+
+func testKafkaTopicConfig() *KafkaConfig {
+	return &KafkaConfig{
+		Topics: KafkaTopicsConfig{AuthEvents: "erp.auth.events", UserEvents: "erp.user.events"},
+		TopicSpecs: map[string]KafkaTopicSpec{
+			"default":     {Partitions: 3, ReplicationFactor: 1, RetentionMs: 604800000},
+			"auth_events": {Partitions: 6, CleanupPolicy: "compact"},
+		},
+	}
+}
+
+func TestEnsureTopicsCreatesMissingTopicsFromSpecs(t *testing.T) {
+	admin := &fakeTopicAdmin{topics: map[string]KafkaTopicState{}}
+
+	results, err := EnsureTopics(context.Background(), admin, testKafkaTopicConfig(), false)
+	if err != nil {
+		t.Fatalf("EnsureTopics: %v", err)
+	}
+	if len(results) != 2 || results[0].Action != TopicActionCreate || results[1].Action != TopicActionCreate {
+		t.Fatalf("results = %+v", results)
+	}
+
+	auth := admin.topics["erp.auth.events"]
+	want := KafkaTopicState{
+		Partitions:        6,
+		ReplicationFactor: 1,
+		Configs:           map[string]string{"retention.ms": "604800000", "cleanup.policy": "compact"},
+	}
+	if !reflect.DeepEqual(auth, want) {
+		t.Errorf("erp.auth.events = %+v, want %+v", auth, want)
+	}
+	if got := admin.topics["erp.user.events"].Partitions; got != 3 {
+		t.Errorf("erp.user.events partitions = %d, want the default 3", got)
+	}
+}
+
+func TestEnsureTopicsDryRunReportsDrift(t *testing.T) {
+	admin := &fakeTopicAdmin{topics: map[string]KafkaTopicState{
+		"erp.auth.events": {
+			Partitions:        3,
+			ReplicationFactor: 1,
+			Configs:           map[string]string{"retention.ms": "604800000", "cleanup.policy": "delete"},
+		},
+	}}
+
+	results, err := EnsureTopics(context.Background(), admin, testKafkaTopicConfig(), true)
+	if err != nil {
+		t.Fatalf("EnsureTopics: %v", err)
+	}
+	if len(admin.created) != 0 {
+		t.Errorf("dry run created %v", admin.created)
+	}
+
+	auth, user := results[0], results[1]
+	if auth.Action != TopicActionDrift || len(auth.Drift) != 2 {
+		t.Errorf("auth_events = %+v, want partition and cleanup.policy drift", auth)
+	}
+	if user.Action != TopicActionCreate {
+		t.Errorf("user_events action = %q, want %q", user.Action, TopicActionCreate)
+	}
+}
+
+func TestEnsureTopicsStopsOnDescribeError(t *testing.T) {
+	describeErr := errors.New("TOPIC_AUTHORIZATION_FAILED")
+	admin := &fakeTopicAdmin{topics: map[string]KafkaTopicState{}, describeErr: describeErr}
+
+	if _, err := EnsureTopics(context.Background(), admin, testKafkaTopicConfig(), false); !errors.Is(err, describeErr) {
+		t.Fatalf("err = %v, want the describe error", err)
+	}
+	if len(admin.created) != 0 {
+		t.Errorf("created %v after a describe error", admin.created)
+	}
+}
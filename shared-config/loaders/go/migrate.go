@@ -0,0 +1,392 @@
+package sharedconfig
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PostgreSQLMigrationsConfig locates the per-module migration files and the
+// table that records which of them have been applied
+type PostgreSQLMigrationsConfig struct {
+	Dir   string `yaml:"dir"`
+	Table string `yaml:"table"`
+}
+
+// GetDir returns the directory holding one migrations/<module> folder per module
+func (m *PostgreSQLMigrationsConfig) GetDir() string {
+	if m.Dir == "" {
+		return "migrations" // Default
+	}
+	return m.Dir
+}
+
+// GetTable returns the migration history table name
+func (m *PostgreSQLMigrationsConfig) GetTable() string {
+	if m.Table == "" {
+		return "schema_migrations" // Default
+	}
+	return m.Table
+}
+
+// GetModules returns the modules that have a PostgreSQL database, sorted by name
+func (d *PostgreSQLDatabasesConfig) GetModules() []string {
+	var modules []string
+	for module := range d.fields() {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+	return modules
+}
+
+// Migration is one versioned schema change. The checksum covers the up script
+// only, so a broken down script can still be fixed after the fact.
+type Migration struct {
+	Version  int64
+	Name     string
+	UpSQL    string
+	DownSQL  string
+	Checksum string
+}
+
+// MigrationState describes a migration relative to the history table
+type MigrationState string
+
+const (
+	MigrationApplied  MigrationState = "applied"
+	MigrationPending  MigrationState = "pending"
+	MigrationModified MigrationState = "modified"
+	MigrationMissing  MigrationState = "missing"
+)
+
+// MigrationStatus is one row of the migration status report
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	State     MigrationState
+	AppliedAt time.Time
+}
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([A-Za-z0-9_\-]+)\.(up|down)\.sql$`)
+
+// LoadMigrations reads NNNN_name.up.sql and NNNN_name.down.sql files from the
+// module's folder in fsys, sorted by version. A missing folder means the module
+// has no migrations.
+func LoadMigrations(fsys fs.FS, module string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, module)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations for %s: %w", module, err)
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			if strings.HasSuffix(entry.Name(), ".sql") {
+				return nil, fmt.Errorf("migration file %s/%s does not match NNNN_name.up.sql or NNNN_name.down.sql", module, entry.Name())
+			}
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s/%s: %w", module, entry.Name(), err)
+		}
+		content, err := fs.ReadFile(fsys, module+"/"+entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %s/%s: %w", module, entry.Name(), err)
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d of %s is used by both %s and %s", version, module, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.UpSQL = string(content)
+		} else {
+			m.DownSQL = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.UpSQL == "" {
+			return nil, fmt.Errorf("migration %d_%s of %s has no up script", m.Version, m.Name, module)
+		}
+		sum := sha256.Sum256([]byte(m.UpSQL))
+		m.Checksum = hex.EncodeToString(sum[:])
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator applies one module's migrations to that module's database
+type Migrator struct {
+	DB         *sql.DB
+	Module     string
+	Table      string
+	Migrations []Migration
+}
+
+// NewMigrator loads the module's migrations from the configured directory
+func NewMigrator(db *sql.DB, cfg *PostgreSQLConfig, module string) (*Migrator, error) {
+	migrations, err := LoadMigrations(os.DirFS(cfg.Migrations.GetDir()), module)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		DB:         db,
+		Module:     module,
+		Table:      cfg.Migrations.GetTable(),
+		Migrations: migrations,
+	}, nil
+}
+
+type appliedMigration struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// lockKey derives the advisory lock key from the module name, so migrations of
+// different modules sharing a server do not block each other
+func (m *Migrator) lockKey() int64 {
+	h := fnv.New64a()
+	h.Write([]byte("erp-migrations:" + m.Module))
+	return int64(h.Sum64())
+}
+
+// withLock runs fn on a dedicated connection holding the module's advisory
+// lock, creating the history table first
+func (m *Migrator) withLock(ctx context.Context, fn func(*sql.Conn) error) error {
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error acquiring connection for %s migrations: %w", m.Module, err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", m.lockKey()); err != nil {
+		return fmt.Errorf("error acquiring migration lock for %s: %w", m.Module, err)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", m.lockKey())
+
+	createTable := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	version BIGINT PRIMARY KEY,
+	name TEXT NOT NULL,
+	checksum TEXT NOT NULL,
+	applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`, m.Table)
+	if _, err := conn.ExecContext(ctx, createTable); err != nil {
+		return fmt.Errorf("error creating migration table for %s: %w", m.Module, err)
+	}
+
+	return fn(conn)
+}
+
+// migrationQuerier is satisfied by both *sql.DB and *sql.Conn
+type migrationQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (m *Migrator) applied(ctx context.Context, q migrationQuerier) (map[int64]appliedMigration, error) {
+	rows, err := q.QueryContext(ctx, fmt.Sprintf("SELECT version, name, checksum, applied_at FROM %s", m.Table))
+	if err != nil {
+		return nil, fmt.Errorf("error reading migration history for %s: %w", m.Module, err)
+	}
+	defer rows.Close()
+
+	applied := map[int64]appliedMigration{}
+	for rows.Next() {
+		var version int64
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.name, &a.checksum, &a.appliedAt); err != nil {
+			return nil, fmt.Errorf("error reading migration history for %s: %w", m.Module, err)
+		}
+		applied[version] = a
+	}
+	return applied, rows.Err()
+}
+
+// status merges the migration files with the history table
+func (m *Migrator) status(applied map[int64]appliedMigration) []MigrationStatus {
+	var statuses []MigrationStatus
+	known := map[int64]bool{}
+	for _, migration := range m.Migrations {
+		known[migration.Version] = true
+		s := MigrationStatus{Version: migration.Version, Name: migration.Name, State: MigrationPending}
+		if a, ok := applied[migration.Version]; ok {
+			s.AppliedAt = a.appliedAt
+			s.State = MigrationApplied
+			if a.checksum != migration.Checksum {
+				s.State = MigrationModified
+			}
+		}
+		statuses = append(statuses, s)
+	}
+	for version, a := range applied {
+		if !known[version] {
+			statuses = append(statuses, MigrationStatus{Version: version, Name: a.name, State: MigrationMissing, AppliedAt: a.appliedAt})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses
+}
+
+// verifyStatuses returns an error naming every applied migration whose file
+// was edited or removed
+func (m *Migrator) verifyStatuses(statuses []MigrationStatus) error {
+	var problems []string
+	for _, s := range statuses {
+		switch s.State {
+		case MigrationModified:
+			problems = append(problems, fmt.Sprintf("%d_%s was edited after it was applied", s.Version, s.Name))
+		case MigrationMissing:
+			problems = append(problems, fmt.Sprintf("%d_%s was applied but its file is missing", s.Version, s.Name))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s migrations do not match the history: %s", m.Module, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Status reports every known migration and whether it has been applied. It
+// only reads: it takes no lock and treats a missing history table as empty.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var exists bool
+	if err := m.DB.QueryRowContext(ctx, "SELECT to_regclass($1) IS NOT NULL", m.Table).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("error looking up migration table for %s: %w", m.Module, err)
+	}
+	applied := map[int64]appliedMigration{}
+	if exists {
+		var err error
+		if applied, err = m.applied(ctx, m.DB); err != nil {
+			return nil, err
+		}
+	}
+	return m.status(applied), nil
+}
+
+// Verify fails if an applied migration was edited or removed. Like Status it
+// only reads.
+func (m *Migrator) Verify(ctx context.Context) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	return m.verifyStatuses(statuses)
+}
+
+// Up applies pending migrations up to and including target, or all of them
+// when target is 0. Each migration runs in its own transaction together with
+// its history row. Nothing is applied if the history does not verify.
+func (m *Migrator) Up(ctx context.Context, target int64) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verifyStatuses(m.status(applied)); err != nil {
+			return err
+		}
+
+		for _, migration := range m.Migrations {
+			if target > 0 && migration.Version > target {
+				break
+			}
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			insert := fmt.Sprintf("INSERT INTO %s (version, name, checksum) VALUES ($1, $2, $3)", m.Table)
+			err := m.inTx(ctx, conn, migration.UpSQL, insert, migration.Version, migration.Name, migration.Checksum)
+			if err != nil {
+				return fmt.Errorf("error applying %s migration %d_%s: %w", m.Module, migration.Version, migration.Name, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back the most recently applied steps migrations, newest first
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verifyStatuses(m.status(applied)); err != nil {
+			return err
+		}
+
+		for i := len(m.Migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := m.Migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if migration.DownSQL == "" {
+				return fmt.Errorf("%s migration %d_%s has no down script", m.Module, migration.Version, migration.Name)
+			}
+			remove := fmt.Sprintf("DELETE FROM %s WHERE version = $1", m.Table)
+			if err := m.inTx(ctx, conn, migration.DownSQL, remove, migration.Version); err != nil {
+				return fmt.Errorf("error rolling back %s migration %d_%s: %w", m.Module, migration.Version, migration.Name, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// inTx runs script followed by the history statement in one transaction
+func (m *Migrator) inTx(ctx context.Context, conn *sql.Conn, script, history string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, history, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// WriteMigrationStatus prints one line per migration of a module
+func WriteMigrationStatus(w io.Writer, module string, statuses []MigrationStatus) {
+	for _, s := range statuses {
+		appliedAt := ""
+		if !s.AppliedAt.IsZero() {
+			appliedAt = s.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%-9s %-10s %04d_%-30s %s\n", s.State, module, s.Version, s.Name, appliedAt)
+	}
+}
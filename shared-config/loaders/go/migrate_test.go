@@ -0,0 +1,228 @@
+package sharedconfig
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"crm/0002_add_deals.up.sql":     {Data: []byte("CREATE TABLE deals ();")},
+		"crm/0001_init.up.sql":          {Data: []byte("CREATE TABLE contacts ();")},
+		"crm/0001_init.down.sql":        {Data: []byte("DROP TABLE contacts;")},
+		"crm/README.md":                 {Data: []byte("not a migration")},
+		"crm/fixtures/0003_seed.up.sql": {Data: []byte("INSERT INTO contacts DEFAULT VALUES;")},
+	}
+
+	migrations, err := LoadMigrations(fsys, "crm")
+	if err != nil {
+		t.Fatalf("LoadMigrations: %v", err)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("got %d migrations, want 2: %+v", len(migrations), migrations)
+	}
+	first, second := migrations[0], migrations[1]
+	if first.Version != 1 || first.Name != "init" || first.DownSQL != "DROP TABLE contacts;" {
+		t.Errorf("first migration = %+v", first)
+	}
+	if second.Version != 2 || second.Name != "add_deals" || second.DownSQL != "" {
+		t.Errorf("second migration = %+v", second)
+	}
+	if sum := sha256.Sum256([]byte("CREATE TABLE contacts ();")); first.Checksum != hex.EncodeToString(sum[:]) {
+		t.Errorf("checksum = %q, want the sha256 of the up script", first.Checksum)
+	}
+	edited := fstest.MapFS{
+		"crm/0001_init.up.sql":   {Data: []byte("CREATE TABLE contacts ();")},
+		"crm/0001_init.down.sql": {Data: []byte("DROP TABLE contacts CASCADE;")},
+	}
+	if again, _ := LoadMigrations(edited, "crm"); again[0].Checksum != first.Checksum {
+		t.Error("editing the down script changed the checksum")
+	}
+
+	if migrations, err := LoadMigrations(fsys, "hrm"); err != nil || migrations != nil {
+		t.Errorf("module without a folder = %v, %v, want no migrations", migrations, err)
+	}
+}
+
+func TestLoadMigrationsRejectsBadFiles(t *testing.T) {
+	tests := map[string]struct {
+		fsys    fstest.MapFS
+		wantErr string
+	}{
+		"bad name": {
+			fstest.MapFS{"crm/init.sql": {Data: []byte("SELECT 1;")}},
+			"does not match",
+		},
+		"version reused": {
+			fstest.MapFS{
+				"crm/0001_init.up.sql":     {Data: []byte("SELECT 1;")},
+				"crm/0001_contacts.up.sql": {Data: []byte("SELECT 2;")},
+			},
+			"is used by both",
+		},
+		"down only": {
+			fstest.MapFS{"crm/0001_init.down.sql": {Data: []byte("SELECT 1;")}},
+			"has no up script",
+		},
+	}
+	for name, tt := range tests {
+		if _, err := LoadMigrations(tt.fsys, "crm"); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: err = %v, want %q", name, err, tt.wantErr)
+		}
+	}
+}
+
+// historyDriver is an in-process PostgreSQL holding a migration history table.
+// It answers the two queries of Status and fails every other statement, so a
+// test notices anything that takes a lock or writes.
+type historyDriver struct {
+	mu         sync.Mutex
+	table      bool
+	rows       [][]driver.Value
+	statements []string
+}
+
+var historyDrivers atomic.Int64
+
+func registerHistoryDriver(t *testing.T, d *historyDriver) *sql.DB {
+	name := fmt.Sprintf("history-%s-%d", t.Name(), historyDrivers.Add(1))
+	sql.Register(name, d)
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func (d *historyDriver) Open(string) (driver.Conn, error) { return &historyConn{d: d}, nil }
+
+type historyConn struct{ d *historyDriver }
+
+func (c *historyConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (c *historyConn) Close() error              { return nil }
+func (c *historyConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (c *historyConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.statements = append(c.d.statements, query)
+	return nil, fmt.Errorf("unexpected statement %q", query)
+}
+
+func (c *historyConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.statements = append(c.d.statements, query)
+	switch {
+	case strings.HasPrefix(query, "SELECT to_regclass"):
+		return &historyRows{columns: []string{"exists"}, rows: [][]driver.Value{{c.d.table}}}, nil
+	case strings.HasPrefix(query, "SELECT version, name, checksum, applied_at") && c.d.table:
+		return &historyRows{columns: []string{"version", "name", "checksum", "applied_at"}, rows: c.d.rows}, nil
+	}
+	return nil, fmt.Errorf("unexpected query %q", query)
+}
+
+type historyRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *historyRows) Columns() []string { return r.columns }
+func (r *historyRows) Close() error      { return nil }
+func (r *historyRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func testMigrator(t *testing.T, d *historyDriver) *Migrator {
+	migrations, err := LoadMigrations(fstest.MapFS{
+		"crm/0001_init.up.sql":      {Data: []byte("CREATE TABLE contacts ();")},
+		"crm/0002_add_deals.up.sql": {Data: []byte("CREATE TABLE deals ();")},
+		"crm/0003_add_notes.up.sql": {Data: []byte("CREATE TABLE notes ();")},
+	}, "crm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Migrator{DB: registerHistoryDriver(t, d), Module: "crm", Table: "schema_migrations", Migrations: migrations}
+}
+
+func TestMigratorStatus(t *testing.T) {
+	appliedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	d := &historyDriver{table: true}
+	m := testMigrator(t, d)
+	d.rows = [][]driver.Value{
+		{int64(1), "init", m.Migrations[0].Checksum, appliedAt},
+		{int64(2), "add_deals", "edited", appliedAt},
+		{int64(9), "dropped", "gone", appliedAt},
+	}
+
+	statuses, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	var got []string
+	for _, s := range statuses {
+		got = append(got, fmt.Sprintf("%d %s %s", s.Version, s.State, s.AppliedAt.Format(time.RFC3339)))
+	}
+	want := []string{
+		"1 applied 2026-01-02T03:04:05Z",
+		"2 modified 2026-01-02T03:04:05Z",
+		"3 pending 0001-01-01T00:00:00Z",
+		"9 missing 2026-01-02T03:04:05Z",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Status() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	err = m.Verify(context.Background())
+	if err == nil {
+		t.Fatal("Verify accepted an edited and a missing migration")
+	}
+	for _, want := range []string{"2_add_deals was edited after it was applied", "9_dropped was applied but its file is missing"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Verify error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestMigratorStatusIsReadOnly(t *testing.T) {
+	d := &historyDriver{}
+	m := testMigrator(t, d)
+
+	statuses, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status without a history table: %v", err)
+	}
+	for _, s := range statuses {
+		if s.State != MigrationPending {
+			t.Errorf("%d_%s = %s, want pending", s.Version, s.Name, s.State)
+		}
+	}
+	if err := m.Verify(context.Background()); err != nil {
+		t.Errorf("Verify without a history table: %v", err)
+	}
+	for _, statement := range d.statements {
+		if !strings.HasPrefix(statement, "SELECT to_regclass") {
+			t.Errorf("status ran %q", statement)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package sharedconfig
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetClientOptions returns MongoDB client options for the given purpose's
+// database with every MongoDBOptionsConfig setting and the TLS config applied
+func (m *MongoDBConfig) GetClientOptions(purpose string) (*options.ClientOptions, error) {
+	opts := options.Client().
+		ApplyURI(m.GetConnectionString(purpose)).
+		SetMaxPoolSize(m.Options.GetMaxPoolSize()).
+		SetMinPoolSize(m.Options.GetMinPoolSize()).
+		SetMaxConnIdleTime(m.Options.GetMaxIdleTime()).
+		SetServerSelectionTimeout(m.Options.GetServerSelectionTimeout())
+
+	if m.UseTLS() {
+		tlsConfig, err := m.TLS.ToStdTLS()
+		if err != nil {
+			return nil, fmt.Errorf("invalid mongodb tls config: %w", err)
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+	return opts, nil
+}
+
+// OpenMongo connects to MongoDB, pings the deployment and returns the database
+// configured for the given purpose (analytics, logs, ai_conversations, audit_trail).
+// Use Database.Client() to reach the underlying client and disconnect it.
+func OpenMongo(ctx context.Context, cfg *MongoDBConfig, purpose string) (*mongo.Database, error) {
+	opts, err := cfg.GetClientOptions(purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := mongo.Connect(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to mongodb for %s: %w", purpose, err)
+	}
+
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("mongodb is not reachable for %s: %w", purpose, err)
+	}
+
+	return client.Database(cfg.getDatabaseName(purpose)), nil
+}
+
+// MongoDriverAdmin implements MongoAdmin with database commands on an
+// official driver client
+type MongoDriverAdmin struct {
+	Client *mongo.Client
+}
+
+type mongoCollectionInfo struct {
+	Name    string `bson:"name"`
+	Type    string `bson:"type"`
+	Options struct {
+		Capped           bool   `bson:"capped"`
+		Size             int64  `bson:"size"`
+		Max              int64  `bson:"max"`
+		Validator        bson.M `bson:"validator"`
+		ValidationLevel  string `bson:"validationLevel"`
+		ValidationAction string `bson:"validationAction"`
+	} `bson:"options"`
+}
+
+type mongoIndexInfo struct {
+	Name               string `bson:"name"`
+	Key                bson.D `bson:"key"`
+	Unique             bool   `bson:"unique"`
+	Sparse             bool   `bson:"sparse"`
+	ExpireAfterSeconds *int64 `bson:"expireAfterSeconds"`
+}
+
+// ListCollections returns the collections of database, skipping views. The
+// driver cursor follows getMore, so databases with more collections than fit
+// in the first batch are listed completely.
+func (a *MongoDriverAdmin) ListCollections(ctx context.Context, database string) (map[string]MongoCollectionState, error) {
+	cursor, err := a.Client.Database(database).ListCollections(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	var infos []mongoCollectionInfo
+	if err := cursor.All(ctx, &infos); err != nil {
+		return nil, err
+	}
+
+	collections := map[string]MongoCollectionState{}
+	for _, info := range infos {
+		if info.Type == "view" {
+			continue
+		}
+		collections[info.Name] = MongoCollectionState{
+			Name:             info.Name,
+			Capped:           info.Options.Capped,
+			SizeBytes:        info.Options.Size,
+			MaxDocuments:     info.Options.Max,
+			Validator:        info.Options.Validator,
+			ValidationLevel:  info.Options.ValidationLevel,
+			ValidationAction: info.Options.ValidationAction,
+		}
+	}
+	return collections, nil
+}
+
+// CreateCollection creates a collection with the spec's validator and capping
+func (a *MongoDriverAdmin) CreateCollection(ctx context.Context, database, collection string, spec MongoCollectionSpec) error {
+	cmd := bson.D{{Key: "create", Value: collection}}
+	if spec.Capped != nil {
+		cmd = append(cmd, bson.E{Key: "capped", Value: true}, bson.E{Key: "size", Value: spec.Capped.SizeBytes})
+		if spec.Capped.MaxDocuments > 0 {
+			cmd = append(cmd, bson.E{Key: "max", Value: spec.Capped.MaxDocuments})
+		}
+	}
+	if validator := spec.GetValidator(); validator != nil {
+		cmd = append(cmd,
+			bson.E{Key: "validator", Value: validator},
+			bson.E{Key: "validationLevel", Value: spec.GetValidationLevel()},
+			bson.E{Key: "validationAction", Value: spec.GetValidationAction()})
+	}
+	return a.Client.Database(database).RunCommand(ctx, cmd).Err()
+}
+
+// SetValidator replaces the collection's validator; a spec without a JSON
+// schema removes it
+func (a *MongoDriverAdmin) SetValidator(ctx context.Context, database, collection string, spec MongoCollectionSpec) error {
+	validator := spec.GetValidator()
+	if validator == nil {
+		validator = map[string]interface{}{}
+	}
+	cmd := bson.D{
+		{Key: "collMod", Value: collection},
+		{Key: "validator", Value: validator},
+		{Key: "validationLevel", Value: spec.GetValidationLevel()},
+		{Key: "validationAction", Value: spec.GetValidationAction()},
+	}
+	return a.Client.Database(database).RunCommand(ctx, cmd).Err()
+}
+
+// ListIndexes returns the indexes of a collection, following getMore like
+// ListCollections
+func (a *MongoDriverAdmin) ListIndexes(ctx context.Context, database, collection string) ([]MongoIndexState, error) {
+	cursor, err := a.Client.Database(database).Collection(collection).Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var infos []mongoIndexInfo
+	if err := cursor.All(ctx, &infos); err != nil {
+		return nil, err
+	}
+
+	indexes := make([]MongoIndexState, 0, len(infos))
+	for _, info := range infos {
+		index := MongoIndexState{
+			Name:               info.Name,
+			Unique:             info.Unique,
+			Sparse:             info.Sparse,
+			ExpireAfterSeconds: info.ExpireAfterSeconds,
+		}
+		for _, key := range info.Key {
+			index.Keys = append(index.Keys, formatMongoIndexKey(key.Key, key.Value))
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+// CreateIndex creates one index, as a TTL index when expireAfterSeconds is set
+func (a *MongoDriverAdmin) CreateIndex(ctx context.Context, database, collection string, index MongoIndexSpec, expireAfterSeconds *int64) error {
+	keys := bson.D{}
+	for _, key := range index.Keys {
+		field, value := ParseMongoIndexKey(key)
+		keys = append(keys, bson.E{Key: field, Value: value})
+	}
+	definition := bson.D{{Key: "key", Value: keys}, {Key: "name", Value: index.GetName()}}
+	if index.Unique {
+		definition = append(definition, bson.E{Key: "unique", Value: true})
+	}
+	if index.Sparse {
+		definition = append(definition, bson.E{Key: "sparse", Value: true})
+	}
+	if expireAfterSeconds != nil {
+		definition = append(definition, bson.E{Key: "expireAfterSeconds", Value: *expireAfterSeconds})
+	}
+
+	cmd := bson.D{{Key: "createIndexes", Value: collection}, {Key: "indexes", Value: bson.A{definition}}}
+	return a.Client.Database(database).RunCommand(ctx, cmd).Err()
+}
+
+// SetIndexTTL changes the expiry of an existing TTL index in place
+func (a *MongoDriverAdmin) SetIndexTTL(ctx context.Context, database, collection, index string, expireAfterSeconds int64) error {
+	cmd := bson.D{
+		{Key: "collMod", Value: collection},
+		{Key: "index", Value: bson.D{{Key: "name", Value: index}, {Key: "expireAfterSeconds", Value: expireAfterSeconds}}},
+	}
+	return a.Client.Database(database).RunCommand(ctx, cmd).Err()
+}
+
+// formatMongoIndexKey is the inverse of ParseMongoIndexKey
+func formatMongoIndexKey(field string, value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return field + ":" + v
+	case int32:
+		if v < 0 {
+			return "-" + field
+		}
+	case int64:
+		if v < 0 {
+			return "-" + field
+		}
+	case float64:
+		if v < 0 {
+			return "-" + field
+		}
+	}
+	return field
+}
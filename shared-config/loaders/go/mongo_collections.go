@@ -0,0 +1,405 @@
+package sharedconfig
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MongoCollectionSpec declares one collection: an optional JSON schema
+// validator, capped sizing and the indexes it should have
+type MongoCollectionSpec struct {
+	JSONSchema       map[string]interface{} `yaml:"json_schema"`
+	ValidationLevel  string                 `yaml:"validation_level"`
+	ValidationAction string                 `yaml:"validation_action"`
+	Capped           *MongoCappedConfig     `yaml:"capped"`
+	Indexes          []MongoIndexSpec       `yaml:"indexes"`
+}
+
+// MongoCappedConfig makes a collection capped. Capping cannot be changed after
+// creation, so a mismatch is only reported.
+type MongoCappedConfig struct {
+	SizeBytes    int64 `yaml:"size_bytes"`
+	MaxDocuments int64 `yaml:"max_documents"`
+}
+
+// MongoIndexSpec declares an index. Keys are field names in order, prefixed
+// with "-" for descending or suffixed with ":text", ":2dsphere" or ":hashed"
+// for special index types. ExpireAfter turns a single-field index into a TTL
+// index; "retention" uses monitoring.logging.retention_period for the current
+// environment, anything else is a duration such as "36h" or "30d".
+type MongoIndexSpec struct {
+	Name        string   `yaml:"name"`
+	Keys        []string `yaml:"keys"`
+	Unique      bool     `yaml:"unique"`
+	Sparse      bool     `yaml:"sparse"`
+	ExpireAfter string   `yaml:"expire_after"`
+}
+
+// GetName returns the index name, defaulting to MongoDB's own naming scheme
+// (field_1_other_-1)
+func (i *MongoIndexSpec) GetName() string {
+	if i.Name != "" {
+		return i.Name
+	}
+	parts := make([]string, 0, len(i.Keys))
+	for _, key := range i.Keys {
+		field, value := ParseMongoIndexKey(key)
+		parts = append(parts, fmt.Sprintf("%s_%v", field, value))
+	}
+	return strings.Join(parts, "_")
+}
+
+// GetExpireAfterSeconds resolves ExpireAfter against the logging retention
+// period; nil means the index is not a TTL index
+func (i *MongoIndexSpec) GetExpireAfterSeconds(retention time.Duration) (*int64, error) {
+	if i.ExpireAfter == "" {
+		return nil, nil
+	}
+	if len(i.Keys) != 1 {
+		return nil, fmt.Errorf("ttl index %s must have exactly one key", i.GetName())
+	}
+
+	expireAfter := retention
+	if i.ExpireAfter != "retention" {
+		d, err := ParseRetentionPeriod(i.ExpireAfter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expire_after for index %s: %w", i.GetName(), err)
+		}
+		expireAfter = d
+	}
+	if expireAfter <= 0 {
+		return nil, fmt.Errorf("ttl index %s has no retention period", i.GetName())
+	}
+	seconds := int64(expireAfter / time.Second)
+	return &seconds, nil
+}
+
+// ParseMongoIndexKey splits a key spec into the field and its index value:
+// 1, -1 or a special index type name
+func ParseMongoIndexKey(key string) (string, interface{}) {
+	if field, kind, ok := strings.Cut(key, ":"); ok {
+		return field, kind
+	}
+	if strings.HasPrefix(key, "-") {
+		return key[1:], -1
+	}
+	return key, 1
+}
+
+// MonitoringLoggingConfig holds the log retention settings from monitoring.logging
+type MonitoringLoggingConfig struct {
+	RetentionPeriod map[string]string `yaml:"retention_period"`
+}
+
+// GetRetentionPeriod returns how long logs are kept in the given environment
+func (l *MonitoringLoggingConfig) GetRetentionPeriod(environment string) (time.Duration, error) {
+	period, ok := l.RetentionPeriod[environment]
+	if !ok {
+		return 30 * 24 * time.Hour, nil // Default
+	}
+	return ParseRetentionPeriod(period)
+}
+
+// ParseRetentionPeriod parses durations such as "7d", "12h" or "90m". Days are
+// not supported by time.ParseDuration, so a "d" suffix is handled here.
+func ParseRetentionPeriod(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid retention period %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid retention period %q", s)
+	}
+	return d, nil
+}
+
+// MongoCollectionState is the current state of a collection as reported by
+// the server
+type MongoCollectionState struct {
+	Name             string
+	Capped           bool
+	SizeBytes        int64
+	MaxDocuments     int64
+	Validator        map[string]interface{}
+	ValidationLevel  string
+	ValidationAction string
+}
+
+// MongoIndexState is an existing index as reported by the server
+type MongoIndexState struct {
+	Name               string
+	Keys               []string
+	Unique             bool
+	Sparse             bool
+	ExpireAfterSeconds *int64
+}
+
+// MongoAdmin is the subset of MongoDB administration EnsureMongo needs.
+// MongoDriverAdmin implements it on top of the official driver.
+type MongoAdmin interface {
+	ListCollections(ctx context.Context, database string) (map[string]MongoCollectionState, error)
+	CreateCollection(ctx context.Context, database, collection string, spec MongoCollectionSpec) error
+	SetValidator(ctx context.Context, database, collection string, spec MongoCollectionSpec) error
+	ListIndexes(ctx context.Context, database, collection string) ([]MongoIndexState, error)
+	CreateIndex(ctx context.Context, database, collection string, index MongoIndexSpec, expireAfterSeconds *int64) error
+	SetIndexTTL(ctx context.Context, database, collection, index string, expireAfterSeconds int64) error
+}
+
+// MongoAction describes what EnsureMongo did, or would do in dry-run mode,
+// for one collection
+type MongoAction string
+
+const (
+	MongoActionOK     MongoAction = "ok"
+	MongoActionCreate MongoAction = "create"
+	MongoActionUpdate MongoAction = "update"
+	MongoActionDrift  MongoAction = "drift"
+)
+
+// MongoResult is the outcome of ensuring one collection. Changes lists what
+// was (or would be) applied; Drift lists differences that need a manual fix.
+type MongoResult struct {
+	Database   string
+	Collection string
+	Action     MongoAction
+	Changes    []string
+	Drift      []string
+}
+
+// EnsureMongo creates missing collections and indexes declared in
+// CollectionSpecs, brings validators and TTLs in line with the spec and
+// reports differences it cannot fix, such as capping or index key changes.
+// Nothing is changed when dryRun is true.
+func EnsureMongo(ctx context.Context, admin MongoAdmin, cfg *MongoDBConfig, retention time.Duration, dryRun bool) ([]MongoResult, error) {
+	purposes := make([]string, 0, len(cfg.CollectionSpecs))
+	for purpose := range cfg.CollectionSpecs {
+		purposes = append(purposes, purpose)
+	}
+	sort.Strings(purposes)
+
+	var results []MongoResult
+	for _, purpose := range purposes {
+		database := cfg.getDatabaseName(purpose)
+		existing, err := admin.ListCollections(ctx, database)
+		if err != nil {
+			return results, fmt.Errorf("error listing collections of %s: %w", database, err)
+		}
+
+		specs := cfg.CollectionSpecs[purpose]
+		names := make([]string, 0, len(specs))
+		for name := range specs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			state, exists := existing[name]
+			result, err := ensureMongoCollection(ctx, admin, database, name, specs[name], state, exists, retention, dryRun)
+			results = append(results, result)
+			if err != nil {
+				return results, fmt.Errorf("error ensuring %s.%s: %w", database, name, err)
+			}
+		}
+	}
+	return results, nil
+}
+
+func ensureMongoCollection(ctx context.Context, admin MongoAdmin, database, name string, spec MongoCollectionSpec, state MongoCollectionState, exists bool, retention time.Duration, dryRun bool) (MongoResult, error) {
+	result := MongoResult{Database: database, Collection: name, Action: MongoActionOK}
+
+	if !exists {
+		result.Action = MongoActionCreate
+		result.Changes = append(result.Changes, "create collection")
+		if !dryRun {
+			if err := admin.CreateCollection(ctx, database, name, spec); err != nil {
+				return result, err
+			}
+		}
+	} else {
+		result.Drift = append(result.Drift, cappedDrift(spec.Capped, state)...)
+
+		if changed, err := validatorChanged(spec, state); err != nil {
+			return result, err
+		} else if changed {
+			result.Changes = append(result.Changes, "update validator")
+			if !dryRun {
+				if err := admin.SetValidator(ctx, database, name, spec); err != nil {
+					return result, err
+				}
+			}
+		}
+	}
+
+	var indexes []MongoIndexState
+	if exists {
+		var err error
+		if indexes, err = admin.ListIndexes(ctx, database, name); err != nil {
+			return result, err
+		}
+	}
+	byName := map[string]MongoIndexState{}
+	for _, index := range indexes {
+		byName[index.Name] = index
+	}
+
+	managed := map[string]bool{"_id_": true}
+	for _, index := range spec.Indexes {
+		indexName := index.GetName()
+		managed[indexName] = true
+
+		expireAfter, err := index.GetExpireAfterSeconds(retention)
+		if err != nil {
+			return result, err
+		}
+
+		current, ok := byName[indexName]
+		if !ok {
+			result.Changes = append(result.Changes, "create index "+indexName)
+			if !dryRun {
+				if err := admin.CreateIndex(ctx, database, name, index, expireAfter); err != nil {
+					return result, err
+				}
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(current.Keys, index.Keys) {
+			result.Drift = append(result.Drift, fmt.Sprintf("index %s has keys %v, want %v", indexName, current.Keys, index.Keys))
+		}
+		if current.Unique != index.Unique || current.Sparse != index.Sparse {
+			result.Drift = append(result.Drift, fmt.Sprintf("index %s has unique=%t sparse=%t, want unique=%t sparse=%t",
+				indexName, current.Unique, current.Sparse, index.Unique, index.Sparse))
+		}
+		switch {
+		case expireAfter == nil && current.ExpireAfterSeconds != nil:
+			result.Drift = append(result.Drift, fmt.Sprintf("index %s is a ttl index but the spec has no expire_after", indexName))
+		case expireAfter != nil && current.ExpireAfterSeconds == nil:
+			result.Drift = append(result.Drift, fmt.Sprintf("index %s is not a ttl index", indexName))
+		case expireAfter != nil && *expireAfter != *current.ExpireAfterSeconds:
+			result.Changes = append(result.Changes, fmt.Sprintf("set ttl of %s from %ds to %ds", indexName, *current.ExpireAfterSeconds, *expireAfter))
+			if !dryRun {
+				if err := admin.SetIndexTTL(ctx, database, name, indexName, *expireAfter); err != nil {
+					return result, err
+				}
+			}
+		}
+	}
+
+	for _, index := range indexes {
+		if !managed[index.Name] {
+			result.Drift = append(result.Drift, fmt.Sprintf("index %s is not declared in the spec", index.Name))
+		}
+	}
+
+	switch {
+	case len(result.Drift) > 0:
+		result.Action = MongoActionDrift
+	case result.Action == MongoActionOK && len(result.Changes) > 0:
+		result.Action = MongoActionUpdate
+	}
+	return result, nil
+}
+
+func cappedDrift(want *MongoCappedConfig, state MongoCollectionState) []string {
+	if want != nil {
+		// MongoDB rounds capped sizes up to a multiple of 256 bytes
+		rounded := *want
+		rounded.SizeBytes = (rounded.SizeBytes + 255) / 256 * 256
+		want = &rounded
+	}
+	switch {
+	case want == nil && state.Capped:
+		return []string{"collection is capped but the spec is not"}
+	case want != nil && !state.Capped:
+		return []string{"collection is not capped"}
+	case want != nil && (want.SizeBytes != state.SizeBytes || want.MaxDocuments != state.MaxDocuments):
+		return []string{fmt.Sprintf("capped at %d bytes/%d documents, want %d bytes/%d documents",
+			state.SizeBytes, state.MaxDocuments, want.SizeBytes, want.MaxDocuments)}
+	}
+	return nil
+}
+
+// validatorChanged compares validators after a JSON round trip, so numeric
+// types decoded from YAML and BSON compare equal
+func validatorChanged(spec MongoCollectionSpec, state MongoCollectionState) (bool, error) {
+	want, err := normalizeJSON(spec.GetValidator())
+	if err != nil {
+		return false, fmt.Errorf("invalid validator: %w", err)
+	}
+	have, err := normalizeJSON(state.Validator)
+	if err != nil {
+		return false, err
+	}
+	if !reflect.DeepEqual(want, have) {
+		return true, nil
+	}
+	if spec.JSONSchema == nil {
+		return false, nil
+	}
+	return spec.GetValidationLevel() != state.ValidationLevel || spec.GetValidationAction() != state.ValidationAction, nil
+}
+
+func normalizeJSON(v map[string]interface{}) (interface{}, error) {
+	if len(v) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	err = json.Unmarshal(data, &out)
+	return out, err
+}
+
+// GetValidator returns the $jsonSchema validator document, or nil
+func (s *MongoCollectionSpec) GetValidator() map[string]interface{} {
+	if s.JSONSchema == nil {
+		return nil
+	}
+	return map[string]interface{}{"$jsonSchema": s.JSONSchema}
+}
+
+// GetValidationLevel returns the validation level applied with the validator
+func (s *MongoCollectionSpec) GetValidationLevel() string {
+	if s.ValidationLevel == "" {
+		return "strict" // Default
+	}
+	return s.ValidationLevel
+}
+
+// GetValidationAction returns what MongoDB does with invalid documents
+func (s *MongoCollectionSpec) GetValidationAction() string {
+	if s.ValidationAction == "" {
+		return "error" // Default
+	}
+	return s.ValidationAction
+}
+
+// WriteMongoReport prints one line per collection followed by its changes and drift
+func WriteMongoReport(w io.Writer, results []MongoResult, dryRun bool) {
+	for _, r := range results {
+		action := r.Action
+		if dryRun && (action == MongoActionCreate || action == MongoActionUpdate) {
+			action = "would " + action
+		}
+		fmt.Fprintf(w, "%-14s %s.%s\n", action, r.Database, r.Collection)
+		for _, c := range r.Changes {
+			fmt.Fprintf(w, "%14s   + %s\n", "", c)
+		}
+		for _, d := range r.Drift {
+			fmt.Fprintf(w, "%14s   - %s\n", "", d)
+		}
+	}
+}
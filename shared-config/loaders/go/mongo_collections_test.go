@@ -0,0 +1,298 @@
+package sharedconfig
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRetentionPeriod(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"7d", 7 * 24 * time.Hour},
+		{"0d", 0},
+		{"12h", 12 * time.Hour},
+		{"90m", 90 * time.Minute},
+		{"1h30m", 90 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got, err := ParseRetentionPeriod(tt.in); err != nil || got != tt.want {
+			t.Errorf("ParseRetentionPeriod(%q) = %s, %v, want %s", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "d", "1.5d", "seven days", "7w"} {
+		if _, err := ParseRetentionPeriod(in); err == nil {
+			t.Errorf("ParseRetentionPeriod(%q) succeeded", in)
+		}
+	}
+
+	logging := MonitoringLoggingConfig{RetentionPeriod: map[string]string{"production": "90d", "testing": "bogus"}}
+	if got, _ := logging.GetRetentionPeriod("production"); got != 90*24*time.Hour {
+		t.Errorf("production retention = %s", got)
+	}
+	if got, _ := logging.GetRetentionPeriod("staging"); got != 30*24*time.Hour {
+		t.Errorf("unset retention = %s, want the 30 day default", got)
+	}
+	if _, err := logging.GetRetentionPeriod("testing"); err == nil {
+		t.Error("an invalid retention period was accepted")
+	}
+}
+
+func TestGetExpireAfterSeconds(t *testing.T) {
+	retention := 14 * 24 * time.Hour
+	tests := []struct {
+		name    string
+		index   MongoIndexSpec
+		want    int64
+		wantErr string
+	}{
+		{"not ttl", MongoIndexSpec{Keys: []string{"created_at"}}, -1, ""},
+		{"retention", MongoIndexSpec{Keys: []string{"created_at"}, ExpireAfter: "retention"}, 14 * 24 * 3600, ""},
+		{"duration", MongoIndexSpec{Keys: []string{"created_at"}, ExpireAfter: "36h"}, 36 * 3600, ""},
+		{"days", MongoIndexSpec{Keys: []string{"created_at"}, ExpireAfter: "2d"}, 2 * 24 * 3600, ""},
+		{"compound", MongoIndexSpec{Keys: []string{"user_id", "created_at"}, ExpireAfter: "1h"}, 0, "exactly one key"},
+		{"invalid", MongoIndexSpec{Keys: []string{"created_at"}, ExpireAfter: "soon"}, 0, "invalid expire_after for index created_at_1"},
+		{"zero", MongoIndexSpec{Keys: []string{"created_at"}, ExpireAfter: "0d"}, 0, "no retention period"},
+	}
+	for _, tt := range tests {
+		got, err := tt.index.GetExpireAfterSeconds(retention)
+		switch {
+		case tt.wantErr != "":
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.want < 0 && got != nil:
+			t.Errorf("%s: got %d, want no ttl", tt.name, *got)
+		case tt.want >= 0 && (got == nil || *got != tt.want):
+			t.Errorf("%s: got %v, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMongoIndexKeys(t *testing.T) {
+	index := MongoIndexSpec{Keys: []string{"tenant_id", "-created_at", "body:text"}}
+	if got := index.GetName(); got != "tenant_id_1_created_at_-1_body_text" {
+		t.Errorf("GetName() = %q", got)
+	}
+	for _, key := range index.Keys {
+		field, value := ParseMongoIndexKey(key)
+		if direction, ok := value.(int); ok {
+			value = int32(direction) // as listIndexes returns it
+		}
+		if got := formatMongoIndexKey(field, value); got != key {
+			t.Errorf("round trip of %q = %q", key, got)
+		}
+	}
+}
+
+func TestCappedDrift(t *testing.T) {
+	tests := []struct {
+		name  string
+		want  *MongoCappedConfig
+		state MongoCollectionState
+		drift string
+	}{
+		{"not capped", nil, MongoCollectionState{}, ""},
+		{"size rounded by the server", &MongoCappedConfig{SizeBytes: 1000}, MongoCollectionState{Capped: true, SizeBytes: 1024}, ""},
+		{"capped but not declared", nil, MongoCollectionState{Capped: true, SizeBytes: 1024}, "collection is capped but the spec is not"},
+		{"declared but not capped", &MongoCappedConfig{SizeBytes: 1024}, MongoCollectionState{}, "collection is not capped"},
+		{"other size", &MongoCappedConfig{SizeBytes: 4096, MaxDocuments: 10}, MongoCollectionState{Capped: true, SizeBytes: 1024, MaxDocuments: 10},
+			"capped at 1024 bytes/10 documents, want 4096 bytes/10 documents"},
+	}
+	for _, tt := range tests {
+		got := strings.Join(cappedDrift(tt.want, tt.state), "; ")
+		if got != tt.drift {
+			t.Errorf("%s: drift = %q, want %q", tt.name, got, tt.drift)
+		}
+	}
+}
+
+// fakeMongoAdmin keeps collections and indexes in memory and records every
+// change it is asked to make
+type fakeMongoAdmin struct {
+	collections map[string]map[string]MongoCollectionState // database -> collection
+	indexes     map[string][]MongoIndexState               // database.collection
+	calls       []string
+}
+
+func newFakeMongoAdmin() *fakeMongoAdmin {
+	return &fakeMongoAdmin{collections: map[string]map[string]MongoCollectionState{}, indexes: map[string][]MongoIndexState{}}
+}
+
+func (a *fakeMongoAdmin) ListCollections(ctx context.Context, database string) (map[string]MongoCollectionState, error) {
+	return a.collections[database], nil
+}
+
+func (a *fakeMongoAdmin) CreateCollection(ctx context.Context, database, collection string, spec MongoCollectionSpec) error {
+	a.calls = append(a.calls, "create "+database+"."+collection)
+	state := MongoCollectionState{Name: collection, Validator: spec.GetValidator(), ValidationLevel: spec.GetValidationLevel(), ValidationAction: spec.GetValidationAction()}
+	if spec.Capped != nil {
+		state.Capped, state.SizeBytes, state.MaxDocuments = true, (spec.Capped.SizeBytes+255)/256*256, spec.Capped.MaxDocuments
+	}
+	if a.collections[database] == nil {
+		a.collections[database] = map[string]MongoCollectionState{}
+	}
+	a.collections[database][collection] = state
+	a.indexes[database+"."+collection] = []MongoIndexState{{Name: "_id_", Keys: []string{"_id"}}}
+	return nil
+}
+
+func (a *fakeMongoAdmin) SetValidator(ctx context.Context, database, collection string, spec MongoCollectionSpec) error {
+	a.calls = append(a.calls, "collMod validator "+database+"."+collection)
+	state := a.collections[database][collection]
+	state.Validator, state.ValidationLevel, state.ValidationAction = spec.GetValidator(), spec.GetValidationLevel(), spec.GetValidationAction()
+	a.collections[database][collection] = state
+	return nil
+}
+
+func (a *fakeMongoAdmin) ListIndexes(ctx context.Context, database, collection string) ([]MongoIndexState, error) {
+	return a.indexes[database+"."+collection], nil
+}
+
+func (a *fakeMongoAdmin) CreateIndex(ctx context.Context, database, collection string, index MongoIndexSpec, expireAfterSeconds *int64) error {
+	a.calls = append(a.calls, "createIndexes "+database+"."+collection+" "+index.GetName())
+	key := database + "." + collection
+	a.indexes[key] = append(a.indexes[key], MongoIndexState{Name: index.GetName(), Keys: index.Keys, Unique: index.Unique, Sparse: index.Sparse, ExpireAfterSeconds: expireAfterSeconds})
+	return nil
+}
+
+func (a *fakeMongoAdmin) SetIndexTTL(ctx context.Context, database, collection, index string, expireAfterSeconds int64) error {
+	a.calls = append(a.calls, fmt.Sprintf("collMod ttl %s.%s %s %d", database, collection, index, expireAfterSeconds))
+	for i, state := range a.indexes[database+"."+collection] {
+		if state.Name == index {
+			a.indexes[database+"."+collection][i].ExpireAfterSeconds = &expireAfterSeconds
+		}
+	}
+	return nil
+}
+
+func testMongoConfig() *MongoDBConfig {
+	return &MongoDBConfig{
+		Databases: MongoDBDatabasesConfig{Logs: "erp_logs"},
+		CollectionSpecs: map[string]map[string]MongoCollectionSpec{
+			"logs": {
+				"app_logs": {
+					JSONSchema: map[string]interface{}{"bsonType": "object", "required": []interface{}{"level"}},
+					Indexes: []MongoIndexSpec{
+						{Keys: []string{"service", "-timestamp"}},
+						{Keys: []string{"timestamp"}, ExpireAfter: "retention"},
+					},
+				},
+				"events": {Capped: &MongoCappedConfig{SizeBytes: 1 << 20}},
+			},
+		},
+	}
+}
+
+func mongoActions(results []MongoResult) []string {
+	var actions []string
+	for _, r := range results {
+		actions = append(actions, fmt.Sprintf("%s %s.%s %v %v", r.Action, r.Database, r.Collection, r.Changes, r.Drift))
+	}
+	return actions
+}
+
+func TestEnsureMongoCreatesAndIsIdempotent(t *testing.T) {
+	admin := newFakeMongoAdmin()
+	retention := 7 * 24 * time.Hour
+
+	results, err := EnsureMongo(context.Background(), admin, testMongoConfig(), retention, false)
+	if err != nil {
+		t.Fatalf("EnsureMongo: %v", err)
+	}
+	want := []string{
+		"create erp_logs.app_logs [create collection create index service_1_timestamp_-1 create index timestamp_1] []",
+		"create erp_logs.events [create collection] []",
+	}
+	if got := mongoActions(results); !reflect.DeepEqual(got, want) {
+		t.Errorf("results =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if ttl := admin.indexes["erp_logs.app_logs"][2].ExpireAfterSeconds; ttl == nil || *ttl != 7*24*3600 {
+		t.Errorf("ttl index expireAfterSeconds = %v", ttl)
+	}
+
+	admin.calls = nil
+	results, err = EnsureMongo(context.Background(), admin, testMongoConfig(), retention, false)
+	if err != nil {
+		t.Fatalf("second EnsureMongo: %v", err)
+	}
+	for _, r := range results {
+		if r.Action != MongoActionOK {
+			t.Errorf("second run: %s.%s = %s %v %v", r.Database, r.Collection, r.Action, r.Changes, r.Drift)
+		}
+	}
+	if len(admin.calls) != 0 {
+		t.Errorf("second run changed %v", admin.calls)
+	}
+}
+
+func TestEnsureMongoUpdatesValidatorAndTTL(t *testing.T) {
+	admin := newFakeMongoAdmin()
+	if _, err := EnsureMongo(context.Background(), admin, testMongoConfig(), 7*24*time.Hour, false); err != nil {
+		t.Fatal(err)
+	}
+	cfg := testMongoConfig()
+	spec := cfg.CollectionSpecs["logs"]["app_logs"]
+	spec.ValidationAction = "warn"
+	cfg.CollectionSpecs["logs"]["app_logs"] = spec
+	admin.calls = nil
+
+	results, err := EnsureMongo(context.Background(), admin, cfg, 30*24*time.Hour, true)
+	if err != nil {
+		t.Fatalf("EnsureMongo: %v", err)
+	}
+	if want := "update erp_logs.app_logs [update validator set ttl of timestamp_1 from 604800s to 2592000s] []"; mongoActions(results)[0] != want {
+		t.Errorf("dry run = %s, want %s", mongoActions(results)[0], want)
+	}
+	if len(admin.calls) != 0 {
+		t.Errorf("dry run changed %v", admin.calls)
+	}
+
+	if _, err := EnsureMongo(context.Background(), admin, cfg, 30*24*time.Hour, false); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"collMod validator erp_logs.app_logs", "collMod ttl erp_logs.app_logs timestamp_1 2592000"}
+	if !reflect.DeepEqual(admin.calls, want) {
+		t.Errorf("calls = %v, want %v", admin.calls, want)
+	}
+}
+
+func TestEnsureMongoReportsDrift(t *testing.T) {
+	admin := newFakeMongoAdmin()
+	admin.collections["erp_logs"] = map[string]MongoCollectionState{
+		"app_logs": {Name: "app_logs", Capped: true, SizeBytes: 4096},
+		"events":   {Name: "events", Capped: true, SizeBytes: 4096},
+	}
+	admin.indexes["erp_logs.app_logs"] = []MongoIndexState{
+		{Name: "_id_", Keys: []string{"_id"}},
+		{Name: "service_1_timestamp_-1", Keys: []string{"service", "timestamp"}, Unique: true},
+		{Name: "timestamp_1", Keys: []string{"timestamp"}},
+		{Name: "legacy_1", Keys: []string{"legacy"}},
+	}
+
+	results, err := EnsureMongo(context.Background(), admin, testMongoConfig(), 7*24*time.Hour, true)
+	if err != nil {
+		t.Fatalf("EnsureMongo: %v", err)
+	}
+	wantAppLogs := []string{
+		"collection is capped but the spec is not",
+		"index service_1_timestamp_-1 has keys [service timestamp], want [service -timestamp]",
+		"index service_1_timestamp_-1 has unique=true sparse=false, want unique=false sparse=false",
+		"index timestamp_1 is not a ttl index",
+		"index legacy_1 is not declared in the spec",
+	}
+	if results[0].Action != MongoActionDrift || !reflect.DeepEqual(results[0].Drift, wantAppLogs) {
+		t.Errorf("app_logs = %s %v, want drift\n%s", results[0].Action, results[0].Drift, strings.Join(wantAppLogs, "\n"))
+	}
+	wantEvents := []string{"capped at 4096 bytes/0 documents, want 1048576 bytes/0 documents"}
+	if results[1].Action != MongoActionDrift || !reflect.DeepEqual(results[1].Drift, wantEvents) {
+		t.Errorf("events = %s %v, want drift %v", results[1].Action, results[1].Drift, wantEvents)
+	}
+}
@@ -0,0 +1,233 @@
+package sharedconfig
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ValidationConfig mirrors the validation section of config.yaml
+type ValidationConfig struct {
+	NamingConventions NamingConventions `yaml:"naming_conventions"`
+}
+
+// NamingConventions holds the resource name patterns from config.yaml. Patterns
+// use {module}, {event_type}, {service}, {purpose} and {environment}
+// placeholders. EnvironmentTokens maps an environment to the token substituted
+// for {environment}; an empty token drops the placeholder and its separator.
+type NamingConventions struct {
+	EnvironmentFiles     string            `yaml:"environment_files"`
+	DatabaseNames        string            `yaml:"database_names"`
+	KafkaTopics          string            `yaml:"kafka_topics"`
+	KafkaGroups          string            `yaml:"kafka_groups"`
+	ElasticsearchIndices string            `yaml:"elasticsearch_indices"`
+	QdrantCollections    string            `yaml:"qdrant_collections"`
+	EnvironmentTokens    map[string]string `yaml:"environment_tokens"`
+}
+
+// NamingViolation reports a configured name that deviates from its convention
+type NamingViolation struct {
+	Kind     string `json:"kind"`
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Expected string `json:"expected"`
+}
+
+func (v NamingViolation) String() string {
+	return fmt.Sprintf("%s %s is %q, convention expects %q", v.Kind, v.Key, v.Value, v.Expected)
+}
+
+var environmentPlaceholder = regexp.MustCompile(`[-_.]?\{environment\}`)
+
+// DatabaseName returns the conventional database name for a module
+func (n *NamingConventions) DatabaseName(module, environment string) string {
+	return n.render(orDefault(n.DatabaseNames, "erp_{module}_{environment}"), environment, "{module}", module)
+}
+
+// TopicName returns the conventional topic name for an event type such as auth-events
+func (n *NamingConventions) TopicName(eventType, environment string) string {
+	return n.render(orDefault(n.KafkaTopics, "{event_type}-{environment}"), environment, "{event_type}", eventType)
+}
+
+// ConsumerGroup returns the conventional consumer group for a service such as auth-service
+func (n *NamingConventions) ConsumerGroup(service, environment string) string {
+	return n.render(orDefault(n.KafkaGroups, "{service}-group-{environment}"), environment, "{service}", service)
+}
+
+// IndexName returns the conventional Elasticsearch index name for a purpose
+func (n *NamingConventions) IndexName(purpose, environment string) string {
+	return n.render(orDefault(n.ElasticsearchIndices, "erp_{purpose}_{environment}"), environment, "{purpose}", purpose)
+}
+
+// CollectionName returns the conventional Qdrant collection name for a purpose
+func (n *NamingConventions) CollectionName(purpose, environment string) string {
+	return n.render(orDefault(n.QdrantCollections, "erp_{purpose}_{environment}"), environment, "{purpose}", purpose)
+}
+
+// EnvironmentToken returns the token substituted for {environment}
+func (n *NamingConventions) EnvironmentToken(environment string) string {
+	if token, ok := n.EnvironmentTokens[environment]; ok {
+		return token
+	}
+	return environment
+}
+
+func (n *NamingConventions) render(pattern, environment, placeholder, value string) string {
+	token := n.EnvironmentToken(environment)
+	if token == "" {
+		pattern = environmentPlaceholder.ReplaceAllString(pattern, "")
+	}
+	return strings.NewReplacer(placeholder, value, "{environment}", token).Replace(pattern)
+}
+
+func orDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// namedResource is one configurable name together with its conventional value
+type namedResource struct {
+	kind     string
+	key      string
+	value    *string
+	expected string
+}
+
+// namedResources lists every resource name the naming conventions govern
+func (c *Config) namedResources() []namedResource {
+	n := &c.Validation.NamingConventions
+	env := c.Environment.Current
+	var resources []namedResource
+
+	add := func(kind string, fields map[string]*string, expected func(key string) string) {
+		keys := make([]string, 0, len(fields))
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			resources = append(resources, namedResource{kind, key, fields[key], expected(key)})
+		}
+	}
+
+	add("postgresql database", c.Database.PostgreSQL.Databases.fields(), func(key string) string {
+		return n.DatabaseName(key, env)
+	})
+	add("mongodb database", c.Database.MongoDB.Databases.fields(), func(key string) string {
+		return n.DatabaseName(key, env)
+	})
+	add("kafka topic", c.MessageBroker.Kafka.Topics.fields(), func(key string) string {
+		return n.TopicName(strings.ReplaceAll(key, "_", "-"), env)
+	})
+	add("kafka consumer group", c.MessageBroker.Kafka.ConsumerGroups.fields(), func(key string) string {
+		return n.ConsumerGroup(strings.ReplaceAll(key, "_", "-"), env)
+	})
+	add("elasticsearch index", c.Search.Elasticsearch.Indices.fields(), func(key string) string {
+		return n.IndexName(key, env)
+	})
+	add("qdrant collection", c.VectorDatabase.Qdrant.Collections.fields(), func(key string) string {
+		return n.CollectionName(qdrantPurpose(key), env)
+	})
+
+	return resources
+}
+
+// ApplyNamingDefaults fills every unset database, topic, consumer group, index
+// and collection name from the naming conventions. Explicit values are kept.
+func (c *Config) ApplyNamingDefaults() {
+	for _, r := range c.namedResources() {
+		if *r.value == "" {
+			*r.value = r.expected
+		}
+	}
+}
+
+// ValidateNaming reports every configured name that deviates from the naming
+// conventions for the current environment
+func (c *Config) ValidateNaming() []NamingViolation {
+	var violations []NamingViolation
+	for _, r := range c.namedResources() {
+		if *r.value != "" && *r.value != r.expected {
+			violations = append(violations, NamingViolation{
+				Kind:     r.kind,
+				Key:      r.key,
+				Value:    *r.value,
+				Expected: r.expected,
+			})
+		}
+	}
+	return violations
+}
+
+func (d *PostgreSQLDatabasesConfig) fields() map[string]*string {
+	return map[string]*string{
+		"auth":      &d.Auth,
+		"crm":       &d.CRM,
+		"hrm":       &d.HRM,
+		"finance":   &d.Finance,
+		"inventory": &d.Inventory,
+		"projects":  &d.Projects,
+		"analytics": &d.Analytics,
+	}
+}
+
+func (d *MongoDBDatabasesConfig) fields() map[string]*string {
+	return map[string]*string{
+		"analytics":        &d.Analytics,
+		"logs":             &d.Logs,
+		"ai_conversations": &d.AIConversations,
+		"audit_trail":      &d.AuditTrail,
+	}
+}
+
+func (k *KafkaTopicsConfig) fields() map[string]*string {
+	return map[string]*string{
+		"auth_events":         &k.AuthEvents,
+		"user_events":         &k.UserEvents,
+		"business_events":     &k.BusinessEvents,
+		"system_events":       &k.SystemEvents,
+		"ai_events":           &k.AIEvents,
+		"notification_events": &k.NotificationEvents,
+	}
+}
+
+func (k *KafkaConsumerGroupsConfig) fields() map[string]*string {
+	return map[string]*string{
+		"auth_service":         &k.AuthService,
+		"notification_service": &k.NotificationService,
+		"analytics_service":    &k.AnalyticsService,
+		"audit_service":        &k.AuditService,
+		"ai_service":           &k.AIService,
+	}
+}
+
+func (e *ElasticsearchIndicesConfig) fields() map[string]*string {
+	return map[string]*string{
+		"contacts":     &e.Contacts,
+		"products":     &e.Products,
+		"documents":    &e.Documents,
+		"employees":    &e.Employees,
+		"transactions": &e.Transactions,
+	}
+}
+
+// qdrantPurpose returns the {purpose} of a collections key: knowledge_base
+// collections are named erp_knowledge_{environment}
+func qdrantPurpose(key string) string {
+	if key == "knowledge_base" {
+		return "knowledge"
+	}
+	return key
+}
+
+func (q *QdrantCollectionsConfig) fields() map[string]*string {
+	return map[string]*string{
+		"documents":      &q.Documents,
+		"products":       &q.Products,
+		"conversations":  &q.Conversations,
+		"knowledge_base": &q.KnowledgeBase,
+	}
+}
@@ -0,0 +1,82 @@
+package sharedconfig
+
+import (
+	"reflect"
+	"testing"
+)
+
+var testConventions = NamingConventions{
+	DatabaseNames:     "erp_{module}_{environment}",
+	KafkaTopics:       "{event_type}-{environment}",
+	KafkaGroups:       "{service}-group-{environment}",
+	QdrantCollections: "erp_{purpose}_{environment}",
+	EnvironmentTokens: map[string]string{"development": "", "testing": "test"},
+}
+
+func TestNamingConventionsExpandPatterns(t *testing.T) {
+	n := testConventions
+	tests := []struct {
+		name, got, want string
+	}{
+		{"token", n.DatabaseName("crm", "testing"), "erp_crm_test"},
+		{"environment as token", n.DatabaseName("crm", "staging"), "erp_crm_staging"},
+		{"empty token drops the separator", n.DatabaseName("crm", "development"), "erp_crm"},
+		{"dash separator", n.TopicName("auth-events", "development"), "auth-events"},
+		{"group", n.ConsumerGroup("auth-service", "testing"), "auth-service-group-test"},
+		{"collection", n.CollectionName("documents", "staging"), "erp_documents_staging"},
+		{"default pattern", (&NamingConventions{}).IndexName("contacts", "production"), "erp_contacts_production"},
+		{"custom pattern", (&NamingConventions{KafkaTopics: "{environment}.{event_type}"}).TopicName("ai-events", "staging"), "staging.ai-events"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestApplyNamingDefaults(t *testing.T) {
+	c := &Config{Environment: EnvironmentConfig{Current: "testing"}}
+	c.Validation.NamingConventions = testConventions
+	c.Database.PostgreSQL.Databases.CRM = "crm_custom"
+	c.ApplyNamingDefaults()
+
+	if got := c.Database.PostgreSQL.Databases.Auth; got != "erp_auth_test" {
+		t.Errorf("postgresql auth = %q", got)
+	}
+	if got := c.Database.PostgreSQL.Databases.CRM; got != "crm_custom" {
+		t.Errorf("postgresql crm = %q, want the explicit value kept", got)
+	}
+	if got := c.MessageBroker.Kafka.Topics.NotificationEvents; got != "notification-events-test" {
+		t.Errorf("kafka notification_events = %q", got)
+	}
+	if got := c.MessageBroker.Kafka.ConsumerGroups.AIService; got != "ai-service-group-test" {
+		t.Errorf("kafka ai_service group = %q", got)
+	}
+	if got := c.VectorDatabase.Qdrant.Collections.KnowledgeBase; got != "erp_knowledge_test" {
+		t.Errorf("qdrant knowledge_base = %q", got)
+	}
+}
+
+func TestValidateNaming(t *testing.T) {
+	c := &Config{Environment: EnvironmentConfig{Current: "testing"}}
+	c.Validation.NamingConventions = testConventions
+	c.Database.PostgreSQL.Databases.CRM = "crm_custom"
+	c.MessageBroker.Kafka.Topics.AuthEvents = "auth-events-test"
+	c.VectorDatabase.Qdrant.Collections.KnowledgeBase = "erp_knowledge_base_test"
+
+	want := []NamingViolation{
+		{Kind: "postgresql database", Key: "crm", Value: "crm_custom", Expected: "erp_crm_test"},
+		{Kind: "qdrant collection", Key: "knowledge_base", Value: "erp_knowledge_base_test", Expected: "erp_knowledge_test"},
+	}
+	if got := c.ValidateNaming(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ValidateNaming() = %v, want %v", got, want)
+	}
+}
+
+func TestShippedNamesFollowConventions(t *testing.T) {
+	for _, env := range []string{"staging", "testing"} {
+		for _, v := range loadEnvironment(t, env).ValidateNaming() {
+			t.Errorf("%s: %s", env, v)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package sharedconfig
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"expvar"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// PostgreSQLRetryConfig controls how OpenPostgres retries during startup.
+// Every setting is in milliseconds.
+type PostgreSQLRetryConfig struct {
+	InitialInterval int `yaml:"initial_interval_ms"`
+	MaxInterval     int `yaml:"max_interval_ms"`
+	MaxElapsedTime  int `yaml:"max_elapsed_time_ms"`
+}
+
+// GetInitialInterval returns the delay before the first retry
+func (r *PostgreSQLRetryConfig) GetInitialInterval() time.Duration {
+	if r.InitialInterval <= 0 {
+		return 250 * time.Millisecond // Default
+	}
+	return time.Duration(r.InitialInterval) * time.Millisecond
+}
+
+// GetMaxInterval returns the upper bound for a single retry delay
+func (r *PostgreSQLRetryConfig) GetMaxInterval() time.Duration {
+	if r.MaxInterval <= 0 {
+		return 10 * time.Second // Default
+	}
+	return time.Duration(r.MaxInterval) * time.Millisecond
+}
+
+// GetMaxElapsedTime returns how long OpenPostgres keeps retrying before giving up
+func (r *PostgreSQLRetryConfig) GetMaxElapsedTime() time.Duration {
+	if r.MaxElapsedTime <= 0 {
+		return 1 * time.Minute // Default
+	}
+	return time.Duration(r.MaxElapsedTime) * time.Millisecond
+}
+
+// GetDriver returns the database/sql driver name used by OpenPostgres
+func (p *PostgreSQLConfig) GetDriver() string {
+	if p.Driver == "" {
+		return "pgx" // Default
+	}
+	return p.Driver
+}
+
+// OpenPostgres opens a connection pool for the given module's database as its
+// app role, applies every pool setting and retries with exponential backoff
+// and jitter until the database answers a ping or the retry deadline passes.
+// The driver named by GetDriver must be registered by the caller, e.g. by
+// importing github.com/jackc/pgx/v5/stdlib.
+func OpenPostgres(ctx context.Context, cfg *PostgreSQLConfig, module string) (*sql.DB, error) {
+	return OpenPostgresAs(ctx, cfg, module, PostgreSQLRoleApp)
+}
+
+// OpenPostgresAs is OpenPostgres connecting as the given role, e.g. the owner
+// role for migrations. Only app role pools are published with
+// PublishPoolStats; the others are short-lived.
+func OpenPostgresAs(ctx context.Context, cfg *PostgreSQLConfig, module string, role PostgreSQLRole) (*sql.DB, error) {
+	dsn, err := cfg.GetDSNAs(module, role)
+	if err != nil {
+		return nil, err
+	}
+	db, err := openPostgres(ctx, cfg, module, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if role == PostgreSQLRoleApp {
+		PublishPoolStats("postgres."+module, db)
+	}
+	return db, nil
+}
+
+func openPostgres(ctx context.Context, cfg *PostgreSQLConfig, name, dsn string) (*sql.DB, error) {
+	if cfg.ConnectionTimeout > 0 {
+		dsn = fmt.Sprintf("%s connect_timeout=%d", dsn, cfg.ConnectionTimeout)
+	}
+
+	db, err := sql.Open(cfg.GetDriver(), dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening postgres pool for %s: %w", name, err)
+	}
+
+	db.SetMaxOpenConns(cfg.Pool.GetMaxOpenConnections())
+	db.SetMaxIdleConns(cfg.Pool.GetMaxIdleConnections())
+	db.SetConnMaxLifetime(cfg.Pool.GetConnectionMaxLifetime())
+	db.SetConnMaxIdleTime(cfg.Pool.GetConnectionMaxIdleTime())
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Retry.GetMaxElapsedTime())
+	defer cancel()
+
+	if err := retryWithBackoff(ctx, &cfg.Retry, db.PingContext); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("postgres database for %s is not reachable: %w", name, err)
+	}
+	return db, nil
+}
+
+// PoolStatsVar is the expvar under which PublishPoolStats exports pool
+// statistics, keyed by pool name
+const PoolStatsVar = "sql_pools"
+
+var (
+	poolStatsOnce sync.Once
+	poolStatsMu   sync.Mutex
+	poolStats     = map[string]*sql.DB{}
+)
+
+// PublishPoolStats exports the pool statistics of db under name in the
+// PoolStatsVar expvar, so they show up on /debug/vars. Publishing a name
+// again, e.g. after a reconnect, replaces the pool reported for it.
+func PublishPoolStats(name string, db *sql.DB) {
+	poolStatsOnce.Do(func() {
+		expvar.Publish(PoolStatsVar, expvar.Func(func() interface{} {
+			poolStatsMu.Lock()
+			defer poolStatsMu.Unlock()
+			stats := make(map[string]sql.DBStats, len(poolStats))
+			for name, db := range poolStats {
+				stats[name] = db.Stats()
+			}
+			return stats
+		}))
+	})
+	poolStatsMu.Lock()
+	defer poolStatsMu.Unlock()
+	poolStats[name] = db
+}
+
+// UnpublishPoolStats stops exporting the pool published under name, e.g.
+// when it is closed
+func UnpublishPoolStats(name string) {
+	poolStatsMu.Lock()
+	defer poolStatsMu.Unlock()
+	delete(poolStats, name)
+}
+
+// retryWithBackoff calls fn until it succeeds or ctx is done, sleeping an
+// exponentially growing, fully jittered interval between attempts
+func retryWithBackoff(ctx context.Context, r *PostgreSQLRetryConfig, fn func(context.Context) error) error {
+	interval := r.GetInitialInterval()
+	for {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+
+		delay := time.Duration(rand.Int63n(int64(interval)) + 1)
+		select {
+		case <-ctx.Done():
+			if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+				return ctx.Err()
+			}
+			return fmt.Errorf("%w (last error: %v)", ctx.Err(), err)
+		case <-time.After(delay):
+		}
+
+		interval *= 2
+		if interval > r.GetMaxInterval() {
+			interval = r.GetMaxInterval()
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package sharedconfig
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PostgreSQLRole selects whose credentials a connection uses
+type PostgreSQLRole string
+
+const (
+	// PostgreSQLRoleAdmin is the shared superuser from Username/Password
+	PostgreSQLRoleAdmin PostgreSQLRole = "admin"
+	// PostgreSQLRoleOwner owns the module database and runs its migrations
+	PostgreSQLRoleOwner PostgreSQLRole = "owner"
+	// PostgreSQLRoleApp is used by the service and may only read and write rows
+	PostgreSQLRoleApp PostgreSQLRole = "app"
+	// PostgreSQLRoleReadOnly is the optional reporting role
+	PostgreSQLRoleReadOnly PostgreSQLRole = "readonly"
+)
+
+// PostgreSQLCredentials is a login role. Username defaults to
+// <database>_<role>; a role without a password is created NOLOGIN.
+type PostgreSQLCredentials struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// PostgreSQLModuleRoles are the roles provisioned for one module database.
+// ReadOnly is only provisioned when set.
+type PostgreSQLModuleRoles struct {
+	Owner    PostgreSQLCredentials  `yaml:"owner"`
+	App      PostgreSQLCredentials  `yaml:"app"`
+	ReadOnly *PostgreSQLCredentials `yaml:"readonly"`
+}
+
+// GetModuleRoles returns the module's roles with default usernames filled in
+func (p *PostgreSQLConfig) GetModuleRoles(module string) PostgreSQLModuleRoles {
+	roles := p.Roles[module]
+	dbName := p.getDatabaseName(module)
+	if roles.Owner.Username == "" {
+		roles.Owner.Username = dbName + "_owner"
+	}
+	if roles.App.Username == "" {
+		roles.App.Username = dbName + "_app"
+	}
+	if roles.ReadOnly != nil {
+		readOnly := *roles.ReadOnly
+		if readOnly.Username == "" {
+			readOnly.Username = dbName + "_readonly"
+		}
+		roles.ReadOnly = &readOnly
+	}
+	return roles
+}
+
+// GetCredentials returns the username and password used to connect to the
+// module's database as role. A module role without a password is an error:
+// connections never fall back to the admin credentials.
+func (p *PostgreSQLConfig) GetCredentials(module string, role PostgreSQLRole) (string, string, error) {
+	roles := p.GetModuleRoles(module)
+	var creds *PostgreSQLCredentials
+	switch role {
+	case PostgreSQLRoleAdmin:
+		return p.Username, p.Password, nil
+	case PostgreSQLRoleOwner:
+		creds = &roles.Owner
+	case PostgreSQLRoleApp:
+		creds = &roles.App
+	case PostgreSQLRoleReadOnly:
+		if roles.ReadOnly == nil {
+			return "", "", fmt.Errorf("postgresql %s has no readonly role; set POSTGRES_%s_READONLY_PASSWORD", module, strings.ToUpper(module))
+		}
+		creds = roles.ReadOnly
+	default:
+		return "", "", fmt.Errorf("unknown postgresql role %q", role)
+	}
+	if creds.Password == "" {
+		return creds.Username, "", fmt.Errorf("postgresql %s role %s of %s has no password; set POSTGRES_%s_%s_PASSWORD",
+			role, creds.Username, module, strings.ToUpper(module), strings.ToUpper(string(role)))
+	}
+	return creds.Username, creds.Password, nil
+}
+
+// overrideRolesWithEnvVars reads role passwords from
+// POSTGRES_<MODULE>_{OWNER,APP,READONLY}_PASSWORD. Setting the read-only
+// password enables the read-only role.
+func (p *PostgreSQLConfig) overrideRolesWithEnvVars() {
+	for _, module := range p.Databases.GetModules() {
+		prefix := "POSTGRES_" + strings.ToUpper(module) + "_"
+		roles := p.Roles[module]
+		roles.Owner.Password = getEnv(prefix+"OWNER_PASSWORD", roles.Owner.Password)
+		roles.App.Password = getEnv(prefix+"APP_PASSWORD", roles.App.Password)
+		if password := getEnv(prefix+"READONLY_PASSWORD", ""); password != "" {
+			if roles.ReadOnly == nil {
+				roles.ReadOnly = &PostgreSQLCredentials{}
+			}
+			roles.ReadOnly.Password = password
+		}
+		if roles.Owner.Password != "" || roles.App.Password != "" || roles.ReadOnly != nil {
+			if p.Roles == nil {
+				p.Roles = map[string]PostgreSQLModuleRoles{}
+			}
+			p.Roles[module] = roles
+		}
+	}
+}
+
+// GetMaintenanceDatabase returns the database the admin connects to when
+// creating module databases and roles
+func (p *PostgreSQLConfig) GetMaintenanceDatabase() string {
+	if p.MaintenanceDatabase == "" {
+		return "postgres" // Default
+	}
+	return p.MaintenanceDatabase
+}
+
+// ProvisionAction describes what ProvisionPostgres did, or would do in dry-run
+// mode, for one object
+type ProvisionAction string
+
+const (
+	ProvisionActionOK     ProvisionAction = "ok"
+	ProvisionActionCreate ProvisionAction = "create"
+	ProvisionActionUpdate ProvisionAction = "update"
+	ProvisionActionGrant  ProvisionAction = "grant"
+)
+
+// ProvisionResult is one row of the provisioning report
+type ProvisionResult struct {
+	Module string
+	Object string
+	Name   string
+	Action ProvisionAction
+	Detail string
+}
+
+// ProvisionPostgres idempotently creates every module's roles and database and
+// applies least-privilege grants: the owner owns the database and public
+// schema, the app role gets DML only and the optional read-only role SELECT
+// only. Default privileges cover tables the owner creates later, so migrations
+// must run as the owner. Statements only run when dryRun is false.
+func ProvisionPostgres(ctx context.Context, cfg *PostgreSQLConfig, dryRun bool) ([]ProvisionResult, error) {
+	admin, err := openPostgres(ctx, cfg, "maintenance", cfg.dsn(cfg.GetMaintenanceDatabase(), cfg.Username, cfg.Password))
+	if err != nil {
+		return nil, err
+	}
+	defer admin.Close()
+
+	var results []ProvisionResult
+	for _, module := range cfg.Databases.GetModules() {
+		dbName := cfg.getDatabaseName(module)
+		if dbName == "" {
+			continue
+		}
+		moduleResults, err := provisionModule(ctx, admin, cfg, module, dryRun)
+		results = append(results, moduleResults...)
+		if err != nil {
+			return results, fmt.Errorf("error provisioning %s: %w", module, err)
+		}
+	}
+	return results, nil
+}
+
+func provisionModule(ctx context.Context, admin *sql.DB, cfg *PostgreSQLConfig, module string, dryRun bool) ([]ProvisionResult, error) {
+	roles := cfg.GetModuleRoles(module)
+	dbName := cfg.getDatabaseName(module)
+	var results []ProvisionResult
+
+	logins := []PostgreSQLCredentials{roles.Owner, roles.App}
+	if roles.ReadOnly != nil {
+		logins = append(logins, *roles.ReadOnly)
+	}
+	for _, creds := range logins {
+		result, err := provisionRole(ctx, admin, module, creds, dryRun)
+		results = append(results, result)
+		if err != nil {
+			return results, err
+		}
+	}
+
+	var exists bool
+	if err := admin.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)", dbName).Scan(&exists); err != nil {
+		return results, err
+	}
+	dbStatements := []string{
+		fmt.Sprintf("ALTER DATABASE %s OWNER TO %s", quoteIdent(dbName), quoteIdent(roles.Owner.Username)),
+		fmt.Sprintf("REVOKE ALL ON DATABASE %s FROM PUBLIC", quoteIdent(dbName)),
+		fmt.Sprintf("GRANT CONNECT ON DATABASE %s TO %s", quoteIdent(dbName), quoteIdent(roles.App.Username)),
+	}
+	if roles.ReadOnly != nil {
+		dbStatements = append(dbStatements,
+			fmt.Sprintf("GRANT CONNECT ON DATABASE %s TO %s", quoteIdent(dbName), quoteIdent(roles.ReadOnly.Username)))
+	}
+	action := ProvisionActionOK
+	if !exists {
+		action = ProvisionActionCreate
+		dbStatements = append([]string{fmt.Sprintf("CREATE DATABASE %s OWNER %s", quoteIdent(dbName), quoteIdent(roles.Owner.Username))}, dbStatements...)
+	}
+	results = append(results, ProvisionResult{Module: module, Object: "database", Name: dbName, Action: action, Detail: "owner " + roles.Owner.Username})
+	if dryRun {
+		results = append(results, grantResults(module, roles)...)
+		return results, nil
+	}
+	if err := execAll(ctx, admin, dbStatements); err != nil {
+		return results, err
+	}
+
+	// Schema grants have to be issued inside the module database
+	db, err := openPostgres(ctx, cfg, module+".admin", cfg.dsn(dbName, cfg.Username, cfg.Password))
+	if err != nil {
+		return results, err
+	}
+	defer db.Close()
+
+	if err := execAll(ctx, db, schemaGrants(roles)); err != nil {
+		return results, err
+	}
+	results = append(results, grantResults(module, roles)...)
+	return results, nil
+}
+
+func provisionRole(ctx context.Context, admin *sql.DB, module string, creds PostgreSQLCredentials, dryRun bool) (ProvisionResult, error) {
+	result := ProvisionResult{Module: module, Object: "role", Name: creds.Username, Action: ProvisionActionOK}
+
+	var exists bool
+	if err := admin.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)", creds.Username).Scan(&exists); err != nil {
+		return result, err
+	}
+
+	login := "NOLOGIN"
+	if creds.Password != "" {
+		login = "LOGIN PASSWORD " + quoteLiteral(creds.Password)
+	} else {
+		result.Detail = "no password configured, NOLOGIN"
+	}
+
+	var statement string
+	switch {
+	case !exists:
+		result.Action = ProvisionActionCreate
+		statement = fmt.Sprintf("CREATE ROLE %s %s", quoteIdent(creds.Username), login)
+	case creds.Password != "":
+		// Passwords are re-applied on every run so rotations take effect
+		result.Action = ProvisionActionUpdate
+		statement = fmt.Sprintf("ALTER ROLE %s %s", quoteIdent(creds.Username), login)
+	default:
+		return result, nil
+	}
+
+	if dryRun {
+		return result, nil
+	}
+	_, err := admin.ExecContext(ctx, statement)
+	return result, err
+}
+
+// schemaGrants returns the statements that give each role its rights on the
+// public schema, for existing objects and for those the owner creates later
+func schemaGrants(roles PostgreSQLModuleRoles) []string {
+	owner := quoteIdent(roles.Owner.Username)
+	app := quoteIdent(roles.App.Username)
+	statements := []string{
+		fmt.Sprintf("ALTER SCHEMA public OWNER TO %s", owner),
+		"REVOKE CREATE ON SCHEMA public FROM PUBLIC",
+		fmt.Sprintf("GRANT USAGE ON SCHEMA public TO %s", app),
+		fmt.Sprintf("GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO %s", app),
+		fmt.Sprintf("GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA public TO %s", app),
+		fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s IN SCHEMA public GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO %s", owner, app),
+		fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s IN SCHEMA public GRANT USAGE, SELECT ON SEQUENCES TO %s", owner, app),
+	}
+	if roles.ReadOnly != nil {
+		readOnly := quoteIdent(roles.ReadOnly.Username)
+		statements = append(statements,
+			fmt.Sprintf("GRANT USAGE ON SCHEMA public TO %s", readOnly),
+			fmt.Sprintf("GRANT SELECT ON ALL TABLES IN SCHEMA public TO %s", readOnly),
+			fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s IN SCHEMA public GRANT SELECT ON TABLES TO %s", owner, readOnly),
+		)
+	}
+	return statements
+}
+
+func grantResults(module string, roles PostgreSQLModuleRoles) []ProvisionResult {
+	results := []ProvisionResult{
+		{Module: module, Object: "grants", Name: roles.App.Username, Action: ProvisionActionGrant, Detail: "SELECT, INSERT, UPDATE, DELETE"},
+	}
+	if roles.ReadOnly != nil {
+		results = append(results, ProvisionResult{Module: module, Object: "grants", Name: roles.ReadOnly.Username, Action: ProvisionActionGrant, Detail: "SELECT"})
+	}
+	return results
+}
+
+func execAll(ctx context.Context, db *sql.DB, statements []string) error {
+	for _, statement := range statements {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("%s: %w", statement, err)
+		}
+	}
+	return nil
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// WriteProvisionReport prints one line per provisioned object
+func WriteProvisionReport(w io.Writer, results []ProvisionResult, dryRun bool) {
+	for _, r := range results {
+		action := r.Action
+		if dryRun && action != ProvisionActionOK {
+			action = "would " + action
+		}
+		fmt.Fprintf(w, "%-14s %-10s %-9s %-32s %s\n", action, r.Module, r.Object, r.Name, r.Detail)
+	}
+}
@@ -0,0 +1,259 @@
+package sharedconfig
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// recordingDriver is an in-process PostgreSQL that answers the EXISTS
+// queries of ProvisionPostgres from existing and records every statement,
+// prefixed with the database it ran in
+type recordingDriver struct {
+	mu         sync.Mutex
+	existing   map[string]bool
+	statements []string
+}
+
+var recordingDrivers atomic.Int64
+
+func registerRecordingDriver(t *testing.T, existing ...string) (string, *recordingDriver) {
+	d := &recordingDriver{existing: map[string]bool{}}
+	for _, name := range existing {
+		d.existing[name] = true
+	}
+	name := fmt.Sprintf("recording-%s-%d", t.Name(), recordingDrivers.Add(1))
+	sql.Register(name, d)
+	return name, d
+}
+
+func (d *recordingDriver) Open(dsn string) (driver.Conn, error) {
+	for _, field := range strings.Fields(dsn) {
+		if dbName, ok := strings.CutPrefix(field, "dbname="); ok {
+			return &recordingConn{d: d, dbName: dbName}, nil
+		}
+	}
+	return nil, errors.New("no dbname in dsn")
+}
+
+func (d *recordingDriver) Statements() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.statements...)
+}
+
+type recordingConn struct {
+	d      *recordingDriver
+	dbName string
+}
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (c *recordingConn) Close() error              { return nil }
+func (c *recordingConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (c *recordingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.statements = append(c.d.statements, c.dbName+": "+query)
+	return driver.RowsAffected(0), nil
+}
+
+func (c *recordingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if !strings.HasPrefix(query, "SELECT EXISTS") || len(args) != 1 {
+		return nil, fmt.Errorf("unexpected query %q", query)
+	}
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	return &existsRows{exists: c.d.existing[args[0].Value.(string)]}, nil
+}
+
+type existsRows struct {
+	exists bool
+	done   bool
+}
+
+func (r *existsRows) Columns() []string { return []string{"exists"} }
+func (r *existsRows) Close() error      { return nil }
+func (r *existsRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.exists
+	return nil
+}
+
+func TestGetModuleRolesDefaults(t *testing.T) {
+	p := &PostgreSQLConfig{
+		Databases: PostgreSQLDatabasesConfig{CRM: "erp_crm_test", Analytics: "erp_analytics_test"},
+		Roles: map[string]PostgreSQLModuleRoles{
+			"analytics": {ReadOnly: &PostgreSQLCredentials{}},
+			"crm":       {App: PostgreSQLCredentials{Username: "crm_service"}},
+		},
+	}
+
+	crm := p.GetModuleRoles("crm")
+	if crm.Owner.Username != "erp_crm_test_owner" || crm.App.Username != "crm_service" || crm.ReadOnly != nil {
+		t.Errorf("crm roles = %+v", crm)
+	}
+	analytics := p.GetModuleRoles("analytics")
+	if analytics.ReadOnly == nil || analytics.ReadOnly.Username != "erp_analytics_test_readonly" {
+		t.Errorf("analytics readonly = %+v", analytics.ReadOnly)
+	}
+	if p.Roles["analytics"].ReadOnly.Username != "" {
+		t.Error("GetModuleRoles modified the configured roles")
+	}
+}
+
+func TestGetCredentials(t *testing.T) {
+	p := &PostgreSQLConfig{
+		Username:  "postgres",
+		Password:  "superuser",
+		Databases: PostgreSQLDatabasesConfig{Inventory: "erp_inventory_test"},
+		Roles: map[string]PostgreSQLModuleRoles{
+			"inventory": {App: PostgreSQLCredentials{Password: "app-secret"}},
+		},
+	}
+
+	tests := []struct {
+		role     PostgreSQLRole
+		username string
+		password string
+		wantErr  string
+	}{
+		{PostgreSQLRoleAdmin, "postgres", "superuser", ""},
+		{PostgreSQLRoleApp, "erp_inventory_test_app", "app-secret", ""},
+		{PostgreSQLRoleOwner, "erp_inventory_test_owner", "", "set POSTGRES_INVENTORY_OWNER_PASSWORD"},
+		{PostgreSQLRoleReadOnly, "", "", "set POSTGRES_INVENTORY_READONLY_PASSWORD"},
+		{"superuser", "", "", `unknown postgresql role "superuser"`},
+	}
+	for _, tt := range tests {
+		username, password, err := p.GetCredentials("inventory", tt.role)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: err = %v, want %q", tt.role, err, tt.wantErr)
+			}
+			if password != "" || username == "postgres" {
+				t.Errorf("%s: got %s/%s, want no admin credentials", tt.role, username, password)
+			}
+			continue
+		}
+		if err != nil || username != tt.username || password != tt.password {
+			t.Errorf("%s = %s, %s, %v, want %s, %s", tt.role, username, password, err, tt.username, tt.password)
+		}
+	}
+
+	if dsn := p.GetDSN("crm"); strings.Contains(dsn, "postgres ") || strings.Contains(dsn, "superuser") {
+		t.Errorf("GetDSN without an app role password uses the admin credentials: %s", dsn)
+	}
+}
+
+func TestOverrideRolesWithEnvVars(t *testing.T) {
+	t.Setenv("POSTGRES_HRM_APP_PASSWORD", "hrm-app")
+	t.Setenv("POSTGRES_ANALYTICS_READONLY_PASSWORD", "reporting")
+	p := &PostgreSQLConfig{Databases: PostgreSQLDatabasesConfig{HRM: "erp_hrm", Analytics: "erp_analytics", CRM: "erp_crm"}}
+	p.overrideRolesWithEnvVars()
+
+	if got := p.Roles["hrm"].App.Password; got != "hrm-app" {
+		t.Errorf("hrm app password = %q", got)
+	}
+	if ro := p.Roles["analytics"].ReadOnly; ro == nil || ro.Password != "reporting" {
+		t.Errorf("analytics readonly = %+v, want it enabled by its password", ro)
+	}
+	if _, ok := p.Roles["crm"]; ok {
+		t.Error("crm got roles without any password set")
+	}
+}
+
+func TestProvisionPostgresStatements(t *testing.T) {
+	name, d := registerRecordingDriver(t, "erp_auth_app")
+	cfg := &PostgreSQLConfig{
+		Host:      "localhost",
+		Driver:    name,
+		Username:  "postgres",
+		Password:  "superuser",
+		Databases: PostgreSQLDatabasesConfig{Auth: "erp_auth"},
+		Roles: map[string]PostgreSQLModuleRoles{
+			"auth": {
+				App:      PostgreSQLCredentials{Password: "it's secret"},
+				ReadOnly: &PostgreSQLCredentials{Username: "erp_reporting", Password: "ro"},
+			},
+		},
+	}
+
+	results, err := ProvisionPostgres(context.Background(), cfg, false)
+	if err != nil {
+		t.Fatalf("ProvisionPostgres: %v", err)
+	}
+	want := []string{
+		`postgres: CREATE ROLE "erp_auth_owner" NOLOGIN`,
+		`postgres: ALTER ROLE "erp_auth_app" LOGIN PASSWORD 'it''s secret'`,
+		`postgres: CREATE ROLE "erp_reporting" LOGIN PASSWORD 'ro'`,
+		`postgres: CREATE DATABASE "erp_auth" OWNER "erp_auth_owner"`,
+		`postgres: ALTER DATABASE "erp_auth" OWNER TO "erp_auth_owner"`,
+		`postgres: REVOKE ALL ON DATABASE "erp_auth" FROM PUBLIC`,
+		`postgres: GRANT CONNECT ON DATABASE "erp_auth" TO "erp_auth_app"`,
+		`postgres: GRANT CONNECT ON DATABASE "erp_auth" TO "erp_reporting"`,
+		`erp_auth: ALTER SCHEMA public OWNER TO "erp_auth_owner"`,
+		`erp_auth: REVOKE CREATE ON SCHEMA public FROM PUBLIC`,
+		`erp_auth: GRANT USAGE ON SCHEMA public TO "erp_auth_app"`,
+		`erp_auth: GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO "erp_auth_app"`,
+		`erp_auth: GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA public TO "erp_auth_app"`,
+		`erp_auth: ALTER DEFAULT PRIVILEGES FOR ROLE "erp_auth_owner" IN SCHEMA public GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO "erp_auth_app"`,
+		`erp_auth: ALTER DEFAULT PRIVILEGES FOR ROLE "erp_auth_owner" IN SCHEMA public GRANT USAGE, SELECT ON SEQUENCES TO "erp_auth_app"`,
+		`erp_auth: GRANT USAGE ON SCHEMA public TO "erp_reporting"`,
+		`erp_auth: GRANT SELECT ON ALL TABLES IN SCHEMA public TO "erp_reporting"`,
+		`erp_auth: ALTER DEFAULT PRIVILEGES FOR ROLE "erp_auth_owner" IN SCHEMA public GRANT SELECT ON TABLES TO "erp_reporting"`,
+	}
+	if got := d.Statements(); !reflect.DeepEqual(got, want) {
+		t.Errorf("statements =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	var actions []string
+	for _, r := range results {
+		actions = append(actions, fmt.Sprintf("%s %s %s", r.Action, r.Object, r.Name))
+	}
+	wantActions := []string{
+		"create role erp_auth_owner",
+		"update role erp_auth_app",
+		"create role erp_reporting",
+		"create database erp_auth",
+		"grant grants erp_auth_app",
+		"grant grants erp_reporting",
+	}
+	if !reflect.DeepEqual(actions, wantActions) {
+		t.Errorf("results = %v, want %v", actions, wantActions)
+	}
+}
+
+func TestProvisionPostgresDryRunOnlyQueries(t *testing.T) {
+	name, d := registerRecordingDriver(t, "erp_crm", "erp_crm_owner", "erp_crm_app")
+	cfg := &PostgreSQLConfig{
+		Host:      "localhost",
+		Driver:    name,
+		Databases: PostgreSQLDatabasesConfig{CRM: "erp_crm"},
+	}
+
+	results, err := ProvisionPostgres(context.Background(), cfg, true)
+	if err != nil {
+		t.Fatalf("ProvisionPostgres: %v", err)
+	}
+	if got := d.Statements(); len(got) != 0 {
+		t.Errorf("dry run executed %q", got)
+	}
+	for _, r := range results {
+		if r.Object != "grants" && r.Action != ProvisionActionOK {
+			t.Errorf("%s %s: action = %s, want ok for an existing object", r.Object, r.Name, r.Action)
+		}
+	}
+}
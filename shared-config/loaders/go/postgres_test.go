@@ -0,0 +1,235 @@
+package sharedconfig
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyDriver is an in-process stand-in for a PostgreSQL server that refuses
+// the first failures connections, like a database that is still starting
+type flakyDriver struct {
+	mu       sync.Mutex
+	failures int
+	attempts int
+}
+
+func (d *flakyDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.attempts++
+	if d.attempts <= d.failures {
+		return nil, errors.New("connection refused")
+	}
+	return flakyConn{}, nil
+}
+
+func (d *flakyDriver) Attempts() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.attempts
+}
+
+type flakyConn struct{}
+
+func (flakyConn) Prepare(query string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (flakyConn) Close() error                              { return nil }
+func (flakyConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+// flakyDrivers numbers registered drivers; sql.Register panics on a name
+// registered before, e.g. by an earlier run under -count
+var flakyDrivers atomic.Int64
+
+// registerFlakyDriver registers a flakyDriver under a name unique to the test
+func registerFlakyDriver(t *testing.T, failures int) (string, *flakyDriver) {
+	d := &flakyDriver{failures: failures}
+	name := fmt.Sprintf("flaky-%s-%d", t.Name(), flakyDrivers.Add(1))
+	sql.Register(name, d)
+	return name, d
+}
+
+// rolePasswords gives the owner and app roles of modules a password, so that
+// connections may use them
+func rolePasswords(modules ...string) map[string]PostgreSQLModuleRoles {
+	roles := map[string]PostgreSQLModuleRoles{}
+	for _, module := range modules {
+		roles[module] = PostgreSQLModuleRoles{
+			Owner: PostgreSQLCredentials{Password: module + "-owner-secret"},
+			App:   PostgreSQLCredentials{Password: module + "-app-secret"},
+		}
+	}
+	return roles
+}
+
+// publishedPools returns the pools exported in the PoolStatsVar expvar
+func publishedPools(t *testing.T) map[string]sql.DBStats {
+	t.Helper()
+	var stats map[string]sql.DBStats
+	if err := json.Unmarshal([]byte(expvar.Get(PoolStatsVar).String()), &stats); err != nil {
+		t.Fatalf("decoding %s: %v", PoolStatsVar, err)
+	}
+	return stats
+}
+
+func TestRetryWithBackoffSucceedsAfterFailures(t *testing.T) {
+	retry := &PostgreSQLRetryConfig{InitialInterval: 1, MaxInterval: 4, MaxElapsedTime: 1000}
+	calls := 0
+	err := retryWithBackoff(context.Background(), retry, func(context.Context) error {
+		calls++
+		if calls < 5 {
+			return errors.New("not yet")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("retryWithBackoff: %v", err)
+	}
+	if calls != 5 {
+		t.Errorf("calls = %d, want 5", calls)
+	}
+}
+
+func TestRetryWithBackoffGivesUpAtDeadline(t *testing.T) {
+	retry := &PostgreSQLRetryConfig{InitialInterval: 1, MaxInterval: 5}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := retryWithBackoff(ctx, retry, func(context.Context) error {
+		return errors.New("connection refused")
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("gave up after %s, want about 50ms", elapsed)
+	}
+}
+
+func TestRetryIntervalsAreMilliseconds(t *testing.T) {
+	retry := &PostgreSQLRetryConfig{InitialInterval: 100, MaxInterval: 2000, MaxElapsedTime: 30000}
+	if got := retry.GetInitialInterval(); got != 100*time.Millisecond {
+		t.Errorf("GetInitialInterval() = %s", got)
+	}
+	if got := retry.GetMaxInterval(); got != 2*time.Second {
+		t.Errorf("GetMaxInterval() = %s", got)
+	}
+	if got := retry.GetMaxElapsedTime(); got != 30*time.Second {
+		t.Errorf("GetMaxElapsedTime() = %s", got)
+	}
+}
+
+func TestOpenPostgresRetriesUntilReachable(t *testing.T) {
+	name, d := registerFlakyDriver(t, 3)
+	cfg := &PostgreSQLConfig{
+		Host:   "localhost",
+		Driver: name,
+		Retry:  PostgreSQLRetryConfig{InitialInterval: 1, MaxInterval: 2, MaxElapsedTime: 5000},
+		Roles:  rolePasswords("crm"),
+	}
+
+	db, err := OpenPostgres(context.Background(), cfg, "crm")
+	if err != nil {
+		t.Fatalf("OpenPostgres: %v", err)
+	}
+	defer db.Close()
+	if d.Attempts() != 4 {
+		t.Errorf("attempts = %d, want 4", d.Attempts())
+	}
+}
+
+func TestOpenPostgresFailsAfterMaxElapsedTime(t *testing.T) {
+	name, d := registerFlakyDriver(t, 1<<30)
+	cfg := &PostgreSQLConfig{
+		Host:   "localhost",
+		Driver: name,
+		Retry:  PostgreSQLRetryConfig{InitialInterval: 1, MaxInterval: 5, MaxElapsedTime: 50},
+		Roles:  rolePasswords("crm"),
+	}
+
+	if _, err := OpenPostgres(context.Background(), cfg, "crm"); err == nil {
+		t.Fatal("OpenPostgres succeeded against an unreachable database")
+	}
+	if d.Attempts() == 0 {
+		t.Error("OpenPostgres never tried to connect")
+	}
+}
+
+func TestOpenPostgresRequiresRolePassword(t *testing.T) {
+	name, d := registerFlakyDriver(t, 0)
+	cfg := &PostgreSQLConfig{Host: "localhost", Driver: name, Username: "postgres", Password: "superuser"}
+
+	_, err := OpenPostgres(context.Background(), cfg, "crm")
+	if err == nil || err.Error() != "postgresql app role _app of crm has no password; set POSTGRES_CRM_APP_PASSWORD" {
+		t.Errorf("err = %v, want the missing app role password reported", err)
+	}
+	if d.Attempts() != 0 {
+		t.Errorf("attempts = %d, want no connection without credentials", d.Attempts())
+	}
+}
+
+func TestPublishPoolStatsReplacesPool(t *testing.T) {
+	name, _ := registerFlakyDriver(t, 0)
+	first, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.SetMaxOpenConns(1)
+	PublishPoolStats("test.reconnect", first)
+	first.Close()
+
+	second, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	second.SetMaxOpenConns(7)
+	PublishPoolStats("test.reconnect", second)
+
+	if got := publishedPools(t)["test.reconnect"].MaxOpenConnections; got != 7 {
+		t.Errorf("MaxOpenConnections = %d, want 7 from the replacement pool", got)
+	}
+
+	UnpublishPoolStats("test.reconnect")
+	if _, ok := publishedPools(t)["test.reconnect"]; ok {
+		t.Error("test.reconnect is still published after UnpublishPoolStats")
+	}
+}
+
+func TestOpenPostgresAsOnlyPublishesAppPools(t *testing.T) {
+	name, _ := registerFlakyDriver(t, 0)
+	cfg := &PostgreSQLConfig{
+		Host:   "localhost",
+		Driver: name,
+		Retry:  PostgreSQLRetryConfig{InitialInterval: 1, MaxInterval: 2, MaxElapsedTime: 5000},
+		Roles:  rolePasswords("publish_owner", "publish_app"),
+	}
+
+	owner, err := OpenPostgresAs(context.Background(), cfg, "publish_owner", PostgreSQLRoleOwner)
+	if err != nil {
+		t.Fatalf("OpenPostgresAs owner: %v", err)
+	}
+	owner.Close()
+	app, err := OpenPostgres(context.Background(), cfg, "publish_app")
+	if err != nil {
+		t.Fatalf("OpenPostgres: %v", err)
+	}
+	defer app.Close()
+	defer UnpublishPoolStats("postgres.publish_app")
+
+	stats := publishedPools(t)
+	if _, ok := stats["postgres.publish_owner"]; ok {
+		t.Error("owner pool was published")
+	}
+	if _, ok := stats["postgres.publish_app"]; !ok {
+		t.Error("app pool was not published")
+	}
+}
@@ -0,0 +1,493 @@
+package sharedconfig
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// QdrantCollectionSpec declares how a collection should be provisioned. Either
+// Vector (a single unnamed vector) or Vectors (named vectors) is used; unset
+// sizes and distances fall back to the global QdrantConfig.Vector.
+//
+// When Version is set the collection is created as <name>_v<version> and the
+// configured name becomes an alias, so a new embedding model can be rolled out
+// into a fresh collection and switched over with SwitchCollectionAlias.
+type QdrantCollectionSpec struct {
+	Vector         QdrantVectorConfig            `yaml:"vector"`
+	Vectors        map[string]QdrantVectorConfig `yaml:"vectors"`
+	HNSW           QdrantHNSWConfig              `yaml:"hnsw"`
+	Optimizers     QdrantOptimizersConfig        `yaml:"optimizers"`
+	PayloadIndexes map[string]string             `yaml:"payload_indexes"`
+	Version        int                           `yaml:"version"`
+}
+
+type QdrantHNSWConfig struct {
+	M                 int  `yaml:"m" json:"m,omitempty"`
+	EfConstruct       int  `yaml:"ef_construct" json:"ef_construct,omitempty"`
+	FullScanThreshold int  `yaml:"full_scan_threshold" json:"full_scan_threshold,omitempty"`
+	OnDisk            bool `yaml:"on_disk" json:"on_disk,omitempty"`
+}
+
+type QdrantOptimizersConfig struct {
+	IndexingThreshold    int `yaml:"indexing_threshold" json:"indexing_threshold,omitempty"`
+	MemmapThreshold      int `yaml:"memmap_threshold" json:"memmap_threshold,omitempty"`
+	DefaultSegmentNumber int `yaml:"default_segment_number" json:"default_segment_number,omitempty"`
+}
+
+// Collection actions reported by EnsureCollections
+const (
+	CollectionActionOK       = "ok"
+	CollectionActionCreate   = "create"
+	CollectionActionDrift    = "drift"
+	CollectionActionMismatch = "mismatch"
+)
+
+// CollectionResult describes what EnsureCollections did or would do for one collection
+type CollectionResult struct {
+	Purpose    string   `json:"purpose"`
+	Collection string   `json:"collection"`
+	Alias      string   `json:"alias,omitempty"`
+	Action     string   `json:"action"`
+	Details    []string `json:"details,omitempty"`
+}
+
+// QdrantClient is a minimal client for the Qdrant HTTP API
+type QdrantClient struct {
+	BaseURL    string
+	APIKey     string
+	HTTPClient *http.Client
+}
+
+// NewQdrantClient returns a client for the configured Qdrant HTTP endpoint
+func NewQdrantClient(cfg *QdrantConfig) (*QdrantClient, error) {
+	httpClient := http.DefaultClient
+	if cfg.TLS.IsEnabled() {
+		tlsConfig, err := cfg.TLS.ToStdTLS()
+		if err != nil {
+			return nil, fmt.Errorf("invalid qdrant tls config: %w", err)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		httpClient = &http.Client{Transport: transport}
+	}
+
+	return &QdrantClient{
+		BaseURL:    cfg.GetHTTPURL(),
+		APIKey:     cfg.APIKey,
+		HTTPClient: httpClient,
+	}, nil
+}
+
+// QdrantError is returned for non-2xx responses from Qdrant
+type QdrantError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *QdrantError) Error() string {
+	return fmt.Sprintf("qdrant returned %d: %s", e.StatusCode, e.Body)
+}
+
+func (c *QdrantClient) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(c.BaseURL, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("api-key", c.APIKey)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &QdrantError{StatusCode: resp.StatusCode, Body: string(data)}
+	}
+	if out != nil {
+		return json.Unmarshal(data, &struct {
+			Result interface{} `json:"result"`
+		}{out})
+	}
+	return nil
+}
+
+// qdrantCollectionInfo is the subset of GET /collections/{name} we inspect
+type qdrantCollectionInfo struct {
+	Config struct {
+		Params struct {
+			Vectors json.RawMessage `json:"vectors"`
+		} `json:"params"`
+		HNSWConfig      QdrantHNSWConfig       `json:"hnsw_config"`
+		OptimizerConfig QdrantOptimizersConfig `json:"optimizer_config"`
+	} `json:"config"`
+	PayloadSchema map[string]struct {
+		DataType string `json:"data_type"`
+	} `json:"payload_schema"`
+}
+
+// vectors returns the collection's vector params keyed by name; an unnamed
+// vector is returned under the empty name
+func (i *qdrantCollectionInfo) vectors() (map[string]QdrantVectorConfig, error) {
+	var single QdrantVectorConfig
+	if err := json.Unmarshal(i.Config.Params.Vectors, &single); err == nil && single.Size > 0 {
+		return map[string]QdrantVectorConfig{"": single}, nil
+	}
+	var named map[string]QdrantVectorConfig
+	if err := json.Unmarshal(i.Config.Params.Vectors, &named); err != nil {
+		return nil, fmt.Errorf("error decoding vector params: %w", err)
+	}
+	return named, nil
+}
+
+// getCollection returns the collection info, or nil if it does not exist
+func (c *QdrantClient) getCollection(ctx context.Context, name string) (*qdrantCollectionInfo, error) {
+	var info qdrantCollectionInfo
+	if err := c.do(ctx, http.MethodGet, collectionPath(name), nil, &info); err != nil {
+		if qerr, ok := err.(*QdrantError); ok && qerr.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &info, nil
+}
+
+// getAliases returns every alias mapped to its collection
+func (c *QdrantClient) getAliases(ctx context.Context) (map[string]string, error) {
+	var result struct {
+		Aliases []struct {
+			AliasName      string `json:"alias_name"`
+			CollectionName string `json:"collection_name"`
+		} `json:"aliases"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/aliases", nil, &result); err != nil {
+		return nil, err
+	}
+	aliases := make(map[string]string, len(result.Aliases))
+	for _, a := range result.Aliases {
+		aliases[a.AliasName] = a.CollectionName
+	}
+	return aliases, nil
+}
+
+// setAlias points alias at collection. An existing alias is replaced in the
+// same request, so the switch is atomic; Qdrant rejects deleting an alias that
+// does not exist, so exists must tell whether there is one.
+func (c *QdrantClient) setAlias(ctx context.Context, alias, collection string, exists bool) error {
+	var actions []map[string]interface{}
+	if exists {
+		actions = append(actions, map[string]interface{}{"delete_alias": map[string]string{"alias_name": alias}})
+	}
+	actions = append(actions, map[string]interface{}{"create_alias": map[string]string{"alias_name": alias, "collection_name": collection}})
+	return c.do(ctx, http.MethodPost, "/collections/aliases", map[string]interface{}{"actions": actions}, nil)
+}
+
+// collectionPath returns the API path of a collection with its name escaped
+func collectionPath(name string) string {
+	return "/collections/" + url.PathEscape(name)
+}
+
+// GetCollectionSpec returns the spec for a purpose with vector params resolved
+// against the global vector config. Vector names map to their params; the
+// empty name stands for the single unnamed vector.
+func (q *QdrantConfig) GetCollectionSpec(purpose string) (QdrantCollectionSpec, map[string]QdrantVectorConfig) {
+	spec := q.CollectionSpecs[purpose]
+	resolve := func(v QdrantVectorConfig) QdrantVectorConfig {
+		if v.Size <= 0 {
+			v.Size = q.Vector.Size
+		}
+		if v.Distance == "" {
+			v.Distance = q.Vector.Distance
+		}
+		if v.Distance == "" {
+			v.Distance = "Cosine"
+		}
+		v.Distance = normalizeDistance(v.Distance)
+		return v
+	}
+
+	vectors := make(map[string]QdrantVectorConfig)
+	if len(spec.Vectors) > 0 {
+		for name, v := range spec.Vectors {
+			vectors[name] = resolve(v)
+		}
+	} else {
+		vectors[""] = resolve(spec.Vector)
+	}
+	return spec, vectors
+}
+
+// GetPhysicalCollectionName returns the concrete collection backing a purpose:
+// the versioned name when the spec has a version, the configured name otherwise
+func (q *QdrantConfig) GetPhysicalCollectionName(purpose string) string {
+	name := q.Collections.GetCollectionName(purpose)
+	if version := q.CollectionSpecs[purpose].Version; version > 0 {
+		return fmt.Sprintf("%s_v%d", name, version)
+	}
+	return name
+}
+
+// EnsureCollections creates missing collections, payload indexes and aliases
+// and reports vector size/distance mismatches and HNSW/optimizer and payload
+// index type drift on existing collections. An alias that already points at
+// another collection is left alone so search keeps working until
+// SwitchCollectionAlias is called after re-embedding. With dryRun set nothing
+// is changed.
+func EnsureCollections(ctx context.Context, client *QdrantClient, cfg *QdrantConfig, dryRun bool) ([]CollectionResult, error) {
+	aliases, err := client.getAliases(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing qdrant aliases: %w", err)
+	}
+
+	collections := cfg.Collections.fields()
+	purposes := make([]string, 0, len(collections))
+	for purpose, name := range collections {
+		if *name != "" {
+			purposes = append(purposes, purpose)
+		}
+	}
+	sort.Strings(purposes)
+
+	var results []CollectionResult
+	for _, purpose := range purposes {
+		result, err := ensureCollection(ctx, client, cfg, purpose, aliases, dryRun)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func ensureCollection(ctx context.Context, client *QdrantClient, cfg *QdrantConfig, purpose string, aliases map[string]string, dryRun bool) (CollectionResult, error) {
+	spec, vectors := cfg.GetCollectionSpec(purpose)
+	name := cfg.GetPhysicalCollectionName(purpose)
+	result := CollectionResult{Purpose: purpose, Collection: name, Action: CollectionActionOK}
+	if spec.Version > 0 {
+		result.Alias = cfg.Collections.GetCollectionName(purpose)
+	}
+
+	info, err := client.getCollection(ctx, name)
+	if err != nil {
+		return result, fmt.Errorf("error reading qdrant collection %s: %w", name, err)
+	}
+
+	if info == nil {
+		result.Action = CollectionActionCreate
+		if !dryRun {
+			if err := client.do(ctx, http.MethodPut, collectionPath(name), collectionBody(spec, vectors), nil); err != nil {
+				return result, fmt.Errorf("error creating qdrant collection %s: %w", name, err)
+			}
+		}
+	} else {
+		actual, err := info.vectors()
+		if err != nil {
+			return result, fmt.Errorf("qdrant collection %s: %w", name, err)
+		}
+		if mismatch := vectorMismatch(vectors, actual); len(mismatch) > 0 {
+			result.Action = CollectionActionMismatch
+			result.Details = mismatch
+			return result, nil
+		}
+		drift := indexDrift(spec, info)
+		drift = append(drift, payloadIndexDrift(spec, info)...)
+		if len(drift) > 0 {
+			result.Action = CollectionActionDrift
+			result.Details = drift
+		}
+	}
+
+	fields := make([]string, 0, len(spec.PayloadIndexes))
+	for field := range spec.PayloadIndexes {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		if info != nil {
+			if _, ok := info.PayloadSchema[field]; ok {
+				continue
+			}
+		}
+		result.Details = append(result.Details, fmt.Sprintf("create payload index %s (%s)", field, spec.PayloadIndexes[field]))
+		if !dryRun {
+			body := map[string]string{"field_name": field, "field_schema": spec.PayloadIndexes[field]}
+			if err := client.do(ctx, http.MethodPut, collectionPath(name)+"/index", body, nil); err != nil {
+				return result, fmt.Errorf("error creating payload index %s on %s: %w", field, name, err)
+			}
+		}
+	}
+
+	if result.Alias != "" {
+		switch current, ok := aliases[result.Alias]; {
+		case !ok:
+			result.Details = append(result.Details, fmt.Sprintf("create alias %s -> %s", result.Alias, name))
+			if !dryRun {
+				if err := client.setAlias(ctx, result.Alias, name, false); err != nil {
+					return result, fmt.Errorf("error creating alias %s: %w", result.Alias, err)
+				}
+			}
+		case current != name:
+			result.Details = append(result.Details, fmt.Sprintf("alias %s still points to %s; switch once %s is populated", result.Alias, current, name))
+		}
+	}
+
+	return result, nil
+}
+
+// SwitchCollectionAlias points a purpose's alias at its current versioned
+// collection. Run it after the new collection has been fully re-embedded.
+func SwitchCollectionAlias(ctx context.Context, client *QdrantClient, cfg *QdrantConfig, purpose string) error {
+	if cfg.CollectionSpecs[purpose].Version <= 0 {
+		return fmt.Errorf("qdrant collection %s is not versioned", purpose)
+	}
+	aliases, err := client.getAliases(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing qdrant aliases: %w", err)
+	}
+	alias := cfg.Collections.GetCollectionName(purpose)
+	_, exists := aliases[alias]
+	return client.setAlias(ctx, alias, cfg.GetPhysicalCollectionName(purpose), exists)
+}
+
+// collectionBody builds the PUT /collections/{name} request body
+func collectionBody(spec QdrantCollectionSpec, vectors map[string]QdrantVectorConfig) map[string]interface{} {
+	body := map[string]interface{}{}
+	if v, ok := vectors[""]; ok && len(vectors) == 1 {
+		body["vectors"] = v
+	} else {
+		body["vectors"] = vectors
+	}
+	if spec.HNSW != (QdrantHNSWConfig{}) {
+		body["hnsw_config"] = spec.HNSW
+	}
+	if spec.Optimizers != (QdrantOptimizersConfig{}) {
+		body["optimizers_config"] = spec.Optimizers
+	}
+	return body
+}
+
+// vectorMismatch lists vector params that differ between the spec and an
+// existing collection. These cannot be changed in place and would corrupt
+// search results if ignored.
+func vectorMismatch(want, have map[string]QdrantVectorConfig) []string {
+	var mismatch []string
+	names := make([]string, 0, len(want))
+	for name := range want {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		label := name
+		if label == "" {
+			label = "default vector"
+		}
+		h, ok := have[name]
+		if !ok {
+			mismatch = append(mismatch, fmt.Sprintf("%s: missing", label))
+			continue
+		}
+		if h.Size != want[name].Size {
+			mismatch = append(mismatch, fmt.Sprintf("%s: size want %d, have %d", label, want[name].Size, h.Size))
+		}
+		if normalizeDistance(h.Distance) != want[name].Distance {
+			mismatch = append(mismatch, fmt.Sprintf("%s: distance want %s, have %s", label, want[name].Distance, h.Distance))
+		}
+	}
+	for name := range have {
+		if _, ok := want[name]; !ok {
+			mismatch = append(mismatch, fmt.Sprintf("%s: not declared in config", name))
+		}
+	}
+	return mismatch
+}
+
+// indexDrift lists HNSW and optimizer settings that differ from the spec.
+// Only settings the spec sets are compared.
+func indexDrift(spec QdrantCollectionSpec, info *qdrantCollectionInfo) []string {
+	var drift []string
+	check := func(label string, want, have int) {
+		if want > 0 && want != have {
+			drift = append(drift, fmt.Sprintf("%s: want %d, have %d", label, want, have))
+		}
+	}
+	check("hnsw.m", spec.HNSW.M, info.Config.HNSWConfig.M)
+	check("hnsw.ef_construct", spec.HNSW.EfConstruct, info.Config.HNSWConfig.EfConstruct)
+	check("hnsw.full_scan_threshold", spec.HNSW.FullScanThreshold, info.Config.HNSWConfig.FullScanThreshold)
+	check("optimizers.indexing_threshold", spec.Optimizers.IndexingThreshold, info.Config.OptimizerConfig.IndexingThreshold)
+	check("optimizers.memmap_threshold", spec.Optimizers.MemmapThreshold, info.Config.OptimizerConfig.MemmapThreshold)
+	check("optimizers.default_segment_number", spec.Optimizers.DefaultSegmentNumber, info.Config.OptimizerConfig.DefaultSegmentNumber)
+	return drift
+}
+
+// payloadIndexDrift lists payload indexes whose type differs from the spec.
+// Qdrant keeps the old index when asked for a new type, so these need the
+// index dropped and recreated by hand.
+func payloadIndexDrift(spec QdrantCollectionSpec, info *qdrantCollectionInfo) []string {
+	var drift []string
+	fields := make([]string, 0, len(spec.PayloadIndexes))
+	for field := range spec.PayloadIndexes {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		have, ok := info.PayloadSchema[field]
+		if ok && !strings.EqualFold(have.DataType, spec.PayloadIndexes[field]) {
+			drift = append(drift, fmt.Sprintf("payload index %s: want %s, have %s", field, spec.PayloadIndexes[field], have.DataType))
+		}
+	}
+	return drift
+}
+
+// normalizeDistance maps distance names to the casing Qdrant uses
+func normalizeDistance(distance string) string {
+	switch strings.ToLower(distance) {
+	case "cosine":
+		return "Cosine"
+	case "euclid", "euclidean":
+		return "Euclid"
+	case "dot":
+		return "Dot"
+	case "manhattan":
+		return "Manhattan"
+	default:
+		return distance
+	}
+}
+
+// WriteCollectionReport prints EnsureCollections results as a plain-text table
+func WriteCollectionReport(w io.Writer, results []CollectionResult, dryRun bool) {
+	for _, r := range results {
+		action := r.Action
+		if dryRun && action == CollectionActionCreate {
+			action = "would create"
+		}
+		fmt.Fprintf(w, "%-14s %-40s %s\n", action, r.Collection, r.Purpose)
+		for _, d := range r.Details {
+			fmt.Fprintf(w, "%14s   - %s\n", "", d)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package sharedconfig
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type fakeQdrantCollection struct {
+	vectors interface{}
+	hnsw    QdrantHNSWConfig
+	payload map[string]string // field -> data type
+}
+
+// fakeQdrant is an in-memory stand-in for the collection, payload index and
+// alias endpoints EnsureCollections uses. Like Qdrant it rejects deleting an
+// alias that does not exist.
+type fakeQdrant struct {
+	mu          sync.Mutex
+	collections map[string]*fakeQdrantCollection
+	aliases     map[string]string // alias -> collection
+	requests    []string
+	aliasOps    [][]string
+}
+
+func newFakeQdrant(t *testing.T) (*fakeQdrant, *QdrantClient) {
+	q := &fakeQdrant{collections: map[string]*fakeQdrantCollection{}, aliases: map[string]string{}}
+	srv := httptest.NewServer(q)
+	t.Cleanup(srv.Close)
+	return q, &QdrantClient{BaseURL: srv.URL, APIKey: "qdrant-key", HTTPClient: srv.Client()}
+}
+
+func (q *fakeQdrant) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.requests = append(q.requests, r.Method+" "+r.URL.EscapedPath())
+
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	reply := func(status int, result interface{}) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": result})
+	}
+	if r.Header.Get("api-key") != "qdrant-key" {
+		reply(http.StatusUnauthorized, nil)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/collections/")
+	name, sub, _ := strings.Cut(path, "/")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/aliases":
+		var aliases []map[string]string
+		for alias, collection := range q.aliases {
+			aliases = append(aliases, map[string]string{"alias_name": alias, "collection_name": collection})
+		}
+		reply(http.StatusOK, map[string]interface{}{"aliases": aliases})
+
+	case r.Method == http.MethodPost && r.URL.Path == "/collections/aliases":
+		var ops []string
+		for _, a := range body["actions"].([]interface{}) {
+			for op, args := range a.(map[string]interface{}) {
+				args := args.(map[string]interface{})
+				alias := args["alias_name"].(string)
+				ops = append(ops, op+" "+alias)
+				if op == "delete_alias" {
+					if _, ok := q.aliases[alias]; !ok {
+						reply(http.StatusNotFound, "Alias "+alias+" does not exists!")
+						return
+					}
+					delete(q.aliases, alias)
+				} else {
+					q.aliases[alias] = args["collection_name"].(string)
+				}
+			}
+		}
+		q.aliasOps = append(q.aliasOps, ops)
+		reply(http.StatusOK, true)
+
+	case r.Method == http.MethodGet && sub == "":
+		c, ok := q.collections[name]
+		if !ok {
+			reply(http.StatusNotFound, nil)
+			return
+		}
+		schema := map[string]interface{}{}
+		for field, dataType := range c.payload {
+			schema[field] = map[string]string{"data_type": dataType}
+		}
+		reply(http.StatusOK, map[string]interface{}{
+			"config":         map[string]interface{}{"params": map[string]interface{}{"vectors": c.vectors}, "hnsw_config": c.hnsw},
+			"payload_schema": schema,
+		})
+
+	case r.Method == http.MethodPut && sub == "":
+		data, _ := json.Marshal(body["hnsw_config"])
+		c := &fakeQdrantCollection{vectors: body["vectors"], payload: map[string]string{}}
+		json.Unmarshal(data, &c.hnsw)
+		q.collections[name] = c
+		reply(http.StatusOK, true)
+
+	case r.Method == http.MethodPut && sub == "index":
+		q.collections[name].payload[body["field_name"].(string)] = body["field_schema"].(string)
+		reply(http.StatusOK, true)
+
+	default:
+		reply(http.StatusNotFound, nil)
+	}
+}
+
+func testQdrantConfig(version int) *QdrantConfig {
+	return &QdrantConfig{
+		Vector:      QdrantVectorConfig{Size: 384, Distance: "cosine"},
+		Collections: QdrantCollectionsConfig{Documents: "erp documents"},
+		CollectionSpecs: map[string]QdrantCollectionSpec{
+			"documents": {
+				HNSW:           QdrantHNSWConfig{M: 16},
+				PayloadIndexes: map[string]string{"tenant_id": "keyword", "created_at": "datetime"},
+				Version:        version,
+			},
+		},
+	}
+}
+
+func TestEnsureCollectionsCreates(t *testing.T) {
+	q, client := newFakeQdrant(t)
+
+	results, err := EnsureCollections(context.Background(), client, testQdrantConfig(2), false)
+	if err != nil {
+		t.Fatalf("EnsureCollections: %v", err)
+	}
+	if len(results) != 1 || results[0].Action != CollectionActionCreate || results[0].Collection != "erp documents_v2" || results[0].Alias != "erp documents" {
+		t.Fatalf("results = %+v", results)
+	}
+
+	wantRequests := []string{
+		"GET /aliases",
+		"GET /collections/erp%20documents_v2",
+		"PUT /collections/erp%20documents_v2",
+		"PUT /collections/erp%20documents_v2/index",
+		"PUT /collections/erp%20documents_v2/index",
+		"POST /collections/aliases",
+	}
+	if !reflect.DeepEqual(q.requests, wantRequests) {
+		t.Errorf("requests =\n%s\nwant\n%s", strings.Join(q.requests, "\n"), strings.Join(wantRequests, "\n"))
+	}
+	if want := [][]string{{"create_alias erp documents"}}; !reflect.DeepEqual(q.aliasOps, want) {
+		t.Errorf("alias actions = %v, want %v: a new alias must not be deleted first", q.aliasOps, want)
+	}
+	c := q.collections["erp documents_v2"]
+	if c.hnsw.M != 16 || c.payload["tenant_id"] != "keyword" || c.payload["created_at"] != "datetime" {
+		t.Errorf("created collection = %+v", c)
+	}
+
+	results, err = EnsureCollections(context.Background(), client, testQdrantConfig(2), false)
+	if err != nil {
+		t.Fatalf("second EnsureCollections: %v", err)
+	}
+	if results[0].Action != CollectionActionOK || len(results[0].Details) != 0 {
+		t.Errorf("second run = %+v, want ok", results[0])
+	}
+}
+
+func TestEnsureCollectionsReportsDrift(t *testing.T) {
+	q, client := newFakeQdrant(t)
+	q.collections["erp documents"] = &fakeQdrantCollection{
+		vectors: map[string]interface{}{"size": 384, "distance": "Cosine"},
+		hnsw:    QdrantHNSWConfig{M: 32},
+		payload: map[string]string{"tenant_id": "integer"},
+	}
+
+	results, err := EnsureCollections(context.Background(), client, testQdrantConfig(0), true)
+	if err != nil {
+		t.Fatalf("EnsureCollections: %v", err)
+	}
+	want := []string{
+		"hnsw.m: want 16, have 32",
+		"payload index tenant_id: want keyword, have integer",
+		"create payload index created_at (datetime)",
+	}
+	if results[0].Action != CollectionActionDrift || !reflect.DeepEqual(results[0].Details, want) {
+		t.Errorf("result = %s %v, want drift %v", results[0].Action, results[0].Details, want)
+	}
+	for _, r := range q.requests {
+		if !strings.HasPrefix(r, "GET ") {
+			t.Errorf("dry run sent %s", r)
+		}
+	}
+}
+
+func TestEnsureCollectionsReportsVectorMismatch(t *testing.T) {
+	q, client := newFakeQdrant(t)
+	q.collections["erp documents"] = &fakeQdrantCollection{
+		vectors: map[string]interface{}{"size": 768, "distance": "Dot"},
+		payload: map[string]string{},
+	}
+
+	results, err := EnsureCollections(context.Background(), client, testQdrantConfig(0), false)
+	if err != nil {
+		t.Fatalf("EnsureCollections: %v", err)
+	}
+	want := []string{"default vector: size want 384, have 768", "default vector: distance want Cosine, have Dot"}
+	if results[0].Action != CollectionActionMismatch || !reflect.DeepEqual(results[0].Details, want) {
+		t.Errorf("result = %s %v, want mismatch %v", results[0].Action, results[0].Details, want)
+	}
+	if len(q.collections["erp documents"].payload) != 0 {
+		t.Error("payload indexes were created on a mismatched collection")
+	}
+}
+
+func TestSwitchCollectionAlias(t *testing.T) {
+	q, client := newFakeQdrant(t)
+	q.aliases["erp documents"] = "erp documents_v1"
+
+	if err := SwitchCollectionAlias(context.Background(), client, testQdrantConfig(2), "documents"); err != nil {
+		t.Fatalf("SwitchCollectionAlias: %v", err)
+	}
+	if got := q.aliases["erp documents"]; got != "erp documents_v2" {
+		t.Errorf("alias points to %s", got)
+	}
+	if want := [][]string{{"delete_alias erp documents", "create_alias erp documents"}}; !reflect.DeepEqual(q.aliasOps, want) {
+		t.Errorf("alias actions = %v, want %v in one request", q.aliasOps, want)
+	}
+
+	delete(q.aliases, "erp documents")
+	if err := SwitchCollectionAlias(context.Background(), client, testQdrantConfig(2), "documents"); err != nil {
+		t.Errorf("SwitchCollectionAlias without an alias: %v", err)
+	}
+	if err := SwitchCollectionAlias(context.Background(), client, testQdrantConfig(0), "documents"); err == nil {
+		t.Error("SwitchCollectionAlias accepted an unversioned collection")
+	}
+}
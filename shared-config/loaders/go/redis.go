@@ -0,0 +1,79 @@
+package sharedconfig
+
+import (
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// GetClientOptions returns go-redis options for the given purpose (default,
+// sessions, queues, websocket, cache) with the RedisPoolConfig timeouts applied.
+// In cluster mode the database is always 0 and keys are isolated by GetKeyPrefix.
+func (r *RedisConfig) GetClientOptions(purpose string) (*redis.UniversalOptions, error) {
+	opts := &redis.UniversalOptions{
+		Username:        r.Username,
+		Password:        r.Password,
+		DB:              r.getDatabaseNumber(purpose),
+		DialTimeout:     r.Pool.GetDialTimeout(),
+		ReadTimeout:     r.Pool.GetReadTimeout(),
+		WriteTimeout:    r.Pool.GetWriteTimeout(),
+		ConnMaxIdleTime: r.Pool.GetIdleTimeout(),
+		PoolSize:        r.Pool.MaxActive,
+		MaxIdleConns:    r.Pool.MaxIdle,
+	}
+
+	if r.UseTLS() {
+		tlsConfig, err := r.TLS.ToStdTLS()
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis tls config: %w", err)
+		}
+		opts.TLSConfig = tlsConfig
+	}
+
+	switch r.GetMode() {
+	case RedisModeStandalone:
+		opts.Addrs = []string{r.GetAddress()}
+	case RedisModeSentinel:
+		if r.Sentinel.MasterName == "" || len(r.Sentinel.Addresses) == 0 {
+			return nil, fmt.Errorf("redis sentinel mode requires sentinel.master_name and sentinel.addresses")
+		}
+		opts.MasterName = r.Sentinel.MasterName
+		opts.Addrs = r.Sentinel.Addresses
+		opts.SentinelUsername = r.Sentinel.Username
+		opts.SentinelPassword = r.Sentinel.Password
+	case RedisModeCluster:
+		if len(r.Cluster.Nodes) == 0 {
+			return nil, fmt.Errorf("redis cluster mode requires cluster.nodes")
+		}
+		opts.Addrs = r.Cluster.Nodes
+	default:
+		return nil, fmt.Errorf("unknown redis mode %q", r.Mode)
+	}
+
+	return opts, nil
+}
+
+// NewRedisClient returns a client for the given purpose using the topology
+// selected by Mode. When the purpose has a key prefix, every command the client
+// sends is rewritten to use it.
+func NewRedisClient(cfg *RedisConfig, purpose string) (redis.UniversalClient, error) {
+	opts, err := cfg.GetClientOptions(purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	var client redis.UniversalClient
+	switch cfg.GetMode() {
+	case RedisModeSentinel:
+		client = redis.NewFailoverClient(opts.Failover())
+	case RedisModeCluster:
+		client = redis.NewClusterClient(opts.Cluster())
+	default:
+		client = redis.NewClient(opts.Simple())
+	}
+
+	if prefix := cfg.GetKeyPrefix(purpose); prefix != "" {
+		client.AddHook(keyPrefixHook{prefix: prefix})
+	}
+	return client, nil
+}
@@ -0,0 +1,180 @@
+package sharedconfig
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// keyPrefixHook namespaces every key a command touches with a fixed prefix so
+// purposes sharing one cluster database cannot collide. KEYS and SCAN MATCH
+// patterns are prefixed too, and the prefix is stripped from their replies.
+type keyPrefixHook struct {
+	prefix string
+}
+
+// keylessCommands never take a key, so their first argument is left alone
+var keylessCommands = map[string]bool{
+	"acl": true, "auth": true, "bgrewriteaof": true, "bgsave": true, "client": true,
+	"cluster": true, "command": true, "config": true, "dbsize": true, "debug": true,
+	"discard": true, "echo": true, "exec": true, "flushall": true, "flushdb": true,
+	"function": true, "hello": true, "info": true, "lastsave": true, "multi": true,
+	"ping": true, "publish": true, "pubsub": true, "quit": true, "randomkey": true,
+	"readonly": true, "readwrite": true, "role": true, "save": true, "script": true,
+	"select": true, "slowlog": true, "spublish": true, "swapdb": true, "time": true,
+	"unwatch": true, "wait": true,
+}
+
+func (h keyPrefixHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h keyPrefixHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		h.prefixArgs(cmd)
+		err := next(ctx, cmd)
+		h.stripReply(cmd)
+		return err
+	}
+}
+
+func (h keyPrefixHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			h.prefixArgs(cmd)
+		}
+		err := next(ctx, cmds)
+		for _, cmd := range cmds {
+			h.stripReply(cmd)
+		}
+		return err
+	}
+}
+
+// prefixArgs rewrites the key arguments of cmd in place
+func (h keyPrefixHook) prefixArgs(cmd redis.Cmder) {
+	args := cmd.Args()
+	for _, i := range keyPositions(strings.ToLower(cmd.Name()), args) {
+		args[i] = h.prefix + argString(args[i])
+	}
+}
+
+// stripReply removes the prefix from key names returned by KEYS and SCAN
+func (h keyPrefixHook) stripReply(cmd redis.Cmder) {
+	if cmd.Err() != nil {
+		return
+	}
+	switch c := cmd.(type) {
+	case *redis.StringSliceCmd:
+		if strings.EqualFold(c.Name(), "keys") {
+			c.SetVal(h.stripKeys(c.Val()))
+		}
+	case *redis.ScanCmd:
+		if strings.EqualFold(c.Name(), "scan") {
+			keys, cursor := c.Val()
+			c.SetVal(h.stripKeys(keys), cursor)
+		}
+	}
+}
+
+func (h keyPrefixHook) stripKeys(keys []string) []string {
+	out := keys[:0]
+	for _, k := range keys {
+		if strings.HasPrefix(k, h.prefix) {
+			out = append(out, strings.TrimPrefix(k, h.prefix))
+		}
+	}
+	return out
+}
+
+// keyPositions returns the indexes of the key arguments of a command
+func keyPositions(name string, args []interface{}) []int {
+	n := len(args)
+	if n < 2 || keylessCommands[name] {
+		return nil
+	}
+
+	switch name {
+	case "del", "unlink", "exists", "touch", "mget", "watch",
+		"sinter", "sunion", "sdiff", "sinterstore", "sunionstore", "sdiffstore",
+		"pfcount", "pfmerge":
+		return span(1, n)
+	case "mset", "msetnx":
+		var pos []int
+		for i := 1; i < n; i += 2 {
+			pos = append(pos, i)
+		}
+		return pos
+	case "rename", "renamenx", "rpoplpush", "brpoplpush", "smove", "lmove", "blmove", "copy":
+		return span(1, min(3, n))
+	case "blpop", "brpop", "bzpopmin", "bzpopmax":
+		return span(1, n-1)
+	case "eval", "evalsha", "eval_ro", "evalsha_ro", "fcall", "fcall_ro":
+		return numkeysSpan(args, 2)
+	case "zunion", "zinter", "zdiff", "sintercard", "zintercard", "lmpop", "zmpop":
+		return numkeysSpan(args, 1)
+	case "blmpop", "bzmpop":
+		return numkeysSpan(args, 2)
+	case "zunionstore", "zinterstore", "zdiffstore":
+		return append([]int{1}, numkeysSpan(args, 2)...)
+	case "object", "memory":
+		if n > 2 {
+			return []int{2}
+		}
+		return nil
+	case "xread", "xreadgroup":
+		for i := 1; i < n; i++ {
+			if strings.EqualFold(argString(args[i]), "streams") {
+				return span(i+1, i+1+(n-i-1)/2)
+			}
+		}
+		return nil
+	case "scan":
+		for i := 2; i < n-1; i++ {
+			if strings.EqualFold(argString(args[i]), "match") {
+				return []int{i + 1}
+			}
+		}
+		return nil
+	default:
+		return []int{1}
+	}
+}
+
+// numkeysSpan returns the key positions of a command whose key count is the
+// argument at index i and whose keys follow it
+func numkeysSpan(args []interface{}, i int) []int {
+	if i >= len(args) {
+		return nil
+	}
+	count, err := strconv.Atoi(argString(args[i]))
+	if err != nil {
+		return nil
+	}
+	return span(i+1, min(i+1+count, len(args)))
+}
+
+func span(from, to int) []int {
+	var pos []int
+	for i := from; i < to; i++ {
+		pos = append(pos, i)
+	}
+	return pos
+}
+
+func argString(arg interface{}) string {
+	switch v := arg.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,173 @@
+package sharedconfig
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// captureHook records the arguments of every command and answers it without
+// touching the network
+type captureHook struct {
+	args  [][]interface{}
+	reply func(redis.Cmder)
+}
+
+func (h *captureHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h *captureHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		h.args = append(h.args, append([]interface{}(nil), cmd.Args()...))
+		if h.reply != nil {
+			h.reply(cmd)
+		}
+		return nil
+	}
+}
+
+func (h *captureHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			h.args = append(h.args, append([]interface{}(nil), cmd.Args()...))
+		}
+		return nil
+	}
+}
+
+func clusterConfig() *RedisConfig {
+	return &RedisConfig{
+		Mode:     RedisModeCluster,
+		Password: "secret",
+		Cluster:  RedisClusterConfig{Nodes: []string{"redis-1:6379", "redis-2:6379", "redis-3:6379"}},
+	}
+}
+
+func TestNewRedisClientPrefixesKeysInClusterMode(t *testing.T) {
+	client, err := NewRedisClient(clusterConfig(), "sessions")
+	if err != nil {
+		t.Fatalf("NewRedisClient: %v", err)
+	}
+	defer client.Close()
+	capture := &captureHook{}
+	client.AddHook(capture)
+
+	ctx := context.Background()
+	client.Set(ctx, "user:1", "v", 0)
+	client.Del(ctx, "a", "b")
+	client.MSet(ctx, "a", 1, "b", 2)
+	client.Eval(ctx, "return 1", []string{"k"}, "arg")
+	client.Ping(ctx)
+
+	want := [][]interface{}{
+		{"set", "sessions:user:1", "v"},
+		{"del", "sessions:a", "sessions:b"},
+		{"mset", "sessions:a", 1, "sessions:b", 2},
+		{"eval", "return 1", 1, "sessions:k", "arg"},
+		{"ping"},
+	}
+	if !reflect.DeepEqual(capture.args, want) {
+		t.Errorf("args = %v, want %v", capture.args, want)
+	}
+}
+
+func TestNewRedisClientPrefixesPipelines(t *testing.T) {
+	client, err := NewRedisClient(clusterConfig(), "cache")
+	if err != nil {
+		t.Fatalf("NewRedisClient: %v", err)
+	}
+	defer client.Close()
+	capture := &captureHook{}
+	client.AddHook(capture)
+
+	ctx := context.Background()
+	pipe := client.Pipeline()
+	pipe.Get(ctx, "a")
+	pipe.Incr(ctx, "b")
+	if _, err := pipe.Exec(ctx); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+
+	want := [][]interface{}{{"get", "cache:a"}, {"incr", "cache:b"}}
+	if !reflect.DeepEqual(capture.args, want) {
+		t.Errorf("args = %v, want %v", capture.args, want)
+	}
+}
+
+func TestNewRedisClientStripsPrefixFromKeys(t *testing.T) {
+	client, err := NewRedisClient(clusterConfig(), "queues")
+	if err != nil {
+		t.Fatalf("NewRedisClient: %v", err)
+	}
+	defer client.Close()
+	capture := &captureHook{reply: func(cmd redis.Cmder) {
+		if c, ok := cmd.(*redis.StringSliceCmd); ok {
+			c.SetVal([]string{"queues:jobs", "queues:retry"})
+		}
+	}}
+	client.AddHook(capture)
+
+	keys, err := client.Keys(context.Background(), "*").Result()
+	if err != nil {
+		t.Fatalf("Keys: %v", err)
+	}
+	if got := capture.args[0]; !reflect.DeepEqual(got, []interface{}{"keys", "queues:*"}) {
+		t.Errorf("args = %v", got)
+	}
+	if !reflect.DeepEqual(keys, []string{"jobs", "retry"}) {
+		t.Errorf("keys = %v, want unprefixed names", keys)
+	}
+}
+
+func TestNewRedisClientLeavesStandaloneKeysAlone(t *testing.T) {
+	cfg := &RedisConfig{Host: "localhost", Port: 6379, Databases: RedisDatabasesConfig{Sessions: 1}}
+	client, err := NewRedisClient(cfg, "sessions")
+	if err != nil {
+		t.Fatalf("NewRedisClient: %v", err)
+	}
+	defer client.Close()
+	capture := &captureHook{}
+	client.AddHook(capture)
+
+	client.Get(context.Background(), "user:1")
+	if got := capture.args[0]; !reflect.DeepEqual(got, []interface{}{"get", "user:1"}) {
+		t.Errorf("args = %v", got)
+	}
+}
+
+func TestRedisGetURL(t *testing.T) {
+	standalone := &RedisConfig{Host: "localhost", Port: 6379, Password: "secret", Databases: RedisDatabasesConfig{Cache: 4}}
+	if got := standalone.GetConnectionString("cache"); got != "redis://:secret@localhost:6379/4" {
+		t.Errorf("GetConnectionString = %q", got)
+	}
+	got, err := standalone.GetURL("cache")
+	if err != nil || got != "redis://:secret@localhost:6379/4" {
+		t.Errorf("standalone = %q, %v", got, err)
+	}
+
+	got, err = clusterConfig().GetURL("cache")
+	if err != nil {
+		t.Fatalf("cluster: %v", err)
+	}
+	opts, err := redis.ParseClusterURL(got)
+	if err != nil {
+		t.Fatalf("ParseClusterURL(%q): %v", got, err)
+	}
+	if want := clusterConfig().Cluster.Nodes; !reflect.DeepEqual(opts.Addrs, want) {
+		t.Errorf("cluster addrs = %v, want %v", opts.Addrs, want)
+	}
+	if opts.Password != "secret" {
+		t.Errorf("cluster password = %q", opts.Password)
+	}
+
+	sentinel := &RedisConfig{Mode: RedisModeSentinel, Sentinel: RedisSentinelConfig{MasterName: "mymaster", Addresses: []string{"s1:26379"}}}
+	if _, err := sentinel.GetURL("cache"); err == nil {
+		t.Error("sentinel mode returned a standalone connection string")
+	}
+}
@@ -0,0 +1,167 @@
+package sharedconfig
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// EncryptedPrefix marks a value encrypted with EncryptValue. Encrypted values
+// can be used anywhere a string is read, in config.yaml or in environment
+// variables, and are decrypted by Load.
+const EncryptedPrefix = "enc:v1:"
+
+// ConfigKey returns the AES-256 key that encrypts configuration values:
+// ERP_CONFIG_KEY, or the content of the file named by ERP_CONFIG_KEY_FILE,
+// base64 encoded (openssl rand -base64 32)
+func ConfigKey() ([]byte, error) {
+	encoded := os.Getenv("ERP_CONFIG_KEY")
+	if file := os.Getenv("ERP_CONFIG_KEY_FILE"); encoded == "" && file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading config key: %w", err)
+		}
+		encoded = string(data)
+	}
+	if encoded == "" {
+		return nil, errors.New("neither ERP_CONFIG_KEY nor ERP_CONFIG_KEY_FILE is set")
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding config key: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("config key is %d bytes, want 32", len(key))
+	}
+	return key, nil
+}
+
+// IsEncrypted reports whether value was produced by EncryptValue
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, EncryptedPrefix)
+}
+
+func configCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptValue encrypts plaintext with AES-256-GCM under key
+func EncryptValue(key []byte, plaintext string) (string, error) {
+	aead, err := configCipher(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return EncryptedPrefix + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptValue decrypts a value produced by EncryptValue
+func DecryptValue(key []byte, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return "", fmt.Errorf("value does not start with %s", EncryptedPrefix)
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(value, EncryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("error decoding encrypted value: %w", err)
+	}
+	aead, err := configCipher(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("encrypted value is truncated")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errors.New("encrypted value does not decrypt with the config key")
+	}
+	return string(plaintext), nil
+}
+
+// DecryptValues replaces every encrypted string of the configuration with
+// its plaintext. The key is only read when an encrypted value is found.
+func (c *Config) DecryptValues() error {
+	var key []byte
+	decrypt := func(path, value string) (string, error) {
+		if key == nil {
+			var err error
+			if key, err = ConfigKey(); err != nil {
+				return "", fmt.Errorf("%s is encrypted: %w", path, err)
+			}
+		}
+		plaintext, err := DecryptValue(key, value)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", path, err)
+		}
+		return plaintext, nil
+	}
+	return decryptValue(reflect.ValueOf(c).Elem(), "", decrypt)
+}
+
+// decryptValue walks v, which must be settable, and decrypts its strings
+func decryptValue(v reflect.Value, path string, decrypt func(path, value string) (string, error)) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return decryptValue(v.Elem(), path, decrypt)
+		}
+	case reflect.Interface:
+		if s, ok := v.Interface().(string); ok && IsEncrypted(s) {
+			plaintext, err := decrypt(path, s)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(plaintext))
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if f := t.Field(i); f.PkgPath == "" {
+				if err := decryptValue(v.Field(i), joinSettingPath(path, settingName(f)), decrypt); err != nil {
+					return err
+				}
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := decryptValue(v.Index(i), joinSettingPath(path, fmt.Sprint(i)), decrypt); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		// Map entries are not addressable: decrypt a copy and store it back
+		iter := v.MapRange()
+		for iter.Next() {
+			entry := reflect.New(v.Type().Elem()).Elem()
+			entry.Set(iter.Value())
+			if err := decryptValue(entry, joinSettingPath(path, fmt.Sprint(iter.Key())), decrypt); err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), entry)
+		}
+	case reflect.String:
+		if IsEncrypted(v.String()) {
+			plaintext, err := decrypt(path, v.String())
+			if err != nil {
+				return err
+			}
+			v.SetString(plaintext)
+		}
+	}
+	return nil
+}
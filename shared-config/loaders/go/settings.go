@@ -0,0 +1,392 @@
+package sharedconfig
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// RedactedValue replaces secret values in Redacted settings
+const RedactedValue = "********"
+
+// Setting is one leaf of the loaded configuration. Path is its YAML path,
+// e.g. database.postgresql.host; entries of lists such as modules are keyed
+// by their name. Field is the Go path of the setting in Config.
+type Setting struct {
+	Path   string      `json:"path"`
+	Field  string      `json:"-"`
+	Value  interface{} `json:"value"`
+	Secret bool        `json:"secret,omitempty"`
+}
+
+// Redacted returns the setting with a secret value replaced by RedactedValue
+func (s Setting) Redacted() Setting {
+	if s.Secret && s.Value != nil && s.Value != "" {
+		s.Value = RedactedValue
+	}
+	return s
+}
+
+var secretSettingNames = []string{"password", "secret", "token", "api_key", "key"}
+
+// isSecretSetting reports whether the setting at path holds a credential;
+// key_file and similar settings only name where one is stored
+func isSecretSetting(path string) bool {
+	name := path[strings.LastIndex(path, ".")+1:]
+	for _, secret := range secretSettingNames {
+		if name == secret || strings.HasSuffix(name, "_"+secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// settingName is the YAML key of a struct field
+func settingName(f reflect.StructField) string {
+	if name := strings.Split(f.Tag.Get("yaml"), ",")[0]; name != "" {
+		return name
+	}
+	return strings.ToLower(f.Name)
+}
+
+func joinSettingPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// Settings flattens the configuration into its leaves, in the order of the
+// Config struct with map keys sorted. Lists of scalars are one setting.
+func (c *Config) Settings() []Setting {
+	var settings []Setting
+	walkSettings(reflect.ValueOf(c).Elem(), "", "", func(s Setting) {
+		settings = append(settings, s)
+	})
+	return settings
+}
+
+// Setting returns the setting at path
+func (c *Config) Setting(path string) (Setting, bool) {
+	for _, s := range c.Settings() {
+		if s.Path == path {
+			return s, true
+		}
+	}
+	return Setting{}, false
+}
+
+func walkSettings(v reflect.Value, path, field string, visit func(Setting)) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			walkSettings(v.Elem(), path, field, visit)
+		} else if v.Kind() == reflect.Interface || v.Type().Elem().Kind() != reflect.Struct {
+			visit(Setting{Path: path, Field: field, Secret: isSecretSetting(path)})
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" || settingName(f) == "-" {
+				continue
+			}
+			walkSettings(v.Field(i), joinSettingPath(path, settingName(f)), joinSettingPath(field, f.Name), visit)
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		for _, key := range keys {
+			name := fmt.Sprint(key)
+			walkSettings(v.MapIndex(key), joinSettingPath(path, name), joinSettingPath(field, name), visit)
+		}
+	case reflect.Slice:
+		elem := v.Type().Elem()
+		if elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		if elem.Kind() != reflect.Struct && elem.Kind() != reflect.Map {
+			visit(Setting{Path: path, Field: field, Value: v.Interface(), Secret: isSecretSetting(path)})
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			name := fmt.Sprint(i)
+			if entry := reflect.Indirect(v.Index(i)); entry.Kind() == reflect.Struct {
+				if n := entry.FieldByName("Name"); n.IsValid() && n.Kind() == reflect.String && n.String() != "" {
+					name = n.String()
+				}
+			}
+			walkSettings(v.Index(i), joinSettingPath(path, name), joinSettingPath(field, name), visit)
+		}
+	default:
+		visit(Setting{Path: path, Field: field, Value: v.Interface(), Secret: isSecretSetting(path)})
+	}
+}
+
+// SettingChange is a setting that differs between two configurations. A or
+// B is nil for a setting that only one of them has.
+type SettingChange struct {
+	Path   string      `json:"path"`
+	A      interface{} `json:"a"`
+	B      interface{} `json:"b"`
+	Secret bool        `json:"secret,omitempty"`
+}
+
+// Redacted returns the change with secret values replaced by RedactedValue
+func (c SettingChange) Redacted() SettingChange {
+	c.A = Setting{Value: c.A, Secret: c.Secret}.Redacted().Value
+	c.B = Setting{Value: c.B, Secret: c.Secret}.Redacted().Value
+	return c
+}
+
+// DiffSettings returns the settings that differ between a and b, in the
+// order of a followed by those only b has
+func DiffSettings(a, b []Setting) []SettingChange {
+	inB := map[string]Setting{}
+	for _, s := range b {
+		inB[s.Path] = s
+	}
+	var changes []SettingChange
+	seen := map[string]bool{}
+	for _, s := range a {
+		seen[s.Path] = true
+		other, ok := inB[s.Path]
+		if !ok || !reflect.DeepEqual(s.Value, other.Value) {
+			changes = append(changes, SettingChange{Path: s.Path, A: s.Value, B: other.Value, Secret: s.Secret})
+		}
+	}
+	for _, s := range b {
+		if !seen[s.Path] {
+			changes = append(changes, SettingChange{Path: s.Path, B: s.Value, Secret: s.Secret})
+		}
+	}
+	return changes
+}
+
+// EnvBindings returns every environment variable that overrides a setting,
+// including the role passwords of each module database
+func (c *Config) EnvBindings() []EnvBinding {
+	bindings := append([]EnvBinding(nil), envBindings...)
+	for _, module := range c.Database.PostgreSQL.Databases.GetModules() {
+		prefix := "POSTGRES_" + strings.ToUpper(module) + "_"
+		field := "Database.PostgreSQL.Roles." + module
+		bindings = append(bindings,
+			EnvBinding{prefix + "OWNER_PASSWORD", field + ".Owner.Password"},
+			EnvBinding{prefix + "APP_PASSWORD", field + ".App.Password"},
+			EnvBinding{prefix + "READONLY_PASSWORD", field + ".ReadOnly.Password"})
+	}
+	return bindings
+}
+
+// Path returns the YAML path of the setting the binding overrides
+func (b EnvBinding) Path() string {
+	t := reflect.TypeOf(Config{})
+	var path string
+	for _, name := range strings.Split(b.Field, ".") {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() == reflect.Map {
+			path, t = joinSettingPath(path, name), t.Elem()
+			continue
+		}
+		f, ok := t.FieldByName(name)
+		if !ok {
+			return ""
+		}
+		path, t = joinSettingPath(path, settingName(f)), f.Type
+	}
+	return path
+}
+
+// SettingSource is a place a setting can get its value from
+type SettingSource struct {
+	Source string `json:"source"`
+	Value  string `json:"value,omitempty"`
+	Set    bool   `json:"set"`
+}
+
+// Explanation tells where a setting gets its value from. Sources are in
+// order of precedence; Origin is the first one that is set, default when
+// the loader derived the value itself, or unset.
+type Explanation struct {
+	Setting
+	EnvVar  string          `json:"env_var,omitempty"`
+	Sources []SettingSource `json:"sources"`
+	Origin  string          `json:"origin"`
+}
+
+// Explain loads the configuration and explains the setting at key, a YAML
+// path such as database.postgresql.host or the environment variable bound
+// to one. Secret values are redacted.
+func Explain(key string) (*Explanation, error) {
+	// The .env file is loaded into the environment by Load
+	processEnv := map[string]string{}
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		processEnv[name] = value
+	}
+
+	config, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	var binding *EnvBinding
+	path := key
+	for _, b := range config.EnvBindings() {
+		if b.Var == key || b.Path() == key {
+			b := b
+			binding, path = &b, b.Path()
+			break
+		}
+	}
+	setting, ok := config.Setting(path)
+	if !ok && binding == nil {
+		return nil, fmt.Errorf("unknown setting %s", key)
+	}
+	if !ok {
+		setting = Setting{Path: path, Field: binding.Field, Secret: isSecretSetting(path)}
+	}
+
+	e := &Explanation{Setting: setting.Redacted()}
+	redact := func(value string) string {
+		return Setting{Value: value, Secret: setting.Secret}.Redacted().Value.(string)
+	}
+	environment := getEnv("ERP_ENVIRONMENT", "development")
+	if binding != nil {
+		e.EnvVar = binding.Var
+		value, set := processEnv[binding.Var]
+		e.Sources = append(e.Sources, SettingSource{"environment variable " + binding.Var, redact(value), set && value != ""})
+
+		envFile := envFilePath(environment)
+		if vars, err := godotenv.Read(envFile); err == nil {
+			value := vars[binding.Var]
+			e.Sources = append(e.Sources, SettingSource{envFile, redact(value), value != ""})
+		}
+	}
+
+	// References such as ${POSTGRES_PASSWORD} are shown, literals redacted
+	fileSource := func(file, path string) error {
+		raw, err := rawSetting(file, path)
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(raw, "${") {
+			raw = redact(raw)
+		}
+		e.Sources = append(e.Sources, SettingSource{file, raw, raw != ""})
+		return nil
+	}
+	if envPath := environmentSettingPath(path, setting.Field); envPath != "" {
+		if err := fileSource(environmentFilePath(environment), envPath); err != nil {
+			return nil, err
+		}
+	}
+	if err := fileSource(configFilePath, path); err != nil {
+		return nil, err
+	}
+
+	e.Origin = "unset"
+	if setting.Value != nil && !reflect.ValueOf(setting.Value).IsZero() {
+		e.Origin = "default"
+	}
+	for _, source := range e.Sources {
+		if source.Set {
+			e.Origin = source.Source
+			break
+		}
+	}
+	return e, nil
+}
+
+// environmentSettingPath returns the path in environments/<env>.yaml of the
+// setting at path, or "" when no section of that file covers it
+func environmentSettingPath(path, field string) string {
+	for _, section := range environmentSections {
+		if field == section.Field || strings.HasPrefix(field, section.Field+".") {
+			return section.File + strings.TrimPrefix(path, EnvBinding{Field: section.Field}.Path())
+		}
+	}
+	return ""
+}
+
+// rawSetting returns the unexpanded text of the scalar at path in a YAML
+// file, or "" when the file does not set it
+func rawSetting(file, path string) (string, error) {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading config file: %w", err)
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return "", fmt.Errorf("error parsing config file: %w", err)
+	}
+
+	node := &root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	for _, name := range strings.Split(path, ".") {
+		node = childNode(node, name)
+		if node == nil {
+			return "", nil
+		}
+	}
+	if node.Kind == yaml.SequenceNode {
+		values := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			values = append(values, item.Value)
+		}
+		return "[" + strings.Join(values, ", ") + "]", nil
+	}
+	return node.Value, nil
+}
+
+// childNode returns the value of key in a mapping, or the entry of a
+// sequence with that index or name
+func childNode(node *yaml.Node, name string) *yaml.Node {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == name {
+				return node.Content[i+1]
+			}
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			if fmt.Sprint(i) == name {
+				return item
+			}
+			if named := childNode(item, "name"); named != nil && named.Value == name {
+				return item
+			}
+		}
+	}
+	return nil
+}
+
+// LoadEnvironment loads the configuration of an environment and restores
+// the process environment afterwards, so that the .env file of one
+// environment does not leak into the next one loaded. It changes the process
+// environment while it runs and must not be called concurrently.
+func LoadEnvironment(environment string) (*Config, error) {
+	saved := os.Environ()
+	defer func() {
+		os.Clearenv()
+		for _, kv := range saved {
+			name, value, _ := strings.Cut(kv, "=")
+			os.Setenv(name, value)
+		}
+	}()
+	os.Setenv("ERP_ENVIRONMENT", environment)
+	return Load()
+}
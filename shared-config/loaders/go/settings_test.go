@@ -0,0 +1,62 @@
+package sharedconfig
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiffSettingsBetweenEnvironments(t *testing.T) {
+	changes := map[string]SettingChange{}
+	for _, c := range DiffSettings(loadEnvironment(t, "staging").Settings(), loadEnvironment(t, "testing").Settings()) {
+		changes[c.Path] = c
+	}
+
+	want := map[string][2]interface{}{
+		"database.postgresql.host":     {"postgres-staging.internal", "localhost"},
+		"database.postgresql.port":     {5432, 5433},
+		"cache.redis.host":             {"redis-staging.internal", "localhost"},
+		"message_broker.kafka.brokers": {StringList{"kafka-staging.internal:9092"}, StringList{"localhost:9093"}},
+	}
+	for path, values := range want {
+		c, ok := changes[path]
+		if !ok {
+			t.Errorf("%s is not in the diff", path)
+			continue
+		}
+		if !reflect.DeepEqual([2]interface{}{c.A, c.B}, values) {
+			t.Errorf("%s = %v -> %v, want %v -> %v", path, c.A, c.B, values[0], values[1])
+		}
+	}
+	if _, ok := changes["database.postgresql.databases.hrm"]; !ok {
+		t.Error("database names are not in the diff")
+	}
+}
+
+func TestExplainReportsEnvironmentFile(t *testing.T) {
+	root, err := filepath.Abs(repoRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(root)
+	t.Setenv("ERP_ENVIRONMENT", "staging")
+
+	e, err := Explain("POSTGRES_HOST")
+	if err != nil {
+		t.Fatalf("Explain: %v", err)
+	}
+	if e.Path != "database.postgresql.host" || e.Value != "postgres-staging.internal" {
+		t.Errorf("explained %s = %v", e.Path, e.Value)
+	}
+	if want := "shared-config/environments/staging.yaml"; e.Origin != want {
+		t.Errorf("origin = %q, want %q", e.Origin, want)
+	}
+	want := []SettingSource{
+		{"environment variable POSTGRES_HOST", "", false},
+		{"shared-config/environments/staging.yaml", "${POSTGRES_HOST:postgres-staging.internal}", true},
+		{"shared-config/config.yaml", "", false},
+	}
+	if !reflect.DeepEqual(e.Sources, want) {
+		t.Errorf("sources = %+v, want %+v", e.Sources, want)
+	}
+}
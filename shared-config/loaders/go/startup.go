@@ -0,0 +1,355 @@
+package sharedconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StartupConfig controls how WaitForDependencies waits for a module's
+// dependencies and how startup order maps onto docker compose services
+type StartupConfig struct {
+	PollInterval    int               `yaml:"poll_interval"`
+	Timeouts        map[string]int    `yaml:"timeouts"`
+	Addresses       map[string]string `yaml:"addresses"`
+	ComposeServices map[string]string `yaml:"compose_services"`
+}
+
+// GetPollInterval returns the delay between two checks of a dependency
+func (s *StartupConfig) GetPollInterval() time.Duration {
+	if s.PollInterval <= 0 {
+		return 2 * time.Second // Default
+	}
+	return time.Duration(s.PollInterval) * time.Second
+}
+
+// GetTimeout returns how long to wait for a dependency to become healthy
+func (s *StartupConfig) GetTimeout(name string) time.Duration {
+	if seconds, ok := s.Timeouts[name]; ok && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	switch name {
+	case "kafka", "elasticsearch":
+		return 300 * time.Second // Default
+	case "mongodb":
+		return 240 * time.Second // Default
+	default:
+		return 180 * time.Second // Default
+	}
+}
+
+// GetComposeService returns the docker compose service that runs name
+func (s *StartupConfig) GetComposeService(name string) string {
+	if service, ok := s.ComposeServices[name]; ok {
+		return service
+	}
+	return name
+}
+
+// GetHost returns the host other services reach the module on
+func (m *ModuleConfig) GetHost() string {
+	if m.Host == "" {
+		return m.Name // Default
+	}
+	return m.Host
+}
+
+// GetHealthEndpoint returns the path that reports the module ready
+func (m *ModuleConfig) GetHealthEndpoint() string {
+	if m.HealthEndpoint == "" {
+		return "/readyz" // Default
+	}
+	return m.HealthEndpoint
+}
+
+// GetModule returns the module with the given name
+func (c *Config) GetModule(name string) (*ModuleConfig, bool) {
+	for i := range c.Modules {
+		if c.Modules[i].Name == name {
+			return &c.Modules[i], true
+		}
+	}
+	return nil, false
+}
+
+// DependencyCycleError reports modules that depend on each other
+type DependencyCycleError struct {
+	Cycle []string
+}
+
+func (e *DependencyCycleError) Error() string {
+	return "dependency cycle: " + strings.Join(e.Cycle, " -> ")
+}
+
+// DependencyGraph maps every module and infrastructure service to the
+// services it depends on. Dependencies that are not modules (postgresql,
+// redis, kafka, ...) are leaves.
+type DependencyGraph struct {
+	deps map[string][]string
+}
+
+// NewDependencyGraph builds the graph declared by modules[].dependencies
+func NewDependencyGraph(modules []ModuleConfig) *DependencyGraph {
+	g := &DependencyGraph{deps: map[string][]string{}}
+	for _, m := range modules {
+		deps := append([]string(nil), m.Dependencies...)
+		sort.Strings(deps)
+		g.deps[m.Name] = deps
+		for _, dep := range deps {
+			if _, ok := g.deps[dep]; !ok {
+				g.deps[dep] = nil
+			}
+		}
+	}
+	return g
+}
+
+// Nodes returns every service in the graph, sorted
+func (g *DependencyGraph) Nodes() []string {
+	nodes := make([]string, 0, len(g.deps))
+	for name := range g.deps {
+		nodes = append(nodes, name)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// Dependencies returns the direct dependencies of name
+func (g *DependencyGraph) Dependencies(name string) []string {
+	return g.deps[name]
+}
+
+// Has reports whether name is in the graph
+func (g *DependencyGraph) Has(name string) bool {
+	_, ok := g.deps[name]
+	return ok
+}
+
+// Closure returns names and everything they transitively depend on
+func (g *DependencyGraph) Closure(names ...string) []string {
+	seen := map[string]bool{}
+	var visit func(string)
+	visit = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		for _, dep := range g.deps[name] {
+			visit(dep)
+		}
+	}
+	for _, name := range names {
+		visit(name)
+	}
+
+	closure := make([]string, 0, len(seen))
+	for name := range seen {
+		closure = append(closure, name)
+	}
+	sort.Strings(closure)
+	return closure
+}
+
+// FindCycle returns the first dependency cycle, or nil if the graph is acyclic
+func (g *DependencyGraph) FindCycle() []string {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := map[string]int{}
+	var path []string
+	var visit func(string) []string
+	visit = func(name string) []string {
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range g.deps[name] {
+			switch state[dep] {
+			case visiting:
+				for i, n := range path {
+					if n == dep {
+						return append(append([]string(nil), path[i:]...), dep)
+					}
+				}
+			case unvisited:
+				if cycle := visit(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = done
+		return nil
+	}
+	for _, name := range g.Nodes() {
+		if state[name] == unvisited {
+			if cycle := visit(name); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// StartupOrder groups names and their transitive dependencies into waves:
+// every service only depends on services of earlier waves, so each wave can
+// be started in parallel once the previous one is healthy. With no names the
+// whole graph is ordered.
+func (g *DependencyGraph) StartupOrder(names ...string) ([][]string, error) {
+	if cycle := g.FindCycle(); cycle != nil {
+		return nil, &DependencyCycleError{Cycle: cycle}
+	}
+	for _, name := range names {
+		if !g.Has(name) {
+			return nil, fmt.Errorf("unknown module or dependency %q", name)
+		}
+	}
+
+	nodes := g.Nodes()
+	if len(names) > 0 {
+		nodes = g.Closure(names...)
+	}
+
+	level := map[string]int{}
+	var depth func(string) int
+	depth = func(name string) int {
+		if l, ok := level[name]; ok {
+			return l
+		}
+		l := 0
+		for _, dep := range g.deps[name] {
+			if d := depth(dep) + 1; d > l {
+				l = d
+			}
+		}
+		level[name] = l
+		return l
+	}
+
+	var waves [][]string
+	for _, name := range nodes {
+		l := depth(name)
+		for len(waves) <= l {
+			waves = append(waves, nil)
+		}
+		waves[l] = append(waves[l], name)
+	}
+	return waves, nil
+}
+
+// DependencyGraph returns the graph of the configured modules
+func (c *Config) DependencyGraph() *DependencyGraph {
+	return NewDependencyGraph(c.Modules)
+}
+
+// StartupChecker returns the checker WaitForDependencies uses for dep when
+// module starts. startup.addresses overrides everything with a TCP check;
+// modules are checked on their HTTP health endpoint and infrastructure
+// through the health check factory of the same type.
+func (c *Config) StartupChecker(module, dep string) (HealthChecker, error) {
+	if address, ok := c.Startup.Addresses[dep]; ok {
+		return TCPHealthChecker(address), nil
+	}
+	if m, ok := c.GetModule(dep); ok {
+		if m.Ports.HTTP == 0 {
+			return nil, fmt.Errorf("module %s has no http port to check", dep)
+		}
+		url := fmt.Sprintf("http://%s%s", net.JoinHostPort(m.GetHost(), strconv.Itoa(m.Ports.HTTP)), m.GetHealthEndpoint())
+		return HTTPHealthChecker(http.DefaultClient, url), nil
+	}
+
+	check := HealthCheckDependency{Name: dep, Type: dep}
+	switch dep {
+	case "postgresql":
+		pg := &c.Database.PostgreSQL
+		if pg.getDatabaseName(module) == "" {
+			return TCPHealthChecker(net.JoinHostPort(pg.Host, strconv.Itoa(pg.Port))), nil
+		}
+		check.Target = module
+	case "kafka":
+		check.Target = module
+	}
+	factory, ok := lookupHealthCheckerFactory(dep)
+	if !ok {
+		return nil, fmt.Errorf("no way to check %s; set startup.addresses.%s", dep, dep)
+	}
+	return factory(c, check)
+}
+
+// WaitForDependencies waits until every name is healthy, each within its
+// own startup timeout, and reports progress to w. It returns the joined
+// errors of the dependencies that did not become healthy.
+func (c *Config) WaitForDependencies(ctx context.Context, module string, names []string, w io.Writer) error {
+	var (
+		mu       sync.Mutex
+		errs     []error
+		wg       sync.WaitGroup
+		checkers = map[string]HealthChecker{}
+	)
+	// Every checker is resolved before the first wait starts, so only the
+	// goroutines append to errs below
+	for _, name := range names {
+		checker, err := c.StartupChecker(module, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		checkers[name] = checker
+	}
+	for _, name := range names {
+		checker, ok := checkers[name]
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(name string, checker HealthChecker) {
+			defer wg.Done()
+			defer closeChecker(checker)
+			start := time.Now()
+			err := WaitFor(ctx, checker, c.Startup.GetTimeout(name), c.Startup.GetPollInterval(), c.HealthCheck.GetTimeout())
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				fmt.Fprintf(w, "%-14s not ready after %s\n", name, time.Since(start).Round(time.Second))
+				return
+			}
+			fmt.Fprintf(w, "%-14s ready after %s\n", name, time.Since(start).Round(time.Second))
+		}(name, checker)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// WaitFor polls checker every interval, bounding each check by checkTimeout,
+// until it succeeds or timeout passes
+func WaitFor(ctx context.Context, checker HealthChecker, timeout, interval, checkTimeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		checkCtx, cancelCheck := context.WithTimeout(ctx, checkTimeout)
+		err := checker.Check(checkCtx)
+		cancelCheck()
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("not healthy within %s: %w", timeout, err)
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package sharedconfig
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testModules(deps map[string][]string) []ModuleConfig {
+	var modules []ModuleConfig
+	for name, d := range deps {
+		modules = append(modules, ModuleConfig{Name: name, Dependencies: d})
+	}
+	return modules
+}
+
+func TestFindCycle(t *testing.T) {
+	tests := []struct {
+		name string
+		deps map[string][]string
+		want []string
+	}{
+		{"acyclic", map[string][]string{"crm": {"auth", "postgresql"}, "auth": {"postgresql"}}, nil},
+		{"self", map[string][]string{"a": {"a"}}, []string{"a", "a"}},
+		{"pair", map[string][]string{"a": {"b"}, "b": {"a"}}, []string{"a", "b", "a"}},
+		{"behind a tail", map[string][]string{"x": {"a"}, "a": {"b"}, "b": {"c"}, "c": {"a"}}, []string{"a", "b", "c", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewDependencyGraph(testModules(tt.deps)).FindCycle(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindCycle() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStartupOrder(t *testing.T) {
+	g := NewDependencyGraph(testModules(map[string][]string{
+		"auth":    {"postgresql", "redis"},
+		"crm":     {"auth", "postgresql"},
+		"reports": {"crm", "auth"},
+	}))
+	tests := []struct {
+		names []string
+		want  [][]string
+	}{
+		{nil, [][]string{{"postgresql", "redis"}, {"auth"}, {"crm"}, {"reports"}}},
+		{[]string{"crm"}, [][]string{{"postgresql", "redis"}, {"auth"}, {"crm"}}},
+		{[]string{"auth"}, [][]string{{"postgresql", "redis"}, {"auth"}}},
+		{[]string{"redis"}, [][]string{{"redis"}}},
+	}
+	for _, tt := range tests {
+		got, err := g.StartupOrder(tt.names...)
+		if err != nil {
+			t.Errorf("StartupOrder(%v): %v", tt.names, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("StartupOrder(%v) = %v, want %v", tt.names, got, tt.want)
+		}
+	}
+
+	if _, err := g.StartupOrder("billing"); err == nil {
+		t.Error("StartupOrder accepted an unknown module")
+	}
+}
+
+func TestStartupOrderRejectsCycle(t *testing.T) {
+	g := NewDependencyGraph(testModules(map[string][]string{"a": {"b"}, "b": {"a"}}))
+	_, err := g.StartupOrder()
+	var cycle *DependencyCycleError
+	if !errors.As(err, &cycle) {
+		t.Fatalf("err = %v, want a DependencyCycleError", err)
+	}
+	if want := "dependency cycle: a -> b -> a"; err.Error() != want {
+		t.Errorf("err = %q, want %q", err, want)
+	}
+}
+
+func TestWaitFor(t *testing.T) {
+	errDown := errors.New("connection refused")
+	tests := []struct {
+		name     string
+		failures int
+		timeout  time.Duration
+		wantErr  bool
+	}{
+		{"healthy", 0, time.Second, false},
+		{"after failures", 3, time.Second, false},
+		{"never", 1 << 30, 20 * time.Millisecond, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			checker := HealthCheckerFunc(func(context.Context) error {
+				calls++
+				if calls <= tt.failures {
+					return errDown
+				}
+				return nil
+			})
+			err := WaitFor(context.Background(), checker, tt.timeout, time.Millisecond, time.Second)
+			if tt.wantErr {
+				if !errors.Is(err, errDown) {
+					t.Errorf("err = %v, want it to wrap the last check error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("WaitFor: %v", err)
+			}
+			if calls != tt.failures+1 {
+				t.Errorf("calls = %d, want %d", calls, tt.failures+1)
+			}
+		})
+	}
+}
+
+func TestWaitForDependencies(t *testing.T) {
+	up, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer up.Close()
+	down, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down.Close()
+
+	cfg := &Config{Startup: StartupConfig{
+		PollInterval: 1,
+		Timeouts:     map[string]int{"up": 1, "down": 1},
+		Addresses:    map[string]string{"up": up.Addr().String(), "down": down.Addr().String()},
+	}}
+	var out bytes.Buffer
+	err = cfg.WaitForDependencies(context.Background(), "crm", []string{"up", "unknown", "down"}, &out)
+	if err == nil {
+		t.Fatal("WaitForDependencies succeeded with a dependency down")
+	}
+	for _, want := range []string{"down: not healthy within 1s", "no way to check unknown"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("err = %q, want it to mention %q", err, want)
+		}
+	}
+	if !strings.Contains(out.String(), "up") || !strings.Contains(out.String(), "ready after") {
+		t.Errorf("progress = %q, want up reported ready", out.String())
+	}
+}
+
+func TestWaitForDependenciesCancelled(t *testing.T) {
+	cfg := &Config{Startup: StartupConfig{Addresses: map[string]string{"a": "127.0.0.1:1", "b": "127.0.0.1:1"}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := cfg.WaitForDependencies(ctx, "crm", []string{"a", "unknown", "b"}, &bytes.Buffer{})
+	for _, want := range []string{"a: ", "b: ", "no way to check unknown"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("err = %v, want it to mention %q", err, want)
+		}
+	}
+}
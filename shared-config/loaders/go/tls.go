@@ -0,0 +1,235 @@
+package sharedconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSConfig is the TLS configuration shared by every backend. CA material can
+// be given as a file or inline PEM; client certificates enable mutual TLS.
+// Files are re-read when they change, so rotated certificates are picked up
+// without a restart.
+type TLSConfig struct {
+	Enabled            bool   `yaml:"enabled"`
+	CAFile             string `yaml:"ca_file"`
+	CAPEM              string `yaml:"ca_pem"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	ServerName         string `yaml:"server_name"`
+	MinVersion         string `yaml:"min_version"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// IsEnabled reports whether TLS should be used: explicitly enabled or any
+// CA or client certificate configured
+func (t *TLSConfig) IsEnabled() bool {
+	return t.Enabled || t.CAFile != "" || t.CAPEM != "" || t.CertFile != ""
+}
+
+// GetMinVersion returns the minimum TLS version
+func (t *TLSConfig) GetMinVersion() (uint16, error) {
+	switch t.MinVersion {
+	case "", "1.2":
+		return tls.VersionTLS12, nil // Default
+	case "1.3":
+		return tls.VersionTLS13, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	default:
+		return 0, fmt.Errorf("unsupported tls min_version %q", t.MinVersion)
+	}
+}
+
+// Validate rejects settings that must not be used in the given environment
+func (t *TLSConfig) Validate(environment string) error {
+	if t.InsecureSkipVerify && environment == "production" {
+		return errors.New("tls insecure_skip_verify is not allowed in production")
+	}
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return errors.New("tls cert_file and key_file must be set together")
+	}
+	if _, err := t.GetMinVersion(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ToStdTLS returns a *tls.Config for the settings. The CA bundle and client
+// certificate are loaded once up front, so configuration errors surface here,
+// and reloaded on later handshakes whenever the files change on disk.
+func (t *TLSConfig) ToStdTLS() (*tls.Config, error) {
+	minVersion, err := t.GetMinVersion()
+	if err != nil {
+		return nil, err
+	}
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return nil, errors.New("tls cert_file and key_file must be set together")
+	}
+
+	config := &tls.Config{
+		MinVersion:         minVersion,
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+	reloader := &tlsReloader{config: t}
+
+	if t.CertFile != "" {
+		if _, err := reloader.clientCertificate(); err != nil {
+			return nil, err
+		}
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return reloader.clientCertificate()
+		}
+	}
+
+	if (t.CAFile != "" || t.CAPEM != "") && !t.InsecureSkipVerify {
+		if _, err := reloader.rootCAs(); err != nil {
+			return nil, err
+		}
+		// Verification is done in VerifyConnection so that it always uses
+		// the most recently loaded CA bundle
+		config.InsecureSkipVerify = true
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			roots, err := reloader.rootCAs()
+			if err != nil {
+				return err
+			}
+			// cs.ServerName is empty when the host is an IP address, which
+			// would skip the hostname check; server_name must be set then
+			serverName := t.ServerName
+			if serverName == "" {
+				serverName = cs.ServerName
+			}
+			if serverName == "" {
+				return errors.New("tls: no server name to verify the certificate against; set tls server_name")
+			}
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("tls: server presented no certificate")
+			}
+			opts := x509.VerifyOptions{
+				Roots:         roots,
+				DNSName:       serverName,
+				Intermediates: x509.NewCertPool(),
+			}
+			for _, cert := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err = cs.PeerCertificates[0].Verify(opts)
+			return err
+		}
+	}
+
+	return config, nil
+}
+
+// tlsReloader caches the CA pool and client certificate and reloads them when
+// the underlying files' modification times change
+type tlsReloader struct {
+	config *TLSConfig
+
+	mu        sync.Mutex
+	roots     *x509.CertPool
+	caModTime time.Time
+	cert      *tls.Certificate
+	certMod   time.Time
+	keyMod    time.Time
+}
+
+func modTime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+func (r *tlsReloader) rootCAs() (*x509.CertPool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var caMod time.Time
+	if r.config.CAFile != "" {
+		mod, err := modTime(r.config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading tls ca_file: %w", err)
+		}
+		caMod = mod
+	}
+	if r.roots != nil && caMod.Equal(r.caModTime) {
+		return r.roots, nil
+	}
+
+	pool := x509.NewCertPool()
+	if r.config.CAPEM != "" && !pool.AppendCertsFromPEM([]byte(r.config.CAPEM)) {
+		return nil, errors.New("no certificates found in tls ca_pem")
+	}
+	if r.config.CAFile != "" {
+		pem, err := os.ReadFile(r.config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading tls ca_file: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in tls ca_file %s", r.config.CAFile)
+		}
+	}
+
+	r.roots = pool
+	r.caModTime = caMod
+	return pool, nil
+}
+
+func (r *tlsReloader) clientCertificate() (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	certMod, err := modTime(r.config.CertFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading tls cert_file: %w", err)
+	}
+	keyMod, err := modTime(r.config.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading tls key_file: %w", err)
+	}
+	if r.cert != nil && certMod.Equal(r.certMod) && keyMod.Equal(r.keyMod) {
+		return r.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading tls client certificate: %w", err)
+	}
+	r.cert = &cert
+	r.certMod = certMod
+	r.keyMod = keyMod
+	return r.cert, nil
+}
+
+// ValidateTLS checks the TLS settings of every backend for the current
+// environment
+func (c *Config) ValidateTLS() error {
+	backends := map[string]*TLSConfig{
+		"postgresql":    &c.Database.PostgreSQL.TLS,
+		"mongodb":       &c.Database.MongoDB.TLS,
+		"redis":         &c.Cache.Redis.TLS,
+		"kafka":         &c.MessageBroker.Kafka.TLS,
+		"qdrant":        &c.VectorDatabase.Qdrant.TLS,
+		"elasticsearch": &c.Search.Elasticsearch.TLS,
+		"websocket":     &c.Realtime.WebSocket.TLS,
+	}
+	for name, t := range backends {
+		if err := t.Validate(c.Environment.Current); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if c.IsProduction() && !c.Search.Elasticsearch.GetVerifyCerts() {
+		return errors.New("elasticsearch: verify_certs: false is not allowed in production")
+	}
+	return nil
+}
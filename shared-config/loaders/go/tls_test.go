@@ -0,0 +1,169 @@
+package sharedconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writePEM writes the certificates to path and moves its modification time
+// forward, so that a reloader sees the change within the same second
+func writePEM(t *testing.T, path string, bump time.Duration, certs ...*testCert) {
+	t.Helper()
+	var data []byte
+	for _, c := range certs {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})...)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mod := time.Now().Add(bump)
+	if err := os.Chtimes(path, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeKey(t *testing.T, path string, bump time.Duration, c *testCert) {
+	t.Helper()
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mod := time.Now().Add(bump)
+	if err := os.Chtimes(path, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// presented is the connection state of a server presenting leaf and chain
+func presented(serverName string, leaf *testCert, chain ...*testCert) tls.ConnectionState {
+	cs := tls.ConnectionState{ServerName: serverName, PeerCertificates: []*x509.Certificate{leaf.cert}}
+	for _, c := range chain {
+		cs.PeerCertificates = append(cs.PeerCertificates, c.cert)
+	}
+	return cs
+}
+
+func TestToStdTLSVerifiesHostname(t *testing.T) {
+	ca := newTestCert(t, "erp ca", nil, nil)
+	leaf := newTestCert(t, "postgres", []string{"postgres.internal", "10.0.0.5"}, ca)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writePEM(t, caFile, 0, ca)
+
+	tests := []struct {
+		name       string
+		serverName string
+		sni        string
+		wantErr    string
+	}{
+		{"sni", "", "postgres.internal", ""},
+		{"server_name", "postgres.internal", "", ""},
+		{"server_name ip", "10.0.0.5", "", ""},
+		{"other host", "", "redis.internal", "certificate is valid for"},
+		{"no server name", "", "", "no server name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := &TLSConfig{CAFile: caFile, ServerName: tt.serverName}
+			config, err := settings.ToStdTLS()
+			if err != nil {
+				t.Fatalf("ToStdTLS: %v", err)
+			}
+			err = config.VerifyConnection(presented(tt.sni, leaf))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("VerifyConnection: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestToStdTLSReloadsCA(t *testing.T) {
+	oldCA := newTestCert(t, "old ca", nil, nil)
+	newCA := newTestCert(t, "new ca", nil, nil)
+	leaf := newTestCert(t, "kafka", []string{"kafka.internal"}, newCA)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writePEM(t, caFile, 0, oldCA)
+
+	config, err := (&TLSConfig{CAFile: caFile}).ToStdTLS()
+	if err != nil {
+		t.Fatalf("ToStdTLS: %v", err)
+	}
+	if err := config.VerifyConnection(presented("kafka.internal", leaf)); err == nil {
+		t.Fatal("a certificate of the rotated-in CA verified against the old bundle")
+	}
+
+	writePEM(t, caFile, time.Minute, oldCA, newCA)
+	if err := config.VerifyConnection(presented("kafka.internal", leaf)); err != nil {
+		t.Errorf("VerifyConnection after rotating the CA: %v", err)
+	}
+
+	if err := os.Remove(caFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.VerifyConnection(presented("kafka.internal", leaf)); err == nil {
+		t.Error("VerifyConnection succeeded with the ca_file gone")
+	}
+}
+
+func TestToStdTLSReloadsClientCertificate(t *testing.T) {
+	ca := newTestCert(t, "erp ca", nil, nil)
+	first := newTestCert(t, "crm-1", []string{"crm"}, ca)
+	second := newTestCert(t, "crm-2", []string{"crm"}, ca)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	writePEM(t, certFile, 0, first)
+	writeKey(t, keyFile, 0, first)
+
+	config, err := (&TLSConfig{CertFile: certFile, KeyFile: keyFile}).ToStdTLS()
+	if err != nil {
+		t.Fatalf("ToStdTLS: %v", err)
+	}
+	clientCN := func() string {
+		t.Helper()
+		cert, err := config.GetClientCertificate(nil)
+		if err != nil {
+			t.Fatalf("GetClientCertificate: %v", err)
+		}
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed.Subject.CommonName
+	}
+	if got := clientCN(); got != "crm-1" {
+		t.Errorf("client certificate = %s, want crm-1", got)
+	}
+
+	writePEM(t, certFile, time.Minute, second)
+	writeKey(t, keyFile, time.Minute, second)
+	if got := clientCN(); got != "crm-2" {
+		t.Errorf("client certificate after rotation = %s, want crm-2", got)
+	}
+}
+
+func TestToStdTLSRejectsBadSettings(t *testing.T) {
+	for name, settings := range map[string]TLSConfig{
+		"cert without key": {CertFile: "client.pem"},
+		"missing ca_file":  {CAFile: filepath.Join(t.TempDir(), "missing.pem")},
+		"empty ca_pem":     {CAPEM: "not a certificate"},
+		"min_version":      {MinVersion: "1.4"},
+	} {
+		if _, err := settings.ToStdTLS(); err == nil {
+			t.Errorf("%s: ToStdTLS succeeded", name)
+		}
+	}
+}